@@ -3,6 +3,13 @@ package api
 import (
 	v1 "github.com/MuhammadyusufAdhamov/booking/api/v1"
 	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/MuhammadyusufAdhamov/booking/jobs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/background"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/blob"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/health"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/metrics"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/payments"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/ratelimit"
 	"github.com/MuhammadyusufAdhamov/booking/storage"
 	"github.com/gin-gonic/gin"
 
@@ -16,6 +23,15 @@ type RouterOptions struct {
 	Cfg      *config.Config
 	Storage  storage.StorageI
 	InMemory storage.InMemoryStorageI
+	Limiter  *ratelimit.Limiter
+	Tasks    *background.Group
+	Health   *health.Checker
+	Deriver  *jobs.Deriver
+	Blobs    blob.Store
+	Sweeper  *jobs.MediaSweeper
+	// Documents is the private blob store, kept apart from Blobs
+	Documents blob.Store
+	Payments  payments.Provider
 }
 
 // @title           Swagger for blog api
@@ -26,53 +42,152 @@ type RouterOptions struct {
 // @in header
 // @name Authorization
 // @Security ApiKeyAuth
-func New(opt *RouterOptions) *gin.Engine {
-	router := gin.Default()
+func New(opt *RouterOptions) (*gin.Engine, error) {
+	router := gin.New()
+
+	// without trusted proxies ClientIP ignores X-Forwarded-For, which clients
+	// could otherwise set to dodge rate limits and forge audit IPs
+	err := router.SetTrustedProxies(opt.Cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
 
 	handlerV1 := v1.New(&v1.HandlerV1Options{
-		Cfg:      opt.Cfg,
-		Storage:  opt.Storage,
-		InMemory: opt.InMemory,
+		Cfg:       opt.Cfg,
+		Storage:   opt.Storage,
+		InMemory:  opt.InMemory,
+		Limiter:   opt.Limiter,
+		Tasks:     opt.Tasks,
+		Health:    opt.Health,
+		Deriver:   opt.Deriver,
+		Blobs:     opt.Blobs,
+		Sweeper:   opt.Sweeper,
+		Documents: opt.Documents,
+		Payments:  opt.Payments,
 	})
-
-	router.Static("/media", "./media")
+	limits := opt.Cfg.RateLimit
+
+	router.HandleMethodNotAllowed = true
+	router.Use(handlerV1.Tracing, handlerV1.RequestIDMiddleware, handlerV1.RequestLogger)
+	// metrics wrap Recovery so requests that panic are measured as 500s
+	if opt.Cfg.Metrics.Enabled {
+		router.Use(handlerV1.HTTPMetrics)
+	}
+	router.Use(handlerV1.Recovery)
+	if opt.Cfg.Metrics.Enabled && opt.Cfg.Metrics.Addr == "" {
+		router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	}
+	router.NoRoute(handlerV1.NoRoute)
+	router.NoMethod(handlerV1.NoMethod)
+
+	router.GET("/healthz", handlerV1.Healthz)
+	router.GET("/readyz", handlerV1.Readyz)
+
+	router.GET("/media/*key", handlerV1.ServeMedia)
+	router.GET("/documents/:id", handlerV1.ServeDocument)
 
 	apiV1 := router.Group("/v1")
+	apiV1.Use(handlerV1.ActorMiddleware)
 
 	apiV1.GET("/users/:id", handlerV1.GetUser)
 	apiV1.POST("/users", handlerV1.CreateUser)
 	apiV1.GET("/users", handlerV1.GetAllUsers)
 	apiV1.PUT("/users/:id", handlerV1.UpdateUser)
-	apiV1.DELETE("/users/:id", handlerV1.DeleteUser)
+	apiV1.PATCH("/users/:id", handlerV1.AuthMiddleware, handlerV1.PatchUser)
+	apiV1.DELETE("/users/:id", handlerV1.AuthMiddleware, handlerV1.DeleteUser)
+	apiV1.POST("/users/:id/restore", handlerV1.AuthMiddleware, handlerV1.RestoreUser)
 
 	apiV1.GET("/hotels/:id", handlerV1.GetHotel)
+	apiV1.GET("/hotels/:id/documents", handlerV1.AuthMiddleware, handlerV1.GetHotelDocuments)
 	apiV1.POST("/hotels", handlerV1.CreateHotel)
 	apiV1.GET("/hotels", handlerV1.GetAllHotels)
 	apiV1.PUT("/hotels/:id", handlerV1.UpdateHotel)
+	apiV1.PATCH("/hotels/:id", handlerV1.AuthMiddleware, handlerV1.PatchHotel)
 	apiV1.DELETE("/hotels/:id", handlerV1.DeleteHotel)
+	apiV1.POST("/hotels/:id/restore", handlerV1.AuthMiddleware, handlerV1.RestoreHotel)
+	apiV1.GET("/hotels/:id/legal", handlerV1.AuthMiddleware, handlerV1.GetLegalDetails)
+	apiV1.PUT("/hotels/:id/legal", handlerV1.AuthMiddleware, handlerV1.SetLegalDetails)
+	apiV1.GET("/hotels/:id/tax-rules", handlerV1.GetHotelTaxRules)
+	apiV1.POST("/hotels/:id/tax-rules", handlerV1.AuthMiddleware, handlerV1.CreateTaxRule)
+	apiV1.PUT("/hotels/:id/tax-rules/:rule_id", handlerV1.AuthMiddleware, handlerV1.UpdateTaxRule)
+	apiV1.DELETE("/hotels/:id/tax-rules/:rule_id", handlerV1.AuthMiddleware, handlerV1.DeleteTaxRule)
+	apiV1.POST("/hotels/:id/gallery", handlerV1.AuthMiddleware, handlerV1.AddHotelImage)
+	apiV1.PUT("/hotels/:id/gallery", handlerV1.AuthMiddleware, handlerV1.ReorderHotelGallery)
+	apiV1.PUT("/hotels/:id/gallery/:media_id", handlerV1.AuthMiddleware, handlerV1.UpdateHotelImage)
+	apiV1.DELETE("/hotels/:id/gallery/:media_id", handlerV1.AuthMiddleware, handlerV1.RemoveHotelImage)
 
 	apiV1.GET("/rooms/:id", handlerV1.GetRoom)
 	apiV1.POST("/rooms", handlerV1.CreateRoom)
 	apiV1.GET("/rooms", handlerV1.GetAllRooms)
 	apiV1.PUT("/rooms/:id", handlerV1.UpdateRoom)
+	apiV1.PATCH("/rooms/:id", handlerV1.AuthMiddleware, handlerV1.PatchRoom)
 	apiV1.DELETE("/rooms/:id", handlerV1.DeleteRoom)
+	apiV1.POST("/rooms/:id/restore", handlerV1.AuthMiddleware, handlerV1.RestoreRoom)
+	apiV1.POST("/rooms/:id/gallery", handlerV1.AuthMiddleware, handlerV1.AddRoomImage)
+	apiV1.PUT("/rooms/:id/gallery", handlerV1.AuthMiddleware, handlerV1.ReorderRoomGallery)
+	apiV1.PUT("/rooms/:id/gallery/:media_id", handlerV1.AuthMiddleware, handlerV1.UpdateRoomImage)
+	apiV1.DELETE("/rooms/:id/gallery/:media_id", handlerV1.AuthMiddleware, handlerV1.RemoveRoomImage)
 
 	apiV1.GET("/bookings/:id", handlerV1.GetBooking)
+	apiV1.GET("/bookings/:id/documents", handlerV1.AuthMiddleware, handlerV1.GetBookingDocuments)
 	apiV1.POST("/bookings", handlerV1.CreateBooking)
 	apiV1.GET("/bookings", handlerV1.GetAllBookings)
 	apiV1.PUT("/bookings/:id", handlerV1.UpdateBooking)
+	apiV1.PATCH("/bookings/:id", handlerV1.AuthMiddleware, handlerV1.PatchBooking)
 	apiV1.DELETE("/bookings/:id", handlerV1.DeleteBooking)
-
-	apiV1.POST("/auth/register", handlerV1.Register)
-	apiV1.POST("/auth/verify", handlerV1.Verify)
-	apiV1.POST("/auth/login", handlerV1.Login)
-	apiV1.POST("/auth/forgot-password", handlerV1.ForgotPassword)
-	apiV1.POST("/auth/verify-forgot-password", handlerV1.VerifyForgotPassword)
+	apiV1.POST("/bookings/:id/restore", handlerV1.AuthMiddleware, handlerV1.RestoreBooking)
+	apiV1.POST("/bookings/:id/cancel", handlerV1.AuthMiddleware, handlerV1.CancelBooking)
+	apiV1.GET("/bookings/:id/payments", handlerV1.AuthMiddleware, handlerV1.GetBookingPayments)
+	apiV1.POST("/bookings/:id/payments", handlerV1.AuthMiddleware, handlerV1.CreatePayment)
+	apiV1.POST("/payments/webhook", handlerV1.PaymentWebhook)
+	apiV1.GET("/bookings/:id/invoices", handlerV1.AuthMiddleware, handlerV1.GetBookingInvoices)
+	apiV1.POST("/bookings/:id/invoices", handlerV1.AuthMiddleware, handlerV1.CreateInvoice)
+	apiV1.GET("/invoices/:id", handlerV1.AuthMiddleware, handlerV1.GetInvoice)
+	apiV1.GET("/invoices/:id/pdf", handlerV1.AuthMiddleware, handlerV1.DownloadInvoice)
+	apiV1.POST("/invoices/:id/email", handlerV1.AuthMiddleware, handlerV1.RateLimit("invoice-email", limits.InvoiceEmail), handlerV1.EmailInvoice)
+
+	apiV1.POST("/campaigns", handlerV1.AuthMiddleware, handlerV1.CreateCampaign)
+	apiV1.GET("/campaigns", handlerV1.AuthMiddleware, handlerV1.GetAllCampaigns)
+	apiV1.GET("/campaigns/:id", handlerV1.AuthMiddleware, handlerV1.GetCampaign)
+	apiV1.PUT("/campaigns/:id", handlerV1.AuthMiddleware, handlerV1.UpdateCampaign)
+	apiV1.DELETE("/campaigns/:id", handlerV1.AuthMiddleware, handlerV1.DeleteCampaign)
+	apiV1.GET("/campaigns/:id/report", handlerV1.AuthMiddleware, handlerV1.GetCampaignReport)
+
+	apiV1.GET("/users/:id/commission-rate", handlerV1.AuthMiddleware, handlerV1.GetCommissionRate)
+	apiV1.PUT("/users/:id/commission-rate", handlerV1.AuthMiddleware, handlerV1.SetCommissionRate)
+	apiV1.DELETE("/users/:id/commission-rate", handlerV1.AuthMiddleware, handlerV1.DeleteCommissionRate)
+	apiV1.GET("/commissions", handlerV1.AuthMiddleware, handlerV1.GetAllCommissionEntries)
+	apiV1.POST("/commissions/adjustments", handlerV1.AuthMiddleware, handlerV1.CreateCommissionAdjustment)
+
+	apiV1.POST("/payouts", handlerV1.AuthMiddleware, handlerV1.CreatePayouts)
+	apiV1.GET("/payouts", handlerV1.AuthMiddleware, handlerV1.GetAllPayouts)
+	apiV1.GET("/payouts/:id", handlerV1.AuthMiddleware, handlerV1.GetPayout)
+	apiV1.GET("/payouts/:id/csv", handlerV1.AuthMiddleware, handlerV1.DownloadPayoutCSV)
+	apiV1.POST("/payouts/:id/settle", handlerV1.AuthMiddleware, handlerV1.SettlePayout)
+
+	apiV1.GET("/exchange-rates", handlerV1.GetAllExchangeRates)
+	apiV1.PUT("/exchange-rates/:currency", handlerV1.AuthMiddleware, handlerV1.SetExchangeRate)
+	apiV1.DELETE("/exchange-rates/:currency", handlerV1.AuthMiddleware, handlerV1.DeleteExchangeRate)
+
+	apiV1.POST("/auth/register", handlerV1.RateLimit("register", limits.Register), handlerV1.Register)
+	apiV1.POST("/auth/verify", handlerV1.RateLimit("verify", limits.Verify), handlerV1.Verify)
+	apiV1.POST("/auth/login", handlerV1.RateLimit("login", limits.Login), handlerV1.Login)
+	apiV1.POST("/auth/forgot-password", handlerV1.RateLimit("forgot-password", limits.ForgotPassword), handlerV1.ForgotPassword)
+	apiV1.POST("/auth/verify-forgot-password", handlerV1.RateLimit("verify-forgot-password", limits.Verify), handlerV1.VerifyForgotPassword)
 	apiV1.POST("/auth/update-password", handlerV1.AuthMiddleware, handlerV1.UpdatePassword)
 
-	apiV1.POST("/file-upload", handlerV1.UploadFile)
+	apiV1.POST("/file-upload", handlerV1.AuthMiddleware, handlerV1.RateLimit("file-upload", limits.FileUpload), handlerV1.UploadFile)
+
+	apiV1.POST("/documents", handlerV1.AuthMiddleware, handlerV1.RateLimit("document-upload", limits.FileUpload), handlerV1.UploadDocument)
+	apiV1.GET("/documents/:id", handlerV1.AuthMiddleware, handlerV1.GetDocument)
+
+	apiV1.GET("/media/orphans", handlerV1.AuthMiddleware, handlerV1.GetOrphanedMedia)
+
+	apiV1.GET("/audit-logs", handlerV1.AuthMiddleware, handlerV1.GetAllAuditLogs)
+
+	router.GET("/debug/vars", handlerV1.AuthMiddleware, handlerV1.DebugVars)
 
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
-	return router
+	return router, nil
 }
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditLog struct {
+	ID        int64           `json:"id"`
+	Entity    string          `json:"entity"`
+	EntityID  int64           `json:"entity_id"`
+	Action    string          `json:"action"`
+	ActorID   *int64          `json:"actor_id"`
+	ActorType string          `json:"actor_type"`
+	IP        string          `json:"ip"`
+	RequestID string          `json:"request_id"`
+	Before    json.RawMessage `json:"before" swaggertype:"object"`
+	After     json.RawMessage `json:"after" swaggertype:"object"`
+	Changes   json.RawMessage `json:"changes" swaggertype:"object"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type GetAllAuditLogsParams struct {
+	Limit    int32  `json:"limit" default:"10"`
+	Page     int32  `json:"page" default:"1"`
+	After    string `json:"after"`
+	Entity   string `json:"entity" enums:"user,hotel,room,booking"`
+	EntityID int64  `json:"entity_id"`
+	ActorID  int64  `json:"actor_id"`
+	From     string `json:"from" example:"2023-01-01T00:00:00Z"`
+	To       string `json:"to" example:"2023-02-01T00:00:00Z"`
+}
+
+type GetAllAuditLogsResponse struct {
+	AuditLogs  []*AuditLog `json:"audit_logs"`
+	Count      int32       `json:"count"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
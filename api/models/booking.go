@@ -2,27 +2,48 @@ package models
 
 import "time"
 
+// Booking prices are in minor units of Currency, e.g. cents. Price is the
+// nightly price of the room times the nights booked. ExchangeRate is the
+// number of base currency units one unit of Currency was worth when the
+// booking was made. Total is the price plus the exclusive charges, the
+// taxes and fees of the hotel. DisplayPrice and DisplayTotal are converted
+// to the ?currency= asked for.
 type Booking struct {
-	ID        int64     `json:"id"`
-	RoomId    int       `json:"room_id"`
-	UserId    int       `json:"user_id"`
-	HotelId   int       `json:"hotel_id"`
-	FromDate  string    `json:"from_date"`
-	ToDate    string    `json:"to_date"`
-	Price     float64   `json:"price"`
-	CreatedAt time.Time `json:"created_at"`
+	ID              int64      `json:"id"`
+	RoomId          int        `json:"room_id"`
+	UserId          int        `json:"user_id"`
+	HotelId         int        `json:"hotel_id"`
+	FromDate        string     `json:"from_date"`
+	ToDate          string     `json:"to_date"`
+	Price           int64      `json:"price" example:"12500"`
+	Currency        string     `json:"currency" example:"USD"`
+	ExchangeRate    string     `json:"exchange_rate" example:"1"`
+	Guests          int        `json:"guests" example:"2"`
+	Charges         []*Charge  `json:"charges"`
+	Total           int64      `json:"total" example:"14000"`
+	DisplayPrice    *int64     `json:"display_price,omitempty"`
+	DisplayTotal    *int64     `json:"display_total,omitempty"`
+	DisplayCurrency string     `json:"display_currency,omitempty"`
+	Status          string     `json:"status" example:"confirmed"`
+	Version         int64      `json:"version"`
+	CreatedAt       time.Time  `json:"created_at"`
+	DeletedAt       *time.Time `json:"deleted_at,omitempty"`
 }
 
 type CreateBookingRequest struct {
-	RoomId   int     `json:"room_id"`
-	UserId   int     `json:"user_id"`
-	HotelId  int     `json:"hotel_id"`
-	FromDate string  `json:"from_date"`
-	ToDate   string  `json:"to_date"`
-	Price    float64 `json:"price"`
+	RoomId   int    `json:"room_id" binding:"required,gt=0"`
+	UserId   int    `json:"user_id" binding:"required,gt=0"`
+	HotelId  int    `json:"hotel_id" binding:"required,gt=0"`
+	FromDate string `json:"from_date" binding:"required,isodate" example:"2022-10-01"`
+	ToDate   string `json:"to_date" binding:"required,isodate,date_after=from_date" example:"2022-10-05"`
+	Currency string `json:"currency" binding:"omitempty,currency" example:"USD"`
+	Guests   int    `json:"guests" binding:"omitempty,gte=1,lte=50" example:"2"`
+	// PromoCode is only taken when booking.
+	PromoCode string `json:"promo_code" binding:"max=50" example:"SUMMER22"`
 }
 
 type GetAllBookingsResponse struct {
-	Bookings []*Booking `json:"bookings"`
-	Count    int32      `json:"count"`
+	Bookings   []*Booking `json:"bookings"`
+	Count      int32      `json:"count"`
+	NextCursor string     `json:"next_cursor,omitempty"`
 }
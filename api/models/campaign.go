@@ -0,0 +1,77 @@
+package models
+
+import "time"
+
+// Campaign is a discount. With a code it is redeemed by giving the code as
+// promo_code when booking, without one it applies to every booking it
+// matches. Campaigns without a hotel apply to all hotels. Zero caps and
+// minimum nights mean no limit. Stackable campaigns combine with each other,
+// the others only apply on their own.
+type Campaign struct {
+	ID             int64      `json:"id"`
+	Code           string     `json:"code,omitempty" example:"SUMMER22"`
+	Name           string     `json:"name" example:"Summer sale"`
+	HotelID        *int64     `json:"hotel_id,omitempty"`
+	CreatedBy      int64      `json:"created_by"`
+	Type           string     `json:"type" example:"percent"`
+	Percent        string     `json:"percent,omitempty" example:"15"`
+	Amount         int64      `json:"amount,omitempty"`
+	Currency       string     `json:"currency,omitempty"`
+	ValidFrom      *time.Time `json:"valid_from,omitempty"`
+	ValidUntil     *time.Time `json:"valid_until,omitempty"`
+	MinNights      int        `json:"min_nights"`
+	MaxUses        int        `json:"max_uses"`
+	MaxUsesPerUser int        `json:"max_uses_per_user"`
+	Stackable      bool       `json:"stackable"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+type CreateCampaignRequest struct {
+	Code           string     `json:"code" binding:"max=50" example:"SUMMER22"`
+	Name           string     `json:"name" binding:"required,max=100" example:"Summer sale"`
+	HotelID        *int64     `json:"hotel_id" binding:"omitempty,gt=0"`
+	Type           string     `json:"type" binding:"required,oneof=percent fixed" example:"percent"`
+	Percent        string     `json:"percent" binding:"required_if=Type percent,max=10" example:"15"`
+	Amount         int64      `json:"amount" binding:"required_if=Type fixed,gte=0,lt=100000000000"`
+	Currency       string     `json:"currency" binding:"required_if=Type fixed,omitempty,currency"`
+	ValidFrom      *time.Time `json:"valid_from" example:"2022-06-01T00:00:00Z"`
+	ValidUntil     *time.Time `json:"valid_until" example:"2022-09-01T00:00:00Z"`
+	MinNights      int        `json:"min_nights" binding:"gte=0,lte=365"`
+	MaxUses        int        `json:"max_uses" binding:"gte=0"`
+	MaxUsesPerUser int        `json:"max_uses_per_user" binding:"gte=0"`
+	Stackable      bool       `json:"stackable"`
+}
+
+type GetAllCampaignsResponse struct {
+	Campaigns []*Campaign `json:"campaigns"`
+}
+
+// Redemption is a booking a campaign was applied to. Cancelled redemptions
+// belong to bookings cancelled or deleted since and do not count.
+type Redemption struct {
+	ID        int64     `json:"id"`
+	BookingID int64     `json:"booking_id"`
+	UserID    int64     `json:"user_id"`
+	Amount    int64     `json:"amount"`
+	Currency  string    `json:"currency" example:"USD"`
+	Cancelled bool      `json:"cancelled"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type CurrencyAmount struct {
+	Currency string `json:"currency" example:"USD"`
+	Amount   int64  `json:"amount"`
+}
+
+// CampaignReport sums up the use of a campaign. Uses, Guests and Discounts
+// leave out cancelled redemptions, Discounts are per currency in minor
+// units.
+type CampaignReport struct {
+	CampaignID  int64             `json:"campaign_id"`
+	Uses        int               `json:"uses"`
+	Guests      int               `json:"guests"`
+	Cancelled   int               `json:"cancelled"`
+	Discounts   []*CurrencyAmount `json:"discounts"`
+	Redemptions []*Redemption     `json:"redemptions"`
+}
@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+// CommissionRate is the percentage of the booking total a partner pays.
+// Default is set when the partner has no rate of their own.
+type CommissionRate struct {
+	PartnerID int64      `json:"partner_id"`
+	Rate      string     `json:"rate" example:"12.5"`
+	Default   bool       `json:"default"`
+	UpdatedAt *time.Time `json:"updated_at,omitempty"`
+}
+
+type SetCommissionRateRequest struct {
+	Rate string `json:"rate" binding:"required,max=10" example:"12.5"`
+}
+
+// CommissionEntry is a line of the commission ledger. Base is the part of
+// the booking the commission was taken on, Amount the commission, both in
+// minor units of Currency. Refunds are negative.
+type CommissionEntry struct {
+	ID        int64     `json:"id"`
+	PartnerID int64     `json:"partner_id"`
+	HotelID   int64     `json:"hotel_id"`
+	BookingID int64     `json:"booking_id"`
+	RefundID  *int64    `json:"refund_id,omitempty"`
+	Kind      string    `json:"kind" example:"earned"`
+	Rate      string    `json:"rate" example:"12.5"`
+	Base      int64     `json:"base"`
+	Amount    int64     `json:"amount"`
+	Currency  string    `json:"currency" example:"USD"`
+	Note      string    `json:"note,omitempty"`
+	CreatedBy *int64    `json:"created_by,omitempty"`
+	PayoutID  *int64    `json:"payout_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type GetAllCommissionEntriesResponse struct {
+	Entries []*CommissionEntry `json:"entries"`
+}
+
+// CreateCommissionAdjustmentRequest corrects the commission on a booking by
+// Amount minor units of its currency, negative amounts credit the partner.
+type CreateCommissionAdjustmentRequest struct {
+	BookingID int64  `json:"booking_id" binding:"required,gt=0"`
+	Amount    int64  `json:"amount" binding:"required"`
+	Note      string `json:"note" binding:"required,max=255" example:"Goodwill credit"`
+}
+
+// CreatePayoutsRequest closes the period at Until, now if it is not given.
+type CreatePayoutsRequest struct {
+	Until *time.Time `json:"until" example:"2022-11-01T00:00:00Z"`
+}
+
+// Payout is the statement of what a partner is paid for a period in one
+// currency: the Gross of the bookings less the Commission.
+type Payout struct {
+	ID          int64      `json:"id"`
+	PartnerID   int64      `json:"partner_id"`
+	Currency    string     `json:"currency" example:"USD"`
+	PeriodFrom  time.Time  `json:"period_from"`
+	PeriodUntil time.Time  `json:"period_until"`
+	Gross       int64      `json:"gross"`
+	Commission  int64      `json:"commission"`
+	Amount      int64      `json:"amount"`
+	Status      string     `json:"status" example:"pending"`
+	Reference   string     `json:"reference,omitempty"`
+	CreatedBy   int64      `json:"created_by"`
+	SettledBy   *int64     `json:"settled_by,omitempty"`
+	SettledAt   *time.Time `json:"settled_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type GetAllPayoutsResponse struct {
+	Payouts []*Payout `json:"payouts"`
+}
+
+// PayoutStatement is a payout with its ledger entries and the commission
+// broken down by kind.
+type PayoutStatement struct {
+	Payout
+	Earned   int64              `json:"earned"`
+	Refunded int64              `json:"refunded"`
+	Adjusted int64              `json:"adjusted"`
+	Entries  []*CommissionEntry `json:"entries"`
+}
+
+type SettlePayoutRequest struct {
+	Reference string `json:"reference" binding:"max=255" example:"SEPA-2022-11-0042"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Document is a private upload. URL is a signed link that works without a
+// token until URLExpiresAt; fetch the document again for a fresh one.
+type Document struct {
+	ID           int64     `json:"id"`
+	Kind         string    `json:"kind" example:"identity"`
+	HotelID      int64     `json:"hotel_id"`
+	BookingID    *int64    `json:"booking_id"`
+	ContentType  string    `json:"content_type" example:"application/pdf"`
+	Size         int64     `json:"size"`
+	URL          string    `json:"url" example:"/documents/1?expires=1700000000&signature=..."`
+	URLExpiresAt time.Time `json:"url_expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type GetAllDocumentsResponse struct {
+	Documents []*Document `json:"documents"`
+}
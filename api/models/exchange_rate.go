@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// ExchangeRate is how many units of Currency one unit of the base currency
+// buys.
+type ExchangeRate struct {
+	Currency  string    `json:"currency" example:"EUR"`
+	Rate      string    `json:"rate" example:"0.92"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SetExchangeRateRequest struct {
+	Rate string `json:"rate" binding:"required,max=40" example:"0.92"`
+}
+
+type GetAllExchangeRatesResponse struct {
+	Base  string          `json:"base" example:"USD"`
+	Rates []*ExchangeRate `json:"rates"`
+}
@@ -0,0 +1,36 @@
+package models
+
+// GalleryImage is an image of a hotel or room gallery. Position starts at
+// 1. At most one image is marked as the cover; without one the first image
+// is used.
+type GalleryImage struct {
+	MediaID  int64  `json:"media_id"`
+	Position int    `json:"position"`
+	Caption  string `json:"caption"`
+	AltText  string `json:"alt_text"`
+	Cover    bool   `json:"cover"`
+	Image    *Image `json:"image"`
+}
+
+type Gallery struct {
+	Images []*GalleryImage `json:"images"`
+}
+
+type AddGalleryImageRequest struct {
+	MediaID int64  `json:"media_id" binding:"required,gt=0"`
+	Caption string `json:"caption" binding:"max=500"`
+	AltText string `json:"alt_text" binding:"max=500"`
+	Cover   bool   `json:"cover"`
+}
+
+type UpdateGalleryImageRequest struct {
+	Caption string `json:"caption" binding:"max=500"`
+	AltText string `json:"alt_text" binding:"max=500"`
+	Cover   bool   `json:"cover"`
+}
+
+// ReorderGalleryRequest lists every media id of the gallery in the new
+// order.
+type ReorderGalleryRequest struct {
+	MediaIDs []int64 `json:"media_ids" binding:"required,dive,gt=0"`
+}
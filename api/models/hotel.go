@@ -3,24 +3,29 @@ package models
 import "time"
 
 type Hotel struct {
-	ID            int64     `json:"id"`
-	UserID        int64     `json:"user_id"`
-	HotelName     string    `json:"hotel_name"`
-	HotelLocation string    `json:"hotel_location"`
-	HotelImageUrl *string   `json:"hotel_image_url"`
-	NumberOfRooms int32     `json:"number_of_rooms"`
-	CreatedAt     time.Time `json:"created_at"`
+	ID            int64           `json:"id"`
+	UserID        int64           `json:"user_id"`
+	HotelName     string          `json:"hotel_name"`
+	HotelLocation string          `json:"hotel_location"`
+	Image         *Image          `json:"image,omitempty"`
+	Cover         *GalleryImage   `json:"cover,omitempty"`
+	Gallery       []*GalleryImage `json:"gallery,omitempty"`
+	NumberOfRooms int32           `json:"number_of_rooms"`
+	Version       int64           `json:"version"`
+	CreatedAt     time.Time       `json:"created_at"`
+	DeletedAt     *time.Time      `json:"deleted_at,omitempty"`
 }
 
 type CreateHotelRequest struct {
-	UserID        int64   `json:"user_id" binding:"required"`
-	HotelName     string  `json:"hotel_name" binding:"required"`
-	HotelLocation string  `json:"hotel_location" binding:"required"`
-	HotelImageUrl *string `json:"hotel_image_url" binding:"required"`
-	NumberOfRooms int32   `json:"number_of_rooms" binding:"required"`
+	UserID        int64  `json:"user_id" binding:"required,gt=0"`
+	HotelName     string `json:"hotel_name" binding:"required,max=255"`
+	HotelLocation string `json:"hotel_location" binding:"required,max=255"`
+	ImageID       *int64 `json:"image_id" binding:"omitempty,gt=0"`
+	NumberOfRooms int32  `json:"number_of_rooms" binding:"required,gt=0"`
 }
 
 type GetAllHotelsResponse struct {
-	Hotels []*Hotel `json:"hotels"`
-	Count  int32    `json:"count"`
+	Hotels     []*Hotel `json:"hotels"`
+	Count      int32    `json:"count"`
+	NextCursor string   `json:"next_cursor,omitempty"`
 }
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// LegalDetails identify the company operating a hotel on its invoices.
+type LegalDetails struct {
+	HotelID            int64     `json:"hotel_id"`
+	LegalName          string    `json:"legal_name" example:"Grand Hotel LLC"`
+	Address            string    `json:"address" example:"1 Amir Temur St, Tashkent"`
+	TaxID              string    `json:"tax_id" example:"301234567"`
+	RegistrationNumber string    `json:"registration_number"`
+	Email              string    `json:"email"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+type SetLegalDetailsRequest struct {
+	LegalName          string `json:"legal_name" binding:"required,max=255"`
+	Address            string `json:"address" binding:"required,max=500"`
+	TaxID              string `json:"tax_id" binding:"required,max=50"`
+	RegistrationNumber string `json:"registration_number" binding:"max=100"`
+	Email              string `json:"email" binding:"omitempty,email,max=255"`
+}
+
+type InvoiceLine struct {
+	Kind        string `json:"kind" example:"night"`
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitAmount  int64  `json:"unit_amount"`
+	Amount      int64  `json:"amount"`
+	Included    bool   `json:"included,omitempty"`
+}
+
+// Invoice is an issued invoice or receipt. Amounts are in minor units. The
+// PDF is downloaded from URL.
+type Invoice struct {
+	ID        int64          `json:"id"`
+	HotelID   int64          `json:"hotel_id"`
+	BookingID int64          `json:"booking_id"`
+	Kind      string         `json:"kind" example:"invoice"`
+	Number    string         `json:"number" example:"INV-1-000042"`
+	Currency  string         `json:"currency" example:"USD"`
+	Total     int64          `json:"total"`
+	Lines     []*InvoiceLine `json:"lines"`
+	Checksum  string         `json:"checksum"`
+	URL       string         `json:"url" example:"/v1/invoices/1/pdf"`
+	IssuedAt  time.Time      `json:"issued_at"`
+}
+
+type CreateInvoiceRequest struct {
+	Kind string `json:"kind" binding:"required,oneof=invoice receipt" example:"invoice"`
+}
+
+type GetAllInvoicesResponse struct {
+	Invoices []*Invoice `json:"invoices"`
+}
+
+// EmailInvoiceRequest sends an invoice to Email, by default the guest's
+// address. Only partners and superadmins may pick another address.
+type EmailInvoiceRequest struct {
+	Email string `json:"email" binding:"omitempty,email"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+type Media struct {
+	ID          int64     `json:"id"`
+	URL         string    `json:"url"`
+	ContentType string    `json:"content_type" example:"image/jpeg"`
+	Size        int64     `json:"size"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	Checksum    string    `json:"checksum"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// Image is a picture in every size it is available in. Srcset can be used
+// as is in an <img srcset> attribute, Sizes maps the derivative names, such
+// as "thumbnail", to their URLs. Until the derivatives are generated only the
+// original is listed.
+type Image struct {
+	URL    string            `json:"url"`
+	Width  int               `json:"width"`
+	Height int               `json:"height"`
+	Srcset string            `json:"srcset" example:"/media/a_thumbnail.jpg 200w, /media/a.jpg 1920w"`
+	Sizes  map[string]string `json:"sizes,omitempty"`
+}
+
+type MediaSweepReport struct {
+	DryRun       bool     `json:"dry_run"`
+	Media        []int64  `json:"media"`
+	Files        []string `json:"files"`
+	Bytes        int64    `json:"bytes"`
+	Unrecognized []string `json:"unrecognized"`
+}
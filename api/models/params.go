@@ -1,7 +1,9 @@
 package models
 
 type GetAllParams struct {
-	Limit  int32  `json:"limit" binding:"required" default:"10"`
-	Page   int32  `json:"page" binding:"required" default:"1"`
-	Search string `json:"search"`
+	Limit          int32  `json:"limit" binding:"required" default:"10"`
+	Page           int32  `json:"page" binding:"required" default:"1"`
+	Search         string `json:"search"`
+	After          string `json:"after"`
+	IncludeDeleted bool   `json:"include_deleted"`
 }
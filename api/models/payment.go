@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Payment is a payment towards a booking. Amounts are in minor units of the
+// currency, e.g. cents. ClientSecret is only returned when the payment is
+// created; the client completes a pending payment with it at the provider.
+type Payment struct {
+	ID           int64     `json:"id"`
+	BookingID    int64     `json:"booking_id"`
+	Provider     string    `json:"provider" example:"fake"`
+	Amount       int64     `json:"amount" example:"12000"`
+	Currency     string    `json:"currency" example:"USD"`
+	Status       string    `json:"status" example:"captured"`
+	Refunded     int64     `json:"refunded"`
+	Refunds      []*Refund `json:"refunds"`
+	ClientSecret string    `json:"client_secret,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type Refund struct {
+	ID        int64     `json:"id"`
+	PaymentID int64     `json:"payment_id"`
+	Amount    int64     `json:"amount"`
+	Reason    string    `json:"reason"`
+	Status    string    `json:"status" example:"succeeded"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CreatePaymentRequest pays Amount towards a booking. Without an amount the
+// outstanding balance is paid.
+type CreatePaymentRequest struct {
+	Amount *int64 `json:"amount" binding:"omitempty,gt=0"`
+}
+
+type GetAllPaymentsResponse struct {
+	Payments []*Payment `json:"payments"`
+}
+
+// CancelBookingRequest may override the refund the cancellation policy
+// gives. Only superadmins may set RefundAmount.
+type CancelBookingRequest struct {
+	RefundAmount *int64 `json:"refund_amount" binding:"omitempty,gte=0"`
+	Reason       string `json:"reason" binding:"max=255"`
+}
+
+type CancelBookingResponse struct {
+	Booking Booking   `json:"booking"`
+	Refunds []*Refund `json:"refunds"`
+}
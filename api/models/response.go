@@ -1,9 +1,23 @@
 package models
 
 type ErrorResponse struct {
-	Error string `json:"error"`
+	Error     string       `json:"error"`
+	Code      string       `json:"code" example:"not_found"`
+	Details   []FieldError `json:"details,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	TraceID   string       `json:"trace_id,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
 
 type ResponseOK struct {
 	Message string `json:"message"`
 }
+
+type HealthResponse struct {
+	Status string            `json:"status" example:"ok"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
@@ -2,25 +2,36 @@ package models
 
 import "time"
 
+// Room prices are per night, in minor units of Currency, e.g. cents. Rooms
+// without a price can not be booked.
 type Room struct {
-	ID           int64     `json:"id"`
-	Type         string    `json:"type"`
-	NumberOfRoom int       `json:"number_of_room"`
-	RoomImageUrl *string   `json:"room_image_url"`
-	Status       string    `json:"status"`
-	HotelId      int       `json:"hotel_id"`
-	CreatedAt    time.Time `json:"created_at"`
+	ID           int64           `json:"id"`
+	Type         string          `json:"type"`
+	NumberOfRoom int             `json:"number_of_room"`
+	Price        *int64          `json:"price" example:"12500"`
+	Currency     string          `json:"currency" example:"USD"`
+	Image        *Image          `json:"image,omitempty"`
+	Cover        *GalleryImage   `json:"cover,omitempty"`
+	Gallery      []*GalleryImage `json:"gallery,omitempty"`
+	Status       string          `json:"status"`
+	HotelId      int             `json:"hotel_id"`
+	Version      int64           `json:"version"`
+	CreatedAt    time.Time       `json:"created_at"`
+	DeletedAt    *time.Time      `json:"deleted_at,omitempty"`
 }
 
 type CreateRoomRequest struct {
-	Type         string  `json:"type"`
-	NumberOfRoom int     `json:"number_of_room"`
-	RoomImageUrl *string `json:"room_image_url"`
-	Status       string  `json:"status"`
-	HotelId      int     `json:"hotel_id"`
+	Type         string `json:"type" binding:"required,max=255"`
+	NumberOfRoom int    `json:"number_of_room" binding:"required,gt=0"`
+	Price        *int64 `json:"price" binding:"required,gte=0,lt=100000000000" example:"12500"`
+	Currency     string `json:"currency" binding:"omitempty,currency" example:"USD"`
+	ImageID      *int64 `json:"image_id" binding:"omitempty,gt=0"`
+	Status       string `json:"status" binding:"required,room_status" enums:"available,occupied,maintenance"`
+	HotelId      int    `json:"hotel_id" binding:"required,gt=0"`
 }
 
 type GetAllRoomsResponse struct {
-	Rooms []*Room `json:"rooms"`
-	Count int32   `json:"count"`
+	Rooms      []*Room `json:"rooms"`
+	Count      int32   `json:"count"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
@@ -0,0 +1,49 @@
+package models
+
+import "time"
+
+// TaxRule is a tax or fee a hotel charges. Percent rules apply to the whole
+// price, fixed ones charge Amount minor units of Currency per stay, night or
+// guest-night. Inclusive rules are already part of the price, exclusive ones
+// are added on top of it.
+type TaxRule struct {
+	ID        int64     `json:"id"`
+	HotelID   int64     `json:"hotel_id"`
+	Name      string    `json:"name" example:"VAT"`
+	Kind      string    `json:"kind" example:"tax"`
+	Type      string    `json:"type" example:"percent"`
+	Basis     string    `json:"basis" example:"stay"`
+	Percent   string    `json:"percent,omitempty" example:"12"`
+	Amount    int64     `json:"amount,omitempty"`
+	Currency  string    `json:"currency,omitempty"`
+	Inclusive bool      `json:"inclusive"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type CreateTaxRuleRequest struct {
+	Name      string `json:"name" binding:"required,max=100" example:"Tourist tax"`
+	Kind      string `json:"kind" binding:"required,oneof=tax fee" example:"tax"`
+	Type      string `json:"type" binding:"required,oneof=percent fixed" example:"fixed"`
+	Basis     string `json:"basis" binding:"required,oneof=stay night guest_night" example:"guest_night"`
+	Percent   string `json:"percent" binding:"required_if=Type percent,max=10" example:""`
+	Amount    int64  `json:"amount" binding:"required_if=Type fixed,gte=0,lt=100000000000" example:"1500000"`
+	Currency  string `json:"currency" binding:"required_if=Type fixed,omitempty,currency" example:"UZS"`
+	Inclusive bool   `json:"inclusive"`
+}
+
+type GetAllTaxRulesResponse struct {
+	TaxRules []*TaxRule `json:"tax_rules"`
+}
+
+// Charge is a tax or fee of a booking in minor units of its currency.
+// Inclusive charges are part of the price, the others are added to it.
+type Charge struct {
+	Name       string `json:"name" example:"Tourist tax"`
+	Kind       string `json:"kind" example:"tax"`
+	Basis      string `json:"basis" example:"guest_night"`
+	Inclusive  bool   `json:"inclusive"`
+	Quantity   int    `json:"quantity"`
+	UnitAmount int64  `json:"unit_amount"`
+	Amount     int64  `json:"amount"`
+}
@@ -3,15 +3,17 @@ package models
 import "time"
 
 type User struct {
-	ID          int64     `json:"id"`
-	FirstName   string    `json:"first_name"`
-	LastName    string    `json:"last_name"`
-	Email       string    `json:"email"`
-	PhoneNumber *string   `json:"phone_number"`
-	Username    *string   `json:"username"`
-	Password    string    `json:"password"`
-	Type        string    `json:"type"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID          int64      `json:"id"`
+	FirstName   string     `json:"first_name"`
+	LastName    string     `json:"last_name"`
+	Email       string     `json:"email"`
+	PhoneNumber *string    `json:"phone_number"`
+	Username    *string    `json:"username"`
+	Password    string     `json:"password"`
+	Type        string     `json:"type"`
+	Version     int64      `json:"version"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
 }
 
 type CreateUserRequest struct {
@@ -21,10 +23,20 @@ type CreateUserRequest struct {
 	PhoneNumber *string `json:"phone_number"`
 	Username    *string `json:"username" binding:"required,min=2,max=30"`
 	Password    string  `json:"password" binding:"required,min=6,max=16"`
-	Type        string  `json:"type" binding:"required oneof=user partner"`
+	Type        string  `json:"type" binding:"required,oneof=user partner"`
+}
+
+// PatchUserRequest lists the user fields a merge patch may change.
+type PatchUserRequest struct {
+	FirstName   string  `json:"first_name" binding:"required,min=2,max=30"`
+	LastName    string  `json:"last_name" binding:"required,min=2,max=30"`
+	Email       string  `json:"email" binding:"required,email"`
+	PhoneNumber *string `json:"phone_number"`
+	Username    *string `json:"username" binding:"required,min=2,max=30"`
 }
 
 type GetAllUsersResponse struct {
-	Users []*User `json:"users"`
-	Count int32   `json:"count"`
+	Users      []*User `json:"users"`
+	Count      int32   `json:"count"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
@@ -0,0 +1,135 @@
+package v1
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+// @Security ApiKeyAuth
+// @Router /audit-logs [get]
+// @Summary Get audit logs
+// @Description Get audit logs filtered by entity, actor and time range. Superadmin only.
+// @Tags audit
+// @Accept json
+// @Produce json
+// @Param filter query models.GetAllAuditLogsParams false "Filter"
+// @Success 200 {object} models.GetAllAuditLogsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetAllAuditLogs(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	req, cursor, err := validateGetAllParams(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	params := repo.GetAllAuditLogsParams{
+		Limit:  req.Limit,
+		Page:   req.Page,
+		Cursor: cursor,
+		Entity: c.Query("entity"),
+	}
+
+	params.EntityID, err = queryInt64(c, "entity_id")
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	params.ActorID, err = queryInt64(c, "actor_id")
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	params.From, err = queryTime(c, "from")
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	params.To, err = queryTime(c, "to")
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	result, err := h.storage.Audit().GetAll(c.Request.Context(), &params)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getAuditLogsResponse(result))
+}
+
+func getAuditLogsResponse(data *repo.GetAllAuditLogsResult) *models.GetAllAuditLogsResponse {
+	response := models.GetAllAuditLogsResponse{
+		AuditLogs:  make([]*models.AuditLog, 0),
+		Count:      data.Count,
+		NextCursor: encodeCursor(data.NextCursor),
+	}
+
+	for _, a := range data.AuditLogs {
+		response.AuditLogs = append(response.AuditLogs, &models.AuditLog{
+			ID:        a.ID,
+			Entity:    a.Entity,
+			EntityID:  a.EntityID,
+			Action:    a.Action,
+			ActorID:   a.ActorID,
+			ActorType: a.ActorType,
+			IP:        a.IP,
+			RequestID: a.RequestID,
+			Before:    a.Before,
+			After:     a.After,
+			Changes:   a.Changes,
+			CreatedAt: a.CreatedAt,
+		})
+	}
+
+	return &response
+}
+
+func queryInt64(c *gin.Context, key string) (int64, error) {
+	if c.Query(key) == "" {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseInt(c.Query(key), 10, 64)
+	if err != nil {
+		return 0, errs.Validation(errs.Field(key, "must be an integer"))
+	}
+
+	return n, nil
+}
+
+func queryTime(c *gin.Context, key string) (*time.Time, error) {
+	if c.Query(key) == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, c.Query(key))
+	if err != nil {
+		return nil, errs.Validation(errs.Field(key, "must be an RFC 3339 timestamp"))
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,37 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryParamsValidation(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/?entity_id=abc&from=yesterday&actor_id=7", nil)
+
+	var e *errs.Error
+
+	_, err := queryInt64(c, "entity_id")
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, errs.CodeValidation, e.Code)
+	require.Equal(t, "entity_id", e.Fields[0].Field)
+
+	_, err = queryTime(c, "from")
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, errs.CodeValidation, e.Code)
+	require.Equal(t, "from", e.Fields[0].Field)
+
+	id, err := queryInt64(c, "actor_id")
+	require.NoError(t, err)
+	require.Equal(t, int64(7), id)
+
+	to, err := queryTime(c, "to")
+	require.NoError(t, err)
+	require.Nil(t, to)
+}
@@ -1,14 +1,18 @@
 package v1
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/logger"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/metrics"
 	"github.com/MuhammadyusufAdhamov/booking/pkg/utils"
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slog"
 	"net/http"
 	"time"
 
@@ -28,6 +32,8 @@ const (
 // @Produce json
 // @Param data body models.RegisterRequest true "Data"
 // @Success 200 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) Register(c *gin.Context) {
 	var (
@@ -36,19 +42,23 @@ func (h *handlerV1) Register(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	_, err = h.storage.User().GetByEmail(req.Email)
+	_, err = h.storage.User().GetByEmail(c.Request.Context(), req.Email)
+	if err == nil {
+		handleError(c, ErrEmailExists)
+		return
+	}
 	if !errors.Is(err, sql.ErrNoRows) {
-		c.JSON(http.StatusBadRequest, errorResponse(ErrEmailExists))
+		handleError(c, err)
 		return
 	}
 
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
@@ -61,40 +71,41 @@ func (h *handlerV1) Register(c *gin.Context) {
 
 	userData, err := json.Marshal(user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	err = h.inMemory.Set("user_"+user.Email, string(userData), 10*time.Minute)
+	err = h.inMemory.Set(c.Request.Context(), "user_"+user.Email, string(userData), 10*time.Minute)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	go func() {
-		err := h.sendVerificationCode(RegisterCodeKey, req.Email)
+	ctx := logger.Detach(c.Request.Context())
+	h.tasks.Go(func() {
+		err := h.sendVerificationCode(ctx, RegisterCodeKey, req.Email)
 		if err != nil {
-			fmt.Printf("failed to send verification code: %v", err)
+			slog.ErrorCtx(ctx, "failed to send verification code", err)
 		}
-	}()
+	})
 
 	c.JSON(http.StatusCreated, models.ResponseOK{
 		Message: "Verification code has been sent!",
 	})
 }
 
-func (h *handlerV1) sendVerificationCode(key, email string) error {
+func (h *handlerV1) sendVerificationCode(ctx context.Context, key, email string) error {
 	code, err := utils.GenerateRandomCode(6)
 	if err != nil {
 		return err
 	}
 
-	err = h.inMemory.Set(key+email, code, time.Minute)
+	err = h.inMemory.Set(ctx, key+email, code, time.Minute)
 	if err != nil {
 		return err
 	}
 
-	err = emailPkg.SendEmail(h.cfg, &emailPkg.SendEmailRequest{
+	err = emailPkg.SendEmail(ctx, h.cfg, &emailPkg.SendEmailRequest{
 		To:      []string{email},
 		Subject: "Verification email",
 		Body: map[string]string{
@@ -117,6 +128,8 @@ func (h *handlerV1) sendVerificationCode(key, email string) error {
 // @Produce json
 // @Param data body models.VerifyRequest true "Data"
 // @Success 200 {object} models.AuthResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) Verify(c *gin.Context) {
 	var (
@@ -125,40 +138,42 @@ func (h *handlerV1) Verify(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	userData, err := h.inMemory.Get("user_" + req.Email)
+	userData, err := h.inMemory.Get(c.Request.Context(), "user_"+req.Email)
 	if err != nil {
-		c.JSON(http.StatusForbidden, errorResponse(err))
+		handleError(c, ErrCodeExpired)
 		return
 	}
 
 	var user repo.User
 	err = json.Unmarshal([]byte(userData), &user)
 	if err != nil {
-		c.JSON(http.StatusForbidden, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	code, err := h.inMemory.Get(RegisterCodeKey + user.Email)
+	code, err := h.inMemory.Get(c.Request.Context(), RegisterCodeKey+user.Email)
 	if err != nil {
-		c.JSON(http.StatusForbidden, errorResponse(ErrCodeExpired))
+		handleError(c, ErrCodeExpired)
 		return
 	}
 
 	if req.Code != code {
-		c.JSON(http.StatusForbidden, errorResponse(ErrIncorrectCode))
+		handleError(c, ErrIncorrectCode)
 		return
 	}
 
-	result, err := h.storage.User().Create(&user)
+	result, err := h.storage.User().Create(c.Request.Context(), &user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
+	metrics.Registrations.Inc()
+
 	token, _, err := utils.CreateToken(h.cfg, &utils.TokenParams{
 		UserID:   result.ID,
 		Email:    result.Email,
@@ -166,7 +181,7 @@ func (h *handlerV1) Verify(c *gin.Context) {
 		Duration: time.Hour * 24,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
@@ -189,6 +204,8 @@ func (h *handlerV1) Verify(c *gin.Context) {
 // @Produce json
 // @Param data body models.LoginRequest true "Data"
 // @Success 200 {object} models.AuthResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) Login(c *gin.Context) {
 	var (
@@ -197,24 +214,26 @@ func (h *handlerV1) Login(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	result, err := h.storage.User().GetByEmail(req.Email)
+	result, err := h.storage.User().GetByEmail(c.Request.Context(), req.Email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusForbidden, errorResponse(ErrWrongEmailOrPass))
+			metrics.FailedLogins.Inc()
+			handleError(c, ErrWrongEmailOrPass)
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
 	err = utils.CheckPassword(req.Password, result.Password)
 	if err != nil {
-		c.JSON(http.StatusForbidden, errorResponse(ErrWrongEmailOrPass))
+		metrics.FailedLogins.Inc()
+		handleError(c, ErrWrongEmailOrPass)
 		return
 	}
 
@@ -225,7 +244,7 @@ func (h *handlerV1) Login(c *gin.Context) {
 		Duration: time.Hour * 24,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
@@ -248,6 +267,8 @@ func (h *handlerV1) Login(c *gin.Context) {
 // @Produce json
 // @Param data body models.ForgotPasswordRequest true "Data"
 // @Success 200 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) ForgotPassword(c *gin.Context) {
 	var (
@@ -256,27 +277,28 @@ func (h *handlerV1) ForgotPassword(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	_, err = h.storage.User().GetByEmail(req.Email)
+	_, err = h.storage.User().GetByEmail(c.Request.Context(), req.Email)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, errorResponse(err))
+			handleError(c, errs.NotFound("user"))
 			return
 		}
 
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	go func() {
-		err := h.sendVerificationCode(ForgotPasswordKey, req.Email)
+	ctx := logger.Detach(c.Request.Context())
+	h.tasks.Go(func() {
+		err := h.sendVerificationCode(ctx, ForgotPasswordKey, req.Email)
 		if err != nil {
-			fmt.Printf("failed to send verification code: %v", err)
+			slog.ErrorCtx(ctx, "failed to send verification code", err)
 		}
-	}()
+	})
 
 	c.JSON(http.StatusCreated, models.ResponseOK{
 		Message: "Verification code has been sent!",
@@ -291,6 +313,8 @@ func (h *handlerV1) ForgotPassword(c *gin.Context) {
 // @Produce json
 // @Param data body models.VerifyRequest true "Data"
 // @Success 200 {object} models.AuthResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) VerifyForgotPassword(c *gin.Context) {
 	var (
@@ -299,24 +323,24 @@ func (h *handlerV1) VerifyForgotPassword(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	code, err := h.inMemory.Get(ForgotPasswordKey + req.Email)
+	code, err := h.inMemory.Get(c.Request.Context(), ForgotPasswordKey+req.Email)
 	if err != nil {
-		c.JSON(http.StatusForbidden, errorResponse(ErrCodeExpired))
+		handleError(c, ErrCodeExpired)
 		return
 	}
 
 	if req.Code != code {
-		c.JSON(http.StatusForbidden, errorResponse(ErrIncorrectCode))
+		handleError(c, ErrIncorrectCode)
 		return
 	}
 
-	result, err := h.storage.User().GetByEmail(req.Email)
+	result, err := h.storage.User().GetByEmail(c.Request.Context(), req.Email)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
@@ -326,7 +350,7 @@ func (h *handlerV1) VerifyForgotPassword(c *gin.Context) {
 		Duration: time.Minute * 30,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
@@ -350,6 +374,7 @@ func (h *handlerV1) VerifyForgotPassword(c *gin.Context) {
 // @Produce json
 // @Param data body models.UpdatePasswordRequest true "Data"
 // @Success 200 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) UpdatePassword(c *gin.Context) {
 	var (
@@ -358,28 +383,28 @@ func (h *handlerV1) UpdatePassword(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
 	payload, err := h.GetAuthPayload(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
 	hashedPassword, err := utils.HashPassword(req.Password)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	err = h.storage.User().UpdatePassword(&repo.UpdatePassword{
+	err = h.storage.User().UpdatePassword(c.Request.Context(), &repo.UpdatePassword{
 		UserID:   payload.UserID,
 		Password: hashedPassword,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
@@ -1,23 +1,26 @@
 package v1
 
 import (
-	"database/sql"
-	"errors"
+	"context"
+	"fmt"
 	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/metrics"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/money"
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/gin-gonic/gin"
 	"net/http"
-	"strconv"
 )
 
 // @Router /bookings [post]
 // @Summary Create a booking
-// @Description Create a booking
+// @Description Create a booking. It stays pending until the deposit has been paid, bookings without a deposit are confirmed right away.
 // @Tags booking
 // @Accept json
 // @Produce json
 // @Param booking body models.CreateBookingRequest true "Booking"
 // @Success 201 {object} models.Booking
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) CreateBooking(c *gin.Context) {
 	var (
@@ -26,23 +29,76 @@ func (h *handlerV1) CreateBooking(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	resp, err := h.storage.Booking().Create(&repo.Booking{
-		RoomId:   req.RoomId,
-		UserId:   req.UserId,
-		HotelId:  req.HotelId,
-		FromDate: req.FromDate,
-		ToDate:   req.ToDate,
-		Price:    req.Price,
-	})
+	err = h.validateBookingReferences(c.Request.Context(), &req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	currency, rate, err := h.lockRate(c.Request.Context(), req.Currency)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
+	commissionRate, err := h.commissionRate(c.Request.Context(), int64(req.HotelId))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	booking := &repo.Booking{
+		RoomId:         req.RoomId,
+		UserId:         req.UserId,
+		HotelId:        req.HotelId,
+		FromDate:       req.FromDate,
+		ToDate:         req.ToDate,
+		Currency:       currency,
+		ExchangeRate:   rate,
+		CommissionRate: commissionRate,
+		Guests:         guestsOrDefault(req.Guests),
+	}
+
+	err = h.priceStay(c.Request.Context(), booking)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	campaigns, err := h.bookingCampaigns(c.Request.Context(), booking, req.PromoCode)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	err = h.priceBooking(c.Request.Context(), booking, campaigns)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.Booking().Create(c.Request.Context(), booking)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	metrics.BookingsCreated.Inc()
+
+	// nothing to pay up front, there is no deposit or it comes to 0
+	if h.requiredDeposit(resp) == 0 {
+		resp, err = h.storage.Booking().SetStatus(c.Request.Context(), resp.ID, repo.BookingStatusConfirmed)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+	}
+
+	setETag(c, resp.Version)
 	c.JSON(http.StatusCreated, parseBookingModel(resp))
 }
 
@@ -53,22 +109,47 @@ func (h *handlerV1) CreateBooking(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path int true "ID"
+// @Param currency query string false "Currency to also show the price in"
 // @Success 200 {object} models.Booking
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) GetBooking(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := idParam(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	resp, err := h.storage.Booking().Get(int64(id))
+	currency, err := displayCurrency(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, parseBookingModel(resp))
+	resp, err := h.storage.Booking().Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	model := parseBookingModel(resp)
+	if currency != "" {
+		rates, err := h.rates(c.Request.Context())
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+
+		err = convertBooking(resp, &model, currency, rates)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+	}
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, model)
 }
 
 // @Router /bookings [get]
@@ -78,52 +159,96 @@ func (h *handlerV1) GetBooking(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param filter query models.GetAllParams false "Filter"
+// @Param currency query string false "Currency to also show the prices in"
 // @Success 200 {object} models.GetAllBookingsResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) GetAllBookings(c *gin.Context) {
-	req, err := validateGetAllParams(c)
+	req, cursor, err := validateGetAllParams(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	withDeleted, err := includeDeleted(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	currency, err := displayCurrency(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	result, err := h.storage.Booking().GetAll(&repo.GetAllBookingsParams{
-		Page:   req.Page,
-		Limit:  req.Limit,
-		Search: req.Search,
+	var rates *money.Rates
+	if currency != "" {
+		rates, err = h.rates(c.Request.Context())
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+	}
+
+	result, err := h.storage.Booking().GetAll(c.Request.Context(), &repo.GetAllBookingsParams{
+		Page:           req.Page,
+		Limit:          req.Limit,
+		Search:         req.Search,
+		Cursor:         cursor,
+		IncludeDeleted: withDeleted,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, getBookingsResponse(result))
+	response, err := getBookingsResponse(result, currency, rates)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
 }
 
-func getBookingsResponse(data *repo.GetAllBookingResult) *models.GetAllBookingsResponse {
+func getBookingsResponse(data *repo.GetAllBookingResult, currency string, rates *money.Rates) (*models.GetAllBookingsResponse, error) {
 	response := models.GetAllBookingsResponse{
-		Bookings: make([]*models.Booking, 0),
-		Count:    data.Count,
+		Bookings:   make([]*models.Booking, 0),
+		Count:      data.Count,
+		NextCursor: encodeCursor(data.NextCursor),
 	}
 
 	for _, booking := range data.Bookings {
 		u := parseBookingModel(booking)
+		err := convertBooking(booking, &u, currency, rates)
+		if err != nil {
+			return nil, err
+		}
 		response.Bookings = append(response.Bookings, &u)
 	}
 
-	return &response
+	return &response, nil
 }
 
 func parseBookingModel(booking *repo.Booking) models.Booking {
 	return models.Booking{
-		ID:        booking.ID,
-		RoomId:    booking.RoomId,
-		UserId:    booking.UserId,
-		HotelId:   booking.HotelId,
-		FromDate:  booking.FromDate,
-		ToDate:    booking.ToDate,
-		Price:     booking.Price,
-		CreatedAt: booking.CreatedAt,
+		ID:           booking.ID,
+		RoomId:       booking.RoomId,
+		UserId:       booking.UserId,
+		HotelId:      booking.HotelId,
+		FromDate:     booking.FromDate,
+		ToDate:       booking.ToDate,
+		Price:        booking.Price,
+		Currency:     booking.Currency,
+		ExchangeRate: normalizeRate(booking.ExchangeRate),
+		Guests:       booking.Guests,
+		Charges:      parseChargeModels(booking.Charges),
+		Total:        booking.Total,
+		Status:       booking.Status,
+		Version:      booking.Version,
+		CreatedAt:    booking.CreatedAt,
+		DeletedAt:    booking.DeletedAt,
 	}
 }
 
@@ -134,9 +259,13 @@ func parseBookingModel(booking *repo.Booking) models.Booking {
 // @Accept json
 // @Produce json
 // @Param id path int true "ID"
+// @Param If-Match header string true "ETag of the version being changed"
 // @Param booking body models.CreateBookingRequest true "Booking"
 // @Success 200 {object} models.Booking
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) UpdateBooking(c *gin.Context) {
 	var (
@@ -145,43 +274,248 @@ func (h *handlerV1) UpdateBooking(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	if req.PromoCode != "" {
+		handleError(c, ErrPromoCodeChange)
 		return
 	}
 
-	id, err := strconv.Atoi(c.Param("id"))
+	err = h.validateBookingReferences(c.Request.Context(), &req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	resp, err := h.storage.Booking().Update(&repo.Booking{
-		ID:       int64(id),
-		RoomId:   req.RoomId,
-		UserId:   req.UserId,
-		HotelId:  req.HotelId,
-		FromDate: req.FromDate,
-		ToDate:   req.ToDate,
-		Price:    req.Price,
-	})
+	id, err := idParam(c)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	currency, rate, err := h.lockRate(c.Request.Context(), req.Currency)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	booking := &repo.Booking{
+		ID:           id,
+		RoomId:       req.RoomId,
+		UserId:       req.UserId,
+		HotelId:      req.HotelId,
+		FromDate:     req.FromDate,
+		ToDate:       req.ToDate,
+		Currency:     currency,
+		ExchangeRate: rate,
+		Guests:       guestsOrDefault(req.Guests),
+		Version:      version,
+	}
+
+	current, err := h.storage.Booking().Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	err = h.priceStay(c.Request.Context(), booking)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	// the commission rate stays locked unless the booking moves hotel
+	booking.CommissionRate = current.CommissionRate
+	if booking.HotelId != current.HotelId {
+		booking.CommissionRate, err = h.commissionRate(c.Request.Context(), int64(booking.HotelId))
+		if err != nil {
+			handleError(c, err)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+	}
+
+	campaigns, err := h.redeemedCampaigns(c.Request.Context(), current, booking)
+	if err != nil {
+		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.Booking{
-		ID:       resp.ID,
-		RoomId:   resp.RoomId,
-		UserId:   resp.UserId,
-		HotelId:  resp.HotelId,
-		FromDate: resp.FromDate,
-		ToDate:   resp.ToDate,
-		Price:    resp.Price,
-	})
+	err = h.priceBooking(c.Request.Context(), booking, campaigns)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	err = h.checkPaidChange(c.Request.Context(), current, booking)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.Booking().Update(c.Request.Context(), booking)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, parseBookingModel(resp))
+}
+
+// @Security ApiKeyAuth
+// @Router /bookings/{id} [patch]
+// @Summary Patch a booking
+// @Description Partially update a booking with an RFC 7396 JSON merge patch. Fields set to null are cleared, omitted fields are kept. Only the guest, the partner owning the hotel and superadmins may, and only superadmins may change its guest.
+// @Tags booking
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Param If-Match header string true "ETag of the version being changed"
+// @Param booking body models.CreateBookingRequest true "Merge patch"
+// @Success 200 {object} models.Booking
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) PatchBooking(c *gin.Context) {
+	current, payload, err := h.accessibleBooking(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if current.Version != version {
+		handleError(c, repo.ErrVersionMismatch)
+		return
+	}
+
+	original := models.CreateBookingRequest{
+		RoomId:   current.RoomId,
+		UserId:   current.UserId,
+		HotelId:  current.HotelId,
+		FromDate: current.FromDate,
+		ToDate:   current.ToDate,
+		Currency: current.Currency,
+		Guests:   current.Guests,
+	}
+
+	var merged models.CreateBookingRequest
+	fields, err := mergePatchRequest(c, &original, &merged)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if _, ok := fields["user_id"]; ok && payload.UserType != repo.UserTypeSuperadmin {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	if _, ok := fields["promo_code"]; ok {
+		handleError(c, ErrPromoCodeChange)
+		return
+	}
+
+	if changesReferences(fields, "room_id", "user_id", "hotel_id") {
+		err = h.validateBookingReferences(c.Request.Context(), &merged)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+	}
+
+	// a new currency gets today's rate, otherwise the locked one is kept
+	if _, ok := fields["currency"]; ok {
+		merged.Currency, fields["exchange_rate"], err = h.lockRate(c.Request.Context(), merged.Currency)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+		fields["currency"] = merged.Currency
+	}
+
+	if merged.HotelId != current.HotelId {
+		fields["commission_rate"], err = h.commissionRate(c.Request.Context(), int64(merged.HotelId))
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+	}
+
+	if _, ok := fields["guests"]; ok {
+		merged.Guests = guestsOrDefault(merged.Guests)
+		fields["guests"] = merged.Guests
+	}
+
+	// the user is kept on the redemptions of the booking
+	if changesReferences(fields, "room_id", "user_id", "hotel_id", "from_date", "to_date", "currency", "guests") {
+		booking := &repo.Booking{
+			RoomId:   merged.RoomId,
+			UserId:   merged.UserId,
+			HotelId:  merged.HotelId,
+			FromDate: merged.FromDate,
+			ToDate:   merged.ToDate,
+			Price:    current.Price,
+			Currency: merged.Currency,
+			Guests:   merged.Guests,
+		}
+
+		// the price stays as booked unless the stay changes
+		if changesReferences(fields, "room_id", "from_date", "to_date", "currency") {
+			err = h.priceStay(c.Request.Context(), booking)
+			if err != nil {
+				handleError(c, err)
+				return
+			}
+			fields["price"] = booking.Price
+		}
+
+		campaigns, err := h.redeemedCampaigns(c.Request.Context(), current, booking)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+
+		err = h.priceBooking(c.Request.Context(), booking, campaigns)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+		fields["charges"], fields["total"] = booking.Charges, booking.Total
+
+		err = h.checkPaidChange(c.Request.Context(), current, booking)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+	}
+
+	resp, err := h.storage.Booking().Patch(c.Request.Context(), current.ID, version, fields)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, parseBookingModel(resp))
 }
 
 // @Router /booking/{id} [delete]
@@ -191,23 +525,29 @@ func (h *handlerV1) UpdateBooking(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path int true "ID"
+// @Param If-Match header string true "ETag of the version being changed"
 // @Success 200 {object} models.ResponseOK
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) DeleteBooking(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := idParam(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	err = h.storage.Booking().Delete(int64(id))
+	version, err := ifMatchVersion(c)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, errorResponse(err))
-			return
-		}
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	err = h.storage.Booking().Delete(c.Request.Context(), id, version)
+	if err != nil {
+		handleError(c, err)
 		return
 	}
 
@@ -215,3 +555,103 @@ func (h *handlerV1) DeleteBooking(c *gin.Context) {
 		Message: "Successfully deleted",
 	})
 }
+
+// @Security ApiKeyAuth
+// @Router /bookings/{id}/restore [post]
+// @Summary Restore a deleted booking
+// @Description Restore a deleted booking. Superadmin only.
+// @Tags booking
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.Booking
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) RestoreBooking(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.Booking().Restore(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, parseBookingModel(resp))
+}
+
+// validateBookingReferences checks that the guest, hotel and room exist and
+// that the room actually belongs to the hotel.
+func (h *handlerV1) validateBookingReferences(ctx context.Context, req *models.CreateBookingRequest) error {
+	err := h.checkReferences(ctx,
+		reference{"user_id", repo.AuditEntityUser, int64(req.UserId)},
+		reference{"hotel_id", repo.AuditEntityHotel, int64(req.HotelId)},
+		reference{"room_id", repo.AuditEntityRoom, int64(req.RoomId)},
+	)
+	if err != nil {
+		return err
+	}
+
+	room, err := h.storage.Room().Get(ctx, int64(req.RoomId))
+	if err != nil {
+		return err
+	}
+
+	if room.HotelId != req.HotelId {
+		return errs.Validation(errs.Field("room_id", fmt.Sprintf("room %d does not belong to hotel %d", req.RoomId, req.HotelId)))
+	}
+
+	return nil
+}
+
+// priceStay prices the booking at the nightly price of its room, converted
+// to the currency of the booking, times the nights booked.
+func (h *handlerV1) priceStay(ctx context.Context, booking *repo.Booking) error {
+	room, err := h.storage.Room().Get(ctx, int64(booking.RoomId))
+	if err != nil {
+		return err
+	}
+
+	if room.Price == nil {
+		return errs.Validation(errs.Field("room_id", fmt.Sprintf("room %d has no price yet", booking.RoomId)))
+	}
+
+	rates, err := h.ratesFor(ctx, booking.Currency, room.Currency)
+	if err != nil {
+		return err
+	}
+
+	nightly, err := convertAmount("room price", *room.Price, room.Currency, booking.Currency, rates)
+	if err != nil {
+		return err
+	}
+
+	booking.Price = nightly * int64(stayNights(booking))
+	return nil
+}
+
+func changesReferences(fields map[string]interface{}, names ...string) bool {
+	for _, name := range names {
+		if _, ok := fields[name]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/storage"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+type roomStorage struct {
+	storage.StorageI
+	rooms roomGetter
+}
+
+func (s *roomStorage) Room() repo.RoomsStorageI { return s.rooms }
+
+type roomGetter struct {
+	repo.RoomsStorageI
+	room *repo.Room
+}
+
+func (r roomGetter) Get(ctx context.Context, id int64) (*repo.Room, error) {
+	return r.room, nil
+}
+
+func TestPriceStay(t *testing.T) {
+	price := int64(12500)
+	room := &repo.Room{ID: 4, Price: &price, Currency: "USD"}
+	h := &handlerV1{storage: &roomStorage{rooms: roomGetter{room: room}}}
+
+	// whatever the client thinks, the stay costs the room's nightly price
+	booking := &repo.Booking{RoomId: 4, FromDate: "2022-10-01", ToDate: "2022-10-04", Price: 1, Currency: "USD"}
+	require.NoError(t, h.priceStay(context.Background(), booking))
+	require.Equal(t, int64(37500), booking.Price)
+
+	room.Price = nil
+	err := h.priceStay(context.Background(), booking)
+
+	var e *errs.Error
+	require.True(t, errors.As(err, &e))
+	require.Equal(t, errs.CodeValidation, e.Code)
+	require.Equal(t, "room_id", e.Fields[0].Field)
+}
@@ -0,0 +1,582 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/money"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/utils"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrPromoCodeChange = errs.Validation(errs.Field("promo_code", "can only be given when booking"))
+
+	promoCodePattern = regexp.MustCompile(`^[A-Z0-9_-]+$`)
+)
+
+// @Security ApiKeyAuth
+// @Router /campaigns [post]
+// @Summary Create a discount campaign
+// @Description Create a campaign. With a code it is redeemed by giving the code as promo_code when booking, without one it applies to every matching booking. Superadmins may create campaigns for all hotels, partners only for their own hotels.
+// @Tags campaign
+// @Accept json
+// @Produce json
+// @Param campaign body models.CreateCampaignRequest true "Campaign"
+// @Success 201 {object} models.Campaign
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) CreateCampaign(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	campaign, err := h.bindCampaign(c, payload)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	campaign.CreatedBy = payload.UserID
+
+	resp, err := h.storage.Campaign().Create(c.Request.Context(), campaign)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, parseCampaignModel(resp))
+}
+
+// @Security ApiKeyAuth
+// @Router /campaigns [get]
+// @Summary Get campaigns
+// @Description Get the running campaigns. Superadmins see all of them, partners those of their hotels.
+// @Tags campaign
+// @Produce json
+// @Param hotel_id query int false "Hotel ID"
+// @Success 200 {object} models.GetAllCampaignsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetAllCampaigns(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var params repo.GetAllCampaignsParams
+
+	switch payload.UserType {
+	case repo.UserTypeSuperadmin:
+	case repo.UserTypePartner:
+		params.PartnerID = payload.UserID
+	default:
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	params.HotelID, err = queryInt64(c, "hotel_id")
+	if err != nil || params.HotelID < 0 {
+		handleError(c, errs.Validation(errs.Field("hotel_id", "must be a positive integer")))
+		return
+	}
+
+	result, err := h.storage.Campaign().GetAll(c.Request.Context(), &params)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response := models.GetAllCampaignsResponse{
+		Campaigns: make([]*models.Campaign, 0, len(result)),
+	}
+	for _, campaign := range result {
+		u := parseCampaignModel(campaign)
+		response.Campaigns = append(response.Campaigns, &u)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Security ApiKeyAuth
+// @Router /campaigns/{id} [get]
+// @Summary Get a campaign
+// @Description Get a campaign. Superadmins and partners owning its hotel only.
+// @Tags campaign
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.Campaign
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetCampaign(c *gin.Context) {
+	campaign, _, err := h.manageableCampaign(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, parseCampaignModel(campaign))
+}
+
+// @Security ApiKeyAuth
+// @Router /campaigns/{id} [put]
+// @Summary Update a campaign
+// @Description Replace a campaign. Bookings it was applied to keep their discount. Superadmins and partners owning its hotel only.
+// @Tags campaign
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Param campaign body models.CreateCampaignRequest true "Campaign"
+// @Success 200 {object} models.Campaign
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) UpdateCampaign(c *gin.Context) {
+	current, payload, err := h.manageableCampaign(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	campaign, err := h.bindCampaign(c, payload)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	campaign.ID = current.ID
+
+	resp, err := h.storage.Campaign().Update(c.Request.Context(), campaign)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, parseCampaignModel(resp))
+}
+
+// @Security ApiKeyAuth
+// @Router /campaigns/{id} [delete]
+// @Summary Delete a campaign
+// @Description End a campaign. Bookings it was applied to keep their discount and it stays in the reports. Superadmins and partners owning its hotel only.
+// @Tags campaign
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DeleteCampaign(c *gin.Context) {
+	campaign, _, err := h.manageableCampaign(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	err = h.storage.Campaign().Delete(c.Request.Context(), campaign.ID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{
+		Message: "Successfully deleted",
+	})
+}
+
+// @Security ApiKeyAuth
+// @Router /campaigns/{id}/report [get]
+// @Summary Get the usage of a campaign
+// @Description Get the bookings a campaign was applied to and the discounts given per currency. Superadmins and partners owning its hotel only.
+// @Tags campaign
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.CampaignReport
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetCampaignReport(c *gin.Context) {
+	campaign, _, err := h.manageableCampaign(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	redemptions, err := h.storage.Campaign().GetRedemptions(c.Request.Context(), campaign.ID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, campaignReport(campaign.ID, redemptions))
+}
+
+// manageableCampaign loads the campaign of the :id parameter if the user may
+// manage it. Campaigns for all hotels are left to superadmins.
+func (h *handlerV1) manageableCampaign(c *gin.Context) (*repo.Campaign, *utils.Payload, error) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	campaign, err := h.storage.Campaign().Get(c.Request.Context(), id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if campaign.HotelID == nil {
+		if payload.UserType != repo.UserTypeSuperadmin {
+			return nil, nil, ErrForbidden
+		}
+		return campaign, payload, nil
+	}
+
+	err = h.canManageHotel(c.Request.Context(), payload, *campaign.HotelID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return campaign, payload, nil
+}
+
+// bindCampaign reads a campaign, checks the fields that depend on its type
+// and that the user may run it for its hotel.
+func (h *handlerV1) bindCampaign(c *gin.Context, payload *utils.Payload) (*repo.Campaign, error) {
+	var req models.CreateCampaignRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	campaign := &repo.Campaign{
+		Code:           normalizePromoCode(req.Code),
+		Name:           req.Name,
+		HotelID:        req.HotelID,
+		Type:           req.Type,
+		ValidFrom:      req.ValidFrom,
+		ValidUntil:     req.ValidUntil,
+		MinNights:      req.MinNights,
+		MaxUses:        req.MaxUses,
+		MaxUsesPerUser: req.MaxUsesPerUser,
+		Stackable:      req.Stackable,
+	}
+
+	var fields []errs.FieldError
+	campaign.Percent, fields = checkAmount(req.Type, req.Percent, req.Amount, req.Currency)
+
+	if req.Type == repo.CampaignTypeFixed {
+		campaign.Amount = req.Amount
+		campaign.Currency = req.Currency
+	}
+
+	if campaign.Code != "" && !promoCodePattern.MatchString(campaign.Code) {
+		fields = append(fields, errs.Field("code", "must only contain letters, digits, dashes and underscores"))
+	}
+
+	if req.ValidFrom != nil && req.ValidUntil != nil && !req.ValidUntil.After(*req.ValidFrom) {
+		fields = append(fields, errs.Field("valid_until", "must be after valid_from"))
+	}
+
+	if campaign.HotelID == nil && payload.UserType != repo.UserTypeSuperadmin {
+		fields = append(fields, errs.Field("hotel_id", "is required"))
+	}
+
+	if len(fields) > 0 {
+		return nil, errs.Validation(fields...)
+	}
+
+	if campaign.HotelID == nil {
+		return campaign, nil
+	}
+
+	err = h.checkReferences(c.Request.Context(), reference{"hotel_id", repo.AuditEntityHotel, *campaign.HotelID})
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.canManageHotel(c.Request.Context(), payload, *campaign.HotelID)
+	if err != nil {
+		return nil, err
+	}
+
+	return campaign, nil
+}
+
+func normalizePromoCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// bookingCampaigns picks the campaigns a new booking gets, the one of the
+// promo code, if any, included.
+func (h *handlerV1) bookingCampaigns(ctx context.Context, booking *repo.Booking, code string) ([]*repo.Campaign, error) {
+	now := time.Now()
+	code = normalizePromoCode(code)
+
+	candidates, err := h.storage.Campaign().GetApplicable(ctx, &repo.GetApplicableCampaignsParams{
+		HotelID: int64(booking.HotelId),
+		UserID:  int64(booking.UserId),
+		At:      now,
+		Code:    code,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	currencies := make([]string, 0, len(candidates))
+	for _, campaign := range candidates {
+		currencies = append(currencies, campaign.Currency)
+	}
+
+	rates, err := h.ratesFor(ctx, booking.Currency, currencies...)
+	if err != nil {
+		return nil, err
+	}
+
+	return applicableCampaigns(candidates, booking, code, now, rates)
+}
+
+// redeemedCampaigns loads the campaigns a booking was given when it was made.
+// Changes never add campaigns, but those that stop fitting the booking are
+// dropped.
+func (h *handlerV1) redeemedCampaigns(ctx context.Context, current, booking *repo.Booking) ([]*repo.Campaign, error) {
+	var ids []int64
+	for _, charge := range current.Charges {
+		if charge.CampaignID != 0 {
+			ids = append(ids, charge.CampaignID)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	list, err := h.storage.Campaign().GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*repo.Campaign, 0, len(list))
+	for _, campaign := range list {
+		if fitsBooking(campaign, booking) == "" {
+			result = append(result, campaign)
+		}
+	}
+
+	return result, nil
+}
+
+// applicableCampaigns applies the campaign of the code on its own, or with
+// the automatic stackable ones if it is stackable itself. Without a code the
+// booking gets whichever is worth more: all stackable campaigns together or
+// the best one that does not stack.
+func applicableCampaigns(candidates []*repo.Campaign, booking *repo.Booking, code string, now time.Time, rates *money.Rates) ([]*repo.Campaign, error) {
+	var (
+		coded     *repo.Campaign
+		stackable []*repo.Campaign
+		single    []*repo.Campaign
+	)
+
+	for _, campaign := range candidates {
+		switch {
+		case campaign.Code != "":
+			if campaign.Code == code {
+				coded = campaign
+			}
+		case campaignReason(campaign, booking, now) != "":
+		case campaign.Stackable:
+			stackable = append(stackable, campaign)
+		default:
+			single = append(single, campaign)
+		}
+	}
+
+	if code != "" {
+		if coded == nil {
+			return nil, errs.Validation(errs.Field("promo_code", "is not valid"))
+		}
+
+		if reason := campaignReason(coded, booking, now); reason != "" {
+			return nil, errs.Validation(errs.Field("promo_code", reason))
+		}
+
+		if !coded.Stackable {
+			return []*repo.Campaign{coded}, nil
+		}
+		return append([]*repo.Campaign{coded}, stackable...), nil
+	}
+
+	best, bestDiscount := stackable, int64(0)
+	for _, campaign := range stackable {
+		discount, err := campaignDiscount(campaign, booking, rates)
+		if err != nil {
+			return nil, err
+		}
+		bestDiscount += discount
+	}
+
+	for _, campaign := range single {
+		discount, err := campaignDiscount(campaign, booking, rates)
+		if err != nil {
+			return nil, err
+		}
+
+		if discount > bestDiscount {
+			best, bestDiscount = []*repo.Campaign{campaign}, discount
+		}
+	}
+
+	return best, nil
+}
+
+// campaignReason tells why a campaign does not apply to a booking made at
+// now, or returns an empty string if it does.
+func campaignReason(campaign *repo.Campaign, booking *repo.Booking, now time.Time) string {
+	switch {
+	case campaign.ValidFrom != nil && now.Before(*campaign.ValidFrom):
+		return "is not valid yet"
+	case campaign.ValidUntil != nil && !now.Before(*campaign.ValidUntil):
+		return "has expired"
+	case campaign.MaxUses > 0 && campaign.Uses >= campaign.MaxUses:
+		return "has been used up"
+	case campaign.MaxUsesPerUser > 0 && campaign.UserUses >= campaign.MaxUsesPerUser:
+		return "has already been used as often as allowed"
+	}
+
+	return fitsBooking(campaign, booking)
+}
+
+// fitsBooking checks the hotel and length of stay, which also decide whether
+// a booking keeps its campaigns when it is changed.
+func fitsBooking(campaign *repo.Campaign, booking *repo.Booking) string {
+	if campaign.HotelID != nil && *campaign.HotelID != int64(booking.HotelId) {
+		return "is not valid for this hotel"
+	}
+
+	if campaign.MinNights > 0 && stayNights(booking) < campaign.MinNights {
+		return fmt.Sprintf("needs a stay of at least %d nights", campaign.MinNights)
+	}
+
+	return ""
+}
+
+// campaignDiscount is the discount a campaign gives on the price of the
+// booking, in its currency.
+func campaignDiscount(campaign *repo.Campaign, booking *repo.Booking, rates *money.Rates) (int64, error) {
+	if campaign.Type == repo.CampaignTypeFixed {
+		return convertAmount(campaign.Name, campaign.Amount, campaign.Currency, booking.Currency, rates)
+	}
+
+	percent, err := money.ParseRate(campaign.Percent)
+	if err != nil {
+		return 0, fmt.Errorf("campaign %d: %w", campaign.ID, err)
+	}
+
+	share := percent.Quo(percent, big.NewRat(100, 1))
+	return money.Round(share.Mul(share, new(big.Rat).SetInt64(booking.Price))), nil
+}
+
+// campaignLabel names the discount on the booking and its invoices.
+func campaignLabel(campaign *repo.Campaign) string {
+	if campaign.Code == "" {
+		return campaign.Name
+	}
+	return fmt.Sprintf("%s (%s)", campaign.Name, campaign.Code)
+}
+
+func campaignReport(campaignID int64, redemptions []*repo.Redemption) *models.CampaignReport {
+	report := models.CampaignReport{
+		CampaignID:  campaignID,
+		Discounts:   make([]*models.CurrencyAmount, 0),
+		Redemptions: make([]*models.Redemption, 0, len(redemptions)),
+	}
+
+	guests := map[int64]bool{}
+	discounts := map[string]int64{}
+
+	for _, r := range redemptions {
+		report.Redemptions = append(report.Redemptions, &models.Redemption{
+			ID:        r.ID,
+			BookingID: r.BookingID,
+			UserID:    r.UserID,
+			Amount:    r.Amount,
+			Currency:  r.Currency,
+			Cancelled: r.Cancelled,
+			CreatedAt: r.CreatedAt,
+		})
+
+		if r.Cancelled {
+			report.Cancelled++
+			continue
+		}
+
+		report.Uses++
+		guests[r.UserID] = true
+		discounts[r.Currency] += r.Amount
+	}
+
+	report.Guests = len(guests)
+
+	for currency, amount := range discounts {
+		report.Discounts = append(report.Discounts, &models.CurrencyAmount{
+			Currency: currency,
+			Amount:   amount,
+		})
+	}
+	sort.Slice(report.Discounts, func(i, j int) bool {
+		return report.Discounts[i].Currency < report.Discounts[j].Currency
+	})
+
+	return &report
+}
+
+func parseCampaignModel(campaign *repo.Campaign) models.Campaign {
+	return models.Campaign{
+		ID:             campaign.ID,
+		Code:           campaign.Code,
+		Name:           campaign.Name,
+		HotelID:        campaign.HotelID,
+		CreatedBy:      campaign.CreatedBy,
+		Type:           campaign.Type,
+		Percent:        campaign.Percent,
+		Amount:         campaign.Amount,
+		Currency:       campaign.Currency,
+		ValidFrom:      campaign.ValidFrom,
+		ValidUntil:     campaign.ValidUntil,
+		MinNights:      campaign.MinNights,
+		MaxUses:        campaign.MaxUses,
+		MaxUsesPerUser: campaign.MaxUsesPerUser,
+		Stackable:      campaign.Stackable,
+		CreatedAt:      campaign.CreatedAt,
+		UpdatedAt:      campaign.UpdatedAt,
+	}
+}
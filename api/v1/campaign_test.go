@@ -0,0 +1,150 @@
+package v1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/money"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplicableCampaigns(t *testing.T) {
+	now := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	hotelID := int64(7)
+
+	// two nights at hotel 7 for 200.00
+	booking := &repo.Booking{HotelId: 7, FromDate: "2022-07-10", ToDate: "2022-07-12", Price: 20000, Currency: "USD"}
+
+	tenPercent := &repo.Campaign{ID: 1, Name: "Summer", Type: repo.CampaignTypePercent, Percent: "10", Stackable: true}
+	fiveOff := &repo.Campaign{ID: 2, Name: "Loyalty", Type: repo.CampaignTypeFixed, Amount: 500, Currency: "USD", Stackable: true}
+	bigSingle := &repo.Campaign{ID: 3, Name: "Flash", HotelID: &hotelID, Type: repo.CampaignTypePercent, Percent: "20"}
+	coded := &repo.Campaign{ID: 4, Code: "WELCOME", Name: "Welcome", Type: repo.CampaignTypeFixed, Amount: 1000, Currency: "USD"}
+	stackableCode := &repo.Campaign{ID: 5, Code: "FRIENDS", Name: "Friends", Type: repo.CampaignTypePercent, Percent: "5", Stackable: true}
+
+	candidates := []*repo.Campaign{tenPercent, fiveOff, bigSingle, coded, stackableCode}
+
+	// 20% beats 10% and 5.00 together
+	result, err := applicableCampaigns(candidates, booking, "", now, nil)
+	require.NoError(t, err)
+	require.Equal(t, []*repo.Campaign{bigSingle}, result)
+
+	// a code that does not stack is applied alone
+	result, err = applicableCampaigns(candidates, booking, "WELCOME", now, nil)
+	require.NoError(t, err)
+	require.Equal(t, []*repo.Campaign{coded}, result)
+
+	// a stackable code takes the stackable campaigns along
+	result, err = applicableCampaigns(candidates, booking, "FRIENDS", now, nil)
+	require.NoError(t, err)
+	require.Equal(t, []*repo.Campaign{stackableCode, tenPercent, fiveOff}, result)
+
+	_, err = applicableCampaigns(candidates, booking, "NOPE", now, nil)
+	require.Equal(t, "is not valid", translateError(err).Fields[0].Message)
+}
+
+func TestApplicableCampaignsStacked(t *testing.T) {
+	now := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	booking := &repo.Booking{HotelId: 7, FromDate: "2022-07-10", ToDate: "2022-07-12", Price: 20000, Currency: "USD"}
+
+	stacked := []*repo.Campaign{
+		{ID: 1, Name: "Summer", Type: repo.CampaignTypePercent, Percent: "10", Stackable: true},
+		{ID: 2, Name: "Loyalty", Type: repo.CampaignTypeFixed, Amount: 500, Currency: "USD", Stackable: true},
+	}
+	single := &repo.Campaign{ID: 3, Name: "Flash", Type: repo.CampaignTypePercent, Percent: "12"}
+
+	result, err := applicableCampaigns(append(stacked, single), booking, "", now, nil)
+	require.NoError(t, err)
+	require.Equal(t, stacked, result)
+}
+
+func TestCampaignReason(t *testing.T) {
+	now := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	later, earlier := now.Add(time.Hour), now.Add(-time.Hour)
+	otherHotel := int64(8)
+
+	booking := &repo.Booking{HotelId: 7, FromDate: "2022-07-10", ToDate: "2022-07-12"}
+
+	tests := []struct {
+		campaign repo.Campaign
+		reason   string
+	}{
+		{repo.Campaign{}, ""},
+		{repo.Campaign{ValidFrom: &earlier, ValidUntil: &later}, ""},
+		{repo.Campaign{HotelID: &otherHotel}, "is not valid for this hotel"},
+		{repo.Campaign{ValidFrom: &later}, "is not valid yet"},
+		{repo.Campaign{ValidUntil: &now}, "has expired"},
+		{repo.Campaign{MinNights: 3}, "needs a stay of at least 3 nights"},
+		{repo.Campaign{MaxUses: 10, Uses: 10}, "has been used up"},
+		{repo.Campaign{MaxUsesPerUser: 1, Uses: 3, UserUses: 1}, "has already been used as often as allowed"},
+		{repo.Campaign{MaxUses: 10, Uses: 9, MaxUsesPerUser: 2, UserUses: 1}, ""},
+	}
+
+	for _, tt := range tests {
+		require.Equal(t, tt.reason, campaignReason(&tt.campaign, booking, now))
+	}
+
+	coded := &repo.Campaign{Code: "LATE", ValidUntil: &earlier}
+	_, err := applicableCampaigns([]*repo.Campaign{coded}, booking, "LATE", now, nil)
+	require.Equal(t, "has expired", translateError(err).Fields[0].Message)
+}
+
+func TestBookingChargesWithDiscounts(t *testing.T) {
+	rates, err := money.NewRates("USD", map[string]string{"EUR": "0.5"})
+	require.NoError(t, err)
+
+	booking := &repo.Booking{FromDate: "2022-07-10", ToDate: "2022-07-12", Price: 20000, Currency: "USD"}
+
+	campaigns := []*repo.Campaign{
+		{ID: 1, Code: "SUMMER", Name: "Summer", Type: repo.CampaignTypePercent, Percent: "10"},
+		// 5 EUR is 10 USD
+		{ID: 2, Name: "Loyalty", Type: repo.CampaignTypeFixed, Amount: 500, Currency: "EUR"},
+	}
+	rules := []*repo.TaxRule{
+		{ID: 1, Name: "Service", Kind: repo.TaxRuleKindFee, Type: repo.TaxRuleTypePercent, Basis: repo.TaxRuleBasisStay, Percent: "10"},
+	}
+
+	charges, total, err := bookingCharges(booking, campaigns, rules, rates)
+	require.NoError(t, err)
+	require.Len(t, charges, 3)
+
+	require.Equal(t, "Summer (SUMMER)", charges[0].Name)
+	require.Equal(t, repo.ChargeKindDiscount, charges[0].Kind)
+	require.Equal(t, int64(1), charges[0].CampaignID)
+	require.Equal(t, int64(-2000), charges[0].Amount)
+	require.Equal(t, int64(-1000), charges[1].Amount)
+
+	// the fee is charged on the discounted price
+	require.Equal(t, int64(1700), charges[2].Amount)
+	require.Equal(t, int64(17000+1700), total)
+}
+
+func TestBookingChargesDiscountCapped(t *testing.T) {
+	booking := &repo.Booking{FromDate: "2022-07-10", ToDate: "2022-07-12", Price: 800, Currency: "USD"}
+
+	charges, total, err := bookingCharges(booking, []*repo.Campaign{
+		{ID: 1, Name: "Voucher", Type: repo.CampaignTypeFixed, Amount: 1000, Currency: "USD"},
+	}, nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(-800), charges[0].Amount)
+	require.Equal(t, int64(0), total)
+}
+
+func TestCampaignReport(t *testing.T) {
+	report := campaignReport(1, []*repo.Redemption{
+		{ID: 1, BookingID: 1, UserID: 10, Amount: 2000, Currency: "USD"},
+		{ID: 2, BookingID: 2, UserID: 10, Amount: 1500, Currency: "USD"},
+		{ID: 3, BookingID: 3, UserID: 11, Amount: 300000, Currency: "UZS"},
+		{ID: 4, BookingID: 4, UserID: 12, Amount: 1000, Currency: "EUR", Cancelled: true},
+	})
+
+	require.Equal(t, 3, report.Uses)
+	require.Equal(t, 2, report.Guests)
+	require.Equal(t, 1, report.Cancelled)
+	require.Len(t, report.Redemptions, 4)
+
+	require.Len(t, report.Discounts, 2)
+	require.Equal(t, "USD", report.Discounts[0].Currency)
+	require.Equal(t, int64(3500), report.Discounts[0].Amount)
+	require.Equal(t, "UZS", report.Discounts[1].Currency)
+}
@@ -0,0 +1,695 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/money"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+// @Security ApiKeyAuth
+// @Router /users/{id}/commission-rate [get]
+// @Summary Get the commission rate of a partner
+// @Description Get the percentage of the booking total taken as commission, the default when the partner has no rate of their own. Superadmin or the partner.
+// @Tags commission
+// @Accept json
+// @Produce json
+// @Param id path int true "Partner ID"
+// @Success 200 {object} models.CommissionRate
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetCommissionRate(c *gin.Context) {
+	partnerID, err := h.partnerParam(c, false)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.Commission().GetRate(c.Request.Context(), partnerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusOK, models.CommissionRate{
+			PartnerID: partnerID,
+			Rate:      h.defaultCommissionRate(),
+			Default:   true,
+		})
+		return
+	}
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, parseCommissionRateModel(resp))
+}
+
+// @Security ApiKeyAuth
+// @Router /users/{id}/commission-rate [put]
+// @Summary Set the commission rate of a partner
+// @Description Create or replace the commission rate of a partner in percent. Bookings keep the rate they were made with. Superadmin only.
+// @Tags commission
+// @Accept json
+// @Produce json
+// @Param id path int true "Partner ID"
+// @Param rate body models.SetCommissionRateRequest true "Rate"
+// @Success 200 {object} models.CommissionRate
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) SetCommissionRate(c *gin.Context) {
+	partnerID, err := h.partnerParam(c, true)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var req models.SetCommissionRateRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	rate, err := money.ParsePercent(req.Rate)
+	if err != nil {
+		handleError(c, errs.Validation(errs.Field("rate", err.Error())))
+		return
+	}
+
+	resp, err := h.storage.Commission().SetRate(c.Request.Context(), &repo.CommissionRate{
+		PartnerID: partnerID,
+		Rate:      money.FormatRate(rate),
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, parseCommissionRateModel(resp))
+}
+
+// @Security ApiKeyAuth
+// @Router /users/{id}/commission-rate [delete]
+// @Summary Delete the commission rate of a partner
+// @Description Delete the rate of a partner, new bookings use the default rate. Superadmin only.
+// @Tags commission
+// @Accept json
+// @Produce json
+// @Param id path int true "Partner ID"
+// @Success 200 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DeleteCommissionRate(c *gin.Context) {
+	partnerID, err := h.partnerParam(c, true)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	err = h.storage.Commission().DeleteRate(c.Request.Context(), partnerID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{
+		Message: "Successfully deleted",
+	})
+}
+
+// @Security ApiKeyAuth
+// @Router /commissions [get]
+// @Summary Get commission ledger entries
+// @Description Get the commission earned, refunded and adjusted per booking. Partners only see their own entries.
+// @Tags commission
+// @Accept json
+// @Produce json
+// @Param limit query int false "Limit"
+// @Param page query int false "Page"
+// @Param partner_id query int false "Partner ID"
+// @Param booking_id query int false "Booking ID"
+// @Param payout_id query int false "Payout ID"
+// @Param unpaid query bool false "Only entries not on a payout yet"
+// @Success 200 {object} models.GetAllCommissionEntriesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetAllCommissionEntries(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	req, _, err := validateGetAllParams(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	params := repo.GetCommissionEntriesParams{
+		Limit: req.Limit,
+		Page:  req.Page,
+	}
+
+	params.PartnerID, err = h.partnerFilter(c, payload.UserType, payload.UserID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	params.BookingID, err = queryInt64(c, "booking_id")
+	if err != nil {
+		handleError(c, errs.Validation(errs.Field("booking_id", "must be an integer")))
+		return
+	}
+
+	params.PayoutID, err = queryInt64(c, "payout_id")
+	if err != nil {
+		handleError(c, errs.Validation(errs.Field("payout_id", "must be an integer")))
+		return
+	}
+
+	if c.Query("unpaid") != "" {
+		params.Unpaid, err = strconv.ParseBool(c.Query("unpaid"))
+		if err != nil {
+			handleError(c, errs.Validation(errs.Field("unpaid", "must be a boolean")))
+			return
+		}
+	}
+
+	result, err := h.storage.Commission().GetEntries(c.Request.Context(), &params)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.GetAllCommissionEntriesResponse{
+		Entries: parseCommissionEntries(result),
+	})
+}
+
+// @Security ApiKeyAuth
+// @Router /commissions/adjustments [post]
+// @Summary Adjust the commission on a booking
+// @Description Record a correction of the commission on a confirmed booking in minor units of its currency. Negative amounts credit the partner. Superadmin only.
+// @Tags commission
+// @Accept json
+// @Produce json
+// @Param adjustment body models.CreateCommissionAdjustmentRequest true "Adjustment"
+// @Success 201 {object} models.CommissionEntry
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) CreateCommissionAdjustment(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	var req models.CreateCommissionAdjustmentRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	if _, err := h.storage.Booking().Get(ctx, req.BookingID); err != nil {
+		handleError(c, err)
+		return
+	}
+
+	createdBy := payload.UserID
+	resp, err := h.storage.Commission().Adjust(ctx, &repo.CommissionEntry{
+		BookingID: req.BookingID,
+		Amount:    req.Amount,
+		Note:      req.Note,
+		CreatedBy: &createdBy,
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, parseCommissionEntryModel(resp))
+}
+
+// @Security ApiKeyAuth
+// @Router /payouts [post]
+// @Summary Create payout statements
+// @Description Put the commission entries made before until that are not paid out yet on one pending payout per partner and currency. Superadmin only.
+// @Tags payout
+// @Accept json
+// @Produce json
+// @Param period body models.CreatePayoutsRequest true "Period"
+// @Success 201 {object} models.GetAllPayoutsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) CreatePayouts(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	var req models.CreatePayoutsRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	until := time.Now()
+	if req.Until != nil {
+		if req.Until.After(until) {
+			handleError(c, errs.Validation(errs.Field("until", "must not be in the future")))
+			return
+		}
+		until = *req.Until
+	}
+
+	result, err := h.storage.Commission().CreatePayouts(c.Request.Context(), until, payload.UserID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.GetAllPayoutsResponse{
+		Payouts: parsePayouts(result),
+	})
+}
+
+// @Security ApiKeyAuth
+// @Router /payouts [get]
+// @Summary Get payouts
+// @Description Get payout statements. Partners only see their own.
+// @Tags payout
+// @Accept json
+// @Produce json
+// @Param partner_id query int false "Partner ID"
+// @Param status query string false "pending or settled"
+// @Success 200 {object} models.GetAllPayoutsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetAllPayouts(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	params := repo.GetAllPayoutsParams{
+		Status: c.Query("status"),
+	}
+
+	switch params.Status {
+	case "", repo.PayoutStatusPending, repo.PayoutStatusSettled:
+	default:
+		handleError(c, errs.Validation(errs.Field("status", "must be one of: pending settled")))
+		return
+	}
+
+	params.PartnerID, err = h.partnerFilter(c, payload.UserType, payload.UserID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	result, err := h.storage.Commission().GetAllPayouts(c.Request.Context(), &params)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.GetAllPayoutsResponse{
+		Payouts: parsePayouts(result),
+	})
+}
+
+// @Security ApiKeyAuth
+// @Router /payouts/{id} [get]
+// @Summary Get a payout statement
+// @Description Get a payout with its ledger entries and the commission broken down by kind. Superadmin or the partner.
+// @Tags payout
+// @Accept json
+// @Produce json
+// @Param id path int true "Payout ID"
+// @Success 200 {object} models.PayoutStatement
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetPayout(c *gin.Context) {
+	payout, entries, err := h.accessiblePayout(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, payoutStatement(payout, entries))
+}
+
+// @Security ApiKeyAuth
+// @Router /payouts/{id}/csv [get]
+// @Summary Download a payout statement
+// @Description Download the ledger entries of a payout as CSV, amounts in major units. Superadmin or the partner.
+// @Tags payout
+// @Produce text/csv
+// @Param id path int true "Payout ID"
+// @Success 200 {file} binary
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DownloadPayoutCSV(c *gin.Context) {
+	payout, entries, err := h.accessiblePayout(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="payout-%d.csv"`, payout.ID))
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+
+	err = writePayoutCSV(c.Writer, payout, entries)
+	if err != nil {
+		_ = c.Error(err)
+	}
+}
+
+// @Security ApiKeyAuth
+// @Router /payouts/{id}/settle [post]
+// @Summary Settle a payout
+// @Description Mark a pending payout as paid to the partner, with the reference of the transfer. Superadmin only.
+// @Tags payout
+// @Accept json
+// @Produce json
+// @Param id path int true "Payout ID"
+// @Param settlement body models.SettlePayoutRequest true "Settlement"
+// @Success 200 {object} models.Payout
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) SettlePayout(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var req models.SettlePayoutRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.Commission().SettlePayout(c.Request.Context(), id, payload.UserID, req.Reference)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, parsePayoutModel(resp))
+}
+
+// partnerParam returns the partner from the path. Superadmins may read and
+// change any rate, partners only read their own.
+func (h *handlerV1) partnerParam(c *gin.Context, change bool) (int64, error) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		return 0, err
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin && (change || payload.UserID != id) {
+		return 0, ErrForbidden
+	}
+
+	user, err := h.storage.User().Get(c.Request.Context(), id)
+	if err != nil {
+		return 0, err
+	}
+
+	if user.Type != repo.UserTypePartner {
+		return 0, errs.Validation(errs.Field("id", "must be a partner"))
+	}
+
+	return id, nil
+}
+
+// partnerFilter reads ?partner_id= for superadmins and pins partners to
+// their own ledger.
+func (h *handlerV1) partnerFilter(c *gin.Context, userType string, userID int64) (int64, error) {
+	switch userType {
+	case repo.UserTypeSuperadmin:
+		partnerID, err := queryInt64(c, "partner_id")
+		if err != nil {
+			return 0, errs.Validation(errs.Field("partner_id", "must be an integer"))
+		}
+		return partnerID, nil
+	case repo.UserTypePartner:
+		return userID, nil
+	}
+
+	return 0, ErrForbidden
+}
+
+// accessiblePayout loads the payout from the path with its entries, if the
+// caller is a superadmin or the partner it is paid to.
+func (h *handlerV1) accessiblePayout(c *gin.Context) (*repo.Payout, []*repo.CommissionEntry, error) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx := c.Request.Context()
+	payout, err := h.storage.Commission().GetPayout(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin && payload.UserID != payout.PartnerID {
+		return nil, nil, ErrForbidden
+	}
+
+	entries, err := h.storage.Commission().GetEntries(ctx, &repo.GetCommissionEntriesParams{
+		PayoutID: payout.ID,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return payout, entries, nil
+}
+
+// commissionRate is the rate a new booking at the hotel is locked to: its
+// partner's rate, or the default when they have none.
+func (h *handlerV1) commissionRate(ctx context.Context, hotelID int64) (string, error) {
+	hotel, err := h.storage.Hotel().Get(ctx, hotelID)
+	if err != nil {
+		return "", err
+	}
+
+	rate, err := h.storage.Commission().GetRate(ctx, hotel.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return h.defaultCommissionRate(), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return rate.Rate, nil
+}
+
+// defaultCommissionRate is the configured default, validated at startup.
+func (h *handlerV1) defaultCommissionRate() string {
+	return normalizePercent(h.cfg.Commission.DefaultRate)
+}
+
+// normalizePercent is normalizeRate for rates that may be 0.
+func normalizePercent(s string) string {
+	rate, err := money.ParsePercent(s)
+	if err != nil {
+		return s
+	}
+	return money.FormatRate(rate)
+}
+
+// writePayoutCSV writes one row per ledger entry of the payout followed by
+// the totals, amounts in major units of the payout currency.
+func writePayoutCSV(w io.Writer, payout *repo.Payout, entries []*repo.CommissionEntry) error {
+	out := csv.NewWriter(w)
+
+	_ = out.Write([]string{"entry_id", "created_at", "booking_id", "hotel_id", "kind", "rate", "base", "commission", "currency", "note"})
+	for _, e := range entries {
+		_ = out.Write([]string{
+			strconv.FormatInt(e.ID, 10),
+			e.CreatedAt.UTC().Format(time.RFC3339),
+			strconv.FormatInt(e.BookingID, 10),
+			strconv.FormatInt(e.HotelID, 10),
+			e.Kind,
+			normalizePercent(e.Rate),
+			money.Format(e.Base, e.Currency),
+			money.Format(e.Amount, e.Currency),
+			e.Currency,
+			e.Note,
+		})
+	}
+
+	_ = out.Write([]string{"", "", "", "", "total", "", money.Format(payout.Gross, payout.Currency), money.Format(payout.Commission, payout.Currency), payout.Currency, ""})
+	_ = out.Write([]string{"", "", "", "", "payout", "", money.Format(payout.Amount, payout.Currency), "", payout.Currency, ""})
+
+	out.Flush()
+	return out.Error()
+}
+
+func payoutStatement(payout *repo.Payout, entries []*repo.CommissionEntry) *models.PayoutStatement {
+	statement := models.PayoutStatement{
+		Payout:  *parsePayoutModel(payout),
+		Entries: parseCommissionEntries(entries),
+	}
+
+	for _, e := range entries {
+		switch e.Kind {
+		case repo.CommissionKindEarned:
+			statement.Earned += e.Amount
+		case repo.CommissionKindRefunded:
+			statement.Refunded += e.Amount
+		case repo.CommissionKindAdjusted:
+			statement.Adjusted += e.Amount
+		}
+	}
+
+	return &statement
+}
+
+func parseCommissionRateModel(rate *repo.CommissionRate) *models.CommissionRate {
+	return &models.CommissionRate{
+		PartnerID: rate.PartnerID,
+		Rate:      normalizePercent(rate.Rate),
+		UpdatedAt: &rate.UpdatedAt,
+	}
+}
+
+func parseCommissionEntries(entries []*repo.CommissionEntry) []*models.CommissionEntry {
+	result := make([]*models.CommissionEntry, 0, len(entries))
+	for _, e := range entries {
+		result = append(result, parseCommissionEntryModel(e))
+	}
+
+	return result
+}
+
+func parseCommissionEntryModel(entry *repo.CommissionEntry) *models.CommissionEntry {
+	return &models.CommissionEntry{
+		ID:        entry.ID,
+		PartnerID: entry.PartnerID,
+		HotelID:   entry.HotelID,
+		BookingID: entry.BookingID,
+		RefundID:  entry.RefundID,
+		Kind:      entry.Kind,
+		Rate:      normalizePercent(entry.Rate),
+		Base:      entry.Base,
+		Amount:    entry.Amount,
+		Currency:  entry.Currency,
+		Note:      entry.Note,
+		CreatedBy: entry.CreatedBy,
+		PayoutID:  entry.PayoutID,
+		CreatedAt: entry.CreatedAt,
+	}
+}
+
+func parsePayouts(payouts []*repo.Payout) []*models.Payout {
+	result := make([]*models.Payout, 0, len(payouts))
+	for _, p := range payouts {
+		result = append(result, parsePayoutModel(p))
+	}
+
+	return result
+}
+
+func parsePayoutModel(payout *repo.Payout) *models.Payout {
+	return &models.Payout{
+		ID:          payout.ID,
+		PartnerID:   payout.PartnerID,
+		Currency:    payout.Currency,
+		PeriodFrom:  payout.PeriodFrom,
+		PeriodUntil: payout.PeriodUntil,
+		Gross:       payout.Gross,
+		Commission:  payout.Commission,
+		Amount:      payout.Amount,
+		Status:      payout.Status,
+		Reference:   payout.Reference,
+		CreatedBy:   payout.CreatedBy,
+		SettledBy:   payout.SettledBy,
+		SettledAt:   payout.SettledAt,
+		CreatedAt:   payout.CreatedAt,
+	}
+}
@@ -0,0 +1,53 @@
+package v1
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWritePayoutCSV(t *testing.T) {
+	at := time.Date(2022, 10, 3, 12, 0, 0, 0, time.UTC)
+	payout := &repo.Payout{ID: 7, Currency: "EUR", Gross: 22500, Commission: 2000, Amount: 20500}
+	entries := []*repo.CommissionEntry{
+		{ID: 1, BookingID: 10, HotelID: 3, Kind: repo.CommissionKindEarned, Rate: "10.0000", Base: 12500, Amount: 1250, Currency: "EUR", CreatedAt: at},
+		{ID: 2, BookingID: 11, HotelID: 3, Kind: repo.CommissionKindEarned, Rate: "10.0000", Base: 10000, Amount: 1000, Currency: "EUR", CreatedAt: at},
+		{ID: 3, BookingID: 10, HotelID: 3, Kind: repo.CommissionKindAdjusted, Rate: "10.0000", Amount: -250, Currency: "EUR", Note: "Goodwill, late check-in", CreatedAt: at},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, writePayoutCSV(&buf, payout, entries))
+
+	want := "entry_id,created_at,booking_id,hotel_id,kind,rate,base,commission,currency,note\n" +
+		"1,2022-10-03T12:00:00Z,10,3,earned,10,125.00,12.50,EUR,\n" +
+		"2,2022-10-03T12:00:00Z,11,3,earned,10,100.00,10.00,EUR,\n" +
+		"3,2022-10-03T12:00:00Z,10,3,adjusted,10,0.00,-2.50,EUR,\"Goodwill, late check-in\"\n" +
+		",,,,total,,225.00,20.00,EUR,\n" +
+		",,,,payout,,205.00,,EUR,\n"
+	require.Equal(t, want, buf.String())
+}
+
+func TestPayoutStatement(t *testing.T) {
+	statement := payoutStatement(&repo.Payout{ID: 7, Commission: 900}, []*repo.CommissionEntry{
+		{Kind: repo.CommissionKindEarned, Amount: 1250},
+		{Kind: repo.CommissionKindEarned, Amount: 1000},
+		{Kind: repo.CommissionKindRefunded, Amount: -600},
+		{Kind: repo.CommissionKindAdjusted, Amount: -750},
+	})
+
+	require.Equal(t, int64(2250), statement.Earned)
+	require.Equal(t, int64(-600), statement.Refunded)
+	require.Equal(t, int64(-750), statement.Adjusted)
+	require.Equal(t, statement.Commission, statement.Earned+statement.Refunded+statement.Adjusted)
+	require.Len(t, statement.Entries, 4)
+}
+
+func TestNormalizePercent(t *testing.T) {
+	require.Equal(t, "12.5", normalizePercent("12.5000"))
+	require.Equal(t, "0", normalizePercent("0.0000"))
+	require.Equal(t, "100", normalizePercent("100"))
+	require.Equal(t, "abc", normalizePercent("abc"))
+}
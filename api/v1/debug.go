@@ -0,0 +1,25 @@
+package v1
+
+import (
+	"expvar"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+// DebugVars serves expvar runtime stats to superadmins. Cache hits and misses
+// are exported as booking_cache_lookups_total on /metrics.
+func (h *handlerV1) DebugVars(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	expvar.Handler().ServeHTTP(c.Writer, c.Request)
+}
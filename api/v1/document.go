@@ -0,0 +1,455 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/imaging"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/signedurl"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/utils"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	ErrUnsupportedDocument = errs.New(errs.CodeUnsupportedMediaType, "file must be a PDF, JPEG, PNG or WebP")
+	ErrLinkExpired         = errs.New(errs.CodeForbidden, "link has expired")
+)
+
+type DocumentUpload struct {
+	File      *multipart.FileHeader `form:"file" binding:"required"`
+	Kind      string                `form:"kind" binding:"required,oneof=identity contract"`
+	BookingID int64                 `form:"booking_id" binding:"required_if=Kind identity,omitempty,gt=0"`
+	HotelID   int64                 `form:"hotel_id" binding:"required_if=Kind contract,omitempty,gt=0"`
+}
+
+func documentPath(id int64) string {
+	return "/documents/" + strconv.FormatInt(id, 10)
+}
+
+// @Security ApiKeyAuth
+// @Router /documents [post]
+// @Summary Upload a private document
+// @Description Upload an ID scan for a booking (kind "identity", by its guest) or a hotel contract (kind "contract", by the partner owning the hotel). Superadmins may upload both. Documents are never public: they are served through signed links that expire.
+// @Tags document
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "PDF, JPEG, PNG or WebP file"
+// @Param kind formData string true "identity or contract"
+// @Param booking_id formData int false "Booking of an identity document"
+// @Param hotel_id formData int false "Hotel of a contract"
+// @Success 201 {object} models.Document
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) UploadDocument(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	maxSize := h.cfg.Documents.MaxSize
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+multipartOverhead)
+
+	var req DocumentUpload
+	err = c.ShouldBind(&req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	doc := repo.Document{
+		OwnerID: payload.UserID,
+		Kind:    req.Kind,
+		HotelID: req.HotelID,
+	}
+
+	err = h.authorizeDocumentUpload(c.Request.Context(), payload, &req, &doc)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	data, err := readUpload(req.File, maxSize)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	contentType, ext, data, err := inspectDocument(data)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	doc.Checksum = hex.EncodeToString(sum[:])
+	doc.ContentType = contentType
+	doc.Size = int64(len(data))
+
+	// random names, so a leaked key says nothing about the content
+	doc.FileName, err = randomKey(ext)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	err = h.documents.Put(c.Request.Context(), doc.FileName, bytes.NewReader(data), doc.Size, contentType)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	result, err := h.storage.Document().Create(c.Request.Context(), &doc)
+	if err != nil {
+		if derr := h.documents.Delete(c.Request.Context(), doc.FileName); derr != nil {
+			slog.ErrorCtx(c.Request.Context(), "failed to delete document file", derr, "key", doc.FileName)
+		}
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, h.parseDocumentModel(result))
+}
+
+// authorizeDocumentUpload checks that the booking or hotel the document is
+// for exists and that the user may attach documents to it, and fills in
+// what the document belongs to.
+func (h *handlerV1) authorizeDocumentUpload(ctx context.Context, payload *utils.Payload, req *DocumentUpload, doc *repo.Document) error {
+	superadmin := payload.UserType == repo.UserTypeSuperadmin
+
+	if req.Kind == repo.DocumentKindIdentity {
+		booking, err := h.storage.Booking().Get(ctx, req.BookingID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errs.Validation(errs.Field("booking_id", fmt.Sprintf("booking %d does not exist", req.BookingID)))
+		}
+		if err != nil {
+			return err
+		}
+
+		if !superadmin && int64(booking.UserId) != payload.UserID {
+			return ErrForbidden
+		}
+
+		doc.BookingID = &booking.ID
+		doc.HotelID = int64(booking.HotelId)
+		return nil
+	}
+
+	hotel, err := h.storage.Hotel().Get(ctx, req.HotelID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return errs.Validation(errs.Field("hotel_id", fmt.Sprintf("hotel %d does not exist", req.HotelID)))
+	}
+	if err != nil {
+		return err
+	}
+
+	if !superadmin && (payload.UserType != repo.UserTypePartner || hotel.UserID != payload.UserID) {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+// canAccess reports whether the user may see the documents and payments of
+// a hotel, and of one of its bookings if bookingID is set: superadmins, the
+// partner owning the hotel and the guest of the booking may.
+func (h *handlerV1) canAccess(ctx context.Context, payload *utils.Payload, hotelID int64, bookingID *int64) (bool, error) {
+	if payload.UserType == repo.UserTypeSuperadmin {
+		return true, nil
+	}
+
+	if bookingID != nil {
+		booking, err := h.storage.Booking().Get(ctx, *bookingID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return false, err
+		}
+		if err == nil && int64(booking.UserId) == payload.UserID {
+			return true, nil
+		}
+	}
+
+	if payload.UserType != repo.UserTypePartner {
+		return false, nil
+	}
+
+	hotel, err := h.storage.Hotel().Get(ctx, hotelID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return hotel.UserID == payload.UserID, nil
+}
+
+// inspectDocument detects the type of a document from its content. Images
+// have their metadata stripped like media uploads.
+func inspectDocument(data []byte) (contentType, ext string, out []byte, err error) {
+	if bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "application/pdf", ".pdf", data, nil
+	}
+
+	info, err := imaging.Inspect(data)
+	if errors.Is(err, imaging.ErrUnsupportedType) {
+		return "", "", nil, ErrUnsupportedDocument
+	}
+	if err != nil {
+		return "", "", nil, errs.Validation(errs.Field("file", "is not a valid image"))
+	}
+
+	data, err = imaging.StripMetadata(info, data)
+	if err != nil {
+		return "", "", nil, errs.Validation(errs.Field("file", "is not a valid image"))
+	}
+
+	return info.ContentType, info.Ext, data, nil
+}
+
+func randomKey(ext string) (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b) + ext, nil
+}
+
+// @Security ApiKeyAuth
+// @Router /documents/{id} [get]
+// @Summary Get a document
+// @Description Get a document with a freshly signed download link. Only the guest of its booking, the partner owning its hotel and superadmins may; anyone else gets 404.
+// @Tags document
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.Document
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetDocument(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	doc, err := h.storage.Document().Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	ok, err := h.canAccess(c.Request.Context(), payload, doc.HotelID, doc.BookingID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	// not 403, so ids cannot be probed
+	if !ok {
+		handleError(c, errs.NotFound("document"))
+		return
+	}
+
+	c.JSON(http.StatusOK, h.parseDocumentModel(doc))
+}
+
+// @Security ApiKeyAuth
+// @Router /bookings/{id}/documents [get]
+// @Summary Get the documents of a booking
+// @Description Get the ID scans of a booking with signed download links. Only its guest, the partner owning the hotel and superadmins may.
+// @Tags document
+// @Produce json
+// @Param id path int true "Booking ID"
+// @Success 200 {object} models.GetAllDocumentsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetBookingDocuments(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	booking, err := h.storage.Booking().Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	ok, err := h.canAccess(c.Request.Context(), payload, int64(booking.HotelId), &booking.ID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	if !ok {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	h.listDocuments(c, &repo.GetAllDocumentsParams{BookingID: &booking.ID})
+}
+
+// @Security ApiKeyAuth
+// @Router /hotels/{id}/documents [get]
+// @Summary Get the documents of a hotel
+// @Description Get the contracts of a hotel and the ID scans of its bookings with signed download links. Only the partner owning the hotel and superadmins may.
+// @Tags document
+// @Produce json
+// @Param id path int true "Hotel ID"
+// @Param kind query string false "identity or contract"
+// @Success 200 {object} models.GetAllDocumentsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetHotelDocuments(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	kind := c.Query("kind")
+	if kind != "" && kind != repo.DocumentKindIdentity && kind != repo.DocumentKindContract {
+		handleError(c, errs.Validation(errs.Field("kind", "must be identity or contract")))
+		return
+	}
+
+	hotel, err := h.storage.Hotel().Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	ok, err := h.canAccess(c.Request.Context(), payload, hotel.ID, nil)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	if !ok {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	h.listDocuments(c, &repo.GetAllDocumentsParams{HotelID: &hotel.ID, Kind: kind})
+}
+
+func (h *handlerV1) listDocuments(c *gin.Context, params *repo.GetAllDocumentsParams) {
+	docs, err := h.storage.Document().GetAll(c.Request.Context(), params)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response := models.GetAllDocumentsResponse{
+		Documents: make([]*models.Document, 0, len(docs)),
+	}
+	for _, doc := range docs {
+		d := h.parseDocumentModel(doc)
+		response.Documents = append(response.Documents, &d)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func (h *handlerV1) parseDocumentModel(doc *repo.Document) models.Document {
+	expires := time.Now().Add(h.cfg.Documents.URLExpiry).Truncate(time.Second)
+
+	return models.Document{
+		ID:           doc.ID,
+		Kind:         doc.Kind,
+		HotelID:      doc.HotelID,
+		BookingID:    doc.BookingID,
+		ContentType:  doc.ContentType,
+		Size:         doc.Size,
+		URL:          h.signer.Sign(documentPath(doc.ID), expires),
+		URLExpiresAt: expires,
+		CreatedAt:    doc.CreatedAt,
+	}
+}
+
+// ServeDocument streams a document to whoever holds a link signed by the
+// API. The link is the authorization, so it is short lived and the response
+// must not be cached.
+func (h *handlerV1) ServeDocument(c *gin.Context) {
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, errs.NotFound("document"))
+		return
+	}
+
+	err = h.signer.Verify(documentPath(id), c.Request.URL.Query())
+	if errors.Is(err, signedurl.ErrExpired) {
+		handleError(c, ErrLinkExpired)
+		return
+	}
+	if err != nil {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	doc, err := h.storage.Document().Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	obj, err := h.documents.Get(c.Request.Context(), doc.FileName)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	defer obj.Close()
+
+	c.DataFromReader(http.StatusOK, obj.Size, doc.ContentType, obj, map[string]string{
+		"Cache-Control":          "private, no-store",
+		"Content-Disposition":    fmt.Sprintf(`attachment; filename="document-%d%s"`, doc.ID, path.Ext(doc.FileName)),
+		"Referrer-Policy":        "no-referrer",
+		"X-Content-Type-Options": "nosniff",
+	})
+}
@@ -0,0 +1,52 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/signedurl"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeDocumentRequiresSignature(t *testing.T) {
+	signer := signedurl.New([]byte("secret"))
+	h := &handlerV1{signer: signer}
+
+	router := gin.New()
+	router.GET("/documents/:id", h.ServeDocument)
+
+	other := signer.Sign("/documents/2", time.Now().Add(time.Minute))
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"unsigned", "/documents/1", http.StatusForbidden},
+		{"signed for another document", "/documents/1" + strings.TrimPrefix(other, "/documents/2"), http.StatusForbidden},
+		{"expired", signer.Sign("/documents/1", time.Now().Add(-time.Minute)), http.StatusForbidden},
+		{"invalid id", "/documents/abc", http.StatusNotFound},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			require.Equal(t, tc.status, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestInspectDocument(t *testing.T) {
+	contentType, ext, _, err := inspectDocument([]byte("%PDF-1.7\n..."))
+	require.NoError(t, err)
+	require.Equal(t, "application/pdf", contentType)
+	require.Equal(t, ".pdf", ext)
+
+	_, _, _, err = inspectDocument([]byte("<html></html>"))
+	require.ErrorIs(t, err, ErrUnsupportedDocument)
+}
@@ -0,0 +1,215 @@
+package v1
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/payments"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/tracing"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/utils"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/lib/pq"
+)
+
+var statusByCode = map[errs.Code]int{
+	errs.CodeValidation:           http.StatusBadRequest,
+	errs.CodeUnauthorized:         http.StatusUnauthorized,
+	errs.CodeForbidden:            http.StatusForbidden,
+	errs.CodeNotFound:             http.StatusNotFound,
+	errs.CodeMethodNotAllowed:     http.StatusMethodNotAllowed,
+	errs.CodeConflict:             http.StatusConflict,
+	errs.CodeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	errs.CodePayloadTooLarge:      http.StatusRequestEntityTooLarge,
+	errs.CodeRateLimited:          http.StatusTooManyRequests,
+	errs.CodePreconditionFailed:   http.StatusPreconditionFailed,
+	errs.CodePreconditionRequired: http.StatusPreconditionRequired,
+	errs.CodeInternal:             http.StatusInternalServerError,
+}
+
+// pqKeyDetail matches the "Key (email)=(...)" part of a constraint violation.
+var pqKeyDetail = regexp.MustCompile(`^Key \(([^)]+)\)=`)
+
+// handleError is the single place where errors coming out of handlers,
+// repositories, Postgres and request validation become HTTP responses.
+// Anything it doesn't recognise is reported as an internal error without
+// leaking the underlying message.
+func handleError(c *gin.Context, err error) {
+	appErr := translateError(err)
+
+	if appErr.Code == errs.CodeInternal {
+		_ = c.Error(err)
+	}
+
+	response := models.ErrorResponse{
+		Error:     appErr.Message,
+		Code:      string(appErr.Code),
+		RequestID: c.GetString(requestIDKey),
+		TraceID:   tracing.TraceID(c.Request.Context()),
+	}
+
+	for _, f := range appErr.Fields {
+		response.Details = append(response.Details, models.FieldError{
+			Field:   f.Field,
+			Message: f.Message,
+		})
+	}
+
+	c.AbortWithStatusJSON(statusByCode[appErr.Code], response)
+}
+
+func translateError(err error) *errs.Error {
+	var (
+		appErr         *errs.Error
+		validationErrs validator.ValidationErrors
+		syntaxErr      *json.SyntaxError
+		typeErr        *json.UnmarshalTypeError
+		pqErr          *pq.Error
+		maxBytesErr    *http.MaxBytesError
+	)
+
+	switch {
+	case errors.As(err, &appErr):
+		return appErr
+	case errors.Is(err, sql.ErrNoRows):
+		return errs.New(errs.CodeNotFound, "resource not found")
+	case errors.Is(err, repo.ErrVersionMismatch):
+		return errs.New(errs.CodePreconditionFailed, "resource has been modified, fetch it again and retry")
+	case errors.Is(err, repo.ErrBookingState):
+		return errs.New(errs.CodeConflict, "booking cannot change to that status")
+	case errors.Is(err, repo.ErrPaymentState), errors.Is(err, payments.ErrInvalidState):
+		return errs.New(errs.CodeConflict, "payment cannot change to that status")
+	case errors.Is(err, repo.ErrRefundTooLarge):
+		return errs.New(errs.CodeConflict, "refund exceeds what is left of the payment")
+	case errors.Is(err, repo.ErrPaymentTooLarge):
+		return errs.Validation(errs.Field("amount", "must not exceed the outstanding balance"))
+	case errors.Is(err, repo.ErrBookingPaid):
+		return errs.New(errs.CodeConflict, "booking has been paid")
+	case errors.Is(err, repo.ErrBookingCancelled):
+		return errs.New(errs.CodeConflict, "booking has been cancelled")
+	case errors.Is(err, repo.ErrCampaignExhausted):
+		return errs.New(errs.CodeConflict, "campaign has just been used up, retry the booking")
+	case errors.Is(err, repo.ErrNoCommission):
+		return errs.New(errs.CodeConflict, "booking has not earned any commission")
+	case errors.Is(err, repo.ErrPayoutSettled):
+		return errs.New(errs.CodeConflict, "payout has already been settled")
+	case errors.Is(err, payments.ErrInvalidWebhook):
+		return errs.New(errs.CodeValidation, "invalid webhook")
+	case errors.Is(err, utils.ErrInvalidToken), errors.Is(err, utils.ErrExpiredToken):
+		return errs.New(errs.CodeUnauthorized, err.Error())
+	case errors.As(err, &validationErrs):
+		return validationError(validationErrs)
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return errs.New(errs.CodeValidation, "request body must be valid JSON")
+	case errors.As(err, &typeErr):
+		return errs.Validation(errs.Field(typeErr.Field, fmt.Sprintf("must be %s", typeErr.Type.String())))
+	case errors.As(err, &pqErr):
+		return postgresError(pqErr)
+	case errors.As(err, &maxBytesErr):
+		return errs.New(errs.CodePayloadTooLarge, fmt.Sprintf("request body must not exceed %d bytes", maxBytesErr.Limit))
+	}
+
+	return errs.Wrap(errs.CodeInternal, err, "internal server error")
+}
+
+func validationError(validationErrs validator.ValidationErrors) *errs.Error {
+	fields := make([]errs.FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		fields = append(fields, errs.Field(fe.Field(), validationMessage(fe)))
+	}
+	return errs.Validation(fields...)
+}
+
+func validationMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required", "required_if":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "min":
+		if fe.Kind().String() == "string" {
+			return fmt.Sprintf("must be at least %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if fe.Kind().String() == "string" {
+			return fmt.Sprintf("must be at most %s characters long", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fe.Param())
+	case "lt":
+		return fmt.Sprintf("must be less than %s", fe.Param())
+	case "gte":
+		return fmt.Sprintf("must be greater than or equal to %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.ReplaceAll(fe.Param(), " ", ", "))
+	case "url":
+		return "must be a valid URL"
+	case "isodate":
+		return "must be a date in YYYY-MM-DD format"
+	case "date_after":
+		return fmt.Sprintf("must be after %s", fe.Param())
+	case "currency":
+		return "must be a supported currency code"
+	case "room_status":
+		return fmt.Sprintf("must be one of: %s", strings.Join(repo.RoomStatuses, ", "))
+	}
+
+	return fmt.Sprintf("failed the %q check", fe.Tag())
+}
+
+// postgresError maps constraint and input errors to client errors. Only
+// column names are exposed, never the offending values.
+func postgresError(pqErr *pq.Error) *errs.Error {
+	field := pqErr.Column
+	if m := pqKeyDetail.FindStringSubmatch(pqErr.Detail); m != nil {
+		field = m[1]
+	}
+
+	switch pqErr.Code.Name() {
+	case "unique_violation":
+		if field != "" {
+			return &errs.Error{
+				Code:    errs.CodeConflict,
+				Message: "resource already exists",
+				Fields:  []errs.FieldError{errs.Field(field, "is already taken")},
+				Err:     pqErr,
+			}
+		}
+		return errs.Wrap(errs.CodeConflict, pqErr, "resource already exists")
+	case "foreign_key_violation":
+		if strings.Contains(pqErr.Detail, "is still referenced") {
+			return errs.Wrap(errs.CodeConflict, pqErr, "resource is still referenced by other records")
+		}
+		return errs.Validation(errs.Field(field, "references a record that does not exist"))
+	case "not_null_violation":
+		return errs.Validation(errs.Field(field, "is required"))
+	case "check_violation":
+		return errs.Validation(errs.Field(field, "is not allowed"))
+	case "invalid_text_representation", "invalid_datetime_format", "datetime_field_overflow",
+		"numeric_value_out_of_range", "string_data_right_truncation":
+		return errs.Wrap(errs.CodeValidation, pqErr, "request contains an invalid value")
+	case "serialization_failure", "deadlock_detected":
+		return errs.Wrap(errs.CodeConflict, pqErr, "request conflicted with a concurrent change, retry it")
+	}
+
+	return errs.Wrap(errs.CodeInternal, pqErr, "internal server error")
+}
+
+func (h *handlerV1) NoRoute(c *gin.Context) {
+	handleError(c, errs.New(errs.CodeNotFound, "route not found"))
+}
+
+func (h *handlerV1) NoMethod(c *gin.Context) {
+	handleError(c, errs.New(errs.CodeMethodNotAllowed, "method not allowed"))
+}
@@ -0,0 +1,64 @@
+package v1
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleErrorStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   errs.Code
+	}{
+		{"no rows", fmt.Errorf("get hotel: %w", sql.ErrNoRows), http.StatusNotFound, errs.CodeNotFound},
+		{"version mismatch", repo.ErrVersionMismatch, http.StatusPreconditionFailed, errs.CodePreconditionFailed},
+		{"missing if-match", ErrPreconditionRequired, http.StatusPreconditionRequired, errs.CodePreconditionRequired},
+		{"forbidden", ErrForbidden, http.StatusForbidden, errs.CodeForbidden},
+		{"unique", &pq.Error{Code: "23505", Detail: "Key (email)=(a@b.c) already exists."}, http.StatusConflict, errs.CodeConflict},
+		{"still referenced", &pq.Error{Code: "23503", Detail: `Key (id)=(1) is still referenced from table "rooms".`}, http.StatusConflict, errs.CodeConflict},
+		{"unknown", fmt.Errorf("dial tcp: refused"), http.StatusInternalServerError, errs.CodeInternal},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+			c.Set(requestIDKey, "req-1")
+
+			handleError(c, tc.err)
+
+			var resp models.ErrorResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			require.Equal(t, tc.status, w.Code)
+			require.Equal(t, string(tc.code), resp.Code)
+			require.Equal(t, "req-1", resp.RequestID)
+		})
+	}
+}
+
+func TestHandleErrorHidesDetails(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+
+	handleError(c, &pq.Error{Code: "23505", Detail: "Key (email)=(secret@example.com) already exists."})
+
+	require.NotContains(t, w.Body.String(), "secret@example.com")
+	require.Contains(t, w.Body.String(), `"field":"email"`)
+}
@@ -0,0 +1,46 @@
+package v1
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	etagHeaderKey    = "ETag"
+	ifMatchHeaderKey = "If-Match"
+)
+
+var (
+	ErrPreconditionRequired = errs.New(errs.CodePreconditionRequired, "If-Match header is required")
+	ErrInvalidIfMatch       = errs.Validation(errs.Field(ifMatchHeaderKey, "must be an ETag returned by the API"))
+)
+
+// setETag exposes the row version so clients can send it back in If-Match.
+func setETag(c *gin.Context, version int64) {
+	c.Header(etagHeaderKey, fmt.Sprintf(`"%d"`, version))
+}
+
+// ifMatchVersion returns the version a client expects to modify. Weak
+// validators are accepted since the version is the only thing compared.
+func ifMatchVersion(c *gin.Context) (int64, error) {
+	value := strings.TrimSpace(c.GetHeader(ifMatchHeaderKey))
+	if value == "" {
+		return 0, ErrPreconditionRequired
+	}
+
+	value = strings.TrimPrefix(value, "W/")
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return 0, ErrInvalidIfMatch
+	}
+
+	version, err := strconv.ParseInt(value[1:len(value)-1], 10, 64)
+	if err != nil || version < 1 {
+		return 0, ErrInvalidIfMatch
+	}
+
+	return version, nil
+}
@@ -0,0 +1,245 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/money"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+// @Router /exchange-rates [get]
+// @Summary Get exchange rates
+// @Description Get how many units of each currency one unit of the base currency buys.
+// @Tags exchange-rate
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.GetAllExchangeRatesResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetAllExchangeRates(c *gin.Context) {
+	result, err := h.storage.ExchangeRate().GetAll(c.Request.Context())
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response := models.GetAllExchangeRatesResponse{
+		Base:  h.cfg.Currency.Base,
+		Rates: make([]*models.ExchangeRate, 0, len(result)),
+	}
+
+	for _, rate := range result {
+		response.Rates = append(response.Rates, parseExchangeRateModel(rate))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Security ApiKeyAuth
+// @Router /exchange-rates/{currency} [put]
+// @Summary Set an exchange rate
+// @Description Create or replace the rate of a currency against the base currency. Bookings keep the rate they were made with. Superadmin only.
+// @Tags exchange-rate
+// @Accept json
+// @Produce json
+// @Param currency path string true "ISO 4217 code"
+// @Param rate body models.SetExchangeRateRequest true "Rate"
+// @Success 200 {object} models.ExchangeRate
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) SetExchangeRate(c *gin.Context) {
+	currency, err := h.rateCurrencyParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var req models.SetExchangeRateRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	rate, err := money.ParseRate(req.Rate)
+	if err != nil {
+		handleError(c, errs.Validation(errs.Field("rate", err.Error())))
+		return
+	}
+
+	resp, err := h.storage.ExchangeRate().Set(c.Request.Context(), &repo.ExchangeRate{
+		Currency: currency,
+		Rate:     money.FormatRate(rate),
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, parseExchangeRateModel(resp))
+}
+
+// @Security ApiKeyAuth
+// @Router /exchange-rates/{currency} [delete]
+// @Summary Delete an exchange rate
+// @Description Delete the rate of a currency, new bookings can no longer be made in it. Superadmin only.
+// @Tags exchange-rate
+// @Accept json
+// @Produce json
+// @Param currency path string true "ISO 4217 code"
+// @Success 200 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DeleteExchangeRate(c *gin.Context) {
+	currency, err := h.rateCurrencyParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	err = h.storage.ExchangeRate().Delete(c.Request.Context(), currency)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{
+		Message: "Successfully deleted",
+	})
+}
+
+// rateCurrencyParam checks that a superadmin is asking and returns the
+// currency from the path. The base currency always has the rate 1.
+func (h *handlerV1) rateCurrencyParam(c *gin.Context) (string, error) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		return "", err
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin {
+		return "", ErrForbidden
+	}
+
+	currency := strings.ToUpper(c.Param("currency"))
+	if !money.Supported(currency) {
+		return "", errs.Validation(errs.Field("currency", "must be a supported currency code"))
+	}
+
+	if currency == h.cfg.Currency.Base {
+		return "", errs.Validation(errs.Field("currency", "the base currency always has the rate 1"))
+	}
+
+	return currency, nil
+}
+
+// rates loads the current exchange rates.
+func (h *handlerV1) rates(ctx context.Context) (*money.Rates, error) {
+	result, err := h.storage.ExchangeRate().GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := make(map[string]string, len(result))
+	for _, rate := range result {
+		rates[rate.Currency] = rate.Rate
+	}
+
+	return money.NewRates(h.cfg.Currency.Base, rates)
+}
+
+// lockRate defaults the currency of a booking to the base currency and
+// returns it with the number of base units one unit of it is worth today.
+func (h *handlerV1) lockRate(ctx context.Context, currency string) (string, string, error) {
+	if currency == "" {
+		currency = h.cfg.Currency.Base
+	}
+
+	rates, err := h.rates(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	rate, err := rates.Rate(currency, rates.Base())
+	if err != nil {
+		return "", "", errs.Validation(errs.Field("currency", "has no exchange rate"))
+	}
+
+	return currency, money.FormatRate(rate), nil
+}
+
+// displayCurrency reads ?currency=, the currency prices are shown in.
+func displayCurrency(c *gin.Context) (string, error) {
+	currency := strings.ToUpper(c.Query("currency"))
+	if currency != "" && !money.Supported(currency) {
+		return "", errs.Validation(errs.Field("currency", "must be a supported currency code"))
+	}
+	return currency, nil
+}
+
+// convertBooking fills in the price and total of the booking in currency.
+// They are converted to the base currency at the rate locked in when the
+// booking was made and from there at today's rate.
+func convertBooking(booking *repo.Booking, model *models.Booking, currency string, rates *money.Rates) error {
+	if currency == "" {
+		return nil
+	}
+
+	model.DisplayCurrency = currency
+
+	if currency == booking.Currency {
+		model.DisplayPrice = &booking.Price
+		model.DisplayTotal = &booking.Total
+		return nil
+	}
+
+	locked, err := money.ParseRate(booking.ExchangeRate)
+	if err != nil {
+		return err
+	}
+
+	rate, err := rates.Rate(rates.Base(), currency)
+	if err != nil {
+		return errs.Validation(errs.Field("currency", "has no exchange rate"))
+	}
+	rate.Mul(locked, rate)
+
+	price, err := money.Convert(booking.Price, booking.Currency, currency, rate)
+	if err != nil {
+		return err
+	}
+
+	total, err := money.Convert(booking.Total, booking.Currency, currency, rate)
+	if err != nil {
+		return err
+	}
+
+	model.DisplayPrice = &price
+	model.DisplayTotal = &total
+	return nil
+}
+
+func parseExchangeRateModel(rate *repo.ExchangeRate) *models.ExchangeRate {
+	return &models.ExchangeRate{
+		Currency:  rate.Currency,
+		Rate:      normalizeRate(rate.Rate),
+		UpdatedAt: rate.UpdatedAt,
+	}
+}
+
+// normalizeRate drops the trailing zeros Postgres pads NUMERIC values with.
+func normalizeRate(s string) string {
+	rate, err := money.ParseRate(s)
+	if err != nil {
+		return s
+	}
+	return money.FormatRate(rate)
+}
@@ -0,0 +1,42 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/money"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertBooking(t *testing.T) {
+	rates, err := money.NewRates("USD", map[string]string{"EUR": "0.9", "UZS": "12000"})
+	require.NoError(t, err)
+
+	// booked in EUR when 1 EUR was worth 1.25 USD
+	booking := &repo.Booking{Price: 10000, Currency: "EUR", ExchangeRate: "1.250000000000"}
+
+	tests := []struct {
+		currency string
+		price    int64
+	}{
+		{"EUR", 10000},
+		{"USD", 12500},
+		{"UZS", 150000000},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.currency, func(t *testing.T) {
+			model := models.Booking{}
+			require.NoError(t, convertBooking(booking, &model, tc.currency, rates))
+			require.Equal(t, tc.currency, model.DisplayCurrency)
+			require.Equal(t, tc.price, *model.DisplayPrice)
+		})
+	}
+
+	model := models.Booking{}
+	require.NoError(t, convertBooking(booking, &model, "", rates))
+	require.Nil(t, model.DisplayPrice)
+
+	require.Error(t, convertBooking(booking, &model, "JPY", rates))
+}
@@ -0,0 +1,477 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/utils"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrInvalidMediaID = errs.Validation(errs.Field("media_id", "must be a positive integer"))
+	ErrInvalidGallery = errs.Validation(errs.Field("media_ids", "must list every image of the gallery once"))
+)
+
+// gallery is the gallery of one hotel or room a request works on.
+type gallery struct {
+	repo    repo.GalleryStorageI
+	ownerID int64
+}
+
+// hotelGallery resolves the hotel of the request and checks the user may
+// manage it.
+func (h *handlerV1) hotelGallery(c *gin.Context) (*gallery, error) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.canManageHotel(c.Request.Context(), payload, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gallery{repo: h.storage.HotelGallery(), ownerID: id}, nil
+}
+
+// roomGallery resolves the room of the request and checks the user may
+// manage its hotel.
+func (h *handlerV1) roomGallery(c *gin.Context) (*gallery, error) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		return nil, err
+	}
+
+	room, err := h.storage.Room().Get(c.Request.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.canManageHotel(c.Request.Context(), payload, int64(room.HotelId))
+	if err != nil {
+		return nil, err
+	}
+
+	return &gallery{repo: h.storage.RoomGallery(), ownerID: id}, nil
+}
+
+// canManageHotel allows superadmins and the partner owning the hotel.
+func (h *handlerV1) canManageHotel(ctx context.Context, payload *utils.Payload, hotelID int64) error {
+	hotel, err := h.storage.Hotel().Get(ctx, hotelID)
+	if err != nil {
+		return err
+	}
+
+	if payload.UserType == repo.UserTypeSuperadmin {
+		return nil
+	}
+
+	if payload.UserType != repo.UserTypePartner || hotel.UserID != payload.UserID {
+		return ErrForbidden
+	}
+
+	return nil
+}
+
+func mediaIDParam(c *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("media_id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, ErrInvalidMediaID
+	}
+
+	return id, nil
+}
+
+// @Security ApiKeyAuth
+// @Router /hotels/{id}/gallery [post]
+// @Summary Add an image to the gallery of a hotel
+// @Description Append an uploaded image to the gallery of a hotel. Marking it as the cover unmarks the previous cover. Only the partner owning the hotel and superadmins may.
+// @Tags hotel
+// @Accept json
+// @Produce json
+// @Param id path int true "Hotel ID"
+// @Param image body models.AddGalleryImageRequest true "Image"
+// @Success 201 {object} models.Gallery
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) AddHotelImage(c *gin.Context) {
+	g, err := h.hotelGallery(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	h.addGalleryImage(c, g)
+}
+
+// @Security ApiKeyAuth
+// @Router /hotels/{id}/gallery [put]
+// @Summary Reorder the gallery of a hotel
+// @Description Set the order of the gallery of a hotel. media_ids must list every image of the gallery once. Only the partner owning the hotel and superadmins may.
+// @Tags hotel
+// @Accept json
+// @Produce json
+// @Param id path int true "Hotel ID"
+// @Param order body models.ReorderGalleryRequest true "Order"
+// @Success 200 {object} models.Gallery
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) ReorderHotelGallery(c *gin.Context) {
+	g, err := h.hotelGallery(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	h.reorderGallery(c, g)
+}
+
+// @Security ApiKeyAuth
+// @Router /hotels/{id}/gallery/{media_id} [put]
+// @Summary Update an image of the gallery of a hotel
+// @Description Change the caption, alt text and cover flag of an image in the gallery of a hotel. Only the partner owning the hotel and superadmins may.
+// @Tags hotel
+// @Accept json
+// @Produce json
+// @Param id path int true "Hotel ID"
+// @Param media_id path int true "Media ID"
+// @Param image body models.UpdateGalleryImageRequest true "Image"
+// @Success 200 {object} models.Gallery
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) UpdateHotelImage(c *gin.Context) {
+	g, err := h.hotelGallery(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	h.updateGalleryImage(c, g)
+}
+
+// @Security ApiKeyAuth
+// @Router /hotels/{id}/gallery/{media_id} [delete]
+// @Summary Remove an image from the gallery of a hotel
+// @Description Remove an image from the gallery of a hotel. The uploaded image itself is garbage collected once nothing refers to it. Only the partner owning the hotel and superadmins may.
+// @Tags hotel
+// @Produce json
+// @Param id path int true "Hotel ID"
+// @Param media_id path int true "Media ID"
+// @Success 200 {object} models.Gallery
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) RemoveHotelImage(c *gin.Context) {
+	g, err := h.hotelGallery(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	h.removeGalleryImage(c, g)
+}
+
+// @Security ApiKeyAuth
+// @Router /rooms/{id}/gallery [post]
+// @Summary Add an image to the gallery of a room
+// @Description Append an uploaded image to the gallery of a room. Marking it as the cover unmarks the previous cover. Only the partner owning the hotel and superadmins may.
+// @Tags room
+// @Accept json
+// @Produce json
+// @Param id path int true "Room ID"
+// @Param image body models.AddGalleryImageRequest true "Image"
+// @Success 201 {object} models.Gallery
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) AddRoomImage(c *gin.Context) {
+	g, err := h.roomGallery(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	h.addGalleryImage(c, g)
+}
+
+// @Security ApiKeyAuth
+// @Router /rooms/{id}/gallery [put]
+// @Summary Reorder the gallery of a room
+// @Description Set the order of the gallery of a room. media_ids must list every image of the gallery once. Only the partner owning the hotel and superadmins may.
+// @Tags room
+// @Accept json
+// @Produce json
+// @Param id path int true "Room ID"
+// @Param order body models.ReorderGalleryRequest true "Order"
+// @Success 200 {object} models.Gallery
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) ReorderRoomGallery(c *gin.Context) {
+	g, err := h.roomGallery(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	h.reorderGallery(c, g)
+}
+
+// @Security ApiKeyAuth
+// @Router /rooms/{id}/gallery/{media_id} [put]
+// @Summary Update an image of the gallery of a room
+// @Description Change the caption, alt text and cover flag of an image in the gallery of a room. Only the partner owning the hotel and superadmins may.
+// @Tags room
+// @Accept json
+// @Produce json
+// @Param id path int true "Room ID"
+// @Param media_id path int true "Media ID"
+// @Param image body models.UpdateGalleryImageRequest true "Image"
+// @Success 200 {object} models.Gallery
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) UpdateRoomImage(c *gin.Context) {
+	g, err := h.roomGallery(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	h.updateGalleryImage(c, g)
+}
+
+// @Security ApiKeyAuth
+// @Router /rooms/{id}/gallery/{media_id} [delete]
+// @Summary Remove an image from the gallery of a room
+// @Description Remove an image from the gallery of a room. The uploaded image itself is garbage collected once nothing refers to it. Only the partner owning the hotel and superadmins may.
+// @Tags room
+// @Produce json
+// @Param id path int true "Room ID"
+// @Param media_id path int true "Media ID"
+// @Success 200 {object} models.Gallery
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) RemoveRoomImage(c *gin.Context) {
+	g, err := h.roomGallery(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	h.removeGalleryImage(c, g)
+}
+
+func (h *handlerV1) addGalleryImage(c *gin.Context, g *gallery) {
+	var req models.AddGalleryImageRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	err = h.checkReferences(c.Request.Context(), reference{"media_id", repo.AuditEntityMedia, req.MediaID})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	result, err := g.repo.Add(c.Request.Context(), &repo.GalleryImage{
+		OwnerID: g.ownerID,
+		MediaID: req.MediaID,
+		Caption: req.Caption,
+		AltText: req.AltText,
+		Cover:   req.Cover,
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	h.galleryResponse(c, http.StatusCreated, result)
+}
+
+func (h *handlerV1) updateGalleryImage(c *gin.Context, g *gallery) {
+	mediaID, err := mediaIDParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var req models.UpdateGalleryImageRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	result, err := g.repo.Update(c.Request.Context(), &repo.GalleryImage{
+		OwnerID: g.ownerID,
+		MediaID: mediaID,
+		Caption: req.Caption,
+		AltText: req.AltText,
+		Cover:   req.Cover,
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	h.galleryResponse(c, http.StatusOK, result)
+}
+
+func (h *handlerV1) reorderGallery(c *gin.Context, g *gallery) {
+	var req models.ReorderGalleryRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	result, err := g.repo.Reorder(c.Request.Context(), g.ownerID, req.MediaIDs)
+	if errors.Is(err, repo.ErrGalleryOrder) {
+		handleError(c, ErrInvalidGallery)
+		return
+	}
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	h.galleryResponse(c, http.StatusOK, result)
+}
+
+func (h *handlerV1) removeGalleryImage(c *gin.Context, g *gallery) {
+	mediaID, err := mediaIDParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	result, err := g.repo.Remove(c.Request.Context(), g.ownerID, mediaID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	h.galleryResponse(c, http.StatusOK, result)
+}
+
+func (h *handlerV1) galleryResponse(c *gin.Context, status int, result []*repo.GalleryImage) {
+	images, err := h.galleryImages(c.Request.Context(), result)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(status, models.Gallery{Images: images})
+}
+
+// galleryImages adds the image URLs to a gallery.
+func (h *handlerV1) galleryImages(ctx context.Context, gallery []*repo.GalleryImage) ([]*models.GalleryImage, error) {
+	ids := make([]*int64, 0, len(gallery))
+	for _, img := range gallery {
+		ids = append(ids, &img.MediaID)
+	}
+
+	images, err := h.images(ctx, ids...)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]*models.GalleryImage, 0, len(gallery))
+	for _, img := range gallery {
+		result = append(result, parseGalleryImageModel(img, images))
+	}
+
+	return result, nil
+}
+
+// covers loads the cover images of many galleries, by owner id.
+func (h *handlerV1) covers(ctx context.Context, galleries repo.GalleryStorageI, ownerIDs []int64) (map[int64]*models.GalleryImage, error) {
+	result := make(map[int64]*models.GalleryImage)
+	if len(ownerIDs) == 0 {
+		return result, nil
+	}
+
+	covers, err := galleries.GetCovers(ctx, ownerIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	images, err := h.galleryImages(ctx, covers)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, cover := range covers {
+		result[cover.OwnerID] = images[i]
+	}
+
+	return result, nil
+}
+
+// coverOf picks the cover of a gallery the way GetCovers does: the marked
+// image or else the first one.
+func coverOf(gallery []*models.GalleryImage) *models.GalleryImage {
+	for _, img := range gallery {
+		if img.Cover {
+			return img
+		}
+	}
+
+	if len(gallery) > 0 {
+		return gallery[0]
+	}
+
+	return nil
+}
+
+func parseGalleryImageModel(img *repo.GalleryImage, images map[int64]*models.Image) *models.GalleryImage {
+	return &models.GalleryImage{
+		MediaID:  img.MediaID,
+		Position: img.Position,
+		Caption:  img.Caption,
+		AltText:  img.AltText,
+		Cover:    img.Cover,
+		Image:    images[img.MediaID],
+	}
+}
@@ -0,0 +1,18 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoverOf(t *testing.T) {
+	first := &models.GalleryImage{MediaID: 1, Position: 1}
+	marked := &models.GalleryImage{MediaID: 2, Position: 2, Cover: true}
+
+	require.Equal(t, marked, coverOf([]*models.GalleryImage{first, marked}))
+	// without a marked cover the first image is used
+	require.Equal(t, first, coverOf([]*models.GalleryImage{first, {MediaID: 3, Position: 2}}))
+	require.Nil(t, coverOf(nil))
+}
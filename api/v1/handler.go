@@ -1,68 +1,138 @@
 package v1
 
 import (
-	"errors"
+	"encoding/base64"
+	"fmt"
 	"github.com/MuhammadyusufAdhamov/booking/api/models"
 	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/MuhammadyusufAdhamov/booking/jobs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/background"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/blob"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/health"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/payments"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/ratelimit"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/signedurl"
 	"github.com/MuhammadyusufAdhamov/booking/storage"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/gin-gonic/gin"
 	"strconv"
+	"strings"
+	"time"
 )
 
+const maxLimit = 100
+
 var (
-	ErrWrongEmailOrPass = errors.New("wrong email or password")
-	ErrEmailExists      = errors.New("email already exists")
-	ErrUserNotVerified  = errors.New("user not verified")
-	ErrIncorrectCode    = errors.New("incorrect verification code")
-	ErrCodeExpired      = errors.New("verification code has been expired")
-	ErrForbidden        = errors.New("forbidden")
+	ErrWrongEmailOrPass = errs.New(errs.CodeUnauthorized, "wrong email or password")
+	ErrEmailExists      = &errs.Error{Code: errs.CodeConflict, Message: "email already exists", Fields: []errs.FieldError{errs.Field("email", "is already taken")}}
+	ErrUserNotVerified  = errs.New(errs.CodeForbidden, "user not verified")
+	ErrIncorrectCode    = errs.New(errs.CodeForbidden, "incorrect verification code")
+	ErrCodeExpired      = errs.New(errs.CodeForbidden, "verification code has been expired")
+	ErrForbidden        = errs.New(errs.CodeForbidden, "forbidden")
+	ErrInvalidID        = errs.Validation(errs.Field("id", "must be a positive integer"))
+	ErrInvalidLimit     = errs.Validation(errs.Field("limit", fmt.Sprintf("must be between 1 and %d", maxLimit)))
+	ErrInvalidPage      = errs.Validation(errs.Field("page", "must be greater than 0"))
+	ErrInvalidCursor    = errs.Validation(errs.Field("after", "is not a valid cursor"))
 )
 
 type handlerV1 struct {
 	cfg      *config.Config
 	storage  storage.StorageI
 	inMemory storage.InMemoryStorageI
+	limiter  *ratelimit.Limiter
+	tasks    *background.Group
+	health   *health.Checker
+	deriver  *jobs.Deriver
+	blobs    blob.Store
+	sweeper  *jobs.MediaSweeper
+	// documents is the private store, never served without a signed link
+	documents blob.Store
+	signer    *signedurl.Signer
+	payments  payments.Provider
 }
 
 type HandlerV1Options struct {
-	Cfg      *config.Config
-	Storage  storage.StorageI
-	InMemory storage.InMemoryStorageI
+	Cfg       *config.Config
+	Storage   storage.StorageI
+	InMemory  storage.InMemoryStorageI
+	Limiter   *ratelimit.Limiter
+	Tasks     *background.Group
+	Health    *health.Checker
+	Deriver   *jobs.Deriver
+	Blobs     blob.Store
+	Sweeper   *jobs.MediaSweeper
+	Documents blob.Store
+	Payments  payments.Provider
 }
 
 //goland:noinspection GoExportedFuncWithUnexportedType
 func New(options *HandlerV1Options) *handlerV1 {
+	registerValidators()
+
 	return &handlerV1{
-		cfg:      options.Cfg,
-		storage:  options.Storage,
-		inMemory: options.InMemory,
+		cfg:       options.Cfg,
+		storage:   options.Storage,
+		inMemory:  options.InMemory,
+		limiter:   options.Limiter,
+		tasks:     options.Tasks,
+		health:    options.Health,
+		deriver:   options.Deriver,
+		blobs:     options.Blobs,
+		sweeper:   options.Sweeper,
+		documents: options.Documents,
+		signer:    signedurl.New([]byte(options.Cfg.Documents.SigningKey)),
+		payments:  options.Payments,
 	}
 }
 
-func errorResponse(err error) *models.ErrorResponse {
-	return &models.ErrorResponse{
-		Error: err.Error(),
+// idParam reads the :id path parameter.
+func idParam(c *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, ErrInvalidID
 	}
+
+	return id, nil
 }
 
-func validateGetAllParams(c *gin.Context) (*models.GetAllParams, error) {
+// validateGetAllParams reads limit/page/search and the optional opaque
+// "after" cursor. When a cursor is given the page is ignored and the
+// repositories switch to keyset pagination.
+func validateGetAllParams(c *gin.Context) (*models.GetAllParams, *repo.Cursor, error) {
 	var (
-		limit int = 10
-		page  int = 1
-		err   error
+		limit  int = 10
+		page   int = 1
+		cursor *repo.Cursor
+		err    error
 	)
 
 	if c.Query("limit") != "" {
 		limit, err = strconv.Atoi(c.Query("limit"))
 		if err != nil {
-			return nil, err
+			return nil, nil, ErrInvalidLimit
 		}
 	}
 
+	if limit < 1 || limit > maxLimit {
+		return nil, nil, ErrInvalidLimit
+	}
+
 	if c.Query("page") != "" {
 		page, err = strconv.Atoi(c.Query("page"))
 		if err != nil {
-			return nil, err
+			return nil, nil, ErrInvalidPage
+		}
+	}
+
+	if page < 1 {
+		return nil, nil, ErrInvalidPage
+	}
+
+	if c.Query("after") != "" {
+		cursor, err = decodeCursor(c.Query("after"))
+		if err != nil {
+			return nil, nil, err
 		}
 	}
 
@@ -70,5 +140,60 @@ func validateGetAllParams(c *gin.Context) (*models.GetAllParams, error) {
 		Limit:  int32(limit),
 		Page:   int32(page),
 		Search: c.Query("search"),
+		After:  c.Query("after"),
+	}, cursor, nil
+}
+
+func encodeCursor(cursor *repo.Cursor) string {
+	if cursor == nil {
+		return ""
+	}
+
+	raw := fmt.Sprintf("%d:%d", cursor.CreatedAt.UnixNano(), cursor.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s string) (*repo.Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return &repo.Cursor{
+		CreatedAt: time.Unix(0, nanos),
+		ID:        id,
 	}, nil
 }
+
+// includeDeleted reads ?include_deleted=true, which only superadmins may use.
+func includeDeleted(c *gin.Context) (bool, error) {
+	if c.Query("include_deleted") == "" {
+		return false, nil
+	}
+
+	include, err := strconv.ParseBool(c.Query("include_deleted"))
+	if err != nil {
+		return false, errs.Validation(errs.Field("include_deleted", "must be a boolean"))
+	}
+
+	if include && repo.ActorFromContext(c.Request.Context()).UserType != repo.UserTypeSuperadmin {
+		return false, ErrForbidden
+	}
+
+	return include, nil
+}
@@ -0,0 +1,40 @@
+package v1
+
+import (
+	"net/http"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/gin-gonic/gin"
+)
+
+// Healthz is the liveness probe. It only reports that the process serves
+// requests and does not touch any dependency.
+func (h *handlerV1) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, models.HealthResponse{Status: "ok"})
+}
+
+// Readyz is the readiness probe. It checks Postgres, Redis and the schema
+// migration version and answers 503 while the server shuts down.
+func (h *handlerV1) Readyz(c *gin.Context) {
+	ready, results := h.health.Ready(c.Request.Context())
+
+	resp := models.HealthResponse{
+		Status: "ok",
+		Checks: make(map[string]string, len(results)),
+	}
+	for name, err := range results {
+		if err != nil {
+			resp.Checks[name] = err.Error()
+			continue
+		}
+		resp.Checks[name] = "ok"
+	}
+
+	status := http.StatusOK
+	if !ready {
+		status = http.StatusServiceUnavailable
+		resp.Status = "unavailable"
+	}
+
+	c.JSON(status, resp)
+}
@@ -1,13 +1,10 @@
 package v1
 
 import (
-	"database/sql"
-	"errors"
 	"github.com/MuhammadyusufAdhamov/booking/api/models"
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/gin-gonic/gin"
 	"net/http"
-	"strconv"
 )
 
 // @Router /hotels [post]
@@ -18,6 +15,7 @@ import (
 // @Produce json
 // @Param hotel body models.CreateHotelRequest true "Hotel"
 // @Success 201 {object} models.Hotel
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) CreateHotel(c *gin.Context) {
 	var (
@@ -26,102 +24,172 @@ func (h *handlerV1) CreateHotel(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	err = h.checkReferences(c.Request.Context(), hotelReferences(&req)...)
+	if err != nil {
+		handleError(c, err)
 		return
 	}
 
-	resp, err := h.storage.Hotel().Create(&repo.Hotel{
+	resp, err := h.storage.Hotel().Create(c.Request.Context(), &repo.Hotel{
 		UserID:        req.UserID,
 		HotelName:     req.HotelName,
 		HotelLocation: req.HotelLocation,
-		HotelImageUrl: req.HotelImageUrl,
+		ImageID:       req.ImageID,
 		NumberOfRooms: req.NumberOfRooms,
 	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	images, err := h.images(c.Request.Context(), resp.ImageID)
+	if err != nil {
+		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, parseHotelModel(resp))
+	setETag(c, resp.Version)
+	c.JSON(http.StatusCreated, parseHotelModel(resp, images))
 }
 
 // @Router /hotels/{id} [get]
 // @Summary Get hotel by id
-// @Description Get hotel by id
+// @Description Get hotel by id, with its gallery and cover image
 // @Tags hotel
 // @Accept json
 // @Produce json
 // @Param id path int true "ID"
 // @Success 200 {object} models.Hotel
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) GetHotel(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.Hotel().Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	images, err := h.images(c.Request.Context(), resp.ImageID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	gallery, err := h.storage.HotelGallery().Get(c.Request.Context(), resp.ID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	resp, err := h.storage.Hotel().Get(int64(id))
+	galleryImages, err := h.galleryImages(c.Request.Context(), gallery)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, parseHotelModel(resp))
+	result := parseHotelModel(resp, images)
+	result.Gallery = galleryImages
+	result.Cover = coverOf(galleryImages)
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, result)
 }
 
 // @Router /hotels [get]
 // @Summary Get all hotels
-// @Description Get all hotels
+// @Description Get all hotels with their cover images
 // @Tags hotel
 // @Accept json
 // @Produce json
 // @Param filter query models.GetAllParams false "Filter"
 // @Success 200 {object} models.GetAllHotelsResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) GetAllHotels(c *gin.Context) {
-	req, err := validateGetAllParams(c)
+	req, cursor, err := validateGetAllParams(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	result, err := h.storage.Hotel().GetAll(&repo.GetAllHotelsParams{
-		Page:   req.Page,
-		Limit:  req.Limit,
-		Search: req.Search,
+	withDeleted, err := includeDeleted(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	result, err := h.storage.Hotel().GetAll(c.Request.Context(), &repo.GetAllHotelsParams{
+		Page:           req.Page,
+		Limit:          req.Limit,
+		Search:         req.Search,
+		Cursor:         cursor,
+		IncludeDeleted: withDeleted,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	ids := make([]*int64, 0, len(result.Hotels))
+	ownerIDs := make([]int64, 0, len(result.Hotels))
+	for _, hotel := range result.Hotels {
+		ids = append(ids, hotel.ImageID)
+		ownerIDs = append(ownerIDs, hotel.ID)
+	}
+
+	images, err := h.images(c.Request.Context(), ids...)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	covers, err := h.covers(c.Request.Context(), h.storage.HotelGallery(), ownerIDs)
+	if err != nil {
+		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, getHotelsResponse(result))
+	c.JSON(http.StatusOK, getHotelsResponse(result, images, covers))
 }
 
-func getHotelsResponse(data *repo.GetAllHotelsResult) *models.GetAllHotelsResponse {
+func getHotelsResponse(data *repo.GetAllHotelsResult, images map[int64]*models.Image, covers map[int64]*models.GalleryImage) *models.GetAllHotelsResponse {
 	response := models.GetAllHotelsResponse{
-		Hotels: make([]*models.Hotel, 0),
-		Count:  data.Count,
+		Hotels:     make([]*models.Hotel, 0),
+		Count:      data.Count,
+		NextCursor: encodeCursor(data.NextCursor),
 	}
 
 	for _, hotel := range data.Hotels {
-		u := parseHotelModel(hotel)
+		u := parseHotelModel(hotel, images)
+		u.Cover = covers[hotel.ID]
 		response.Hotels = append(response.Hotels, &u)
 	}
 
 	return &response
 }
 
-func parseHotelModel(hotel *repo.Hotel) models.Hotel {
+func parseHotelModel(hotel *repo.Hotel, images map[int64]*models.Image) models.Hotel {
 	return models.Hotel{
 		ID:            hotel.ID,
 		UserID:        hotel.UserID,
 		HotelName:     hotel.HotelName,
 		HotelLocation: hotel.HotelLocation,
-		HotelImageUrl: hotel.HotelImageUrl,
+		Image:         imageOf(images, hotel.ImageID, hotel.ImageURL),
 		NumberOfRooms: hotel.NumberOfRooms,
+		Version:       hotel.Version,
 		CreatedAt:     hotel.CreatedAt,
+		DeletedAt:     hotel.DeletedAt,
 	}
 }
 
@@ -132,9 +200,13 @@ func parseHotelModel(hotel *repo.Hotel) models.Hotel {
 // @Accept json
 // @Produce json
 // @Param id path int true "ID"
+// @Param If-Match header string true "ETag of the version being changed"
 // @Param hotel body models.CreateHotelRequest true "Hotel"
 // @Success 200 {object} models.Hotel
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) UpdateHotel(c *gin.Context) {
 	var (
@@ -143,41 +215,149 @@ func (h *handlerV1) UpdateHotel(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	id, err := strconv.Atoi(c.Param("id"))
+	err = h.checkReferences(c.Request.Context(), hotelReferences(&req)...)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	resp, err := h.storage.Hotel().Update(&repo.Hotel{
-		ID:            int64(id),
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.Hotel().Update(c.Request.Context(), &repo.Hotel{
+		ID:            id,
 		UserID:        req.UserID,
 		HotelName:     req.HotelName,
 		HotelLocation: req.HotelLocation,
-		HotelImageUrl: req.HotelImageUrl,
+		ImageID:       req.ImageID,
 		NumberOfRooms: req.NumberOfRooms,
+		Version:       version,
 	})
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	images, err := h.images(c.Request.Context(), resp.ImageID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, parseHotelModel(resp, images))
+}
+
+// @Security ApiKeyAuth
+// @Router /hotels/{id} [patch]
+// @Summary Patch a hotel
+// @Description Partially update a hotel with an RFC 7396 JSON merge patch. Fields set to null are cleared, omitted fields are kept. Only the partner owning the hotel and superadmins may, and only superadmins may change its owner.
+// @Tags hotel
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Param If-Match header string true "ETag of the version being changed"
+// @Param hotel body models.CreateHotelRequest true "Merge patch"
+// @Success 200 {object} models.Hotel
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) PatchHotel(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	current, err := h.storage.Hotel().Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if current.Version != version {
+		handleError(c, repo.ErrVersionMismatch)
+		return
+	}
+
+	err = h.canManageHotel(c.Request.Context(), payload, id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	original := models.CreateHotelRequest{
+		UserID:        current.UserID,
+		HotelName:     current.HotelName,
+		HotelLocation: current.HotelLocation,
+		ImageID:       current.ImageID,
+		NumberOfRooms: current.NumberOfRooms,
+	}
+
+	var merged models.CreateHotelRequest
+	fields, err := mergePatchRequest(c, &original, &merged)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if _, ok := fields["user_id"]; ok && payload.UserType != repo.UserTypeSuperadmin {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	if changesReferences(fields, "user_id", "image_id") {
+		err = h.checkReferences(c.Request.Context(), hotelReferences(&merged)...)
+		if err != nil {
+			handleError(c, err)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+	}
+
+	resp, err := h.storage.Hotel().Patch(c.Request.Context(), id, version, fields)
+	if err != nil {
+		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.Hotel{
-		ID:            resp.ID,
-		UserID:        resp.UserID,
-		HotelName:     resp.HotelName,
-		HotelLocation: resp.HotelLocation,
-		HotelImageUrl: resp.HotelImageUrl,
-		NumberOfRooms: resp.NumberOfRooms,
-	})
+	images, err := h.images(c.Request.Context(), resp.ImageID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, parseHotelModel(resp, images))
 }
 
 // @Router /hotel/{id} [delete]
@@ -187,23 +367,29 @@ func (h *handlerV1) UpdateHotel(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path int true "ID"
+// @Param If-Match header string true "ETag of the version being changed"
 // @Success 200 {object} models.ResponseOK
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) DeleteHotel(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := idParam(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	err = h.storage.Hotel().Delete(int64(id))
+	version, err := ifMatchVersion(c)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, errorResponse(err))
-			return
-		}
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	err = h.storage.Hotel().Delete(c.Request.Context(), id, version)
+	if err != nil {
+		handleError(c, err)
 		return
 	}
 
@@ -211,3 +397,50 @@ func (h *handlerV1) DeleteHotel(c *gin.Context) {
 		Message: "Successfully deleted",
 	})
 }
+
+// @Security ApiKeyAuth
+// @Router /hotels/{id}/restore [post]
+// @Summary Restore a deleted hotel
+// @Description Restore a deleted hotel. Superadmin only.
+// @Tags hotel
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.Hotel
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) RestoreHotel(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.Hotel().Restore(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	images, err := h.images(c.Request.Context(), resp.ImageID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, parseHotelModel(resp, images))
+}
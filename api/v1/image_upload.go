@@ -1,53 +1,177 @@
 package v1
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/imaging"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"io"
 	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
 )
 
+// multipartOverhead is allowed on top of the file size for the multipart
+// boundaries and headers.
+const multipartOverhead = 64 << 10
+
+var ErrUnsupportedImage = errs.New(errs.CodeUnsupportedMediaType, "file must be a JPEG, PNG or WebP image")
+
 type File struct {
 	File *multipart.FileHeader `form:"file" binding:"required"`
 }
 
 // @Security ApiKeyAuth
 // @Router /file-upload [post]
-// @Summary File upload
-// @Description File upload
+// @Summary Upload an image
+// @Description Upload a JPEG, PNG or WebP image. The type is detected from the content, EXIF and other metadata is stripped, and uploading the same file again returns the existing media with 200. Resized copies are generated in the background; pass the id as image_id of a hotel or room.
 // @Tags file-upload
-// @Accept json
+// @Accept multipart/form-data
 // @Produce json
 // @Param file formData file true "File"
-// @Success 200 {object} models.ResponseOK
+// @Success 200 {object} models.Media
+// @Success 201 {object} models.Media
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) UploadFile(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	limits := h.cfg.Upload
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limits.MaxSize+multipartOverhead)
+
 	var file File
+	err = c.ShouldBind(&file)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
 
-	err := c.ShouldBind(&file)
+	data, err := readUpload(file.File, limits.MaxSize)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	id := uuid.New()
-	fileName := id.String() + filepath.Ext(file.File.Filename)
-	dst, _ := os.Getwd()
+	info, err := imaging.Inspect(data)
+	if errors.Is(err, imaging.ErrUnsupportedType) {
+		handleError(c, ErrUnsupportedImage)
+		return
+	}
+	if err != nil {
+		handleError(c, errs.Validation(errs.Field("file", "is not a valid image")))
+		return
+	}
 
-	if _, err := os.Stat(dst + "/media"); os.IsNotExist(err) {
-		os.Mkdir(dst+"/media", os.ModePerm)
+	if info.Width > limits.MaxWidth || info.Height > limits.MaxHeight {
+		handleError(c, errs.Validation(errs.Field("file", fmt.Sprintf("must be at most %dx%d pixels", limits.MaxWidth, limits.MaxHeight))))
+		return
 	}
 
-	filePath := "/media/" + fileName
-	err = c.SaveUploadedFile(file.File, dst+filePath)
+	data, err = imaging.StripMetadata(info, data)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, errs.Validation(errs.Field("file", "is not a valid image")))
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+
+	existing, err := h.storage.Media().GetByChecksum(c.Request.Context(), payload.UserID, checksum)
+	if err == nil {
+		c.JSON(http.StatusOK, parseMediaModel(existing))
+		return
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"filename": filePath,
+	// identical uploads of other owners share the file, the lock keeps the
+	// sweeper from deleting it before the media is recorded
+	fileName := checksum + info.Ext
+	var media *repo.Media
+	err = h.storage.Media().LockChecksum(c.Request.Context(), checksum, func() error {
+		exists, err := h.blobs.Exists(c.Request.Context(), fileName)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			err = h.blobs.Put(c.Request.Context(), fileName, bytes.NewReader(data), int64(len(data)), info.ContentType)
+			if err != nil {
+				return err
+			}
+		}
+
+		media, err = h.storage.Media().Create(c.Request.Context(), &repo.Media{
+			OwnerID:     payload.UserID,
+			Checksum:    checksum,
+			FileName:    fileName,
+			ContentType: info.ContentType,
+			Size:        int64(len(data)),
+			Width:       info.Width,
+			Height:      info.Height,
+		})
+		return err
 	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	h.deriver.Notify()
+
+	c.JSON(http.StatusCreated, parseMediaModel(media))
+}
+
+// readUpload reads the whole file, refusing anything over maxSize whatever
+// size the client declared.
+func readUpload(header *multipart.FileHeader, maxSize int64) ([]byte, error) {
+	tooLarge := errs.New(errs.CodePayloadTooLarge, fmt.Sprintf("file must not exceed %d bytes", maxSize))
+	if header.Size > maxSize {
+		return nil, tooLarge
+	}
+
+	f, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(io.LimitReader(f, maxSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxSize {
+		return nil, tooLarge
+	}
+
+	return data, nil
+}
+
+func parseMediaModel(media *repo.Media) models.Media {
+	return models.Media{
+		ID:          media.ID,
+		URL:         mediaURL(media.FileName),
+		ContentType: media.ContentType,
+		Size:        media.Size,
+		Width:       media.Width,
+		Height:      media.Height,
+		Checksum:    media.Checksum,
+		CreatedAt:   media.CreatedAt,
+	}
 }
@@ -0,0 +1,61 @@
+package v1
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func uploadRequest(t *testing.T, name string, content []byte) *http.Request {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	part, err := w.CreateFormFile("file", name)
+	require.NoError(t, err)
+	_, err = part.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/file-upload", &body)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestUploadFileRejectsBeforeStoring(t *testing.T) {
+	h := &handlerV1{cfg: &config.Config{Upload: config.Upload{
+		MaxSize:   1024,
+		MaxWidth:  100,
+		MaxHeight: 100,
+	}}}
+
+	router := gin.New()
+	router.POST("/file-upload", func(c *gin.Context) {
+		c.Set(authorizationPayloadKey, &utils.Payload{UserID: 1})
+	}, h.UploadFile)
+
+	tests := []struct {
+		name    string
+		file    string
+		content []byte
+		status  int
+	}{
+		// the extension is not trusted, the content is
+		{"html named as image", "photo.jpg", []byte("<html><script>alert(1)</script></html>"), http.StatusUnsupportedMediaType},
+		{"too large", "photo.png", bytes.Repeat([]byte{0}, 2048), http.StatusRequestEntityTooLarge},
+		{"broken image", "photo.png", []byte("\x89PNG\r\n\x1a\nbroken"), http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, uploadRequest(t, tc.file, tc.content))
+			require.Equal(t, tc.status, w.Code, w.Body.String())
+		})
+	}
+}
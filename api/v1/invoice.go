@@ -0,0 +1,654 @@
+package v1
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	emailPkg "github.com/MuhammadyusufAdhamov/booking/pkg/email"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/invoice"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/logger"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/utils"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slog"
+)
+
+var (
+	ErrNoLegalDetails      = errs.New(errs.CodeConflict, "hotel has no legal details, set them first")
+	ErrBookingNotConfirmed = errs.New(errs.CodeConflict, "booking has not been confirmed")
+	ErrNothingPaid         = errs.New(errs.CodeConflict, "booking has no payments")
+)
+
+var invoiceTitles = map[string]string{
+	repo.InvoiceKindInvoice: "Invoice",
+	repo.InvoiceKindReceipt: "Receipt",
+}
+
+// @Security ApiKeyAuth
+// @Router /hotels/{id}/legal [get]
+// @Summary Get the legal details of a hotel
+// @Description Get the company details printed on the hotel's invoices. Partners owning the hotel and superadmins only.
+// @Tags invoice
+// @Accept json
+// @Produce json
+// @Param id path int true "Hotel ID"
+// @Success 200 {object} models.LegalDetails
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetLegalDetails(c *gin.Context) {
+	hotelID, err := h.manageableHotel(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.LegalDetails().Get(c.Request.Context(), hotelID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, parseLegalDetailsModel(resp))
+}
+
+// @Security ApiKeyAuth
+// @Router /hotels/{id}/legal [put]
+// @Summary Set the legal details of a hotel
+// @Description Set the company details printed on the hotel's invoices. Invoices already issued keep the details they were issued with. Partners owning the hotel and superadmins only.
+// @Tags invoice
+// @Accept json
+// @Produce json
+// @Param id path int true "Hotel ID"
+// @Param details body models.SetLegalDetailsRequest true "Legal details"
+// @Success 200 {object} models.LegalDetails
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) SetLegalDetails(c *gin.Context) {
+	hotelID, err := h.manageableHotel(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var req models.SetLegalDetailsRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.LegalDetails().Set(c.Request.Context(), &repo.LegalDetails{
+		HotelID:            hotelID,
+		LegalName:          req.LegalName,
+		Address:            req.Address,
+		TaxID:              req.TaxID,
+		RegistrationNumber: req.RegistrationNumber,
+		Email:              req.Email,
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, parseLegalDetailsModel(resp))
+}
+
+// @Security ApiKeyAuth
+// @Router /bookings/{id}/invoices [post]
+// @Summary Issue an invoice or receipt
+// @Description Issue an invoice with a line per night, or a receipt of the payments, for a booking. Numbers have no gaps per hotel and kind, and issued documents never change. A booking gets one of each kind; asking again returns the existing one with 200.
+// @Tags invoice
+// @Accept json
+// @Produce json
+// @Param id path int true "Booking ID"
+// @Param invoice body models.CreateInvoiceRequest true "Invoice"
+// @Success 200 {object} models.Invoice
+// @Success 201 {object} models.Invoice
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) CreateInvoice(c *gin.Context) {
+	booking, _, err := h.accessibleBooking(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var req models.CreateInvoiceRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	inv, err := h.issueInvoice(ctx, booking, req.Kind)
+	if errors.Is(err, repo.ErrInvoiceExists) {
+		inv, err = h.bookingInvoice(ctx, booking.ID, req.Kind)
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, parseInvoiceModel(inv))
+		return
+	}
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, parseInvoiceModel(inv))
+}
+
+// @Security ApiKeyAuth
+// @Router /bookings/{id}/invoices [get]
+// @Summary Get the invoices of a booking
+// @Description Get the invoices and receipts issued for a booking
+// @Tags invoice
+// @Accept json
+// @Produce json
+// @Param id path int true "Booking ID"
+// @Success 200 {object} models.GetAllInvoicesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetBookingInvoices(c *gin.Context) {
+	booking, _, err := h.accessibleBooking(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	list, err := h.storage.Invoice().GetByBooking(c.Request.Context(), booking.ID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response := models.GetAllInvoicesResponse{
+		Invoices: make([]*models.Invoice, 0, len(list)),
+	}
+	for _, inv := range list {
+		m := parseInvoiceModel(inv)
+		response.Invoices = append(response.Invoices, &m)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Security ApiKeyAuth
+// @Router /invoices/{id} [get]
+// @Summary Get an invoice
+// @Description Get an invoice or receipt
+// @Tags invoice
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.Invoice
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetInvoice(c *gin.Context) {
+	inv, _, err := h.accessibleInvoice(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, parseInvoiceModel(inv))
+}
+
+// @Security ApiKeyAuth
+// @Router /invoices/{id}/pdf [get]
+// @Summary Download an invoice
+// @Description Download an invoice or receipt as PDF
+// @Tags invoice
+// @Produce application/pdf
+// @Param id path int true "ID"
+// @Success 200 {file} binary
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DownloadInvoice(c *gin.Context) {
+	inv, _, err := h.accessibleInvoice(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	err = verifyInvoice(inv)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, inv.Number))
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Data(http.StatusOK, "application/pdf", inv.Content)
+}
+
+// @Security ApiKeyAuth
+// @Router /invoices/{id}/email [post]
+// @Summary Email an invoice
+// @Description Send an invoice or receipt as PDF attachment, by default to the guest. Only partners and superadmins may send it to another address.
+// @Tags invoice
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Param email body models.EmailInvoiceRequest false "Recipient"
+// @Success 202 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) EmailInvoice(c *gin.Context) {
+	inv, payload, err := h.accessibleInvoice(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var req models.EmailInvoiceRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		handleError(c, err)
+		return
+	}
+
+	if req.Email != "" && payload.UserType == repo.UserTypeUser {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	err = verifyInvoice(inv)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	booking, err := h.storage.Booking().Get(ctx, inv.BookingID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	hotel, err := h.storage.Hotel().Get(ctx, inv.HotelID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	to := req.Email
+	if to == "" {
+		guest, err := h.storage.User().Get(ctx, int64(booking.UserId))
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+		to = guest.Email
+	}
+
+	title := invoiceTitles[inv.Kind]
+	request := &emailPkg.SendEmailRequest{
+		To:      []string{to},
+		Type:    emailPkg.InvoiceEmail,
+		Subject: fmt.Sprintf("%s %s", title, inv.Number),
+		Body: map[string]string{
+			"kind":   inv.Kind,
+			"number": inv.Number,
+			"hotel":  hotel.HotelName,
+		},
+		Attachments: []emailPkg.Attachment{{
+			FileName:    inv.Number + ".pdf",
+			ContentType: "application/pdf",
+			Data:        inv.Content,
+		}},
+	}
+
+	detached := logger.Detach(ctx)
+	h.tasks.Go(func() {
+		err := emailPkg.SendEmail(detached, h.cfg, request)
+		if err != nil {
+			slog.ErrorCtx(detached, "failed to send invoice", err, "invoice_id", inv.ID)
+		}
+	})
+
+	c.JSON(http.StatusAccepted, models.ResponseOK{
+		Message: title + " will be sent to " + to,
+	})
+}
+
+// manageableHotel reads the hotel :id parameter if the user may manage the
+// hotel.
+func (h *handlerV1) manageableHotel(c *gin.Context) (int64, error) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		return 0, err
+	}
+
+	return id, h.canManageHotel(c.Request.Context(), payload, id)
+}
+
+// accessibleInvoice loads the invoice of the :id parameter with its content
+// if the user may see its booking.
+func (h *handlerV1) accessibleInvoice(c *gin.Context) (*repo.Invoice, *utils.Payload, error) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inv, err := h.storage.Invoice().Get(c.Request.Context(), id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ok, err := h.canAccess(c.Request.Context(), payload, inv.HotelID, &inv.BookingID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, ErrForbidden
+	}
+
+	return inv, payload, nil
+}
+
+func (h *handlerV1) bookingInvoice(ctx context.Context, bookingID int64, kind string) (*repo.Invoice, error) {
+	list, err := h.storage.Invoice().GetByBooking(ctx, bookingID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, inv := range list {
+		if inv.Kind == kind {
+			return inv, nil
+		}
+	}
+
+	return nil, errs.NotFound("invoice")
+}
+
+// issueInvoice snapshots everything printed on the invoice, so later changes
+// to the hotel, guest or legal details leave it as it was issued.
+func (h *handlerV1) issueInvoice(ctx context.Context, booking *repo.Booking, kind string) (*repo.Invoice, error) {
+	legal, err := h.storage.LegalDetails().Get(ctx, int64(booking.HotelId))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNoLegalDetails
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	hotel, err := h.storage.Hotel().Get(ctx, int64(booking.HotelId))
+	if err != nil {
+		return nil, err
+	}
+
+	room, err := h.storage.Room().Get(ctx, int64(booking.RoomId))
+	if err != nil {
+		return nil, err
+	}
+
+	guest, err := h.storage.User().Get(ctx, int64(booking.UserId))
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []repo.InvoiceLine
+	switch kind {
+	case repo.InvoiceKindInvoice:
+		if booking.Status != repo.BookingStatusConfirmed {
+			return nil, ErrBookingNotConfirmed
+		}
+		lines = append(nightLines(booking), chargeLines(booking)...)
+	case repo.InvoiceKindReceipt:
+		list, err := h.storage.Payment().GetByBooking(ctx, booking.ID)
+		if err != nil {
+			return nil, err
+		}
+		lines = paymentLines(list)
+		if len(lines) == 0 {
+			return nil, ErrNothingPaid
+		}
+	}
+
+	var total int64
+	for _, line := range lines {
+		if !line.Included {
+			total += line.Amount
+		}
+	}
+
+	data := &invoice.Data{
+		Title: invoiceTitles[kind],
+		Issuer: invoice.Party{
+			Name:               legal.LegalName,
+			Address:            legal.Address,
+			TaxID:              legal.TaxID,
+			RegistrationNumber: legal.RegistrationNumber,
+			Email:              legal.Email,
+		},
+		Customer: invoice.Party{
+			Name:  guest.FirstName + " " + guest.LastName,
+			Email: guest.Email,
+		},
+		Reference: []string{
+			fmt.Sprintf("Booking #%d", booking.ID),
+			fmt.Sprintf("%s, %s", hotel.HotelName, hotel.HotelLocation),
+			fmt.Sprintf("Room %d (%s)", room.NumberOfRoom, room.Type),
+			fmt.Sprintf("Stay %s to %s", isoDate(booking.FromDate), isoDate(booking.ToDate)),
+		},
+		Currency: booking.Currency,
+		Total:    total,
+	}
+	for _, line := range lines {
+		data.Lines = append(data.Lines, invoice.Line{
+			Description: line.Description,
+			Quantity:    line.Quantity,
+			UnitAmount:  line.UnitAmount,
+			Amount:      line.Amount,
+			Included:    line.Included,
+		})
+	}
+	if kind == repo.InvoiceKindReceipt {
+		data.Notes = []string{"Thank you for your payment."}
+	}
+
+	return h.storage.Invoice().Create(ctx, &repo.Invoice{
+		HotelID:   int64(booking.HotelId),
+		BookingID: booking.ID,
+		Kind:      kind,
+		Currency:  data.Currency,
+		Total:     total,
+		Lines:     lines,
+	}, func(inv *repo.Invoice) ([]byte, error) {
+		data.Number = inv.Number
+		data.IssuedAt = inv.IssuedAt
+		return invoice.Render(data), nil
+	})
+}
+
+// nightLines splits the price over the nights of the stay. Minor units that
+// do not divide evenly go to the first nights.
+func nightLines(booking *repo.Booking) []repo.InvoiceLine {
+	from, _ := time.Parse(isoDateLayout, isoDate(booking.FromDate))
+	to, _ := time.Parse(isoDateLayout, isoDate(booking.ToDate))
+	price := booking.Price
+
+	nights := int64(to.Sub(from).Hours() / 24)
+	if nights < 1 {
+		return []repo.InvoiceLine{{
+			Kind:        repo.InvoiceLineNight,
+			Description: "Stay from " + isoDate(booking.FromDate),
+			Quantity:    1,
+			UnitAmount:  price,
+			Amount:      price,
+		}}
+	}
+
+	lines := make([]repo.InvoiceLine, 0, nights)
+	for i := int64(0); i < nights; i++ {
+		amount := price / nights
+		if i < price%nights {
+			amount++
+		}
+
+		lines = append(lines, repo.InvoiceLine{
+			Kind:        repo.InvoiceLineNight,
+			Description: "Night of " + from.AddDate(0, 0, int(i)).Format(isoDateLayout),
+			Quantity:    1,
+			UnitAmount:  amount,
+			Amount:      amount,
+		})
+	}
+
+	return lines
+}
+
+// chargeLines lists the discounts, taxes and fees of a booking. Inclusive
+// ones are already part of the nights.
+func chargeLines(booking *repo.Booking) []repo.InvoiceLine {
+	lines := make([]repo.InvoiceLine, 0, len(booking.Charges))
+
+	for _, charge := range booking.Charges {
+		kind := repo.InvoiceLineFee
+		switch charge.Kind {
+		case repo.TaxRuleKindTax:
+			kind = repo.InvoiceLineTax
+		case repo.ChargeKindDiscount:
+			kind = repo.InvoiceLineDiscount
+		}
+
+		lines = append(lines, repo.InvoiceLine{
+			Kind:        kind,
+			Description: charge.Name,
+			Quantity:    charge.Quantity,
+			UnitAmount:  charge.UnitAmount,
+			Amount:      charge.Amount,
+			Included:    charge.Inclusive,
+		})
+	}
+
+	return lines
+}
+
+// paymentLines lists the captured payments and succeeded refunds.
+func paymentLines(list []*repo.Payment) []repo.InvoiceLine {
+	var lines []repo.InvoiceLine
+
+	for _, p := range list {
+		if p.Status != repo.PaymentStatusCaptured {
+			continue
+		}
+
+		lines = append(lines, repo.InvoiceLine{
+			Kind:        repo.InvoiceLinePayment,
+			Description: fmt.Sprintf("Payment of %s", p.CreatedAt.UTC().Format(isoDateLayout)),
+			Amount:      p.Amount,
+		})
+
+		for _, r := range p.Refunds {
+			if r.Status != repo.RefundStatusSucceeded {
+				continue
+			}
+
+			lines = append(lines, repo.InvoiceLine{
+				Kind:        repo.InvoiceLineRefund,
+				Description: fmt.Sprintf("Refund of %s", r.CreatedAt.UTC().Format(isoDateLayout)),
+				Amount:      -r.Amount,
+			})
+		}
+	}
+
+	return lines
+}
+
+// verifyInvoice makes sure the stored PDF is the one that was issued.
+func verifyInvoice(inv *repo.Invoice) error {
+	sum := sha256.Sum256(inv.Content)
+	if hex.EncodeToString(sum[:]) != inv.Checksum {
+		return fmt.Errorf("invoice %d does not match its checksum", inv.ID)
+	}
+	return nil
+}
+
+func parseLegalDetailsModel(d *repo.LegalDetails) models.LegalDetails {
+	return models.LegalDetails{
+		HotelID:            d.HotelID,
+		LegalName:          d.LegalName,
+		Address:            d.Address,
+		TaxID:              d.TaxID,
+		RegistrationNumber: d.RegistrationNumber,
+		Email:              d.Email,
+		UpdatedAt:          d.UpdatedAt,
+	}
+}
+
+func parseInvoiceModel(inv *repo.Invoice) models.Invoice {
+	result := models.Invoice{
+		ID:        inv.ID,
+		HotelID:   inv.HotelID,
+		BookingID: inv.BookingID,
+		Kind:      inv.Kind,
+		Number:    inv.Number,
+		Currency:  inv.Currency,
+		Total:     inv.Total,
+		Lines:     make([]*models.InvoiceLine, 0, len(inv.Lines)),
+		Checksum:  inv.Checksum,
+		URL:       "/v1/invoices/" + strconv.FormatInt(inv.ID, 10) + "/pdf",
+		IssuedAt:  inv.IssuedAt,
+	}
+
+	for _, line := range inv.Lines {
+		result.Lines = append(result.Lines, &models.InvoiceLine{
+			Kind:        line.Kind,
+			Description: line.Description,
+			Quantity:    line.Quantity,
+			UnitAmount:  line.UnitAmount,
+			Amount:      line.Amount,
+			Included:    line.Included,
+		})
+	}
+
+	return result
+}
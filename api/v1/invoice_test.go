@@ -0,0 +1,69 @@
+package v1
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNightLines(t *testing.T) {
+	lines := nightLines(&repo.Booking{FromDate: "2022-10-01", ToDate: "2022-10-04", Price: 10000})
+	require.Len(t, lines, 3)
+
+	var total int64
+	for _, line := range lines {
+		total += line.Amount
+	}
+	require.Equal(t, int64(10000), total)
+	require.Equal(t, int64(3334), lines[0].Amount)
+	require.Equal(t, int64(3333), lines[2].Amount)
+	require.Equal(t, "Night of 2022-10-03", lines[2].Description)
+
+	// same day stays are billed as one line
+	lines = nightLines(&repo.Booking{FromDate: "2022-10-01", ToDate: "2022-10-01", Price: 5000})
+	require.Len(t, lines, 1)
+	require.Equal(t, int64(5000), lines[0].Amount)
+}
+
+func TestChargeLines(t *testing.T) {
+	lines := chargeLines(&repo.Booking{Charges: []repo.BookingCharge{
+		{Name: "VAT", Kind: repo.TaxRuleKindTax, Inclusive: true, Quantity: 1, UnitAmount: 1200, Amount: 1200},
+		{Name: "Cleaning", Kind: repo.TaxRuleKindFee, Quantity: 1, UnitAmount: 1500, Amount: 1500},
+		{Name: "Summer sale", Kind: repo.ChargeKindDiscount, CampaignID: 1, Quantity: 1, UnitAmount: -1000, Amount: -1000},
+	}})
+
+	require.Len(t, lines, 3)
+	require.Equal(t, repo.InvoiceLineTax, lines[0].Kind)
+	require.True(t, lines[0].Included)
+	require.Equal(t, repo.InvoiceLineFee, lines[1].Kind)
+	require.False(t, lines[1].Included)
+	require.Equal(t, repo.InvoiceLineDiscount, lines[2].Kind)
+}
+
+func TestPaymentLines(t *testing.T) {
+	at := time.Date(2022, 10, 1, 0, 0, 0, 0, time.UTC)
+	lines := paymentLines([]*repo.Payment{
+		{Amount: 5000, Status: repo.PaymentStatusCaptured, CreatedAt: at, Refunds: []*repo.Refund{
+			{Amount: 1000, Status: repo.RefundStatusSucceeded, CreatedAt: at},
+			{Amount: 500, Status: repo.RefundStatusFailed, CreatedAt: at},
+		}},
+		{Amount: 2000, Status: repo.PaymentStatusFailed, CreatedAt: at},
+	})
+
+	require.Len(t, lines, 2)
+	require.Equal(t, repo.InvoiceLinePayment, lines[0].Kind)
+	require.Equal(t, int64(-1000), lines[1].Amount)
+}
+
+func TestVerifyInvoice(t *testing.T) {
+	inv := &repo.Invoice{
+		Content:  []byte("%PDF-1.4"),
+		Checksum: "e16fa5d9b51928755db85b917f0297babaf22c7a47e97d9212adab56e61ba04e",
+	}
+	require.NoError(t, verifyInvoice(inv))
+
+	inv.Content = []byte("%PDF-1.5")
+	require.Error(t, verifyInvoice(inv))
+}
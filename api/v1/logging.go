@@ -0,0 +1,64 @@
+package v1
+
+import (
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/exp/slog"
+)
+
+// RequestLogger writes one record per request. The route template is logged
+// instead of the URL so ids, query strings and tokens in them stay out of
+// the logs. Errors handlers attached with c.Error are included.
+func (h *handlerV1) RequestLogger(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	status := c.Writer.Status()
+	attrs := []interface{}{
+		"method", c.Request.Method,
+		"route", route,
+		"status", status,
+		"latency", time.Since(start),
+		"ip", c.ClientIP(),
+	}
+
+	ctx := c.Request.Context()
+	switch {
+	case status >= 500:
+		var err error
+		if last := c.Errors.Last(); last != nil {
+			err = last.Err
+		}
+		slog.ErrorCtx(ctx, "request failed", err, attrs...)
+	case status >= 400:
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, "error", strings.Join(c.Errors.Errors(), "; "))
+		}
+		slog.WarnCtx(ctx, "request rejected", attrs...)
+	default:
+		slog.InfoCtx(ctx, "request handled", attrs...)
+	}
+}
+
+// Recovery turns a panic into a 500 response and logs it with the stack.
+func (h *handlerV1) Recovery(c *gin.Context) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			slog.ErrorCtx(c.Request.Context(), "panic recovered", fmt.Errorf("%v", recovered),
+				"stack", string(debug.Stack()),
+			)
+			handleError(c, fmt.Errorf("panic: %v", recovered))
+		}
+	}()
+
+	c.Next()
+}
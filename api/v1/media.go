@@ -0,0 +1,162 @@
+package v1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/blob"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+func mediaURL(fileName string) string {
+	return "/media/" + fileName
+}
+
+// images loads the media behind the given ids in one query and returns
+// their image responses by id. Nil ids are skipped.
+func (h *handlerV1) images(ctx context.Context, ids ...*int64) (map[int64]*models.Image, error) {
+	result := make(map[int64]*models.Image)
+
+	var wanted []int64
+	for _, id := range ids {
+		if id != nil {
+			wanted = append(wanted, *id)
+		}
+	}
+	if len(wanted) == 0 {
+		return result, nil
+	}
+
+	media, err := h.storage.Media().GetMany(ctx, wanted)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range media {
+		result[m.ID] = parseImageModel(m)
+	}
+
+	return result, nil
+}
+
+// imageOf returns the uploaded image with the given id, or legacyURL as a
+// bare image for records created before uploads existed.
+func imageOf(images map[int64]*models.Image, id *int64, legacyURL *string) *models.Image {
+	if id == nil {
+		if legacyURL != nil && *legacyURL != "" {
+			return &models.Image{URL: *legacyURL}
+		}
+		return nil
+	}
+	return images[*id]
+}
+
+func parseImageModel(m *repo.Media) *models.Image {
+	image := models.Image{
+		URL:    mediaURL(m.FileName),
+		Width:  m.Width,
+		Height: m.Height,
+	}
+
+	derivatives := append([]*repo.Derivative(nil), m.Derivatives...)
+	sort.Slice(derivatives, func(i, j int) bool {
+		return derivatives[i].Width < derivatives[j].Width
+	})
+
+	candidates := make([]string, 0, len(derivatives)+1)
+	for _, d := range derivatives {
+		if image.Sizes == nil {
+			image.Sizes = make(map[string]string, len(derivatives))
+		}
+		image.Sizes[d.Name] = mediaURL(d.FileName)
+		candidates = append(candidates, fmt.Sprintf("%s %dw", mediaURL(d.FileName), d.Width))
+	}
+	candidates = append(candidates, fmt.Sprintf("%s %dw", image.URL, m.Width))
+	image.Srcset = strings.Join(candidates, ", ")
+
+	return &image
+}
+
+// ServeMedia serves a media file from the blob store. With BLOB_SERVE set
+// to "redirect" clients are sent to a presigned URL when the store has one,
+// otherwise the file is streamed through the API. Names are content
+// addressed, so files can be cached forever.
+func (h *handlerV1) ServeMedia(c *gin.Context) {
+	key := strings.TrimPrefix(c.Param("key"), "/")
+
+	if h.cfg.Blob.Serve == "redirect" {
+		u, err := h.blobs.URL(c.Request.Context(), key, h.cfg.Blob.URLExpiry)
+		if errors.Is(err, blob.ErrInvalidKey) {
+			handleError(c, errs.NotFound("media"))
+			return
+		}
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+		if u != "" {
+			c.Redirect(http.StatusFound, u)
+			return
+		}
+	}
+
+	obj, err := h.blobs.Get(c.Request.Context(), key)
+	if errors.Is(err, blob.ErrNotFound) || errors.Is(err, blob.ErrInvalidKey) {
+		handleError(c, errs.NotFound("media"))
+		return
+	}
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	defer obj.Close()
+
+	c.DataFromReader(http.StatusOK, obj.Size, obj.ContentType, obj, map[string]string{
+		"Cache-Control":          "public, max-age=31536000, immutable",
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// @Security ApiKeyAuth
+// @Router /media/orphans [get]
+// @Summary Report orphaned media
+// @Description Dry run of the media garbage collector: lists the media no hotel or room refers to and the files that would be deleted, without deleting anything. Superadmin only.
+// @Tags file-upload
+// @Produce json
+// @Success 200 {object} models.MediaSweepReport
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetOrphanedMedia(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	report, err := h.sweeper.Sweep(c.Request.Context(), true)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.MediaSweepReport{
+		DryRun:       report.DryRun,
+		Media:        report.Media,
+		Files:        report.Files,
+		Bytes:        report.Bytes,
+		Unrecognized: report.Unrecognized,
+	})
+}
@@ -0,0 +1,73 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/blob"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseImageModel(t *testing.T) {
+	image := parseImageModel(&repo.Media{
+		FileName: "abc.jpg",
+		Width:    1920,
+		Height:   1080,
+		Derivatives: []*repo.Derivative{
+			{Name: "medium", FileName: "abc_medium.jpg", Width: 800},
+			{Name: "thumbnail", FileName: "abc_thumbnail.jpg", Width: 200},
+		},
+	})
+
+	require.Equal(t, "/media/abc.jpg", image.URL)
+	require.Equal(t, "/media/abc_thumbnail.jpg 200w, /media/abc_medium.jpg 800w, /media/abc.jpg 1920w", image.Srcset)
+	require.Equal(t, map[string]string{
+		"thumbnail": "/media/abc_thumbnail.jpg",
+		"medium":    "/media/abc_medium.jpg",
+	}, image.Sizes)
+
+	// not processed yet
+	image = parseImageModel(&repo.Media{FileName: "abc.jpg", Width: 1920})
+	require.Equal(t, "/media/abc.jpg 1920w", image.Srcset)
+	require.Nil(t, image.Sizes)
+}
+
+func TestImageOfLegacyURL(t *testing.T) {
+	legacy := "https://example.com/hotel.jpg"
+	uploaded := &models.Image{URL: "/media/abc.jpg"}
+	id := int64(7)
+	images := map[int64]*models.Image{id: uploaded}
+
+	require.Equal(t, uploaded, imageOf(images, &id, &legacy))
+	require.Equal(t, &models.Image{URL: legacy}, imageOf(images, nil, &legacy))
+	require.Nil(t, imageOf(images, nil, nil))
+}
+
+func TestServeMedia(t *testing.T) {
+	store := blob.NewLocal(t.TempDir())
+	require.NoError(t, store.Put(context.Background(), "abc.jpg", strings.NewReader("jpeg"), 4, "image/jpeg"))
+
+	h := &handlerV1{cfg: &config.Config{Blob: config.Blob{Serve: "redirect"}}, blobs: store}
+	router := gin.New()
+	router.GET("/media/*key", h.ServeMedia)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/media/abc.jpg", nil))
+	// the local store has no URLs of its own, so it is proxied anyway
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "jpeg", w.Body.String())
+	require.Equal(t, "image/jpeg", w.Header().Get("Content-Type"))
+
+	for _, path := range []string{"/media/missing.jpg", "/media/../config/config.go", "/media/%2e%2e/go.mod"} {
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, http.StatusNotFound, w.Code, path)
+	}
+}
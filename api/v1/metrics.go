@@ -0,0 +1,26 @@
+package v1
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// HTTPMetrics records request latency by route template, so /hotels/1 and
+// /hotels/2 share a series. Unmatched paths are grouped together to keep
+// the label set bounded.
+func (h *handlerV1) HTTPMetrics(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+
+	metrics.HTTPRequestDuration.
+		WithLabelValues(c.Request.Method, route, strconv.Itoa(c.Writer.Status())).
+		Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,47 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPMetricsUsesRouteTemplate(t *testing.T) {
+	h := &handlerV1{}
+
+	router := gin.New()
+	router.Use(h.HTTPMetrics)
+	router.GET("/metrics-test/:id", func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	for _, path := range []string{"/metrics-test/1", "/metrics-test/2", "/not-a-route"} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Both ids share the route template series, the unknown path gets its
+	// own "unmatched" one.
+	require.Equal(t, 2, testutil.CollectAndCount(metrics.HTTPRequestDuration))
+}
+
+func TestHTTPMetricsRecordsPanics(t *testing.T) {
+	h := &handlerV1{}
+
+	router := gin.New()
+	router.Use(h.HTTPMetrics, h.Recovery)
+	router.GET("/metrics-panic", func(c *gin.Context) {
+		panic("boom")
+	})
+
+	before := testutil.CollectAndCount(metrics.HTTPRequestDuration)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics-panic", nil))
+
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Equal(t, before+1, testutil.CollectAndCount(metrics.HTTPRequestDuration))
+}
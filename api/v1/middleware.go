@@ -2,28 +2,85 @@ package v1
 
 import (
 	"errors"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/logger"
 	"github.com/MuhammadyusufAdhamov/booking/pkg/utils"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/gin-gonic/gin"
-	"net/http"
+	"github.com/google/uuid"
 )
 
 const (
 	authorizationHeaderKey  = "authorization"
 	authorizationPayloadKey = "authorization_payload"
+	requestIDHeaderKey      = "X-Request-ID"
+	requestIDKey            = "request_id"
+	maxRequestIDLength      = 128
 )
 
+var ErrAuthorizationRequired = errs.New(errs.CodeUnauthorized, "authorization header is not provided")
+
+// RequestIDMiddleware reuses the caller's X-Request-ID when it looks sane and
+// generates one otherwise. The ID is echoed back in the response.
+func (h *handlerV1) RequestIDMiddleware(c *gin.Context) {
+	requestID := c.GetHeader(requestIDHeaderKey)
+	if !validRequestID(requestID) {
+		requestID = uuid.NewString()
+	}
+
+	c.Set(requestIDKey, requestID)
+	c.Header(requestIDHeaderKey, requestID)
+	c.Request = c.Request.WithContext(logger.WithRequestID(c.Request.Context(), requestID))
+	c.Next()
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ActorMiddleware attaches the caller to the request context so repositories
+// can record it in the audit log. A missing or invalid token is not an error
+// here, routes that require a user are guarded by AuthMiddleware.
+func (h *handlerV1) ActorMiddleware(c *gin.Context) {
+	actor := &repo.Actor{
+		IP:        c.ClientIP(),
+		RequestID: c.GetString(requestIDKey),
+	}
+
+	accessToken := c.GetHeader(authorizationHeaderKey)
+	if accessToken != "" {
+		payload, err := utils.VerifyToken(h.cfg, accessToken)
+		if err == nil {
+			actor.UserID = &payload.UserID
+			actor.UserType = payload.UserType
+		}
+	}
+
+	c.Request = c.Request.WithContext(repo.WithActor(c.Request.Context(), actor))
+	c.Next()
+}
+
 func (h *handlerV1) AuthMiddleware(c *gin.Context) {
 	accessToken := c.GetHeader(authorizationHeaderKey)
 
 	if len(accessToken) == 0 {
-		err := errors.New("authorization header is not provided")
-		c.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+		handleError(c, ErrAuthorizationRequired)
 		return
 	}
 
 	payload, err := utils.VerifyToken(h.cfg, accessToken)
 	if err != nil {
-		c.AbortWithStatusJSON(http.StatusUnauthorized, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
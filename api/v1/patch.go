@@ -0,0 +1,114 @@
+package v1
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"reflect"
+	"strings"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/utils"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+const mergePatchContentType = "application/merge-patch+json"
+
+var (
+	ErrUnsupportedPatchType = errs.New(errs.CodeUnsupportedMediaType, "PATCH body must be "+mergePatchContentType)
+	ErrPatchNotObject       = errs.New(errs.CodeValidation, "merge patch must be a JSON object")
+)
+
+// mergePatchRequest applies the request body as an RFC 7396 merge patch to
+// original and decodes the result into merged, which must point to the same
+// request model type. The merged model is validated like a create request.
+// It returns the changed fields keyed by their JSON names, which match the
+// column names.
+func mergePatchRequest(c *gin.Context, original, merged interface{}) (map[string]interface{}, error) {
+	contentType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+	if err != nil || (contentType != mergePatchContentType && contentType != binding.MIMEJSON) {
+		return nil, ErrUnsupportedPatchType
+	}
+
+	patch, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.HasPrefix(bytes.TrimSpace(patch), []byte("{")) {
+		return nil, ErrPatchNotObject
+	}
+
+	target, err := json.Marshal(original)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := utils.MergePatch(target, patch)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(result))
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(merged)
+	if err != nil {
+		if field, ok := unknownField(err); ok {
+			return nil, errs.Validation(errs.Field(field, "can not be changed"))
+		}
+		return nil, err
+	}
+
+	err = binding.Validator.ValidateStruct(merged)
+	if err != nil {
+		return nil, err
+	}
+
+	return changedFields(original, merged)
+}
+
+// unknownField extracts the name from encoding/json's unknown field error,
+// which has no typed form.
+func unknownField(err error) (string, bool) {
+	const prefix = "json: unknown field "
+	if !strings.HasPrefix(err.Error(), prefix) {
+		return "", false
+	}
+	return strings.Trim(strings.TrimPrefix(err.Error(), prefix), `"`), true
+}
+
+// changedFields compares the models field by field. Every field needs a
+// JSON name since it doubles as the column name.
+func changedFields(original, merged interface{}) (map[string]interface{}, error) {
+	before := reflect.ValueOf(original).Elem()
+	after := reflect.ValueOf(merged).Elem()
+	fields := make(map[string]interface{})
+
+	for i := 0; i < before.NumField(); i++ {
+		name, err := patchFieldName(before.Type().Field(i))
+		if err != nil {
+			return nil, err
+		}
+
+		if name == "-" {
+			continue
+		}
+
+		if !reflect.DeepEqual(before.Field(i).Interface(), after.Field(i).Interface()) {
+			fields[name] = after.Field(i).Interface()
+		}
+	}
+
+	return fields, nil
+}
+
+func patchFieldName(field reflect.StructField) (string, error) {
+	name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+	if name == "" {
+		return "", fmt.Errorf("patch model field %s has no json name", field.Name)
+	}
+	return name, nil
+}
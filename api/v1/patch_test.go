@@ -0,0 +1,86 @@
+package v1
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func patchContext(body, contentType string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPatch, "/", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", contentType)
+	return c
+}
+
+func TestMergePatchRequest(t *testing.T) {
+	registerValidators()
+
+	image := int64(7)
+	original := models.CreateHotelRequest{
+		UserID:        1,
+		HotelName:     "Hilton",
+		HotelLocation: "Tashkent",
+		ImageID:       &image,
+		NumberOfRooms: 10,
+	}
+
+	var merged models.CreateHotelRequest
+	fields, err := mergePatchRequest(patchContext(`{"hotel_name":"Hyatt"}`, mergePatchContentType), &original, &merged)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"hotel_name": "Hyatt"}, fields)
+	require.Equal(t, &image, merged.ImageID)
+
+	_, err = mergePatchRequest(patchContext(`{"number_of_rooms":0}`, mergePatchContentType), &original, &merged)
+	require.Equal(t, "number_of_rooms", translateError(err).Fields[0].Field)
+
+	_, err = mergePatchRequest(patchContext(`{"version":3}`, "application/json"), &original, &merged)
+	require.Equal(t, "version", translateError(err).Fields[0].Field)
+
+	_, err = mergePatchRequest(patchContext(`{"hotel_name":"Hyatt"}`, "text/plain"), &original, &merged)
+	require.ErrorIs(t, err, ErrUnsupportedPatchType)
+
+	_, err = mergePatchRequest(patchContext(`[]`, mergePatchContentType), &original, &merged)
+	require.ErrorIs(t, err, ErrPatchNotObject)
+}
+
+// patchModels are the request models the PATCH handlers merge into.
+var patchModels = []interface{}{
+	models.PatchUserRequest{},
+	models.CreateHotelRequest{},
+	models.CreateRoomRequest{},
+	models.CreateBookingRequest{},
+}
+
+func TestPatchModelsHaveJSONNames(t *testing.T) {
+	for _, m := range patchModels {
+		typ := reflect.TypeOf(m)
+		t.Run(typ.Name(), func(t *testing.T) {
+			for i := 0; i < typ.NumField(); i++ {
+				_, err := patchFieldName(typ.Field(i))
+				require.NoError(t, err)
+			}
+
+			original := reflect.New(typ).Interface()
+			merged := reflect.New(typ).Interface()
+			_, err := changedFields(original, merged)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestChangedFieldsUntagged(t *testing.T) {
+	type untagged struct {
+		Name string `json:"name"`
+		Note string
+	}
+
+	_, err := changedFields(&untagged{}, &untagged{Note: "x"})
+	require.Error(t, err)
+}
@@ -0,0 +1,641 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/metrics"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/payments"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/utils"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+// maxWebhookSize bounds the webhook deliveries that are read.
+const maxWebhookSize = 1 << 20
+
+// ErrBookingPaidChange is returned for changes that would reprice a booking
+// that has payments, nothing would settle the difference.
+var ErrBookingPaidChange = errs.New(errs.CodeConflict, "price, currency, hotel and total of a booking with payments cannot change")
+
+var intentStatuses = map[string]string{
+	payments.IntentPending:    repo.PaymentStatusPending,
+	payments.IntentAuthorized: repo.PaymentStatusAuthorized,
+	payments.IntentCaptured:   repo.PaymentStatusCaptured,
+	payments.IntentFailed:     repo.PaymentStatusFailed,
+	payments.IntentCancelled:  repo.PaymentStatusCancelled,
+}
+
+var refundStatuses = map[string]string{
+	payments.RefundPending:   repo.RefundStatusPending,
+	payments.RefundSucceeded: repo.RefundStatusSucceeded,
+	payments.RefundFailed:    repo.RefundStatusFailed,
+}
+
+// @Security ApiKeyAuth
+// @Router /bookings/{id}/payments [post]
+// @Summary Pay for a booking
+// @Description Start a payment towards a booking, by default of its outstanding balance. Authorized payments are captured right away; pending ones are completed by the client with client_secret and reported by the provider's webhook. The booking is confirmed once the deposit has been captured. Amounts are in minor units of the currency.
+// @Tags payment
+// @Accept json
+// @Produce json
+// @Param id path int true "Booking ID"
+// @Param payment body models.CreatePaymentRequest false "Payment"
+// @Success 201 {object} models.Payment
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) CreatePayment(c *gin.Context) {
+	booking, _, err := h.accessibleBooking(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var req models.CreatePaymentRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		handleError(c, err)
+		return
+	}
+
+	// no amount pays the outstanding balance
+	var amount int64
+	if req.Amount != nil {
+		amount = *req.Amount
+	}
+
+	ctx := c.Request.Context()
+	payment, err := h.storage.Payment().Create(ctx, &repo.Payment{
+		BookingID: booking.ID,
+		Provider:  h.payments.Name(),
+		Amount:    amount,
+		Status:    repo.PaymentStatusPending,
+	})
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	intent, err := h.payments.CreateIntent(ctx, payment.Amount, payment.Currency, "payment_"+strconv.FormatInt(payment.ID, 10))
+	if err != nil {
+		// a pending payment would hold the balance back
+		if _, setErr := h.storage.Payment().SetStatus(ctx, payment.ID, repo.PaymentStatusFailed); setErr != nil {
+			_ = c.Error(setErr)
+		}
+		handleError(c, err)
+		return
+	}
+
+	err = h.storage.Payment().SetProviderRef(ctx, payment.ID, intent.ID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	payment.ProviderRef = intent.ID
+
+	payment, err = h.applyIntent(ctx, payment, intent.ID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	result := parsePaymentModel(payment)
+	result.ClientSecret = intent.ClientSecret
+	c.JSON(http.StatusCreated, result)
+}
+
+// @Security ApiKeyAuth
+// @Router /bookings/{id}/payments [get]
+// @Summary Get the payments of a booking
+// @Description Get the payments of a booking with their refunds, oldest first
+// @Tags payment
+// @Accept json
+// @Produce json
+// @Param id path int true "Booking ID"
+// @Success 200 {object} models.GetAllPaymentsResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetBookingPayments(c *gin.Context) {
+	booking, _, err := h.accessibleBooking(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	list, err := h.storage.Payment().GetByBooking(c.Request.Context(), booking.ID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response := models.GetAllPaymentsResponse{
+		Payments: make([]*models.Payment, 0, len(list)),
+	}
+	for _, p := range list {
+		payment := parsePaymentModel(p)
+		response.Payments = append(response.Payments, &payment)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Security ApiKeyAuth
+// @Router /bookings/{id}/cancel [post]
+// @Summary Cancel a booking
+// @Description Cancel a booking and refund it. Cancelling at least the free cancellation period before check-in refunds everything that was paid, later cancellations get the late refund percentage back. Superadmins may refund a different amount. Payments that were not captured are cancelled with the provider. Nothing changes when the request is invalid. Cancelling again retries refunds that failed.
+// @Tags payment
+// @Accept json
+// @Produce json
+// @Param id path int true "Booking ID"
+// @Param cancellation body models.CancelBookingRequest false "Cancellation"
+// @Success 200 {object} models.CancelBookingResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) CancelBooking(c *gin.Context) {
+	booking, payload, err := h.accessibleBooking(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var req models.CancelBookingRequest
+	err = c.ShouldBindJSON(&req)
+	if err != nil && !errors.Is(err, io.EOF) {
+		handleError(c, err)
+		return
+	}
+
+	if req.RefundAmount != nil && payload.UserType != repo.UserTypeSuperadmin {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	ctx := c.Request.Context()
+	wasCancelled := booking.Status == repo.BookingStatusCancelled
+	if !wasCancelled && !repo.CanTransition(repo.BookingTransitions, booking.Status, repo.BookingStatusCancelled) {
+		handleError(c, repo.ErrBookingState)
+		return
+	}
+
+	list, err := h.storage.Payment().GetByBooking(ctx, booking.ID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	// checked before anything changes, payments in flight are not refundable
+	if req.RefundAmount != nil {
+		b := paymentBalance(list)
+		if refundable := b.captured - b.refunded; *req.RefundAmount > refundable {
+			handleError(c, errs.Validation(errs.Field("refund_amount", fmt.Sprintf("must not exceed the refundable %d", refundable))))
+			return
+		}
+	}
+
+	statuses, err := h.cancelPayments(ctx, list)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	var amount int64
+	if req.RefundAmount != nil {
+		amount = *req.RefundAmount
+	} else {
+		b := paymentBalance(list)
+		percent := refundPercent(&h.cfg.Payments, checkIn(booking), time.Now())
+		amount = b.captured*int64(percent)/100 - b.refunded
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = "booking cancelled"
+	}
+
+	// cancelling again only records new refunds, so failed ones can be retried
+	booking, refunds, err := h.storage.Payment().CancelBooking(ctx, booking.ID, statuses, planRefunds(list, amount, reason))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if !wasCancelled {
+		metrics.BookingsCancelled.Inc()
+	}
+
+	byID := make(map[int64]*repo.Payment, len(list))
+	for _, p := range list {
+		byID[p.ID] = p
+	}
+
+	// every recorded refund is sent or failed, or it would hold the payment back
+	var sendErr error
+	for i, r := range refunds {
+		sent, err := h.sendRefund(ctx, byID[r.PaymentID], r)
+		if err != nil {
+			if sendErr == nil {
+				sendErr = err
+			}
+			continue
+		}
+		refunds[i] = sent
+	}
+
+	if sendErr != nil {
+		handleError(c, sendErr)
+		return
+	}
+
+	response := models.CancelBookingResponse{
+		Booking: parseBookingModel(booking),
+		Refunds: make([]*models.Refund, 0, len(refunds)),
+	}
+	for _, r := range refunds {
+		refund := parseRefundModel(r)
+		response.Refunds = append(response.Refunds, &refund)
+	}
+
+	setETag(c, booking.Version)
+	c.JSON(http.StatusOK, response)
+}
+
+// @Router /payments/webhook [post]
+// @Summary Receive payment provider events
+// @Description Called by the payment provider when a payment or refund changes. Deliveries must be signed by the provider; events for unknown or finished payments are acknowledged and ignored.
+// @Tags payment
+// @Accept json
+// @Produce json
+// @Success 200 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) PaymentWebhook(c *gin.Context) {
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookSize))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	event, err := h.payments.ParseWebhook(body, c.Request.Header)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	ctx := c.Request.Context()
+	switch event.Type {
+	case payments.EventIntentUpdated:
+		var payment *repo.Payment
+		payment, err = h.storage.Payment().GetByProviderRef(ctx, h.payments.Name(), event.Intent.ID)
+		if err == nil {
+			_, err = h.applyIntent(ctx, payment, event.Intent.ID)
+		}
+	case payments.EventRefundUpdated:
+		var refund *repo.Refund
+		refund, err = h.storage.Payment().GetRefundByProviderRef(ctx, h.payments.Name(), event.Refund.ID)
+		if err == nil {
+			_, err = h.applyRefund(ctx, refund.ID, event.Refund.Status)
+		}
+	}
+
+	// redelivering these would not change anything
+	if errors.Is(err, sql.ErrNoRows) || errors.Is(err, repo.ErrPaymentState) || errors.Is(err, payments.ErrNotFound) {
+		c.JSON(http.StatusOK, models.ResponseOK{Message: "ignored"})
+		return
+	}
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{Message: "ok"})
+}
+
+// accessibleBooking loads the booking of the :id parameter if the user may
+// see its payments.
+func (h *handlerV1) accessibleBooking(c *gin.Context) (*repo.Booking, *utils.Payload, error) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	booking, err := h.storage.Booking().Get(c.Request.Context(), id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ok, err := h.canAccess(c.Request.Context(), payload, int64(booking.HotelId), &booking.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, ErrForbidden
+	}
+
+	return booking, payload, nil
+}
+
+// applyIntent brings a payment in line with the provider's intent, which is
+// read back from the provider rather than trusted from the caller.
+// Authorized payments are captured right away, and the booking is confirmed
+// once its deposit has been captured. Payments that failed or were
+// cancelled are left alone.
+func (h *handlerV1) applyIntent(ctx context.Context, payment *repo.Payment, intentID string) (*repo.Payment, error) {
+	if payment.Status == repo.PaymentStatusFailed || payment.Status == repo.PaymentStatusCancelled {
+		return payment, nil
+	}
+
+	intent, err := h.payments.GetIntent(ctx, intentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if intent.Status == payments.IntentAuthorized {
+		captured, err := h.payments.Capture(ctx, intent.ID, payment.Amount)
+		if err != nil {
+			return nil, err
+		}
+		intent = captured
+	}
+
+	status, ok := intentStatuses[intent.Status]
+	if !ok {
+		return nil, fmt.Errorf("unknown intent status %q", intent.Status)
+	}
+
+	payment, err = h.storage.Payment().SetStatus(ctx, payment.ID, status)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment.Status == repo.PaymentStatusCaptured {
+		err = h.confirmIfPaid(ctx, payment.BookingID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return payment, nil
+}
+
+// confirmIfPaid confirms a pending booking once its deposit has been
+// captured.
+func (h *handlerV1) confirmIfPaid(ctx context.Context, bookingID int64) error {
+	booking, err := h.storage.Booking().Get(ctx, bookingID)
+	if err != nil {
+		return err
+	}
+
+	if booking.Status != repo.BookingStatusPending {
+		return nil
+	}
+
+	list, err := h.storage.Payment().GetByBooking(ctx, bookingID)
+	if err != nil {
+		return err
+	}
+
+	if paymentBalance(list).paid() < h.requiredDeposit(booking) {
+		return nil
+	}
+
+	_, err = h.storage.Booking().SetStatus(ctx, bookingID, repo.BookingStatusConfirmed)
+	return err
+}
+
+// checkPaidChange rejects changes to the price, currency, hotel or total of
+// a booking that has captured payments or payments in flight.
+func (h *handlerV1) checkPaidChange(ctx context.Context, current, changed *repo.Booking) error {
+	if changed.Price == current.Price && changed.Currency == current.Currency &&
+		changed.HotelId == current.HotelId && changed.Total == current.Total {
+		return nil
+	}
+
+	list, err := h.storage.Payment().GetByBooking(ctx, current.ID)
+	if err != nil {
+		return err
+	}
+
+	if b := paymentBalance(list); b.captured > 0 || b.inFlight > 0 {
+		return ErrBookingPaidChange
+	}
+
+	return nil
+}
+
+// cancelPayments voids the payments of a booking that were not captured
+// with the provider and returns their new statuses. A payment the customer
+// completed in the meantime comes back captured and is updated in list, so
+// it is refunded like the others.
+func (h *handlerV1) cancelPayments(ctx context.Context, list []*repo.Payment) (map[int64]string, error) {
+	statuses := make(map[int64]string)
+
+	for _, p := range list {
+		if p.Status != repo.PaymentStatusPending && p.Status != repo.PaymentStatusAuthorized {
+			continue
+		}
+
+		// the provider never saw it
+		if p.ProviderRef == "" {
+			statuses[p.ID] = repo.PaymentStatusCancelled
+			p.Status = repo.PaymentStatusCancelled
+			continue
+		}
+
+		intent, err := h.payments.Cancel(ctx, p.ProviderRef)
+		if err != nil {
+			return nil, err
+		}
+
+		status, ok := intentStatuses[intent.Status]
+		if !ok {
+			return nil, fmt.Errorf("unknown intent status %q", intent.Status)
+		}
+
+		statuses[p.ID] = status
+		p.Status = status
+	}
+
+	return statuses, nil
+}
+
+// planRefunds spreads amount over the captured payments, newest first.
+func planRefunds(list []*repo.Payment, amount int64, reason string) []*repo.Refund {
+	result := make([]*repo.Refund, 0)
+
+	for i := len(list) - 1; i >= 0 && amount > 0; i-- {
+		p := list[i]
+		if p.Status != repo.PaymentStatusCaptured {
+			continue
+		}
+
+		available := p.Amount - p.Refunded - pendingRefunds(p)
+		if available <= 0 {
+			continue
+		}
+		if available > amount {
+			available = amount
+		}
+
+		result = append(result, &repo.Refund{
+			PaymentID: p.ID,
+			Amount:    available,
+			Reason:    reason,
+		})
+		amount -= available
+	}
+
+	return result
+}
+
+// sendRefund asks the provider for a refund that has been recorded.
+func (h *handlerV1) sendRefund(ctx context.Context, payment *repo.Payment, refund *repo.Refund) (*repo.Refund, error) {
+	result, err := h.payments.Refund(ctx, payment.ProviderRef, refund.Amount, "refund_"+strconv.FormatInt(refund.ID, 10))
+	if err != nil {
+		// the provider never saw it, so it must not hold the amount back
+		if _, setErr := h.storage.Payment().SetRefundStatus(ctx, refund.ID, repo.RefundStatusFailed); setErr != nil {
+			return nil, setErr
+		}
+		return nil, err
+	}
+
+	err = h.storage.Payment().SetRefundProviderRef(ctx, refund.ID, result.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return h.applyRefund(ctx, refund.ID, result.Status)
+}
+
+func (h *handlerV1) applyRefund(ctx context.Context, id int64, providerStatus string) (*repo.Refund, error) {
+	status, ok := refundStatuses[providerStatus]
+	if !ok {
+		return nil, fmt.Errorf("unknown refund status %q", providerStatus)
+	}
+
+	return h.storage.Payment().SetRefundStatus(ctx, id, status)
+}
+
+// requiredDeposit is how much has to be captured before a booking is
+// confirmed, rounded up to a whole minor unit.
+func (h *handlerV1) requiredDeposit(booking *repo.Booking) int64 {
+	return (booking.Total*int64(h.cfg.Payments.DepositPercent) + 99) / 100
+}
+
+// refundPercent is the share of what was paid that a cancellation at now
+// gets back.
+func refundPercent(cfg *config.Payments, checkIn, now time.Time) int {
+	if checkIn.Sub(now) >= cfg.FreeCancellation {
+		return 100
+	}
+	return cfg.LateRefundPercent
+}
+
+// checkIn is the start of the check-in day.
+func checkIn(booking *repo.Booking) time.Time {
+	t, _ := time.Parse(isoDateLayout, isoDate(booking.FromDate))
+	return t
+}
+
+// isoDate cuts a booking date down to isoDateLayout, dropping a time part
+// older rows may have.
+func isoDate(date string) string {
+	if len(date) > len(isoDateLayout) {
+		return date[:len(isoDateLayout)]
+	}
+	return date
+}
+
+// balance sums up the payments of a booking. Refunded includes refunds that
+// are still pending, inFlight the payments not captured yet.
+type balance struct {
+	captured int64
+	refunded int64
+	inFlight int64
+}
+
+func (b balance) paid() int64 {
+	return b.captured - b.refunded
+}
+
+func paymentBalance(list []*repo.Payment) balance {
+	var b balance
+	for _, p := range list {
+		switch p.Status {
+		case repo.PaymentStatusCaptured:
+			b.captured += p.Amount
+			b.refunded += p.Refunded + pendingRefunds(p)
+		case repo.PaymentStatusPending, repo.PaymentStatusAuthorized:
+			b.inFlight += p.Amount
+		}
+	}
+	return b
+}
+
+func pendingRefunds(p *repo.Payment) int64 {
+	var sum int64
+	for _, r := range p.Refunds {
+		if r.Status == repo.RefundStatusPending {
+			sum += r.Amount
+		}
+	}
+	return sum
+}
+
+func parsePaymentModel(p *repo.Payment) models.Payment {
+	result := models.Payment{
+		ID:        p.ID,
+		BookingID: p.BookingID,
+		Provider:  p.Provider,
+		Amount:    p.Amount,
+		Currency:  p.Currency,
+		Status:    p.Status,
+		Refunded:  p.Refunded,
+		Refunds:   make([]*models.Refund, 0, len(p.Refunds)),
+		CreatedAt: p.CreatedAt,
+		UpdatedAt: p.UpdatedAt,
+	}
+
+	for _, r := range p.Refunds {
+		refund := parseRefundModel(r)
+		result.Refunds = append(result.Refunds, &refund)
+	}
+
+	return result
+}
+
+func parseRefundModel(r *repo.Refund) models.Refund {
+	return models.Refund{
+		ID:        r.ID,
+		PaymentID: r.PaymentID,
+		Amount:    r.Amount,
+		Reason:    r.Reason,
+		Status:    r.Status,
+		CreatedAt: r.CreatedAt,
+	}
+}
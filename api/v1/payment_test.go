@@ -0,0 +1,147 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/payments"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefundPercent(t *testing.T) {
+	cfg := &config.Payments{FreeCancellation: 48 * time.Hour, LateRefundPercent: 50}
+	checkIn := time.Date(2022, 10, 10, 0, 0, 0, 0, time.UTC)
+
+	require.Equal(t, 100, refundPercent(cfg, checkIn, checkIn.Add(-72*time.Hour)))
+	require.Equal(t, 100, refundPercent(cfg, checkIn, checkIn.Add(-48*time.Hour)))
+	require.Equal(t, 50, refundPercent(cfg, checkIn, checkIn.Add(-time.Hour)))
+	require.Equal(t, 50, refundPercent(cfg, checkIn, checkIn.Add(time.Hour)))
+}
+
+func TestPaymentBalance(t *testing.T) {
+	b := paymentBalance([]*repo.Payment{
+		{Amount: 5000, Status: repo.PaymentStatusCaptured, Refunded: 1000, Refunds: []*repo.Refund{
+			{Amount: 1000, Status: repo.RefundStatusSucceeded},
+			{Amount: 500, Status: repo.RefundStatusPending},
+		}},
+		{Amount: 2000, Status: repo.PaymentStatusPending},
+		{Amount: 3000, Status: repo.PaymentStatusFailed},
+	})
+
+	require.Equal(t, int64(5000), b.captured)
+	require.Equal(t, int64(1500), b.refunded)
+	require.Equal(t, int64(3500), b.paid())
+	require.Equal(t, int64(2000), b.inFlight)
+}
+
+func TestPlanRefunds(t *testing.T) {
+	list := []*repo.Payment{
+		{ID: 1, Amount: 5000, Status: repo.PaymentStatusCaptured},
+		{ID: 2, Amount: 2000, Status: repo.PaymentStatusCancelled},
+		{ID: 3, Amount: 3000, Status: repo.PaymentStatusCaptured, Refunds: []*repo.Refund{
+			{Amount: 1000, Status: repo.RefundStatusPending},
+		}},
+	}
+
+	// newest first, leaving out what is being refunded already
+	refunds := planRefunds(list, 4000, "booking cancelled")
+	require.Len(t, refunds, 2)
+	require.Equal(t, int64(3), refunds[0].PaymentID)
+	require.Equal(t, int64(2000), refunds[0].Amount)
+	require.Equal(t, int64(1), refunds[1].PaymentID)
+	require.Equal(t, int64(2000), refunds[1].Amount)
+	require.Equal(t, "booking cancelled", refunds[1].Reason)
+
+	require.Empty(t, planRefunds(list, 0, ""))
+	require.Empty(t, planRefunds(list, -100, ""))
+}
+
+func TestCancelPayments(t *testing.T) {
+	ctx := context.Background()
+	fake := payments.NewFake("secret")
+	h := &handlerV1{payments: fake}
+
+	pending, err := fake.CreateIntent(ctx, 10002, "USD", "payment_1")
+	require.NoError(t, err)
+	completed, err := fake.CreateIntent(ctx, 10000, "USD", "payment_2")
+	require.NoError(t, err)
+	_, err = fake.Capture(ctx, completed.ID, 10000)
+	require.NoError(t, err)
+
+	list := []*repo.Payment{
+		{ID: 1, ProviderRef: pending.ID, Amount: 10002, Status: repo.PaymentStatusPending},
+		{ID: 2, ProviderRef: completed.ID, Amount: 10000, Status: repo.PaymentStatusAuthorized},
+		{ID: 3, Amount: 5000, Status: repo.PaymentStatusPending},
+		{ID: 4, Amount: 5000, Status: repo.PaymentStatusCaptured},
+	}
+
+	statuses, err := h.cancelPayments(ctx, list)
+	require.NoError(t, err)
+	require.Equal(t, map[int64]string{
+		1: repo.PaymentStatusCancelled,
+		2: repo.PaymentStatusCaptured,
+		3: repo.PaymentStatusCancelled,
+	}, statuses)
+
+	// the payment completed meanwhile is refunded with the others
+	require.Equal(t, int64(15000), paymentBalance(list).captured)
+
+	// the customer can no longer complete the cancelled one
+	_, err = fake.Capture(ctx, pending.ID, 10002)
+	require.ErrorIs(t, err, payments.ErrInvalidState)
+}
+
+func TestRequiredDeposit(t *testing.T) {
+	h := &handlerV1{cfg: &config.Config{Payments: config.Payments{DepositPercent: 30}}}
+
+	require.Equal(t, int64(3000), h.requiredDeposit(&repo.Booking{Total: 10000}))
+	require.Equal(t, int64(1), h.requiredDeposit(&repo.Booking{Total: 1}))
+	require.Zero(t, h.requiredDeposit(&repo.Booking{Total: 0}))
+}
+
+func TestPaymentWebhookRequiresSignature(t *testing.T) {
+	fake := payments.NewFake("secret")
+	h := &handlerV1{payments: fake}
+
+	router := gin.New()
+	router.POST("/payments/webhook", h.PaymentWebhook)
+
+	body := `{"id":"evt_1","type":"intent.updated","intent":{"id":"pi_fake_x","status":"captured"}}`
+
+	tests := []struct {
+		name      string
+		signature string
+		status    int
+	}{
+		{"unsigned", "", http.StatusBadRequest},
+		{"signed with another secret", payments.NewFake("other").SignWebhook([]byte(body)), http.StatusBadRequest},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/payments/webhook", strings.NewReader(body))
+			req.Header.Set(payments.FakeSignatureHeader, tc.signature)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, tc.status, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestCheckPaidChangeUnchanged(t *testing.T) {
+	// nothing is looked up when the booking is not repriced
+	h := &handlerV1{}
+	current := &repo.Booking{ID: 1, Price: 10000, Currency: "EUR", HotelId: 3, Total: 11200}
+	changed := *current
+	changed.FromDate = "2022-11-02"
+
+	require.NoError(t, h.checkPaidChange(context.Background(), current, &changed))
+}
@@ -0,0 +1,81 @@
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/ratelimit"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v9"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	cfg := config.Load("./../..")
+
+	rdb := redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("redis is not available: %v", err)
+	}
+
+	cfg.RateLimit.Enabled = true
+	cfg.RateLimit.APIKeys = []string{"a", "b"}
+	h := New(&HandlerV1Options{Cfg: &cfg, Limiter: ratelimit.New(rdb)})
+
+	router := gin.New()
+	router.POST("/", h.RateLimit("test-"+uuid.NewString(), config.RateLimitPolicy{
+		Limit:  2,
+		Window: time.Minute,
+		Key:    rateLimitKeyAPIKey,
+	}), func(c *gin.Context) {
+		c.Status(http.StatusNoContent)
+	})
+
+	send := func(apiKey string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/", nil)
+		req.Header.Set(apiKeyHeaderKey, apiKey)
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	require.Equal(t, http.StatusNoContent, send("a").Code)
+
+	w := send("a")
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+	require.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+
+	w = send("a")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	require.Equal(t, http.StatusNoContent, send("b").Code)
+
+	// unknown keys share the quota of the IP
+	require.Equal(t, http.StatusNoContent, send(uuid.NewString()).Code)
+	require.Equal(t, http.StatusNoContent, send(uuid.NewString()).Code)
+	require.Equal(t, http.StatusTooManyRequests, send(uuid.NewString()).Code)
+}
+
+func TestRateLimitIdentityIgnoresForwardedFor(t *testing.T) {
+	router := gin.New()
+	require.NoError(t, router.SetTrustedProxies(nil))
+
+	var identity string
+	router.GET("/", func(c *gin.Context) {
+		identity = rateLimitIdentity(c, rateLimitKeyIP, nil)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	require.Equal(t, "ip:192.0.2.1", identity)
+}
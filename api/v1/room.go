@@ -1,13 +1,10 @@
 package v1
 
 import (
-	"database/sql"
-	"errors"
 	"github.com/MuhammadyusufAdhamov/booking/api/models"
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/gin-gonic/gin"
 	"net/http"
-	"strconv"
 )
 
 // @Router /rooms [post]
@@ -18,6 +15,7 @@ import (
 // @Produce json
 // @Param room body models.CreateRoomRequest true "Room"
 // @Success 201 {object} models.Room
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) CreateRoom(c *gin.Context) {
 	var (
@@ -26,102 +24,185 @@ func (h *handlerV1) CreateRoom(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	err = h.checkReferences(c.Request.Context(), roomReferences(&req)...)
+	if err != nil {
+		handleError(c, err)
 		return
 	}
 
-	resp, err := h.storage.Room().Create(&repo.Room{
+	resp, err := h.storage.Room().Create(c.Request.Context(), &repo.Room{
 		Type:         req.Type,
 		NumberOfRoom: req.NumberOfRoom,
-		RoomImageUrl: req.RoomImageUrl,
+		Price:        req.Price,
+		Currency:     h.roomCurrency(req.Currency),
+		ImageID:      req.ImageID,
 		Status:       req.Status,
 		HotelId:      req.HotelId,
 	})
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	images, err := h.images(c.Request.Context(), resp.ImageID)
+	if err != nil {
+		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusCreated, parseRoomModel(resp))
+	setETag(c, resp.Version)
+	c.JSON(http.StatusCreated, parseRoomModel(resp, images))
 }
 
 // @Router /rooms/{id} [get]
 // @Summary Get room by id
-// @Description Get room by id
+// @Description Get room by id, with its gallery and cover image
 // @Tags room
 // @Accept json
 // @Produce json
 // @Param id path int true "ID"
 // @Success 200 {object} models.Room
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) GetRoom(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.Room().Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	images, err := h.images(c.Request.Context(), resp.ImageID)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	resp, err := h.storage.Room().Get(int64(id))
+	gallery, err := h.storage.RoomGallery().Get(c.Request.Context(), resp.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, parseRoomModel(resp))
+	galleryImages, err := h.galleryImages(c.Request.Context(), gallery)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	result := parseRoomModel(resp, images)
+	result.Gallery = galleryImages
+	result.Cover = coverOf(galleryImages)
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, result)
 }
 
 // @Router /rooms [get]
 // @Summary Get all rooms
-// @Description Get all rooms
+// @Description Get all rooms with their cover images
 // @Tags room
 // @Accept json
 // @Produce json
 // @Param filter query models.GetAllParams false "Filter"
 // @Success 200 {object} models.GetAllRoomsResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) GetAllRooms(c *gin.Context) {
-	req, err := validateGetAllParams(c)
+	req, cursor, err := validateGetAllParams(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	withDeleted, err := includeDeleted(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	result, err := h.storage.Room().GetAll(&repo.GetAllRoomsParams{
-		Page:   req.Page,
-		Limit:  req.Limit,
-		Search: req.Search,
+	result, err := h.storage.Room().GetAll(c.Request.Context(), &repo.GetAllRoomsParams{
+		Page:           req.Page,
+		Limit:          req.Limit,
+		Search:         req.Search,
+		Cursor:         cursor,
+		IncludeDeleted: withDeleted,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, getRoomsResponse(result))
+	ids := make([]*int64, 0, len(result.Rooms))
+	ownerIDs := make([]int64, 0, len(result.Rooms))
+	for _, room := range result.Rooms {
+		ids = append(ids, room.ImageID)
+		ownerIDs = append(ownerIDs, room.ID)
+	}
+
+	images, err := h.images(c.Request.Context(), ids...)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	covers, err := h.covers(c.Request.Context(), h.storage.RoomGallery(), ownerIDs)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, getRoomsResponse(result, images, covers))
 }
 
-func getRoomsResponse(data *repo.GetAllRoomsResult) *models.GetAllRoomsResponse {
+func getRoomsResponse(data *repo.GetAllRoomsResult, images map[int64]*models.Image, covers map[int64]*models.GalleryImage) *models.GetAllRoomsResponse {
 	response := models.GetAllRoomsResponse{
-		Rooms: make([]*models.Room, 0),
-		Count: data.Count,
+		Rooms:      make([]*models.Room, 0),
+		Count:      data.Count,
+		NextCursor: encodeCursor(data.NextCursor),
 	}
 
 	for _, room := range data.Rooms {
-		u := parseRoomModel(room)
+		u := parseRoomModel(room, images)
+		u.Cover = covers[room.ID]
 		response.Rooms = append(response.Rooms, &u)
 	}
 
 	return &response
 }
 
-func parseRoomModel(room *repo.Room) models.Room {
+// roomCurrency is the currency a room is priced in, the base currency
+// unless one is given.
+func (h *handlerV1) roomCurrency(currency string) string {
+	if currency == "" {
+		return h.cfg.Currency.Base
+	}
+	return currency
+}
+
+func parseRoomModel(room *repo.Room, images map[int64]*models.Image) models.Room {
 	return models.Room{
 		ID:           room.ID,
 		Type:         room.Type,
 		NumberOfRoom: room.NumberOfRoom,
-		RoomImageUrl: room.RoomImageUrl,
+		Price:        room.Price,
+		Currency:     room.Currency,
+		Image:        imageOf(images, room.ImageID, room.ImageURL),
 		Status:       room.Status,
 		HotelId:      room.HotelId,
+		Version:      room.Version,
 		CreatedAt:    room.CreatedAt,
+		DeletedAt:    room.DeletedAt,
 	}
 }
 
@@ -132,9 +213,13 @@ func parseRoomModel(room *repo.Room) models.Room {
 // @Accept json
 // @Produce json
 // @Param id path int true "ID"
+// @Param If-Match header string true "ETag of the version being changed"
 // @Param room body models.CreateRoomRequest true "Room"
 // @Success 200 {object} models.Room
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) UpdateRoom(c *gin.Context) {
 	var (
@@ -143,41 +228,161 @@ func (h *handlerV1) UpdateRoom(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	err = h.checkReferences(c.Request.Context(), roomReferences(&req)...)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
 		return
 	}
 
-	id, err := strconv.Atoi(c.Param("id"))
+	version, err := ifMatchVersion(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	resp, err := h.storage.Room().Update(&repo.Room{
-		ID:           int64(id),
+	resp, err := h.storage.Room().Update(c.Request.Context(), &repo.Room{
+		ID:           id,
 		Type:         req.Type,
 		NumberOfRoom: req.NumberOfRoom,
-		RoomImageUrl: req.RoomImageUrl,
+		Price:        req.Price,
+		Currency:     h.roomCurrency(req.Currency),
+		ImageID:      req.ImageID,
 		Status:       req.Status,
 		HotelId:      req.HotelId,
+		Version:      version,
 	})
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	images, err := h.images(c.Request.Context(), resp.ImageID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, parseRoomModel(resp, images))
+}
+
+// @Security ApiKeyAuth
+// @Router /rooms/{id} [patch]
+// @Summary Patch a room
+// @Description Partially update a room with an RFC 7396 JSON merge patch. Fields set to null are cleared, omitted fields are kept. Only the partner owning the hotel of the room and superadmins may.
+// @Tags room
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Param If-Match header string true "ETag of the version being changed"
+// @Param room body models.CreateRoomRequest true "Merge patch"
+// @Success 200 {object} models.Room
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) PatchRoom(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	current, err := h.storage.Room().Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if current.Version != version {
+		handleError(c, repo.ErrVersionMismatch)
+		return
+	}
+
+	err = h.canManageHotel(c.Request.Context(), payload, int64(current.HotelId))
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	original := models.CreateRoomRequest{
+		Type:         current.Type,
+		NumberOfRoom: current.NumberOfRoom,
+		Price:        current.Price,
+		Currency:     current.Currency,
+		ImageID:      current.ImageID,
+		Status:       current.Status,
+		HotelId:      current.HotelId,
+	}
+
+	var merged models.CreateRoomRequest
+	fields, err := mergePatchRequest(c, &original, &merged)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if changesReferences(fields, "hotel_id", "image_id") {
+		err = h.checkReferences(c.Request.Context(), roomReferences(&merged)...)
+		if err != nil {
+			handleError(c, err)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+	}
+
+	if _, ok := fields["currency"]; ok {
+		fields["currency"] = h.roomCurrency(merged.Currency)
+	}
+
+	// moving a room needs the right to manage the new hotel as well
+	if _, ok := fields["hotel_id"]; ok {
+		err = h.canManageHotel(c.Request.Context(), payload, int64(merged.HotelId))
+		if err != nil {
+			handleError(c, err)
+			return
+		}
+	}
+
+	resp, err := h.storage.Room().Patch(c.Request.Context(), id, version, fields)
+	if err != nil {
+		handleError(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, models.Room{
-		ID:           resp.ID,
-		Type:         resp.Type,
-		NumberOfRoom: resp.NumberOfRoom,
-		RoomImageUrl: resp.RoomImageUrl,
-		Status:       resp.Status,
-		HotelId:      resp.HotelId,
-	})
+	images, err := h.images(c.Request.Context(), resp.ImageID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, parseRoomModel(resp, images))
 }
 
 // @Router /room/{id} [delete]
@@ -187,23 +392,29 @@ func (h *handlerV1) UpdateRoom(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path int true "ID"
+// @Param If-Match header string true "ETag of the version being changed"
 // @Success 200 {object} models.ResponseOK
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) DeleteRoom(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := idParam(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	err = h.storage.Room().Delete(int64(id))
+	version, err := ifMatchVersion(c)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, errorResponse(err))
-			return
-		}
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	err = h.storage.Room().Delete(c.Request.Context(), id, version)
+	if err != nil {
+		handleError(c, err)
 		return
 	}
 
@@ -211,3 +422,50 @@ func (h *handlerV1) DeleteRoom(c *gin.Context) {
 		Message: "Successfully deleted",
 	})
 }
+
+// @Security ApiKeyAuth
+// @Router /rooms/{id}/restore [post]
+// @Summary Restore a deleted room
+// @Description Restore a deleted room. Superadmin only.
+// @Tags room
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.Room
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) RestoreRoom(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.Room().Restore(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	images, err := h.images(c.Request.Context(), resp.ImageID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, parseRoomModel(resp, images))
+}
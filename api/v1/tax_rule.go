@@ -0,0 +1,451 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/money"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin"
+)
+
+var ErrInvalidRuleID = errs.Validation(errs.Field("rule_id", "must be a positive integer"))
+
+// @Router /hotels/{id}/tax-rules [get]
+// @Summary Get the taxes and fees of a hotel
+// @Description Get the tax and fee rules applied when a booking at the hotel is priced.
+// @Tags tax
+// @Accept json
+// @Produce json
+// @Param id path int true "Hotel ID"
+// @Success 200 {object} models.GetAllTaxRulesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) GetHotelTaxRules(c *gin.Context) {
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	_, err = h.storage.Hotel().Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	result, err := h.storage.TaxRule().GetByHotel(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	response := models.GetAllTaxRulesResponse{
+		TaxRules: make([]*models.TaxRule, 0, len(result)),
+	}
+	for _, rule := range result {
+		response.TaxRules = append(response.TaxRules, parseTaxRuleModel(rule))
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// @Security ApiKeyAuth
+// @Router /hotels/{id}/tax-rules [post]
+// @Summary Add a tax or fee to a hotel
+// @Description Add a tax or fee rule. Percent rules apply to the whole price, fixed ones are charged per stay, night or guest-night. Bookings priced before keep their charges. Partners owning the hotel and superadmins only.
+// @Tags tax
+// @Accept json
+// @Produce json
+// @Param id path int true "Hotel ID"
+// @Param rule body models.CreateTaxRuleRequest true "Rule"
+// @Success 201 {object} models.TaxRule
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) CreateTaxRule(c *gin.Context) {
+	hotelID, err := h.manageableHotel(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	rule, err := bindTaxRule(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	rule.HotelID = hotelID
+
+	resp, err := h.storage.TaxRule().Create(c.Request.Context(), rule)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, parseTaxRuleModel(resp))
+}
+
+// @Security ApiKeyAuth
+// @Router /hotels/{id}/tax-rules/{rule_id} [put]
+// @Summary Update a tax or fee of a hotel
+// @Description Replace a tax or fee rule. Bookings priced before keep their charges. Partners owning the hotel and superadmins only.
+// @Tags tax
+// @Accept json
+// @Produce json
+// @Param id path int true "Hotel ID"
+// @Param rule_id path int true "Rule ID"
+// @Param rule body models.CreateTaxRuleRequest true "Rule"
+// @Success 200 {object} models.TaxRule
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) UpdateTaxRule(c *gin.Context) {
+	current, err := h.hotelTaxRule(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	rule, err := bindTaxRule(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+	rule.ID = current.ID
+
+	resp, err := h.storage.TaxRule().Update(c.Request.Context(), rule)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, parseTaxRuleModel(resp))
+}
+
+// @Security ApiKeyAuth
+// @Router /hotels/{id}/tax-rules/{rule_id} [delete]
+// @Summary Delete a tax or fee of a hotel
+// @Description Delete a tax or fee rule. Bookings priced before keep their charges. Partners owning the hotel and superadmins only.
+// @Tags tax
+// @Produce json
+// @Param id path int true "Hotel ID"
+// @Param rule_id path int true "Rule ID"
+// @Success 200 {object} models.ResponseOK
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) DeleteTaxRule(c *gin.Context) {
+	rule, err := h.hotelTaxRule(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	err = h.storage.TaxRule().Delete(c.Request.Context(), rule.ID)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, models.ResponseOK{
+		Message: "Successfully deleted",
+	})
+}
+
+// hotelTaxRule loads the rule of the :rule_id parameter if it belongs to the
+// hotel of :id and the user may manage that hotel.
+func (h *handlerV1) hotelTaxRule(c *gin.Context) (*repo.TaxRule, error) {
+	hotelID, err := h.manageableHotel(c)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := strconv.ParseInt(c.Param("rule_id"), 10, 64)
+	if err != nil || id < 1 {
+		return nil, ErrInvalidRuleID
+	}
+
+	rule, err := h.storage.TaxRule().Get(c.Request.Context(), id)
+	if err != nil {
+		return nil, err
+	}
+
+	if rule.HotelID != hotelID {
+		return nil, sql.ErrNoRows
+	}
+
+	return rule, nil
+}
+
+// bindTaxRule reads a rule and checks the fields that depend on its type.
+func bindTaxRule(c *gin.Context) (*repo.TaxRule, error) {
+	var req models.CreateTaxRuleRequest
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := &repo.TaxRule{
+		Name:      req.Name,
+		Kind:      req.Kind,
+		Type:      req.Type,
+		Basis:     req.Basis,
+		Inclusive: req.Inclusive,
+	}
+
+	var fields []errs.FieldError
+	rule.Percent, fields = checkAmount(req.Type, req.Percent, req.Amount, req.Currency)
+
+	if req.Type == repo.TaxRuleTypePercent {
+		if req.Basis != repo.TaxRuleBasisStay {
+			fields = append(fields, errs.Field("basis", "must be stay for percent rules"))
+		}
+	} else {
+		rule.Amount = req.Amount
+		rule.Currency = req.Currency
+	}
+
+	if len(fields) > 0 {
+		return nil, errs.Validation(fields...)
+	}
+
+	return rule, nil
+}
+
+// checkAmount checks the fields of a percentage or a fixed amount, which
+// tax rules and campaigns share, and returns the normalized percentage.
+func checkAmount(typ, percent string, amount int64, currency string) (string, []errs.FieldError) {
+	var fields []errs.FieldError
+
+	switch typ {
+	case repo.TaxRuleTypePercent:
+		rate, err := money.ParseRate(percent)
+		if err != nil || rate.Cmp(big.NewRat(100, 1)) > 0 {
+			fields = append(fields, errs.Field("percent", "must be a number greater than 0 and at most 100"))
+		} else {
+			percent = money.FormatRate(rate)
+		}
+		if amount != 0 || currency != "" {
+			fields = append(fields, errs.Field("amount", "must not be set for percent rules"))
+		}
+	case repo.TaxRuleTypeFixed:
+		if amount <= 0 {
+			fields = append(fields, errs.Field("amount", "must be greater than 0"))
+		}
+		if percent != "" {
+			fields = append(fields, errs.Field("percent", "must not be set for fixed rules"))
+		}
+	}
+
+	return percent, fields
+}
+
+// priceBooking applies the campaigns and then the tax and fee rules of the
+// hotel to the booking, setting its charges and total.
+func (h *handlerV1) priceBooking(ctx context.Context, booking *repo.Booking, campaigns []*repo.Campaign) error {
+	rules, err := h.storage.TaxRule().GetByHotel(ctx, int64(booking.HotelId))
+	if err != nil {
+		return err
+	}
+
+	currencies := make([]string, 0, len(rules)+len(campaigns))
+	for _, rule := range rules {
+		currencies = append(currencies, rule.Currency)
+	}
+	for _, campaign := range campaigns {
+		currencies = append(currencies, campaign.Currency)
+	}
+
+	rates, err := h.ratesFor(ctx, booking.Currency, currencies...)
+	if err != nil {
+		return err
+	}
+
+	booking.Charges, booking.Total, err = bookingCharges(booking, campaigns, rules, rates)
+	return err
+}
+
+// ratesFor loads the exchange rates if any of the currencies differs from
+// the booking currency. Percentages have no currency.
+func (h *handlerV1) ratesFor(ctx context.Context, currency string, currencies ...string) (*money.Rates, error) {
+	for _, c := range currencies {
+		if c != "" && c != currency {
+			return h.rates(ctx)
+		}
+	}
+	return nil, nil
+}
+
+// bookingCharges works out the discount of every campaign, then the charge
+// of every rule on the discounted price, and the total. Inclusive
+// percentages are the share of the price the tax makes up, exclusive ones
+// are added to it. Fixed amounts are converted to the booking currency at
+// rates, which may be nil if they are all in that currency already.
+func bookingCharges(booking *repo.Booking, campaigns []*repo.Campaign, rules []*repo.TaxRule, rates *money.Rates) ([]repo.BookingCharge, int64, error) {
+	nights := stayNights(booking)
+	guests := guestsOrDefault(booking.Guests)
+
+	charges := make([]repo.BookingCharge, 0, len(campaigns)+len(rules))
+	price := booking.Price
+
+	for _, campaign := range campaigns {
+		discount, err := campaignDiscount(campaign, booking, rates)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		// discounts never take the price below zero
+		if discount > price {
+			discount = price
+		}
+		price -= discount
+
+		charges = append(charges, repo.BookingCharge{
+			CampaignID: campaign.ID,
+			Name:       campaignLabel(campaign),
+			Kind:       repo.ChargeKindDiscount,
+			Basis:      repo.TaxRuleBasisStay,
+			Quantity:   1,
+			UnitAmount: -discount,
+			Amount:     -discount,
+		})
+	}
+
+	total := price
+
+	for _, rule := range rules {
+		charge := repo.BookingCharge{
+			RuleID:    rule.ID,
+			Name:      rule.Name,
+			Kind:      rule.Kind,
+			Basis:     rule.Basis,
+			Inclusive: rule.Inclusive,
+			Quantity:  1,
+		}
+
+		switch rule.Type {
+		case repo.TaxRuleTypePercent:
+			percent, err := money.ParseRate(rule.Percent)
+			if err != nil {
+				return nil, 0, fmt.Errorf("tax rule %d: %w", rule.ID, err)
+			}
+
+			base := big.NewRat(100, 1)
+			if rule.Inclusive {
+				base.Add(base, percent)
+			}
+
+			share := new(big.Rat).Quo(percent, base)
+			charge.UnitAmount = money.Round(share.Mul(share, new(big.Rat).SetInt64(price)))
+		case repo.TaxRuleTypeFixed:
+			amount, err := convertAmount(rule.Name, rule.Amount, rule.Currency, booking.Currency, rates)
+			if err != nil {
+				return nil, 0, err
+			}
+
+			charge.UnitAmount = amount
+			switch rule.Basis {
+			case repo.TaxRuleBasisNight:
+				charge.Quantity = nights
+			case repo.TaxRuleBasisGuestNight:
+				charge.Quantity = nights * guests
+			}
+		}
+
+		charge.Amount = charge.UnitAmount * int64(charge.Quantity)
+		if !charge.Inclusive {
+			total += charge.Amount
+		}
+
+		charges = append(charges, charge)
+	}
+
+	return charges, total, nil
+}
+
+// convertAmount converts the fixed amount of a rule or campaign called name
+// to the booking currency.
+func convertAmount(name string, amount int64, from, to string, rates *money.Rates) (int64, error) {
+	if from == to {
+		return amount, nil
+	}
+
+	if rates == nil {
+		return 0, fmt.Errorf("%s: %w %s", name, money.ErrNoRate, from)
+	}
+
+	rate, err := rates.Rate(from, to)
+	if err != nil {
+		return 0, errs.Validation(errs.Field("currency", fmt.Sprintf("%s can not be converted, it has no exchange rate", name)))
+	}
+
+	return money.Convert(amount, from, to, rate)
+}
+
+// stayNights is the number of nights of a booking, same day stays count as
+// one.
+func stayNights(booking *repo.Booking) int {
+	from, _ := time.Parse(isoDateLayout, isoDate(booking.FromDate))
+	to, _ := time.Parse(isoDateLayout, isoDate(booking.ToDate))
+
+	nights := int(to.Sub(from).Hours() / 24)
+	if nights < 1 {
+		return 1
+	}
+	return nights
+}
+
+func guestsOrDefault(guests int) int {
+	if guests < 1 {
+		return 1
+	}
+	return guests
+}
+
+func parseTaxRuleModel(rule *repo.TaxRule) *models.TaxRule {
+	return &models.TaxRule{
+		ID:        rule.ID,
+		HotelID:   rule.HotelID,
+		Name:      rule.Name,
+		Kind:      rule.Kind,
+		Type:      rule.Type,
+		Basis:     rule.Basis,
+		Percent:   normalizeRate(rule.Percent),
+		Amount:    rule.Amount,
+		Currency:  rule.Currency,
+		Inclusive: rule.Inclusive,
+		CreatedAt: rule.CreatedAt,
+		UpdatedAt: rule.UpdatedAt,
+	}
+}
+
+func parseChargeModels(charges []repo.BookingCharge) []*models.Charge {
+	result := make([]*models.Charge, 0, len(charges))
+	for _, charge := range charges {
+		result = append(result, &models.Charge{
+			Name:       charge.Name,
+			Kind:       charge.Kind,
+			Basis:      charge.Basis,
+			Inclusive:  charge.Inclusive,
+			Quantity:   charge.Quantity,
+			UnitAmount: charge.UnitAmount,
+			Amount:     charge.Amount,
+		})
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package v1
+
+import (
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/money"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBookingCharges(t *testing.T) {
+	rates, err := money.NewRates("USD", map[string]string{"UZS": "12500"})
+	require.NoError(t, err)
+
+	// three nights for two guests
+	booking := &repo.Booking{FromDate: "2022-10-01", ToDate: "2022-10-04", Price: 11200, Currency: "USD", Guests: 2}
+
+	rules := []*repo.TaxRule{
+		{ID: 1, Name: "VAT", Kind: repo.TaxRuleKindTax, Type: repo.TaxRuleTypePercent, Basis: repo.TaxRuleBasisStay, Percent: "12", Inclusive: true},
+		{ID: 2, Name: "Service", Kind: repo.TaxRuleKindFee, Type: repo.TaxRuleTypePercent, Basis: repo.TaxRuleBasisStay, Percent: "10"},
+		{ID: 3, Name: "Tourist tax", Kind: repo.TaxRuleKindTax, Type: repo.TaxRuleTypeFixed, Basis: repo.TaxRuleBasisGuestNight, Amount: 1250000, Currency: "UZS"},
+		{ID: 4, Name: "Cleaning", Kind: repo.TaxRuleKindFee, Type: repo.TaxRuleTypeFixed, Basis: repo.TaxRuleBasisStay, Amount: 1500, Currency: "USD"},
+		{ID: 5, Name: "Resort fee", Kind: repo.TaxRuleKindFee, Type: repo.TaxRuleTypeFixed, Basis: repo.TaxRuleBasisNight, Amount: 500, Currency: "USD", Inclusive: true},
+	}
+
+	charges, total, err := bookingCharges(booking, nil, rules, rates)
+	require.NoError(t, err)
+	require.Len(t, charges, 5)
+
+	// 12% of the price net of VAT
+	require.Equal(t, int64(1200), charges[0].Amount)
+	require.True(t, charges[0].Inclusive)
+
+	require.Equal(t, int64(1120), charges[1].Amount)
+
+	// 12 500 UZS a guest-night is a dollar
+	require.Equal(t, 6, charges[2].Quantity)
+	require.Equal(t, int64(100), charges[2].UnitAmount)
+	require.Equal(t, int64(600), charges[2].Amount)
+
+	require.Equal(t, 1, charges[3].Quantity)
+	require.Equal(t, int64(1500), charges[3].Amount)
+
+	require.Equal(t, 3, charges[4].Quantity)
+	require.Equal(t, int64(1500), charges[4].Amount)
+
+	require.Equal(t, int64(11200+1120+600+1500), total)
+}
+
+func TestBookingChargesWithoutRules(t *testing.T) {
+	charges, total, err := bookingCharges(&repo.Booking{Price: 5000, Currency: "USD"}, nil, nil, nil)
+	require.NoError(t, err)
+	require.Empty(t, charges)
+	require.Equal(t, int64(5000), total)
+}
+
+func TestBookingChargesWithoutRate(t *testing.T) {
+	rates, err := money.NewRates("USD", nil)
+	require.NoError(t, err)
+
+	_, _, err = bookingCharges(&repo.Booking{Price: 5000, Currency: "USD"}, nil, []*repo.TaxRule{
+		{Name: "Tourist tax", Type: repo.TaxRuleTypeFixed, Basis: repo.TaxRuleBasisStay, Amount: 1000, Currency: "EUR"},
+	}, rates)
+	require.Contains(t, translateError(err).Fields[0].Message, "Tourist tax")
+}
+
+func TestStayNights(t *testing.T) {
+	require.Equal(t, 3, stayNights(&repo.Booking{FromDate: "2022-10-01", ToDate: "2022-10-04"}))
+	require.Equal(t, 1, stayNights(&repo.Booking{FromDate: "2022-10-01", ToDate: "2022-10-01"}))
+}
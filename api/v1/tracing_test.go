@@ -0,0 +1,38 @@
+package v1
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestTracingContinuesIncomingTrace(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	h := &handlerV1{}
+
+	router := gin.New()
+	router.Use(h.Tracing)
+	router.GET("/tracing-test", func(c *gin.Context) {
+		handleError(c, errs.NotFound("hotel"))
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/tracing-test", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	var resp models.ErrorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, traceID, resp.TraceID)
+	require.Contains(t, w.Header().Get("traceparent"), traceID)
+}
@@ -1,13 +1,10 @@
 package v1
 
 import (
-	"database/sql"
-	"errors"
 	"github.com/MuhammadyusufAdhamov/booking/api/models"
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/gin-gonic/gin"
 	"net/http"
-	"strconv"
 )
 
 // @Security ApiKeyAuth
@@ -19,6 +16,7 @@ import (
 // @Produce json
 // @Param user body models.CreateUserRequest true "User"
 // @Success 201 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) CreateUser(c *gin.Context) {
 	var (
@@ -27,11 +25,11 @@ func (h *handlerV1) CreateUser(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	resp, err := h.storage.User().Create(&repo.User{
+	resp, err := h.storage.User().Create(c.Request.Context(), &repo.User{
 		FirstName:   req.FirstName,
 		LastName:    req.LastName,
 		PhoneNumber: req.PhoneNumber,
@@ -41,10 +39,11 @@ func (h *handlerV1) CreateUser(c *gin.Context) {
 		Password:    req.Password,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
+	setETag(c, resp.Version)
 	c.JSON(http.StatusCreated, parseUserModel(resp))
 }
 
@@ -56,20 +55,23 @@ func (h *handlerV1) CreateUser(c *gin.Context) {
 // @Produce json
 // @Param id path int true "ID"
 // @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) GetUser(c *gin.Context) {
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := idParam(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	resp, err := h.storage.User().Get(int64(id))
+	resp, err := h.storage.User().Get(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
+	setETag(c, resp.Version)
 	c.JSON(http.StatusOK, parseUserModel(resp))
 }
 
@@ -81,21 +83,30 @@ func (h *handlerV1) GetUser(c *gin.Context) {
 // @Produce json
 // @Param filter query models.GetAllParams false "Filter"
 // @Success 200 {object} models.GetAllUsersResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) GetAllUsers(c *gin.Context) {
-	req, err := validateGetAllParams(c)
+	req, cursor, err := validateGetAllParams(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	withDeleted, err := includeDeleted(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	result, err := h.storage.User().GetAll(&repo.GetAllUsersParams{
-		Page:   req.Page,
-		Limit:  req.Limit,
-		Search: req.Search,
+	result, err := h.storage.User().GetAll(c.Request.Context(), &repo.GetAllUsersParams{
+		Page:           req.Page,
+		Limit:          req.Limit,
+		Search:         req.Search,
+		Cursor:         cursor,
+		IncludeDeleted: withDeleted,
 	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
@@ -104,8 +115,9 @@ func (h *handlerV1) GetAllUsers(c *gin.Context) {
 
 func getUsersResponse(data *repo.GetAllUsersResult) *models.GetAllUsersResponse {
 	response := models.GetAllUsersResponse{
-		Users: make([]*models.User, 0),
-		Count: data.Count,
+		Users:      make([]*models.User, 0),
+		Count:      data.Count,
+		NextCursor: encodeCursor(data.NextCursor),
 	}
 
 	for _, user := range data.Users {
@@ -125,7 +137,9 @@ func parseUserModel(user *repo.User) models.User {
 		Email:       user.Email,
 		Password:    user.Password,
 		Type:        user.Type,
+		Version:     user.Version,
 		CreatedAt:   user.CreatedAt,
+		DeletedAt:   user.DeletedAt,
 	}
 }
 
@@ -136,9 +150,13 @@ func parseUserModel(user *repo.User) models.User {
 // @Accept json
 // @Produce json
 // @Param id path int true "ID"
+// @Param If-Match header string true "ETag of the version being changed"
 // @Param user body models.CreateUserRequest true "User"
 // @Success 200 {object} models.User
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) UpdateUser(c *gin.Context) {
 	var (
@@ -147,18 +165,24 @@ func (h *handlerV1) UpdateUser(c *gin.Context) {
 
 	err := c.ShouldBindJSON(&req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := idParam(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	resp, err := h.storage.User().Update(&repo.User{
-		ID:          int64(id),
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.User().Update(c.Request.Context(), &repo.User{
+		ID:          id,
 		FirstName:   req.FirstName,
 		LastName:    req.LastName,
 		Email:       req.Email,
@@ -166,16 +190,14 @@ func (h *handlerV1) UpdateUser(c *gin.Context) {
 		Username:    req.Username,
 		Password:    req.Password,
 		Type:        req.Type,
+		Version:     version,
 	})
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, errorResponse(err))
-			return
-		}
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
+	setETag(c, resp.Version)
 	c.JSON(http.StatusOK, models.User{
 		ID:          resp.ID,
 		FirstName:   resp.FirstName,
@@ -185,9 +207,89 @@ func (h *handlerV1) UpdateUser(c *gin.Context) {
 		Username:    resp.Username,
 		Password:    resp.Password,
 		Type:        resp.Type,
+		Version:     resp.Version,
 	})
 }
 
+// @Security ApiKeyAuth
+// @Router /users/{id} [patch]
+// @Summary Patch a user
+// @Description Partially update a user with an RFC 7396 JSON merge patch. Fields set to null are cleared, omitted fields are kept. Passwords and user types can not be patched. Users may patch themselves, superadmins anyone.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Param If-Match header string true "ETag of the version being changed"
+// @Param user body models.PatchUserRequest true "Merge patch"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) PatchUser(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin && payload.UserID != id {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	current, err := h.storage.User().Get(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if current.Version != version {
+		handleError(c, repo.ErrVersionMismatch)
+		return
+	}
+
+	original := models.PatchUserRequest{
+		FirstName:   current.FirstName,
+		LastName:    current.LastName,
+		Email:       current.Email,
+		PhoneNumber: current.PhoneNumber,
+		Username:    current.Username,
+	}
+
+	var merged models.PatchUserRequest
+	fields, err := mergePatchRequest(c, &original, &merged)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.User().Patch(c.Request.Context(), id, version, fields)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, parseUserModel(resp))
+}
+
 // @Router /user/{id} [delete]
 // @Summary Delete a user
 // @Description Delete a user
@@ -195,34 +297,40 @@ func (h *handlerV1) UpdateUser(c *gin.Context) {
 // @Accept json
 // @Produce json
 // @Param id path int true "ID"
+// @Param If-Match header string true "ETag of the version being changed"
 // @Success 200 {object} models.ResponseOK
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 412 {object} models.ErrorResponse
+// @Failure 428 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 func (h *handlerV1) DeleteUser(c *gin.Context) {
 	payload, err := h.GetAuthPayload(c)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
 	if payload.UserType != repo.UserTypeSuperadmin {
-		c.JSON(http.StatusForbidden, errorResponse(ErrForbidden))
+		handleError(c, ErrForbidden)
 		return
 	}
 
-	id, err := strconv.Atoi(c.Param("id"))
+	id, err := idParam(c)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, errorResponse(err))
+		handleError(c, err)
 		return
 	}
 
-	err = h.storage.User().Delete(int64(id))
+	version, err := ifMatchVersion(c)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			c.JSON(http.StatusNotFound, errorResponse(err))
-			return
-		}
-		c.JSON(http.StatusInternalServerError, errorResponse(err))
+		handleError(c, err)
+		return
+	}
+
+	err = h.storage.User().Delete(c.Request.Context(), id, version)
+	if err != nil {
+		handleError(c, err)
 		return
 	}
 
@@ -230,3 +338,44 @@ func (h *handlerV1) DeleteUser(c *gin.Context) {
 		Message: "Successfully deleted",
 	})
 }
+
+// @Security ApiKeyAuth
+// @Router /users/{id}/restore [post]
+// @Summary Restore a deleted user
+// @Description Restore a deleted user. Superadmin only.
+// @Tags user
+// @Accept json
+// @Produce json
+// @Param id path int true "ID"
+// @Success 200 {object} models.User
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+func (h *handlerV1) RestoreUser(c *gin.Context) {
+	payload, err := h.GetAuthPayload(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	if payload.UserType != repo.UserTypeSuperadmin {
+		handleError(c, ErrForbidden)
+		return
+	}
+
+	id, err := idParam(c)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	resp, err := h.storage.User().Restore(c.Request.Context(), id)
+	if err != nil {
+		handleError(c, err)
+		return
+	}
+
+	setETag(c, resp.Version)
+	c.JSON(http.StatusOK, parseUserModel(resp))
+}
@@ -0,0 +1,168 @@
+package v1
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/money"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// isoDateLayout is the only date format bookings accept.
+const isoDateLayout = "2006-01-02"
+
+// registerValidators teaches gin's validator the custom tags used by the
+// request models and makes it report fields by their JSON names.
+func registerValidators() {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return
+	}
+
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		for _, tag := range []string{"json", "form"} {
+			name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+			if name == "-" {
+				return ""
+			}
+			if name != "" {
+				return name
+			}
+		}
+		return field.Name
+	})
+
+	_ = v.RegisterValidation("isodate", validateISODate)
+	_ = v.RegisterValidation("date_after", validateDateAfter)
+	_ = v.RegisterValidation("room_status", validateRoomStatus)
+	_ = v.RegisterValidation("currency", validateCurrency)
+}
+
+func validateISODate(fl validator.FieldLevel) bool {
+	_, err := time.Parse(isoDateLayout, fl.Field().String())
+	return err == nil
+}
+
+// validateDateAfter checks that the date is strictly after the sibling field
+// named by the tag parameter, e.g. `binding:"date_after=from_date"`. If the
+// other date is invalid it is reported on its own, so this one passes.
+func validateDateAfter(fl validator.FieldLevel) bool {
+	to, err := time.Parse(isoDateLayout, fl.Field().String())
+	if err != nil {
+		return true
+	}
+
+	other, ok := fieldByJSONName(fl.Parent(), fl.Param())
+	if !ok || other.Kind() != reflect.String {
+		return false
+	}
+
+	from, err := time.Parse(isoDateLayout, other.String())
+	if err != nil {
+		return true
+	}
+
+	return to.After(from)
+}
+
+func validateRoomStatus(fl validator.FieldLevel) bool {
+	status := fl.Field().String()
+	for _, s := range repo.RoomStatuses {
+		if status == s {
+			return true
+		}
+	}
+	return false
+}
+
+func validateCurrency(fl validator.FieldLevel) bool {
+	return money.Supported(fl.Field().String())
+}
+
+func fieldByJSONName(parent reflect.Value, name string) (reflect.Value, bool) {
+	for parent.Kind() == reflect.Ptr {
+		parent = parent.Elem()
+	}
+
+	if parent.Kind() != reflect.Struct {
+		return reflect.Value{}, false
+	}
+
+	t := parent.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if strings.SplitN(t.Field(i).Tag.Get("json"), ",", 2)[0] == name {
+			return parent.Field(i), true
+		}
+	}
+
+	return reflect.Value{}, false
+}
+
+// reference is a foreign key in a request body that must point at a live row.
+type reference struct {
+	field  string
+	entity string
+	id     int64
+}
+
+// checkReferences looks every reference up and reports the missing ones per
+// field, so clients get a 400 instead of a foreign key violation.
+func (h *handlerV1) checkReferences(ctx context.Context, refs ...reference) error {
+	var fields []errs.FieldError
+
+	for _, ref := range refs {
+		var err error
+
+		switch ref.entity {
+		case repo.AuditEntityUser:
+			_, err = h.storage.User().Get(ctx, ref.id)
+		case repo.AuditEntityHotel:
+			_, err = h.storage.Hotel().Get(ctx, ref.id)
+		case repo.AuditEntityRoom:
+			_, err = h.storage.Room().Get(ctx, ref.id)
+		case repo.AuditEntityMedia:
+			_, err = h.storage.Media().Get(ctx, ref.id)
+		default:
+			return fmt.Errorf("unknown reference entity %q", ref.entity)
+		}
+
+		if errors.Is(err, sql.ErrNoRows) {
+			fields = append(fields, errs.Field(ref.field, fmt.Sprintf("%s %d does not exist", ref.entity, ref.id)))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(fields) > 0 {
+		return errs.Validation(fields...)
+	}
+
+	return nil
+}
+
+func hotelReferences(req *models.CreateHotelRequest) []reference {
+	refs := []reference{{"user_id", repo.AuditEntityUser, req.UserID}}
+	if req.ImageID != nil {
+		refs = append(refs, reference{"image_id", repo.AuditEntityMedia, *req.ImageID})
+	}
+	return refs
+}
+
+func roomReferences(req *models.CreateRoomRequest) []reference {
+	refs := []reference{{"hotel_id", repo.AuditEntityHotel, int64(req.HotelId)}}
+	if req.ImageID != nil {
+		refs = append(refs, reference{"image_id", repo.AuditEntityMedia, *req.ImageID})
+	}
+	return refs
+}
@@ -0,0 +1,121 @@
+package v1
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/api/models"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/stretchr/testify/require"
+)
+
+func validationFields(t *testing.T, obj interface{}) map[string]string {
+	registerValidators()
+
+	err := binding.Validator.ValidateStruct(obj)
+	if err == nil {
+		return nil
+	}
+
+	var appErr *errs.Error
+	require.True(t, errors.As(translateError(err), &appErr))
+	require.Equal(t, errs.CodeValidation, appErr.Code)
+
+	fields := make(map[string]string)
+	for _, f := range appErr.Fields {
+		fields[f.Field] = f.Message
+	}
+	return fields
+}
+
+func TestCreateBookingRequestValidation(t *testing.T) {
+	valid := models.CreateBookingRequest{
+		RoomId:   1,
+		UserId:   1,
+		HotelId:  1,
+		FromDate: "2022-10-01",
+		ToDate:   "2022-10-05",
+		Currency: "EUR",
+	}
+	require.Empty(t, validationFields(t, &valid))
+
+	badCurrency := valid
+	badCurrency.Currency = "XYZ"
+	require.Equal(t, "must be a supported currency code", validationFields(t, &badCurrency)["currency"])
+
+	reversed := valid
+	reversed.FromDate, reversed.ToDate = valid.ToDate, valid.FromDate
+	require.Contains(t, validationFields(t, &reversed), "to_date")
+
+	badDate := valid
+	badDate.FromDate = "01/10/2022"
+	fields := validationFields(t, &badDate)
+	require.Contains(t, fields, "from_date")
+	require.NotContains(t, fields, "to_date")
+
+	missing := models.CreateBookingRequest{}
+	fields = validationFields(t, &missing)
+	for _, f := range []string{"room_id", "user_id", "hotel_id", "from_date", "to_date"} {
+		require.Contains(t, fields, f)
+	}
+}
+
+func TestCreateRoomRequestValidation(t *testing.T) {
+	req := models.CreateRoomRequest{
+		Type:         "double",
+		NumberOfRoom: -1,
+		Status:       "broken",
+		HotelId:      1,
+	}
+
+	fields := validationFields(t, &req)
+	require.Contains(t, fields, "number_of_room")
+	require.Contains(t, fields, "status")
+	require.Contains(t, fields, "price")
+	require.NotContains(t, fields, "type")
+}
+
+func TestCreateUserRequestType(t *testing.T) {
+	username := "johnny"
+	req := models.CreateUserRequest{
+		FirstName: "John",
+		LastName:  "Doe",
+		Email:     "john@example.com",
+		Username:  &username,
+		Password:  "secret1",
+		Type:      "superadmin",
+	}
+
+	require.Contains(t, validationFields(t, &req), "type")
+
+	req.Type = "partner"
+	require.Empty(t, validationFields(t, &req))
+}
+
+func TestImageIDValidation(t *testing.T) {
+	hotel := models.CreateHotelRequest{
+		UserID:        1,
+		HotelName:     "Hilton",
+		HotelLocation: "Tashkent",
+		NumberOfRooms: 10,
+	}
+	price := int64(12500)
+	room := models.CreateRoomRequest{
+		Type:         "double",
+		NumberOfRoom: 12,
+		Price:        &price,
+		Status:       "available",
+		HotelId:      1,
+	}
+
+	// hotel and room images are optional and validated the same way
+	require.Empty(t, validationFields(t, &hotel))
+	require.Empty(t, validationFields(t, &room))
+
+	invalid := int64(-1)
+	hotel.ImageID, room.ImageID = &invalid, &invalid
+	require.Contains(t, validationFields(t, &hotel), "image_id")
+	require.Contains(t, validationFields(t, &room), "image_id")
+	require.Equal(t, validationFields(t, &hotel)["image_id"], validationFields(t, &room)["image_id"])
+}
@@ -1,11 +1,31 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/MuhammadyusufAdhamov/booking/api"
+	"github.com/MuhammadyusufAdhamov/booking/jobs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/background"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/blob"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/health"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/logger"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/metrics"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/money"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/payments"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/ratelimit"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/tracing"
 	"github.com/MuhammadyusufAdhamov/booking/storage"
+	"github.com/MuhammadyusufAdhamov/booking/storage/postgres"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/go-redis/redis/v9"
-	"log"
+	"golang.org/x/exp/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
 
 	"github.com/MuhammadyusufAdhamov/booking/config"
 	"github.com/jmoiron/sqlx"
@@ -15,6 +35,16 @@ import (
 func main() {
 	cfg := config.Load(".")
 
+	slog.SetDefault(logger.New(&cfg.Log, os.Stdout))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	shutdownTracing, err := tracing.Setup(ctx, &cfg.Tracing)
+	if err != nil {
+		fatal("failed to set up tracing", err)
+	}
+
 	psqlUrl := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		cfg.Postgres.Host,
 		cfg.Postgres.Port,
@@ -22,29 +52,251 @@ func main() {
 		cfg.Postgres.Password,
 		cfg.Postgres.Database,
 	)
-	fmt.Println("-------------------", psqlUrl)
+
 	psqlConn, err := sqlx.Connect("postgres", psqlUrl)
 	if err != nil {
-		log.Fatalf("failed to connect database: %v", err)
+		fatal("failed to connect database", err)
 	}
+	slog.Info("connected to database",
+		"host", cfg.Postgres.Host,
+		"port", cfg.Postgres.Port,
+		"database", cfg.Postgres.Database,
+	)
 
 	rdb := redis.NewClient(&redis.Options{
 		Addr: cfg.Redis.Addr,
 	})
+	rdb.AddHook(tracing.RedisHook{})
+
+	if cfg.Metrics.Enabled {
+		metrics.RegisterDB(psqlConn.DB, cfg.Postgres.Database)
+		rdb.AddHook(metrics.RedisHook{})
+
+		if cfg.Metrics.Addr != "" {
+			go serveMetrics(cfg.Metrics.Addr)
+		}
+	}
+
+	migration, err := health.LatestMigration(cfg.Postgres.MigrationsDir)
+	if err != nil {
+		fatal("failed to read migrations", err)
+	}
+
+	checker := health.NewChecker(
+		health.Check{Name: "postgres", Check: psqlConn.PingContext},
+		health.Check{Name: "redis", Check: func(ctx context.Context) error {
+			return rdb.Ping(ctx).Err()
+		}},
+		health.Check{Name: "migrations", Check: health.Migrations(func(ctx context.Context) (uint, bool, error) {
+			return postgres.MigrationVersion(ctx, psqlConn)
+		}, migration)},
+	)
 
 	strg := storage.NewStoragePg(psqlConn)
+	if cfg.Cache.Enabled {
+		strg = storage.WithCache(strg, rdb, &cfg.Cache)
+	}
 	inMemory := storage.NewInMemoryStorage(rdb)
 
-	apiServer := api.New(&api.RouterOptions{
-		Cfg:      &cfg,
-		Storage:  strg,
-		InMemory: inMemory,
+	// stored rates are converted while they are relative to the old base
+	err = strg.ExchangeRate().Rebase(ctx, cfg.Currency.Base)
+	if err != nil {
+		fatal("failed to rebase exchange rates", err)
+	}
+
+	if cfg.Currency.RatesFile != "" {
+		err = loadExchangeRates(ctx, strg, &cfg.Currency)
+		if err != nil {
+			fatal("failed to load exchange rates", err)
+		}
+	}
+
+	_, err = money.ParsePercent(cfg.Commission.DefaultRate)
+	if err != nil {
+		fatal("invalid default commission rate", err)
+	}
+
+	tasks := &background.Group{}
+	if cfg.Purge.Retention > 0 {
+		purger := jobs.NewPurger(strg, cfg.Purge.Retention, cfg.Purge.Interval)
+		tasks.Go(func() { purger.Run(ctx) })
+	}
+
+	blobs, err := blob.New(&cfg.Blob)
+	if err != nil {
+		fatal("failed to open blob store", err)
+	}
+
+	documents, err := openDocumentStore(&cfg)
+	if err != nil {
+		fatal("failed to open document store", err)
+	}
+
+	provider, err := payments.New(&cfg.Payments)
+	if err != nil {
+		fatal("failed to set up payment provider", err)
+	}
+
+	deriver := jobs.NewDeriver(strg, blobs, &cfg.Upload.Derivatives)
+	tasks.Go(func() { deriver.Run(ctx) })
+
+	sweeper := jobs.NewMediaSweeper(strg, blobs, cfg.MediaGC.GracePeriod, cfg.MediaGC.Interval, cfg.MediaGC.DryRun)
+	if cfg.MediaGC.GracePeriod > 0 {
+		tasks.Go(func() { sweeper.Run(ctx) })
+	}
+
+	router, err := api.New(&api.RouterOptions{
+		Cfg:       &cfg,
+		Storage:   strg,
+		InMemory:  inMemory,
+		Limiter:   ratelimit.New(rdb),
+		Tasks:     tasks,
+		Health:    checker,
+		Deriver:   deriver,
+		Blobs:     blobs,
+		Sweeper:   sweeper,
+		Documents: documents,
+		Payments:  provider,
 	})
+	if err != nil {
+		fatal("invalid trusted proxies", err)
+	}
+
+	server := &http.Server{
+		Addr:              cfg.HttpPort,
+		Handler:           router,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
 
-	err = apiServer.Run(cfg.HttpPort)
+	go func() {
+		slog.Info("starting server", "addr", cfg.HttpPort)
+		err := server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fatal("failed to run server", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+	slog.Info("shutting down", "timeout", cfg.Server.ShutdownTimeout)
+
+	shutdown(server, checker, tasks, cfg.Server)
+
+	err = psqlConn.Close()
+	if err != nil {
+		slog.Error("failed to close database", err)
+	}
+
+	err = rdb.Close()
 	if err != nil {
-		log.Fatalf("failed to run server: %v", err)
+		slog.Error("failed to close redis", err)
 	}
 
-	log.Print("Server stopped")
+	flushCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	err = shutdownTracing(flushCtx)
+	if err != nil {
+		slog.Error("failed to flush traces", err)
+	}
+
+	slog.Info("server stopped")
+}
+
+// loadExchangeRates stores the rates from the rates file, replacing the
+// ones kept for the same currencies.
+func loadExchangeRates(ctx context.Context, strg storage.StorageI, cfg *config.Currency) error {
+	rates, err := money.LoadRatesFile(cfg.RatesFile)
+	if err != nil {
+		return err
+	}
+
+	for currency, rate := range rates {
+		if currency == cfg.Base {
+			continue
+		}
+
+		_, err = strg.ExchangeRate().Set(ctx, &repo.ExchangeRate{Currency: currency, Rate: rate})
+		if err != nil {
+			return err
+		}
+	}
+
+	slog.Info("loaded exchange rates", "file", cfg.RatesFile, "count", len(rates))
+	return nil
+}
+
+// openDocumentStore opens the blob store private documents are kept in. It
+// uses the media driver and credentials but must not overlap the media
+// store, which is served publicly.
+func openDocumentStore(cfg *config.Config) (blob.Store, error) {
+	private := cfg.Blob
+	private.Dir = cfg.Documents.Dir
+	private.S3.Bucket = cfg.Documents.Bucket
+
+	switch private.Driver {
+	case "local":
+		media, err := filepath.Abs(cfg.Blob.Dir)
+		if err != nil {
+			return nil, err
+		}
+		docs, err := filepath.Abs(private.Dir)
+		if err != nil {
+			return nil, err
+		}
+		if within(docs, media) || within(media, docs) {
+			return nil, fmt.Errorf("DOCUMENTS_DIR %q overlaps BLOB_DIR %q", private.Dir, cfg.Blob.Dir)
+		}
+	case "s3":
+		if private.S3.Bucket == "" || private.S3.Bucket == cfg.Blob.S3.Bucket {
+			return nil, errors.New("DOCUMENTS_S3_BUCKET must be set to a bucket other than BLOB_S3_BUCKET")
+		}
+	}
+
+	return blob.New(&private)
+}
+
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// shutdown stops accepting connections, waits for in-flight requests and
+// then for background tasks such as e-mails, all within the shutdown
+// timeout. Readiness fails first so the load balancer stops sending traffic.
+func shutdown(server *http.Server, checker *health.Checker, tasks *background.Group, cfg config.Server) {
+	checker.Shutdown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if err != nil {
+		slog.Error("failed to drain requests", err)
+	}
+
+	err = tasks.Wait(ctx)
+	if err != nil {
+		slog.Error("failed to drain background tasks", err)
+	}
+}
+
+// serveMetrics exposes /metrics on a listener of its own.
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	slog.Info("starting metrics server", "addr", addr)
+	err := http.ListenAndServe(addr, mux)
+	if err != nil {
+		fatal("failed to run metrics server", err)
+	}
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, err)
+	os.Exit(1)
 }
@@ -0,0 +1,108 @@
+// Command migrate-media copies media files from a local directory into the
+// blob store configured by BLOB_DRIVER, e.g. when moving to S3. Files that
+// are already in the store are skipped, so it can be run again after a
+// failure.
+//
+//	go run ./cmd/migrate-media -from ./media
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"mime"
+	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
+	"syscall"
+
+	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/blob"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/logger"
+	"golang.org/x/exp/slog"
+)
+
+func main() {
+	from := flag.String("from", "./media", "directory to copy the files from")
+	remove := flag.Bool("delete", false, "delete each file from the directory once it is copied")
+	dryRun := flag.Bool("dry-run", false, "only list the files that would be copied")
+	flag.Parse()
+
+	cfg := config.Load(".")
+	slog.SetDefault(logger.New(&cfg.Log, os.Stdout))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Blob.Driver == "local" && filepath.Clean(cfg.Blob.Dir) == filepath.Clean(*from) {
+		fatal("nothing to migrate", errors.New("source directory is the blob store itself"))
+	}
+
+	src := blob.NewLocal(*from)
+	dst, err := blob.New(&cfg.Blob)
+	if err != nil {
+		fatal("failed to open blob store", err)
+	}
+
+	var copied, skipped int
+	err = src.List(ctx, "", func(obj *blob.ObjectInfo) error {
+		key := obj.Key
+		exists, err := dst.Exists(ctx, key)
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			skipped++
+		} else {
+			if *dryRun {
+				slog.Info("would copy", "key", key)
+				copied++
+				return nil
+			}
+
+			err = copyBlob(ctx, src, dst, key)
+			if err != nil {
+				return err
+			}
+			copied++
+		}
+
+		if *remove && !*dryRun {
+			return src.Delete(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		fatal("failed to migrate media", err)
+	}
+
+	slog.Info("media migrated", "copied", copied, "skipped", skipped, "dry_run", *dryRun)
+}
+
+func copyBlob(ctx context.Context, src, dst blob.Store, key string) error {
+	obj, err := src.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer obj.Close()
+
+	contentType := obj.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+
+	err = dst.Put(ctx, key, obj, obj.Size, contentType)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("copied", "key", key, "size", obj.Size)
+	return nil
+}
+
+func fatal(msg string, err error) {
+	slog.Error(msg, err)
+	os.Exit(1)
+}
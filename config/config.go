@@ -1,24 +1,175 @@
 package config
 
 import (
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/joho/godotenv"
 	"github.com/spf13/viper"
 )
 
 type Config struct {
 	HttpPort      string
+	Server        Server
 	Postgres      PostgresConfig
 	Smtp          Smtp
 	Redis         Redis
+	Cache         Cache
+	Purge         Purge
+	RateLimit     RateLimit
+	Log           Log
+	Metrics       Metrics
+	Tracing       Tracing
+	Upload        Upload
+	Blob          Blob
+	MediaGC       MediaGC
+	Documents     Documents
+	Payments      Payments
+	Currency      Currency
+	Commission    Commission
 	AuthSecretKey string
 }
 
+// Server holds the HTTP server timeouts. ShutdownTimeout bounds how long
+// in-flight requests and background e-mails get to finish on SIGTERM.
+// TrustedProxies lists the IPs and CIDRs whose X-Forwarded-For is believed
+// when resolving the client IP. None are trusted by default.
+type Server struct {
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	ShutdownTimeout   time.Duration
+	TrustedProxies    []string
+}
+
+// Log configures the application logger. Format is "json" or "text", level
+// is one of debug, info, warn and error.
+type Log struct {
+	Level  string
+	Format string
+}
+
+// Metrics controls the Prometheus endpoint. With an Addr it is served on its
+// own listener, so it can stay off the public port, otherwise it is mounted
+// at /metrics on the API router.
+type Metrics struct {
+	Enabled bool
+	Addr    string
+}
+
+// Tracing configures the OTLP/HTTP span exporter. Endpoint is host:port of
+// the collector.
+type Tracing struct {
+	Enabled     bool
+	Endpoint    string
+	Insecure    bool
+	ServiceName string
+	SampleRatio float64
+}
+
+// Upload limits what UploadFile accepts. MaxSize is in bytes, images wider
+// or taller than MaxWidth or MaxHeight pixels are rejected.
+type Upload struct {
+	MaxSize     int64
+	MaxWidth    int
+	MaxHeight   int
+	Derivatives Derivatives
+}
+
+// Derivatives configures the resized copies made of every uploaded image.
+// Sizes is read from UPLOAD_DERIVATIVE_SIZES as "name:width" pairs, e.g.
+// "thumbnail:200,medium:800". Interval is how often the worker looks for
+// images it missed, new uploads are picked up right away.
+type Derivatives struct {
+	Sizes    []ImageSize
+	Interval time.Duration
+}
+
+type ImageSize struct {
+	Name  string
+	Width int
+}
+
+// Blob selects where media files are kept: "local" stores them under Dir,
+// "s3" in an S3 compatible bucket. Serve is "proxy" to stream files through
+// the API or "redirect" to send clients to a presigned URL valid for
+// URLExpiry; the local driver always proxies.
+type Blob struct {
+	Driver    string
+	Dir       string
+	S3        S3
+	Serve     string
+	URLExpiry time.Duration
+}
+
+// MediaGC controls the sweeper that deletes media no hotel or room refers
+// to once they are older than GracePeriod. A zero grace period disables it.
+// With DryRun the sweeper only logs what it would delete.
+type MediaGC struct {
+	GracePeriod time.Duration
+	Interval    time.Duration
+	DryRun      bool
+}
+
+// Documents configures private uploads such as ID scans and contracts. They
+// are kept apart from media, under Dir or in Bucket with the s3 driver, and
+// are only served through links signed with SigningKey that expire after
+// URLExpiry. SigningKey defaults to AUTH_SECRET_KEY.
+type Documents struct {
+	Dir        string
+	Bucket     string
+	SigningKey string
+	URLExpiry  time.Duration
+	MaxSize    int64
+}
+
+// Payments selects the payment provider, "fake" being the only one so far,
+// and the booking policy. DepositPercent of the total has to be captured
+// before a booking is confirmed. Cancelling at least FreeCancellation before
+// check-in refunds everything that was paid, later cancellations get
+// LateRefundPercent of it back.
+type Payments struct {
+	Provider          string
+	WebhookSecret     string
+	DepositPercent    int
+	FreeCancellation  time.Duration
+	LateRefundPercent int
+}
+
+// Currency is the base currency exchange rates are quoted against. Rates can
+// be managed over the API or loaded from RatesFile, a "CURRENCY,RATE" per
+// line file, on startup.
+type Currency struct {
+	Base      string
+	RatesFile string
+}
+
+// Commission is the percentage of the booking total partners without a
+// rate of their own pay.
+type Commission struct {
+	DefaultRate string
+}
+
+type S3 struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
 type PostgresConfig struct {
 	Host     string
 	Port     string
 	User     string
 	Password string
 	Database string
+	// MigrationsDir holds the migration files readiness compares the
+	// schema version against.
+	MigrationsDir string
 }
 
 type Smtp struct {
@@ -30,20 +181,117 @@ type Redis struct {
 	Addr string
 }
 
+type Cache struct {
+	Enabled      bool
+	HotelTTL     time.Duration
+	HotelListTTL time.Duration
+	RoomTTL      time.Duration
+	RoomListTTL  time.Duration
+}
+
+// Purge controls the job that hard deletes soft deleted records. A zero
+// retention disables it.
+type Purge struct {
+	Retention time.Duration
+	Interval  time.Duration
+}
+
+// RateLimitPolicy allows Limit requests per Window for each identity. Key is
+// what identifies a caller: "ip", "user" or "api_key". The last two fall back
+// to the IP when the request carries no valid token or no key listed in
+// RATE_LIMIT_API_KEYS. A zero limit disables the policy.
+type RateLimitPolicy struct {
+	Limit  int
+	Window time.Duration
+	Key    string
+}
+
+type RateLimit struct {
+	Enabled        bool
+	APIKeys        []string
+	Register       RateLimitPolicy
+	Login          RateLimitPolicy
+	Verify         RateLimitPolicy
+	ForgotPassword RateLimitPolicy
+	FileUpload     RateLimitPolicy
+	InvoiceEmail   RateLimitPolicy
+}
+
 func Load(path string) Config {
 	godotenv.Load(path + "/.env") // load .env file if it exists
 
 	conf := viper.New()
 	conf.AutomaticEnv()
 
+	conf.SetDefault("SERVER_READ_HEADER_TIMEOUT", 5*time.Second)
+	conf.SetDefault("SERVER_READ_TIMEOUT", 15*time.Second)
+	conf.SetDefault("SERVER_WRITE_TIMEOUT", 30*time.Second)
+	conf.SetDefault("SERVER_IDLE_TIMEOUT", 2*time.Minute)
+	conf.SetDefault("SERVER_SHUTDOWN_TIMEOUT", 20*time.Second)
+	conf.SetDefault("POSTGRES_MIGRATIONS_DIR", "./migrations")
+	conf.SetDefault("LOG_LEVEL", "info")
+	conf.SetDefault("LOG_FORMAT", "json")
+	conf.SetDefault("METRICS_ENABLED", true)
+	conf.SetDefault("TRACING_ENABLED", false)
+	conf.SetDefault("TRACING_ENDPOINT", "localhost:4318")
+	conf.SetDefault("TRACING_INSECURE", true)
+	conf.SetDefault("TRACING_SERVICE_NAME", "booking")
+	conf.SetDefault("TRACING_SAMPLE_RATIO", 1.0)
+	conf.SetDefault("BLOB_DRIVER", "local")
+	conf.SetDefault("BLOB_DIR", "./media")
+	conf.SetDefault("BLOB_SERVE", "proxy")
+	conf.SetDefault("BLOB_URL_EXPIRY", 15*time.Minute)
+	conf.SetDefault("BLOB_S3_REGION", "us-east-1")
+	conf.SetDefault("BLOB_S3_USE_SSL", true)
+	conf.SetDefault("UPLOAD_MAX_SIZE", 10<<20)
+	conf.SetDefault("UPLOAD_MAX_WIDTH", 8000)
+	conf.SetDefault("UPLOAD_MAX_HEIGHT", 8000)
+	conf.SetDefault("UPLOAD_DERIVATIVE_SIZES", "thumbnail:200,medium:800,large:1600")
+	conf.SetDefault("UPLOAD_DERIVATIVE_INTERVAL", time.Minute)
+	conf.SetDefault("MEDIA_GC_GRACE_PERIOD", 24*time.Hour)
+	conf.SetDefault("MEDIA_GC_INTERVAL", 6*time.Hour)
+	conf.SetDefault("MEDIA_GC_DRY_RUN", false)
+	conf.SetDefault("DOCUMENTS_DIR", "./private")
+	conf.SetDefault("DOCUMENTS_URL_EXPIRY", 5*time.Minute)
+	conf.SetDefault("DOCUMENTS_MAX_SIZE", 20<<20)
+	conf.SetDefault("PAYMENTS_PROVIDER", "fake")
+	conf.SetDefault("PAYMENTS_DEPOSIT_PERCENT", 100)
+	conf.SetDefault("PAYMENTS_FREE_CANCELLATION", 48*time.Hour)
+	conf.SetDefault("PAYMENTS_LATE_REFUND_PERCENT", 50)
+	conf.SetDefault("CURRENCY_BASE", "USD")
+	conf.SetDefault("COMMISSION_DEFAULT_RATE", "15")
+	conf.SetDefault("CACHE_ENABLED", true)
+	conf.SetDefault("CACHE_HOTEL_TTL", 10*time.Minute)
+	conf.SetDefault("CACHE_HOTEL_LIST_TTL", time.Minute)
+	conf.SetDefault("CACHE_ROOM_TTL", 10*time.Minute)
+	conf.SetDefault("CACHE_ROOM_LIST_TTL", time.Minute)
+	conf.SetDefault("PURGE_RETENTION", 30*24*time.Hour)
+	conf.SetDefault("PURGE_INTERVAL", 24*time.Hour)
+	conf.SetDefault("RATE_LIMIT_ENABLED", true)
+	setRateLimitDefaults(conf, "REGISTER", 5, time.Hour, "ip")
+	setRateLimitDefaults(conf, "LOGIN", 10, time.Minute, "ip")
+	setRateLimitDefaults(conf, "VERIFY", 10, 10*time.Minute, "ip")
+	setRateLimitDefaults(conf, "FORGOT_PASSWORD", 3, time.Hour, "ip")
+	setRateLimitDefaults(conf, "FILE_UPLOAD", 30, time.Hour, "user")
+	setRateLimitDefaults(conf, "INVOICE_EMAIL", 10, time.Hour, "user")
+
 	cfg := Config{
 		HttpPort: conf.GetString("HTTP_PORT"),
+		Server: Server{
+			ReadHeaderTimeout: conf.GetDuration("SERVER_READ_HEADER_TIMEOUT"),
+			ReadTimeout:       conf.GetDuration("SERVER_READ_TIMEOUT"),
+			WriteTimeout:      conf.GetDuration("SERVER_WRITE_TIMEOUT"),
+			IdleTimeout:       conf.GetDuration("SERVER_IDLE_TIMEOUT"),
+			ShutdownTimeout:   conf.GetDuration("SERVER_SHUTDOWN_TIMEOUT"),
+			TrustedProxies:    list(conf.GetString("SERVER_TRUSTED_PROXIES")),
+		},
 		Postgres: PostgresConfig{
-			Host:     conf.GetString("POSTGRES_HOST"),
-			Port:     conf.GetString("POSTGRES_PORT"),
-			User:     conf.GetString("POSTGRES_USER"),
-			Password: conf.GetString("POSTGRES_PASSWORD"),
-			Database: conf.GetString("POSTGRES_DATABASE"),
+			Host:          conf.GetString("POSTGRES_HOST"),
+			Port:          conf.GetString("POSTGRES_PORT"),
+			User:          conf.GetString("POSTGRES_USER"),
+			Password:      conf.GetString("POSTGRES_PASSWORD"),
+			Database:      conf.GetString("POSTGRES_DATABASE"),
+			MigrationsDir: conf.GetString("POSTGRES_MIGRATIONS_DIR"),
 		},
 		Smtp: Smtp{
 			Sender:   conf.GetString("SMTP_SENDER"),
@@ -52,8 +300,142 @@ func Load(path string) Config {
 		Redis: Redis{
 			Addr: conf.GetString("REDIS_ADDR"),
 		},
+		Cache: Cache{
+			Enabled:      conf.GetBool("CACHE_ENABLED"),
+			HotelTTL:     conf.GetDuration("CACHE_HOTEL_TTL"),
+			HotelListTTL: conf.GetDuration("CACHE_HOTEL_LIST_TTL"),
+			RoomTTL:      conf.GetDuration("CACHE_ROOM_TTL"),
+			RoomListTTL:  conf.GetDuration("CACHE_ROOM_LIST_TTL"),
+		},
+		Purge: Purge{
+			Retention: conf.GetDuration("PURGE_RETENTION"),
+			Interval:  conf.GetDuration("PURGE_INTERVAL"),
+		},
+		RateLimit: RateLimit{
+			Enabled:        conf.GetBool("RATE_LIMIT_ENABLED"),
+			APIKeys:        list(conf.GetString("RATE_LIMIT_API_KEYS")),
+			Register:       rateLimitPolicy(conf, "REGISTER"),
+			Login:          rateLimitPolicy(conf, "LOGIN"),
+			Verify:         rateLimitPolicy(conf, "VERIFY"),
+			ForgotPassword: rateLimitPolicy(conf, "FORGOT_PASSWORD"),
+			FileUpload:     rateLimitPolicy(conf, "FILE_UPLOAD"),
+			InvoiceEmail:   rateLimitPolicy(conf, "INVOICE_EMAIL"),
+		},
+		Log: Log{
+			Level:  conf.GetString("LOG_LEVEL"),
+			Format: conf.GetString("LOG_FORMAT"),
+		},
+		Metrics: Metrics{
+			Enabled: conf.GetBool("METRICS_ENABLED"),
+			Addr:    conf.GetString("METRICS_ADDR"),
+		},
+		Tracing: Tracing{
+			Enabled:     conf.GetBool("TRACING_ENABLED"),
+			Endpoint:    conf.GetString("TRACING_ENDPOINT"),
+			Insecure:    conf.GetBool("TRACING_INSECURE"),
+			ServiceName: conf.GetString("TRACING_SERVICE_NAME"),
+			SampleRatio: conf.GetFloat64("TRACING_SAMPLE_RATIO"),
+		},
+		Upload: Upload{
+			MaxSize:   conf.GetInt64("UPLOAD_MAX_SIZE"),
+			MaxWidth:  conf.GetInt("UPLOAD_MAX_WIDTH"),
+			MaxHeight: conf.GetInt("UPLOAD_MAX_HEIGHT"),
+			Derivatives: Derivatives{
+				Sizes:    imageSizes(conf.GetString("UPLOAD_DERIVATIVE_SIZES")),
+				Interval: conf.GetDuration("UPLOAD_DERIVATIVE_INTERVAL"),
+			},
+		},
+		Blob: Blob{
+			Driver: conf.GetString("BLOB_DRIVER"),
+			Dir:    conf.GetString("BLOB_DIR"),
+			S3: S3{
+				Endpoint:  conf.GetString("BLOB_S3_ENDPOINT"),
+				Region:    conf.GetString("BLOB_S3_REGION"),
+				Bucket:    conf.GetString("BLOB_S3_BUCKET"),
+				AccessKey: conf.GetString("BLOB_S3_ACCESS_KEY"),
+				SecretKey: conf.GetString("BLOB_S3_SECRET_KEY"),
+				UseSSL:    conf.GetBool("BLOB_S3_USE_SSL"),
+			},
+			Serve:     conf.GetString("BLOB_SERVE"),
+			URLExpiry: conf.GetDuration("BLOB_URL_EXPIRY"),
+		},
+		MediaGC: MediaGC{
+			GracePeriod: conf.GetDuration("MEDIA_GC_GRACE_PERIOD"),
+			Interval:    conf.GetDuration("MEDIA_GC_INTERVAL"),
+			DryRun:      conf.GetBool("MEDIA_GC_DRY_RUN"),
+		},
+		Documents: Documents{
+			Dir:        conf.GetString("DOCUMENTS_DIR"),
+			Bucket:     conf.GetString("DOCUMENTS_S3_BUCKET"),
+			SigningKey: conf.GetString("DOCUMENTS_SIGNING_KEY"),
+			URLExpiry:  conf.GetDuration("DOCUMENTS_URL_EXPIRY"),
+			MaxSize:    conf.GetInt64("DOCUMENTS_MAX_SIZE"),
+		},
+		Payments: Payments{
+			Provider:          conf.GetString("PAYMENTS_PROVIDER"),
+			WebhookSecret:     conf.GetString("PAYMENTS_WEBHOOK_SECRET"),
+			DepositPercent:    conf.GetInt("PAYMENTS_DEPOSIT_PERCENT"),
+			FreeCancellation:  conf.GetDuration("PAYMENTS_FREE_CANCELLATION"),
+			LateRefundPercent: conf.GetInt("PAYMENTS_LATE_REFUND_PERCENT"),
+		},
+		Currency: Currency{
+			Base:      conf.GetString("CURRENCY_BASE"),
+			RatesFile: conf.GetString("EXCHANGE_RATES_FILE"),
+		},
+		Commission: Commission{
+			DefaultRate: conf.GetString("COMMISSION_DEFAULT_RATE"),
+		},
 		AuthSecretKey: conf.GetString("AUTH_SECRET_KEY"),
 	}
 
+	if cfg.Documents.SigningKey == "" {
+		cfg.Documents.SigningKey = cfg.AuthSecretKey
+	}
+
 	return cfg
-}
\ No newline at end of file
+}
+
+// setRateLimitDefaults registers RATE_LIMIT_<NAME>_{LIMIT,WINDOW,KEY}.
+func setRateLimitDefaults(conf *viper.Viper, name string, limit int, window time.Duration, key string) {
+	conf.SetDefault("RATE_LIMIT_"+name+"_LIMIT", limit)
+	conf.SetDefault("RATE_LIMIT_"+name+"_WINDOW", window)
+	conf.SetDefault("RATE_LIMIT_"+name+"_KEY", key)
+}
+
+func rateLimitPolicy(conf *viper.Viper, name string) RateLimitPolicy {
+	return RateLimitPolicy{
+		Limit:  conf.GetInt("RATE_LIMIT_" + name + "_LIMIT"),
+		Window: conf.GetDuration("RATE_LIMIT_" + name + "_WINDOW"),
+		Key:    conf.GetString("RATE_LIMIT_" + name + "_KEY"),
+	}
+}
+
+// list splits a comma separated value, dropping empty items.
+func list(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// imageSizes parses "name:width" pairs. Malformed pairs are skipped.
+func imageSizes(value string) []ImageSize {
+	var sizes []ImageSize
+	for _, pair := range strings.Split(value, ",") {
+		name, width, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			continue
+		}
+
+		w, err := strconv.Atoi(width)
+		if err != nil || w <= 0 || name == "" {
+			continue
+		}
+
+		sizes = append(sizes, ImageSize{Name: name, Width: w})
+	}
+	return sizes
+}
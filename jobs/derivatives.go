@@ -0,0 +1,166 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/blob"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/imaging"
+	"github.com/MuhammadyusufAdhamov/booking/storage"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"golang.org/x/exp/slog"
+)
+
+// deriveBatch is how many images one pass picks up.
+const deriveBatch = 20
+
+// Deriver generates the resized copies of uploaded images. Uploads call
+// Notify so new images are processed right away; the periodic pass catches
+// images left over by a restart or a failure.
+type Deriver struct {
+	strg     storage.StorageI
+	blobs    blob.Store
+	sizes    []config.ImageSize
+	interval time.Duration
+	wake     chan struct{}
+}
+
+func NewDeriver(strg storage.StorageI, blobs blob.Store, cfg *config.Derivatives) *Deriver {
+	return &Deriver{
+		strg:     strg,
+		blobs:    blobs,
+		sizes:    cfg.Sizes,
+		interval: cfg.Interval,
+		wake:     make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes the worker up. It never blocks and is a no-op on a nil
+// Deriver.
+func (d *Deriver) Notify() {
+	if d == nil {
+		return
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run processes pending images whenever it is notified and once per interval
+// until ctx is cancelled.
+func (d *Deriver) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.interval)
+	defer ticker.Stop()
+
+	for {
+		err := d.ProcessPending(ctx)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorCtx(ctx, "failed to generate image derivatives", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// ProcessPending generates the derivatives of every image that has none
+// yet. An image that can't be processed is logged and marked done, so it
+// doesn't block the queue; it is still served at its original size.
+func (d *Deriver) ProcessPending(ctx context.Context) error {
+	for {
+		pending, err := d.strg.Media().GetUnprocessed(ctx, deriveBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, media := range pending {
+			derivatives, err := d.derive(ctx, media)
+			if err != nil {
+				slog.ErrorCtx(ctx, "failed to resize image", err, "media_id", media.ID)
+			}
+
+			err = d.strg.Media().SetDerivatives(ctx, media.ID, derivatives)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(pending) < deriveBatch {
+			return nil
+		}
+	}
+}
+
+// derive writes one copy per configured size narrower than the original.
+// The files are named after the original, so identical uploads share them.
+func (d *Deriver) derive(ctx context.Context, media *repo.Media) ([]*repo.Derivative, error) {
+	derivatives := make([]*repo.Derivative, 0, len(d.sizes))
+
+	data, err := d.read(ctx, media.FileName)
+	if err != nil {
+		return derivatives, err
+	}
+
+	info, err := imaging.Inspect(data)
+	if err != nil {
+		return derivatives, err
+	}
+
+	img, err := imaging.Decode(info, data)
+	if err != nil {
+		return derivatives, err
+	}
+
+	base := strings.TrimSuffix(media.FileName, filepath.Ext(media.FileName))
+	for _, size := range d.sizes {
+		if size.Width >= info.Width {
+			continue
+		}
+
+		resized := imaging.Resize(img, size.Width)
+
+		var buf bytes.Buffer
+		contentType, ext, err := imaging.Encode(&buf, resized)
+		if err != nil {
+			return derivatives, err
+		}
+
+		fileName := base + "_" + size.Name + ext
+		err = d.blobs.Put(ctx, fileName, bytes.NewReader(buf.Bytes()), int64(buf.Len()), contentType)
+		if err != nil {
+			return derivatives, err
+		}
+
+		derivatives = append(derivatives, &repo.Derivative{
+			Name:        size.Name,
+			FileName:    fileName,
+			ContentType: contentType,
+			Size:        int64(buf.Len()),
+			Width:       resized.Bounds().Dx(),
+			Height:      resized.Bounds().Dy(),
+		})
+	}
+
+	return derivatives, nil
+}
+
+func (d *Deriver) read(ctx context.Context, key string) ([]byte, error) {
+	obj, err := d.blobs.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer obj.Close()
+
+	return io.ReadAll(obj)
+}
@@ -0,0 +1,196 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/blob"
+	"github.com/MuhammadyusufAdhamov/booking/storage"
+	"github.com/lib/pq"
+	"golang.org/x/exp/slog"
+)
+
+// sweepBatch is how many orphaned media one query fetches.
+const sweepBatch = 100
+
+// contentKey matches the blob keys uploads create: the SHA-256 of the file,
+// optionally followed by a derivative name.
+var contentKey = regexp.MustCompile(`^([0-9a-f]{64})(_[a-z0-9]+)?\.[a-z0-9]+$`)
+
+// SweepReport lists what a sweep deleted, or would delete in a dry run.
+// Unrecognized holds files that were not created by an upload; they are
+// never deleted.
+type SweepReport struct {
+	DryRun       bool
+	Media        []int64
+	Files        []string
+	Bytes        int64
+	Unrecognized []string
+}
+
+// MediaSweeper deletes media no hotel or room refers to, together with their
+// files, once they are older than the grace period. The grace period gives
+// clients time to attach an upload and keeps replaced images around for a
+// while. Files left in the blob store without a media record, e.g. by a
+// failed upload, are deleted too.
+type MediaSweeper struct {
+	strg     storage.StorageI
+	blobs    blob.Store
+	grace    time.Duration
+	interval time.Duration
+	dryRun   bool
+}
+
+func NewMediaSweeper(strg storage.StorageI, blobs blob.Store, grace, interval time.Duration, dryRun bool) *MediaSweeper {
+	return &MediaSweeper{
+		strg:     strg,
+		blobs:    blobs,
+		grace:    grace,
+		interval: interval,
+		dryRun:   dryRun,
+	}
+}
+
+// Run sweeps once per interval until ctx is cancelled.
+func (s *MediaSweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		report, err := s.Sweep(ctx, s.dryRun)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorCtx(ctx, "failed to sweep orphaned media", err)
+		}
+		if report != nil && (len(report.Files) > 0 || len(report.Unrecognized) > 0) {
+			slog.InfoCtx(ctx, "swept orphaned media",
+				"dry_run", report.DryRun,
+				"media", len(report.Media),
+				"files", report.Files,
+				"bytes", report.Bytes,
+				"unrecognized", report.Unrecognized,
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep deletes orphaned media and stray files. With dryRun nothing is
+// deleted and the report lists what would be.
+func (s *MediaSweeper) Sweep(ctx context.Context, dryRun bool) (*SweepReport, error) {
+	report := &SweepReport{
+		DryRun:       dryRun,
+		Media:        make([]int64, 0),
+		Files:        make([]string, 0),
+		Unrecognized: make([]string, 0),
+	}
+	before := time.Now().Add(-s.grace)
+
+	err := s.sweepMedia(ctx, report, before)
+	if err != nil {
+		return report, err
+	}
+
+	err = s.sweepFiles(ctx, report, before)
+	return report, err
+}
+
+func (s *MediaSweeper) sweepMedia(ctx context.Context, report *SweepReport, before time.Time) error {
+	var afterID int64
+	for {
+		orphans, err := s.strg.Media().GetOrphans(ctx, before, afterID, sweepBatch)
+		if err != nil {
+			return err
+		}
+
+		for _, media := range orphans {
+			afterID = media.ID
+
+			if !report.DryRun {
+				err = s.strg.Media().DeleteOrphan(ctx, media.ID)
+				if isAttached(err) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+			}
+			report.Media = append(report.Media, media.ID)
+
+			err = s.strg.Media().LockChecksum(ctx, media.Checksum, func() error {
+				// another owner uploaded the same file
+				shared, err := s.strg.Media().ChecksumInUse(ctx, media.Checksum, media.ID)
+				if err != nil || shared {
+					return err
+				}
+
+				report.Bytes += media.Size
+				for _, d := range media.Derivatives {
+					report.Bytes += d.Size
+				}
+
+				for _, key := range media.Keys() {
+					err = s.delete(ctx, report, key)
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(orphans) < sweepBatch {
+			return nil
+		}
+	}
+}
+
+// isAttached reports whether an orphan got referenced between being listed
+// and being deleted.
+func isAttached(err error) bool {
+	var pqErr *pq.Error
+	return errors.Is(err, sql.ErrNoRows) || (errors.As(err, &pqErr) && pqErr.Code.Name() == "foreign_key_violation")
+}
+
+func (s *MediaSweeper) sweepFiles(ctx context.Context, report *SweepReport, before time.Time) error {
+	return s.blobs.List(ctx, "", func(obj *blob.ObjectInfo) error {
+		if obj.ModTime.After(before) {
+			return nil
+		}
+
+		match := contentKey.FindStringSubmatch(obj.Key)
+		if match == nil {
+			report.Unrecognized = append(report.Unrecognized, obj.Key)
+			return nil
+		}
+
+		return s.strg.Media().LockChecksum(ctx, match[1], func() error {
+			inUse, err := s.strg.Media().ChecksumInUse(ctx, match[1], 0)
+			if err != nil || inUse {
+				return err
+			}
+
+			report.Bytes += obj.Size
+			return s.delete(ctx, report, obj.Key)
+		})
+	})
+}
+
+func (s *MediaSweeper) delete(ctx context.Context, report *SweepReport, key string) error {
+	report.Files = append(report.Files, key)
+	if report.DryRun {
+		return nil
+	}
+
+	return s.blobs.Delete(ctx, key)
+}
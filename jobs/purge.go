@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"golang.org/x/exp/slog"
+)
+
+// Purger hard deletes records that have been soft deleted for longer than the
+// retention period.
+type Purger struct {
+	strg      storage.StorageI
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewPurger(strg storage.StorageI, retention, interval time.Duration) *Purger {
+	return &Purger{
+		strg:      strg,
+		retention: retention,
+		interval:  interval,
+	}
+}
+
+// Run purges once per interval until ctx is cancelled.
+func (p *Purger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		err := p.PurgeOnce(ctx)
+		if err != nil {
+			slog.ErrorCtx(ctx, "failed to purge deleted records", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// PurgeOnce removes expired records. Bookings go first so the rooms, hotels
+// and users they pointed at can be purged in the same run.
+func (p *Purger) PurgeOnce(ctx context.Context) error {
+	before := time.Now().Add(-p.retention)
+
+	purges := []struct {
+		entity string
+		purge  func(context.Context, time.Time) (int64, error)
+	}{
+		{repo.AuditEntityBooking, p.strg.Booking().Purge},
+		{repo.AuditEntityRoom, p.strg.Room().Purge},
+		{repo.AuditEntityHotel, p.strg.Hotel().Purge},
+		{repo.AuditEntityUser, p.strg.User().Purge},
+	}
+
+	for _, item := range purges {
+		count, err := item.purge(ctx, before)
+		if err != nil {
+			return err
+		}
+
+		if count > 0 {
+			slog.InfoCtx(ctx, "purged deleted records", "entity", item.entity, "count", count)
+		}
+	}
+
+	return nil
+}
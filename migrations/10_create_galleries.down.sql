@@ -0,0 +1,7 @@
+CREATE OR REPLACE VIEW "media_references" AS
+    SELECT "image_id" AS "media_id", 'hotel' AS "entity", "id" AS "entity_id" FROM "hotels" WHERE "image_id" IS NOT NULL
+    UNION ALL
+    SELECT "image_id", 'room', "id" FROM "rooms" WHERE "image_id" IS NOT NULL;
+
+DROP TABLE IF EXISTS "room_images";
+DROP TABLE IF EXISTS "hotel_images";
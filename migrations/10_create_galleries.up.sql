@@ -0,0 +1,38 @@
+CREATE TABLE IF NOT EXISTS "hotel_images"(
+    "hotel_id" INTEGER NOT NULL REFERENCES "hotels"("id") ON DELETE CASCADE,
+    "media_id" BIGINT NOT NULL REFERENCES "media"("id"),
+    "position" INTEGER NOT NULL,
+    "caption" VARCHAR(500) NOT NULL DEFAULT '',
+    "alt_text" VARCHAR(500) NOT NULL DEFAULT '',
+    "is_cover" BOOLEAN NOT NULL DEFAULT FALSE,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY ("hotel_id", "media_id")
+);
+
+CREATE TABLE IF NOT EXISTS "room_images"(
+    "room_id" INTEGER NOT NULL REFERENCES "rooms"("id") ON DELETE CASCADE,
+    "media_id" BIGINT NOT NULL REFERENCES "media"("id"),
+    "position" INTEGER NOT NULL,
+    "caption" VARCHAR(500) NOT NULL DEFAULT '',
+    "alt_text" VARCHAR(500) NOT NULL DEFAULT '',
+    "is_cover" BOOLEAN NOT NULL DEFAULT FALSE,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY ("room_id", "media_id")
+);
+
+-- at most one cover per gallery
+CREATE UNIQUE INDEX IF NOT EXISTS "hotel_images_cover_key" ON "hotel_images"("hotel_id") WHERE "is_cover";
+CREATE UNIQUE INDEX IF NOT EXISTS "room_images_cover_key" ON "room_images"("room_id") WHERE "is_cover";
+
+CREATE INDEX IF NOT EXISTS "hotel_images_media_id_idx" ON "hotel_images"("media_id");
+CREATE INDEX IF NOT EXISTS "room_images_media_id_idx" ON "room_images"("media_id");
+
+-- gallery images are not garbage collected either
+CREATE OR REPLACE VIEW "media_references" AS
+    SELECT "image_id" AS "media_id", 'hotel' AS "entity", "id" AS "entity_id" FROM "hotels" WHERE "image_id" IS NOT NULL
+    UNION ALL
+    SELECT "image_id", 'room', "id" FROM "rooms" WHERE "image_id" IS NOT NULL
+    UNION ALL
+    SELECT "media_id", 'hotel_gallery', "hotel_id" FROM "hotel_images"
+    UNION ALL
+    SELECT "media_id", 'room_gallery', "room_id" FROM "room_images";
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "refunds";
+DROP TABLE IF EXISTS "payments";
+
+ALTER TABLE "bookings" DROP COLUMN IF EXISTS "status";
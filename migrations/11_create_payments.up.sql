@@ -0,0 +1,36 @@
+-- bookings made before payments existed stay confirmed, new ones wait for a
+-- payment
+ALTER TABLE "bookings" ADD COLUMN IF NOT EXISTS "status" VARCHAR(20) NOT NULL DEFAULT 'confirmed';
+ALTER TABLE "bookings" ALTER COLUMN "status" SET DEFAULT 'pending';
+
+-- amounts are in minor units of the currency
+CREATE TABLE IF NOT EXISTS "payments"(
+    "id" BIGSERIAL PRIMARY KEY,
+    "booking_id" INTEGER NOT NULL REFERENCES "bookings"("id"),
+    "provider" VARCHAR(50) NOT NULL,
+    "provider_ref" VARCHAR(255),
+    "amount" BIGINT NOT NULL CHECK ("amount" > 0),
+    "currency" CHAR(3) NOT NULL,
+    "status" VARCHAR(20) NOT NULL,
+    "refunded" BIGINT NOT NULL DEFAULT 0,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ("refunded" <= "amount")
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "payments_provider_ref_key" ON "payments"("provider", "provider_ref");
+CREATE INDEX IF NOT EXISTS "payments_booking_id_idx" ON "payments"("booking_id");
+
+CREATE TABLE IF NOT EXISTS "refunds"(
+    "id" BIGSERIAL PRIMARY KEY,
+    "payment_id" BIGINT NOT NULL REFERENCES "payments"("id"),
+    "provider_ref" VARCHAR(255),
+    "amount" BIGINT NOT NULL CHECK ("amount" > 0),
+    "reason" VARCHAR(255) NOT NULL DEFAULT '',
+    "status" VARCHAR(20) NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS "refunds_payment_id_idx" ON "refunds"("payment_id");
+CREATE INDEX IF NOT EXISTS "refunds_provider_ref_idx" ON "refunds"("provider_ref");
@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS "invoices_immutable" ON "invoices";
+DROP FUNCTION IF EXISTS "invoices_immutable"();
+DROP TABLE IF EXISTS "invoices";
+DROP TABLE IF EXISTS "invoice_sequences";
+DROP TABLE IF EXISTS "hotel_legal_details";
@@ -0,0 +1,45 @@
+CREATE TABLE IF NOT EXISTS "hotel_legal_details"(
+    "hotel_id" INTEGER PRIMARY KEY REFERENCES "hotels"("id") ON DELETE CASCADE,
+    "legal_name" VARCHAR(255) NOT NULL,
+    "address" VARCHAR(500) NOT NULL,
+    "tax_id" VARCHAR(50) NOT NULL,
+    "registration_number" VARCHAR(100) NOT NULL DEFAULT '',
+    "email" VARCHAR(255) NOT NULL DEFAULT '',
+    "updated_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- the last number issued per hotel and kind; taking a number locks the row
+-- until the invoice is stored, so rolled back invoices leave no gaps
+CREATE TABLE IF NOT EXISTS "invoice_sequences"(
+    "hotel_id" INTEGER NOT NULL REFERENCES "hotels"("id"),
+    "kind" VARCHAR(20) NOT NULL,
+    "last_number" BIGINT NOT NULL,
+    PRIMARY KEY ("hotel_id", "kind")
+);
+
+CREATE TABLE IF NOT EXISTS "invoices"(
+    "id" BIGSERIAL PRIMARY KEY,
+    "hotel_id" INTEGER NOT NULL REFERENCES "hotels"("id"),
+    "booking_id" INTEGER NOT NULL REFERENCES "bookings"("id"),
+    "kind" VARCHAR(20) NOT NULL CHECK ("kind" IN ('invoice', 'receipt')),
+    "sequence" BIGINT NOT NULL,
+    "number" VARCHAR(50) NOT NULL,
+    "currency" CHAR(3) NOT NULL,
+    "total" BIGINT NOT NULL,
+    "lines" JSONB NOT NULL,
+    "content" BYTEA NOT NULL,
+    "checksum" CHAR(64) NOT NULL,
+    "issued_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE ("hotel_id", "kind", "sequence"),
+    UNIQUE ("booking_id", "kind")
+);
+
+CREATE OR REPLACE FUNCTION "invoices_immutable"() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'invoices cannot be changed or deleted';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "invoices_immutable"
+    BEFORE UPDATE OR DELETE ON "invoices"
+    FOR EACH ROW EXECUTE PROCEDURE "invoices_immutable"();
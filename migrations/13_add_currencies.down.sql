@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS "currency_base";
+DROP TABLE IF EXISTS "exchange_rates";
+
+ALTER TABLE "bookings" DROP COLUMN IF EXISTS "exchange_rate";
+ALTER TABLE "bookings" DROP COLUMN IF EXISTS "currency";
+ALTER TABLE "bookings" ALTER COLUMN "price" TYPE DECIMAL(8, 2) USING "price" / 100.0;
@@ -0,0 +1,24 @@
+-- prices are kept in minor units of their currency; bookings made so far
+-- were all priced in US dollars
+ALTER TABLE "bookings" ALTER COLUMN "price" TYPE BIGINT USING ROUND("price" * 100);
+ALTER TABLE "bookings" ADD COLUMN IF NOT EXISTS "currency" CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE "bookings" ALTER COLUMN "currency" DROP DEFAULT;
+-- units of the base currency one unit of the booking's currency was worth
+-- when it was booked
+ALTER TABLE "bookings" ADD COLUMN IF NOT EXISTS "exchange_rate" NUMERIC(24, 12) NOT NULL DEFAULT 1;
+ALTER TABLE "bookings" ALTER COLUMN "exchange_rate" DROP DEFAULT;
+
+-- units of each currency one unit of the base currency buys
+CREATE TABLE IF NOT EXISTS "exchange_rates"(
+    "currency" CHAR(3) PRIMARY KEY,
+    "rate" NUMERIC(24, 12) NOT NULL CHECK ("rate" > 0),
+    "updated_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- the currency the rates above are relative to; the rows backfilled here
+-- are in US dollars, the app rebases them when CURRENCY_BASE differs
+CREATE TABLE IF NOT EXISTS "currency_base"(
+    "id" BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK ("id"),
+    "currency" CHAR(3) NOT NULL
+);
+INSERT INTO "currency_base"("currency") VALUES('USD') ON CONFLICT DO NOTHING;
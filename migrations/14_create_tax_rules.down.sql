@@ -0,0 +1,5 @@
+ALTER TABLE "bookings" DROP COLUMN IF EXISTS "total";
+ALTER TABLE "bookings" DROP COLUMN IF EXISTS "charges";
+ALTER TABLE "bookings" DROP COLUMN IF EXISTS "guests";
+
+DROP TABLE IF EXISTS "tax_rules";
@@ -0,0 +1,32 @@
+-- taxes and fees a hotel charges on its bookings. Percentages apply to the
+-- price, fixed amounts are in minor units of "currency" and charged once per
+-- stay, night or guest-night. Inclusive rules are part of the price,
+-- exclusive ones are added on top of it.
+CREATE TABLE IF NOT EXISTS "tax_rules"(
+    "id" SERIAL PRIMARY KEY,
+    "hotel_id" INTEGER NOT NULL REFERENCES "hotels"("id") ON DELETE CASCADE,
+    "name" VARCHAR(100) NOT NULL,
+    "kind" VARCHAR(10) NOT NULL CHECK ("kind" IN ('tax', 'fee')),
+    "type" VARCHAR(10) NOT NULL CHECK ("type" IN ('percent', 'fixed')),
+    "basis" VARCHAR(20) NOT NULL CHECK ("basis" IN ('stay', 'night', 'guest_night')),
+    "percent" NUMERIC(7, 4) CHECK ("percent" > 0),
+    "amount" BIGINT CHECK ("amount" > 0),
+    "currency" CHAR(3),
+    "inclusive" BOOLEAN NOT NULL DEFAULT FALSE,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK (
+        ("type" = 'percent' AND "percent" IS NOT NULL AND "amount" IS NULL AND "basis" = 'stay') OR
+        ("type" = 'fixed' AND "amount" IS NOT NULL AND "currency" IS NOT NULL AND "percent" IS NULL)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS "tax_rules_hotel_id_idx" ON "tax_rules"("hotel_id");
+
+-- the charges are a snapshot of the rules when the booking was priced, total
+-- is the price plus the exclusive charges
+ALTER TABLE "bookings" ADD COLUMN IF NOT EXISTS "guests" SMALLINT NOT NULL DEFAULT 1 CHECK ("guests" > 0);
+ALTER TABLE "bookings" ADD COLUMN IF NOT EXISTS "charges" JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE "bookings" ADD COLUMN IF NOT EXISTS "total" BIGINT;
+UPDATE "bookings" SET "total"="price";
+ALTER TABLE "bookings" ALTER COLUMN "total" SET NOT NULL;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "campaign_redemptions";
+DROP TABLE IF EXISTS "campaigns";
@@ -0,0 +1,45 @@
+-- discounts, either redeemed with a code or, without one, applied to every
+-- booking they match. Hotel-less campaigns apply to all hotels.
+CREATE TABLE IF NOT EXISTS "campaigns"(
+    "id" SERIAL PRIMARY KEY,
+    "code" VARCHAR(50),
+    "name" VARCHAR(100) NOT NULL,
+    "hotel_id" INTEGER REFERENCES "hotels"("id"),
+    "created_by" INTEGER NOT NULL REFERENCES "users"("id"),
+    "type" VARCHAR(10) NOT NULL CHECK ("type" IN ('percent', 'fixed')),
+    "percent" NUMERIC(7, 4) CHECK ("percent" > 0 AND "percent" <= 100),
+    "amount" BIGINT CHECK ("amount" > 0),
+    "currency" CHAR(3),
+    "valid_from" TIMESTAMP WITH TIME ZONE,
+    "valid_until" TIMESTAMP WITH TIME ZONE,
+    "min_nights" INTEGER NOT NULL DEFAULT 0 CHECK ("min_nights" >= 0),
+    "max_uses" INTEGER NOT NULL DEFAULT 0 CHECK ("max_uses" >= 0),
+    "max_uses_per_user" INTEGER NOT NULL DEFAULT 0 CHECK ("max_uses_per_user" >= 0),
+    "stackable" BOOLEAN NOT NULL DEFAULT FALSE,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    "deleted_at" TIMESTAMP WITH TIME ZONE,
+    CHECK (
+        ("type" = 'percent' AND "percent" IS NOT NULL AND "amount" IS NULL) OR
+        ("type" = 'fixed' AND "amount" IS NOT NULL AND "currency" IS NOT NULL AND "percent" IS NULL)
+    ),
+    CHECK ("valid_until" IS NULL OR "valid_from" IS NULL OR "valid_until" > "valid_from")
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "campaigns_code_key" ON "campaigns"("code") WHERE "deleted_at" IS NULL;
+CREATE INDEX IF NOT EXISTS "campaigns_hotel_id_idx" ON "campaigns"("hotel_id");
+
+-- a campaign applied to a booking; bookings that are cancelled or deleted
+-- no longer count towards the usage caps
+CREATE TABLE IF NOT EXISTS "campaign_redemptions"(
+    "id" BIGSERIAL PRIMARY KEY,
+    "campaign_id" INTEGER NOT NULL REFERENCES "campaigns"("id"),
+    "booking_id" INTEGER NOT NULL REFERENCES "bookings"("id"),
+    "user_id" INTEGER NOT NULL REFERENCES "users"("id"),
+    "amount" BIGINT NOT NULL,
+    "currency" CHAR(3) NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE ("campaign_id", "booking_id")
+);
+
+CREATE INDEX IF NOT EXISTS "campaign_redemptions_booking_id_idx" ON "campaign_redemptions"("booking_id");
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS "commission_entries";
+DROP TABLE IF EXISTS "payouts";
+DROP TABLE IF EXISTS "commission_rates";
+
+ALTER TABLE "bookings" DROP COLUMN IF EXISTS "commission_rate";
@@ -0,0 +1,60 @@
+-- the commission a booking pays is locked when it is made, like its
+-- exchange rate; bookings made so far pay none
+ALTER TABLE "bookings" ADD COLUMN IF NOT EXISTS "commission_rate" NUMERIC(7, 4) NOT NULL DEFAULT 0
+    CHECK ("commission_rate" >= 0 AND "commission_rate" <= 100);
+ALTER TABLE "bookings" ALTER COLUMN "commission_rate" DROP DEFAULT;
+
+-- partners without a rate of their own pay the configured default
+CREATE TABLE IF NOT EXISTS "commission_rates"(
+    "partner_id" INTEGER PRIMARY KEY REFERENCES "users"("id") ON DELETE CASCADE,
+    "rate" NUMERIC(7, 4) NOT NULL CHECK ("rate" >= 0 AND "rate" <= 100),
+    "updated_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- what is paid out to a partner for the ledger entries of a period, per
+-- currency: the gross of the bookings less the commission
+CREATE TABLE IF NOT EXISTS "payouts"(
+    "id" BIGSERIAL PRIMARY KEY,
+    "partner_id" INTEGER NOT NULL REFERENCES "users"("id"),
+    "currency" CHAR(3) NOT NULL,
+    "period_from" TIMESTAMP WITH TIME ZONE NOT NULL,
+    "period_until" TIMESTAMP WITH TIME ZONE NOT NULL,
+    "gross" BIGINT NOT NULL DEFAULT 0,
+    "commission" BIGINT NOT NULL DEFAULT 0,
+    "amount" BIGINT NOT NULL DEFAULT 0,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "reference" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" INTEGER NOT NULL REFERENCES "users"("id"),
+    "settled_by" INTEGER REFERENCES "users"("id"),
+    "settled_at" TIMESTAMP WITH TIME ZONE,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS "payouts_partner_id_idx" ON "payouts"("partner_id");
+
+-- the commission ledger: earned when a booking is confirmed, refunded with
+-- every refund to the guest and adjusted when a confirmed booking is
+-- repriced or by a superadmin. base is the part of the booking the
+-- commission was taken on, amount the commission itself, both in minor
+-- units of currency. Entries without a payout have not been paid out yet.
+CREATE TABLE IF NOT EXISTS "commission_entries"(
+    "id" BIGSERIAL PRIMARY KEY,
+    "partner_id" INTEGER NOT NULL REFERENCES "users"("id"),
+    "hotel_id" INTEGER NOT NULL REFERENCES "hotels"("id"),
+    "booking_id" INTEGER NOT NULL REFERENCES "bookings"("id"),
+    "refund_id" BIGINT UNIQUE REFERENCES "refunds"("id"),
+    "kind" VARCHAR(10) NOT NULL CHECK ("kind" IN ('earned', 'refunded', 'adjusted')),
+    "rate" NUMERIC(7, 4) NOT NULL,
+    "base" BIGINT NOT NULL,
+    "amount" BIGINT NOT NULL,
+    "currency" CHAR(3) NOT NULL,
+    "note" VARCHAR(255) NOT NULL DEFAULT '',
+    "created_by" INTEGER REFERENCES "users"("id"),
+    "payout_id" BIGINT REFERENCES "payouts"("id"),
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "commission_entries_earned_key" ON "commission_entries"("booking_id") WHERE "kind" = 'earned';
+CREATE INDEX IF NOT EXISTS "commission_entries_booking_id_idx" ON "commission_entries"("booking_id");
+CREATE INDEX IF NOT EXISTS "commission_entries_payout_id_idx" ON "commission_entries"("payout_id");
+CREATE INDEX IF NOT EXISTS "commission_entries_unpaid_idx" ON "commission_entries"("partner_id", "currency") WHERE "payout_id" IS NULL;
@@ -0,0 +1,7 @@
+-- the nightly price of a room, in minor units of its currency; bookings
+-- are priced from it. Rooms created so far have none and can not be booked
+-- until they are given one
+ALTER TABLE "rooms" ADD COLUMN IF NOT EXISTS "price" BIGINT CHECK ("price" >= 0);
+ALTER TABLE "rooms" ADD COLUMN IF NOT EXISTS "currency" CHAR(3);
+UPDATE "rooms" SET "currency" = (SELECT "currency" FROM "currency_base") WHERE "currency" IS NULL;
+ALTER TABLE "rooms" ALTER COLUMN "currency" SET NOT NULL;
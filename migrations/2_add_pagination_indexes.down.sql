@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS "bookings_created_at_id_idx";
+
+DROP INDEX IF EXISTS "rooms_created_at_id_idx";
+
+DROP INDEX IF EXISTS "hotels_created_at_id_idx";
+
+DROP INDEX IF EXISTS "users_created_at_id_idx";
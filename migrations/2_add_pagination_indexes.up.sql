@@ -0,0 +1,7 @@
+CREATE INDEX IF NOT EXISTS "users_created_at_id_idx" ON "users"("created_at" DESC, "id" DESC);
+
+CREATE INDEX IF NOT EXISTS "hotels_created_at_id_idx" ON "hotels"("created_at" DESC, "id" DESC);
+
+CREATE INDEX IF NOT EXISTS "rooms_created_at_id_idx" ON "rooms"("created_at" DESC, "id" DESC);
+
+CREATE INDEX IF NOT EXISTS "bookings_created_at_id_idx" ON "bookings"("created_at" DESC, "id" DESC);
@@ -0,0 +1,7 @@
+ALTER TABLE "bookings" DROP COLUMN IF EXISTS "version";
+
+ALTER TABLE "rooms" DROP COLUMN IF EXISTS "version";
+
+ALTER TABLE "hotels" DROP COLUMN IF EXISTS "version";
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "version";
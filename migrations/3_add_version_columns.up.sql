@@ -0,0 +1,7 @@
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "version" INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE "hotels" ADD COLUMN IF NOT EXISTS "version" INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE "rooms" ADD COLUMN IF NOT EXISTS "version" INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE "bookings" ADD COLUMN IF NOT EXISTS "version" INTEGER NOT NULL DEFAULT 1;
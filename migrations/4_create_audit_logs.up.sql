@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS "audit_logs"(
+    "id" BIGSERIAL PRIMARY KEY,
+    "entity" VARCHAR(255) NOT NULL,
+    "entity_id" BIGINT NOT NULL,
+    "action" VARCHAR(255) NOT NULL,
+    "actor_id" INTEGER,
+    "actor_type" VARCHAR(255),
+    "ip" VARCHAR(255),
+    "request_id" VARCHAR(255),
+    "before" JSONB,
+    "after" JSONB,
+    "changes" JSONB,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS "audit_logs_entity_idx" ON "audit_logs"("entity", "entity_id");
+
+CREATE INDEX IF NOT EXISTS "audit_logs_actor_id_idx" ON "audit_logs"("actor_id");
+
+CREATE INDEX IF NOT EXISTS "audit_logs_created_at_id_idx" ON "audit_logs"("created_at" DESC, "id" DESC);
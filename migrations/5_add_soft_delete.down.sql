@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS "users_username_key";
+DROP INDEX IF EXISTS "users_phone_number_key";
+DROP INDEX IF EXISTS "users_email_key";
+
+ALTER TABLE "users" ADD CONSTRAINT "users_email_key" UNIQUE ("email");
+ALTER TABLE "users" ADD CONSTRAINT "users_phone_number_key" UNIQUE ("phone_number");
+ALTER TABLE "users" ADD CONSTRAINT "users_username_key" UNIQUE ("username");
+
+ALTER TABLE "bookings" DROP COLUMN IF EXISTS "deleted_at";
+
+ALTER TABLE "rooms" DROP COLUMN IF EXISTS "deleted_at";
+
+ALTER TABLE "hotels" DROP COLUMN IF EXISTS "deleted_at";
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "deleted_at";
@@ -0,0 +1,17 @@
+ALTER TABLE "users" ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE "hotels" ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE "rooms" ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMP WITH TIME ZONE;
+
+ALTER TABLE "bookings" ADD COLUMN IF NOT EXISTS "deleted_at" TIMESTAMP WITH TIME ZONE;
+
+-- a deleted user must not block someone else from registering the same email,
+-- phone number or username
+ALTER TABLE "users" DROP CONSTRAINT IF EXISTS "users_email_key";
+ALTER TABLE "users" DROP CONSTRAINT IF EXISTS "users_phone_number_key";
+ALTER TABLE "users" DROP CONSTRAINT IF EXISTS "users_username_key";
+
+CREATE UNIQUE INDEX IF NOT EXISTS "users_email_key" ON "users"("email") WHERE "deleted_at" IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "users_phone_number_key" ON "users"("phone_number") WHERE "deleted_at" IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "users_username_key" ON "users"("username") WHERE "deleted_at" IS NULL;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS "media"(
+    "id" BIGSERIAL PRIMARY KEY,
+    "owner_id" INTEGER NOT NULL REFERENCES "users"("id"),
+    "checksum" CHAR(64) NOT NULL,
+    "file_name" VARCHAR(255) NOT NULL,
+    "content_type" VARCHAR(255) NOT NULL,
+    "size" BIGINT NOT NULL,
+    "width" INTEGER NOT NULL,
+    "height" INTEGER NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- the same file uploaded twice by one owner is stored once
+CREATE UNIQUE INDEX IF NOT EXISTS "media_owner_id_checksum_key" ON "media"("owner_id", "checksum");
+
+CREATE INDEX IF NOT EXISTS "media_checksum_idx" ON "media"("checksum");
@@ -0,0 +1,7 @@
+ALTER TABLE "rooms" DROP COLUMN IF EXISTS "image_id";
+ALTER TABLE "hotels" DROP COLUMN IF EXISTS "image_id";
+
+DROP INDEX IF EXISTS "media_unprocessed_idx";
+
+ALTER TABLE "media" DROP COLUMN IF EXISTS "processed_at";
+ALTER TABLE "media" DROP COLUMN IF EXISTS "derivatives";
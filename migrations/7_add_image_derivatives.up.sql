@@ -0,0 +1,10 @@
+ALTER TABLE "media" ADD COLUMN IF NOT EXISTS "derivatives" JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE "media" ADD COLUMN IF NOT EXISTS "processed_at" TIMESTAMP WITH TIME ZONE;
+
+CREATE INDEX IF NOT EXISTS "media_unprocessed_idx" ON "media"("id") WHERE "processed_at" IS NULL;
+
+-- hotel_image_url and room_image_url are no longer written, images are
+-- uploaded as media and referenced by id. Existing URLs are still returned
+-- until an image is set.
+ALTER TABLE "hotels" ADD COLUMN IF NOT EXISTS "image_id" BIGINT REFERENCES "media"("id");
+ALTER TABLE "rooms" ADD COLUMN IF NOT EXISTS "image_id" BIGINT REFERENCES "media"("id");
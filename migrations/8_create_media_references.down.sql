@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS "rooms_image_id_idx";
+DROP INDEX IF EXISTS "hotels_image_id_idx";
+
+DROP VIEW IF EXISTS "media_references";
@@ -0,0 +1,9 @@
+-- every row that points at an uploaded image; media nothing points at is
+-- garbage collected once its grace period is over
+CREATE OR REPLACE VIEW "media_references" AS
+    SELECT "image_id" AS "media_id", 'hotel' AS "entity", "id" AS "entity_id" FROM "hotels" WHERE "image_id" IS NOT NULL
+    UNION ALL
+    SELECT "image_id", 'room', "id" FROM "rooms" WHERE "image_id" IS NOT NULL;
+
+CREATE INDEX IF NOT EXISTS "hotels_image_id_idx" ON "hotels"("image_id");
+CREATE INDEX IF NOT EXISTS "rooms_image_id_idx" ON "rooms"("image_id");
@@ -0,0 +1,23 @@
+-- private uploads: ID scans guests attach to a booking and contracts of a
+-- hotel. Files live in their own blob store and are only served through
+-- signed links.
+CREATE TABLE IF NOT EXISTS "documents"(
+    "id" BIGSERIAL PRIMARY KEY,
+    "owner_id" INTEGER NOT NULL REFERENCES "users"("id"),
+    "kind" VARCHAR(20) NOT NULL,
+    "hotel_id" INTEGER NOT NULL REFERENCES "hotels"("id"),
+    "booking_id" INTEGER REFERENCES "bookings"("id"),
+    "checksum" CHAR(64) NOT NULL,
+    "file_name" VARCHAR(255) NOT NULL,
+    "content_type" VARCHAR(255) NOT NULL,
+    "size" BIGINT NOT NULL,
+    "created_at" TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT "documents_kind_check" CHECK (
+        ("kind" = 'identity' AND "booking_id" IS NOT NULL) OR
+        ("kind" = 'contract' AND "booking_id" IS NULL)
+    )
+);
+
+CREATE INDEX IF NOT EXISTS "documents_hotel_id_idx" ON "documents"("hotel_id");
+CREATE INDEX IF NOT EXISTS "documents_booking_id_idx" ON "documents"("booking_id");
+CREATE INDEX IF NOT EXISTS "documents_owner_id_idx" ON "documents"("owner_id");
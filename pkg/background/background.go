@@ -0,0 +1,38 @@
+package background
+
+import (
+	"context"
+	"sync"
+)
+
+// Group tracks goroutines that outlive the request that started them, such
+// as e-mail delivery, so shutdown can wait for them to finish.
+type Group struct {
+	wg sync.WaitGroup
+}
+
+// Go runs fn in a new goroutine tracked by the group.
+func (g *Group) Go(fn func()) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		fn()
+	}()
+}
+
+// Wait blocks until every goroutine started with Go has returned or ctx is
+// done, in which case ctx.Err() is returned.
+func (g *Group) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,73 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/config"
+)
+
+var (
+	ErrNotFound   = errors.New("blob not found")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Object is an open blob. The caller must close it.
+type Object struct {
+	io.ReadCloser
+	ContentType string
+	Size        int64
+}
+
+// ObjectInfo describes a blob found by List.
+type ObjectInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Store keeps media files. Keys are slash separated relative paths such as
+// "3f2a....jpg".
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (*Object, error)
+	Exists(ctx context.Context, key string) (bool, error)
+	Delete(ctx context.Context, key string) error
+	// List calls fn with every blob whose key starts with prefix.
+	List(ctx context.Context, prefix string, fn func(obj *ObjectInfo) error) error
+	// URL returns a time limited URL clients can fetch the blob from
+	// directly, or "" when the store can only be read through the API.
+	URL(ctx context.Context, key string, expiry time.Duration) (string, error)
+}
+
+// validKey rejects keys that could escape the store, such as "../x".
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return ErrInvalidKey
+	}
+	return nil
+}
+
+// New opens the store selected by cfg.Driver.
+func New(cfg *config.Blob) (Store, error) {
+	switch cfg.Driver {
+	case "local":
+		return NewLocal(cfg.Dir), nil
+	case "s3":
+		return NewS3(&S3Options{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			UseSSL:    cfg.S3.UseSSL,
+		})
+	}
+
+	return nil, fmt.Errorf("unknown blob driver %q", cfg.Driver)
+}
@@ -0,0 +1,109 @@
+package blob
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeS3 runs an in-process S3 stand-in with an empty "media" bucket.
+func newFakeS3(t *testing.T) Store {
+	backend := s3mem.New()
+	require.NoError(t, backend.CreateBucket("media"))
+
+	fake := gofakes3.New(backend).Server()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// minio sends an empty delimiter for recursive listings, which the
+		// stand-in takes for a real one
+		query := r.URL.Query()
+		if v, ok := query["delimiter"]; ok && v[0] == "" {
+			query.Del("delimiter")
+			r.URL.RawQuery = query.Encode()
+		}
+		fake.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	store, err := NewS3(&S3Options{
+		Endpoint:  u.Host,
+		Region:    "us-east-1",
+		Bucket:    "media",
+		AccessKey: "key",
+		SecretKey: "secret",
+	})
+	require.NoError(t, err)
+
+	return store
+}
+
+func TestStores(t *testing.T) {
+	stores := map[string]func(t *testing.T) Store{
+		"local": func(t *testing.T) Store { return NewLocal(t.TempDir()) },
+		"s3":    newFakeS3,
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			testStore(t, newStore(t))
+		})
+	}
+}
+
+func testStore(t *testing.T, store Store) {
+	ctx := context.Background()
+
+	_, err := store.Get(ctx, "a.jpg")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	exists, err := store.Exists(ctx, "a.jpg")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, store.Put(ctx, "a.jpg", strings.NewReader("jpeg"), 4, "image/jpeg"))
+	require.NoError(t, store.Put(ctx, "a_thumbnail.jpg", strings.NewReader("thumb"), 5, "image/jpeg"))
+	require.NoError(t, store.Put(ctx, "b.png", strings.NewReader("png"), 3, "image/png"))
+
+	obj, err := store.Get(ctx, "a.jpg")
+	require.NoError(t, err)
+	data, err := io.ReadAll(obj)
+	require.NoError(t, err)
+	require.NoError(t, obj.Close())
+	require.Equal(t, "jpeg", string(data))
+	require.Equal(t, "image/jpeg", obj.ContentType)
+	require.Equal(t, int64(4), obj.Size)
+
+	var keys []string
+	require.NoError(t, store.List(ctx, "a", func(obj *ObjectInfo) error {
+		keys = append(keys, obj.Key)
+		require.WithinDuration(t, time.Now(), obj.ModTime, time.Minute)
+		return nil
+	}))
+	sort.Strings(keys)
+	require.Equal(t, []string{"a.jpg", "a_thumbnail.jpg"}, keys)
+
+	require.NoError(t, store.Delete(ctx, "a.jpg"))
+	exists, err = store.Exists(ctx, "a.jpg")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	_, err = store.URL(ctx, "b.png", time.Minute)
+	require.NoError(t, err)
+
+	for _, key := range []string{"../etc/passwd", "/etc/passwd", "a/../../b", ""} {
+		_, err = store.Get(ctx, key)
+		require.ErrorIs(t, err, ErrInvalidKey, key)
+	}
+}
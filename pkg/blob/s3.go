@@ -0,0 +1,142 @@
+package blob
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Options configures an S3 compatible store such as AWS S3 or MinIO.
+// Endpoint is host:port without a scheme.
+type S3Options struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+}
+
+type s3Store struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3 connects to an S3 compatible store. The bucket must exist.
+func NewS3(opts *S3Options) (Store, error) {
+	client, err := minio.New(opts.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(opts.AccessKey, opts.SecretKey, ""),
+		Secure: opts.UseSSL,
+		Region: opts.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Store{
+		client: client,
+		bucket: opts.Bucket,
+	}, nil
+}
+
+// isNotFound reports whether err is S3's answer for a missing key.
+func isNotFound(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	err := validKey(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	return err
+}
+
+func (s *s3Store) Get(ctx context.Context, key string) (*Object, error) {
+	err := validKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// GetObject is lazy, Stat sends the request
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if isNotFound(err) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	return &Object{
+		ReadCloser:  obj,
+		ContentType: info.ContentType,
+		Size:        info.Size,
+	}, nil
+}
+
+func (s *s3Store) Exists(ctx context.Context, key string) (bool, error) {
+	err := validKey(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = s.client.StatObject(ctx, s.bucket, key, minio.StatObjectOptions{})
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *s3Store) Delete(ctx context.Context, key string) error {
+	err := validKey(key)
+	if err != nil {
+		return err
+	}
+
+	return s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+}
+
+func (s *s3Store) List(ctx context.Context, prefix string, fn func(obj *ObjectInfo) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+
+		err := fn(&ObjectInfo{Key: obj.Key, Size: obj.Size, ModTime: obj.LastModified})
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+func (s *s3Store) URL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	err := validKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := s.client.PresignedGetObject(ctx, s.bucket, key, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
@@ -2,25 +2,66 @@ package email
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"fmt"
 	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/metrics"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
 	"html/template"
+	"mime"
+	"mime/multipart"
 	"net/smtp"
+	"net/textproto"
+	"strings"
 )
 
 type SendEmailRequest struct {
-	To      []string
-	Type    string
-	Body    map[string]string
-	Subject string
+	To          []string
+	Type        string
+	Body        map[string]string
+	Subject     string
+	Attachments []Attachment
+}
+
+// Attachment is a file sent along with an e-mail.
+type Attachment struct {
+	FileName    string
+	ContentType string
+	Data        []byte
 }
 
 const (
 	VerificationEmail   = "verification_email"
 	ForgotPasswordEmail = "forgot_password_email"
+	InvoiceEmail        = "invoice_email"
 )
 
-func SendEmail(cfg *config.Config, req *SendEmailRequest) error {
+// SendEmail renders the template for req.Type and sends it over SMTP. The
+// outcome is logged with the request ID carried by ctx.
+func SendEmail(ctx context.Context, cfg *config.Config, req *SendEmailRequest) error {
+	ctx, span := tracing.Start(ctx, "email.send", trace.WithAttributes(attribute.String("email.type", req.Type)))
+	defer span.End()
+
+	err := sendEmail(cfg, req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		metrics.EmailsSent.WithLabelValues(req.Type, metrics.ResultError).Inc()
+		slog.ErrorCtx(ctx, "failed to send email", err, "type", req.Type, "email", strings.Join(req.To, ","))
+		return err
+	}
+
+	metrics.EmailsSent.WithLabelValues(req.Type, metrics.ResultSuccess).Inc()
+	slog.InfoCtx(ctx, "email sent", "type", req.Type, "email", strings.Join(req.To, ","))
+	return nil
+}
+
+func sendEmail(cfg *config.Config, req *SendEmailRequest) error {
 	from := cfg.Smtp.Sender
 	to := req.To
 
@@ -36,9 +77,10 @@ func SendEmail(cfg *config.Config, req *SendEmailRequest) error {
 
 	t.Execute(&body, req.Body)
 
-	mime := "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n"
-	subject := fmt.Sprintf("Subject: %s\n", req.Subject)
-	msg := []byte(subject + mime + body.String())
+	msg, err := message(req.Subject, body.Bytes(), req.Attachments)
+	if err != nil {
+		return err
+	}
 
 	auth := smtp.PlainAuth("", from, password, "smtp.gmail.com")
 	err = smtp.SendMail("smtp.gmail.com:587", auth, from, to, msg)
@@ -49,12 +91,58 @@ func SendEmail(cfg *config.Config, req *SendEmailRequest) error {
 	return nil
 }
 
+// message builds the e-mail. With attachments it is a multipart/mixed
+// message with the HTML body as its first part.
+func message(subject string, html []byte, attachments []Attachment) ([]byte, error) {
+	header := fmt.Sprintf("Subject: %s\n", subject)
+	if len(attachments) == 0 {
+		return []byte(header + "MIME-version: 1.0;\nContent-Type: text/html; charset=\"UTF-8\";\n\n" + string(html)), nil
+	}
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+
+	part, err := w.CreatePart(textproto.MIMEHeader{"Content-Type": {`text/html; charset="UTF-8"`}})
+	if err != nil {
+		return nil, err
+	}
+	part.Write(html)
+
+	for _, a := range attachments {
+		part, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {a.ContentType},
+			"Content-Transfer-Encoding": {"base64"},
+			"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": a.FileName})},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			part.Write([]byte(encoded[:76] + "\r\n"))
+			encoded = encoded[76:]
+		}
+		part.Write([]byte(encoded + "\r\n"))
+	}
+
+	err = w.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	header += "MIME-version: 1.0\nContent-Type: multipart/mixed; boundary=" + w.Boundary() + "\n\n"
+	return append([]byte(header), buf.Bytes()...), nil
+}
+
 func getTemplatePath(emailType string) string {
 	switch emailType {
 	case VerificationEmail:
 		return "./templates/verification_email.html"
 	case ForgotPasswordEmail:
 		return "./templates/forgot_password_email.html"
+	case InvoiceEmail:
+		return "./templates/invoice_email.html"
 	}
 
 	return ""
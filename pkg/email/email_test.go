@@ -0,0 +1,39 @@
+package email
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessageWithAttachment(t *testing.T) {
+	pdf := bytes.Repeat([]byte("%PDF-1.4 "), 20)
+
+	msg, err := message("Invoice INV-1-000001", []byte("<p>attached</p>"), []Attachment{
+		{FileName: "INV-1-000001.pdf", ContentType: "application/pdf", Data: pdf},
+	})
+	require.NoError(t, err)
+
+	parsed, err := mail.ReadMessage(bytes.NewReader(msg))
+	require.NoError(t, err)
+	require.Equal(t, "Invoice INV-1-000001", parsed.Header.Get("Subject"))
+
+	mediaType, params, err := mime.ParseMediaType(parsed.Header.Get("Content-Type"))
+	require.NoError(t, err)
+	require.Equal(t, "multipart/mixed", mediaType)
+
+	r := multipart.NewReader(parsed.Body, params["boundary"])
+	body, err := r.NextPart()
+	require.NoError(t, err)
+	html, _ := io.ReadAll(body)
+	require.Equal(t, "<p>attached</p>", string(html))
+
+	attachment, err := r.NextPart()
+	require.NoError(t, err)
+	require.Equal(t, "INV-1-000001.pdf", attachment.FileName())
+}
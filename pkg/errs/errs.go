@@ -0,0 +1,78 @@
+package errs
+
+import "fmt"
+
+// Code is a stable, machine readable error identifier returned to clients.
+type Code string
+
+const (
+	CodeValidation           Code = "validation_failed"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeMethodNotAllowed     Code = "method_not_allowed"
+	CodeConflict             Code = "conflict"
+	CodeUnsupportedMediaType Code = "unsupported_media_type"
+	CodePayloadTooLarge      Code = "payload_too_large"
+	CodeRateLimited          Code = "rate_limited"
+	CodePreconditionFailed   Code = "precondition_failed"
+	CodePreconditionRequired Code = "precondition_required"
+	CodeInternal             Code = "internal"
+)
+
+// FieldError describes why a single request field was rejected.
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+// Error is a domain error with a code that maps to an HTTP status.
+type Error struct {
+	Code    Code
+	Message string
+	Fields  []FieldError
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func New(code Code, message string) *Error {
+	return &Error{
+		Code:    code,
+		Message: message,
+	}
+}
+
+// Wrap keeps err as the cause so errors.Is still sees it.
+func Wrap(code Code, err error, message string) *Error {
+	return &Error{
+		Code:    code,
+		Message: message,
+		Err:     err,
+	}
+}
+
+func NotFound(entity string) *Error {
+	return New(CodeNotFound, fmt.Sprintf("%s not found", entity))
+}
+
+func Validation(fields ...FieldError) *Error {
+	return &Error{
+		Code:    CodeValidation,
+		Message: "request validation failed",
+		Fields:  fields,
+	}
+}
+
+func Field(field, message string) FieldError {
+	return FieldError{
+		Field:   field,
+		Message: message,
+	}
+}
@@ -0,0 +1,122 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const checkTimeout = 2 * time.Second
+
+var ErrShuttingDown = errors.New("shutting down")
+
+// Check is a single readiness probe such as a database ping.
+type Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Checker runs the readiness checks. Once Shutdown is called it reports not
+// ready so load balancers stop routing to the instance while it drains.
+type Checker struct {
+	checks       []Check
+	shuttingDown atomic.Bool
+}
+
+func NewChecker(checks ...Check) *Checker {
+	return &Checker{checks: checks}
+}
+
+// Shutdown marks the instance as not ready.
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready runs every check concurrently and returns the error of each one by
+// name, nil for those that passed. ready is false if any check failed.
+func (c *Checker) Ready(ctx context.Context) (ready bool, results map[string]error) {
+	if c.shuttingDown.Load() {
+		return false, map[string]error{"server": ErrShuttingDown}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	ready = true
+	results = make(map[string]error, len(c.checks))
+	for _, check := range c.checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+
+			err := check.Check(ctx)
+
+			mu.Lock()
+			defer mu.Unlock()
+			results[check.Name] = err
+			if err != nil {
+				ready = false
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	return ready, results
+}
+
+var migrationFile = regexp.MustCompile(`^(\d+)_.*\.up\.sql$`)
+
+// LatestMigration returns the highest version among the up migrations in
+// dir.
+func LatestMigration(dir string) (uint, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+
+	var latest uint
+	for _, entry := range entries {
+		match := migrationFile.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+
+		version, err := strconv.ParseUint(match[1], 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		if uint(version) > latest {
+			latest = uint(version)
+		}
+	}
+
+	return latest, nil
+}
+
+// Migrations checks that the database schema is at version want and that
+// the last migration did not fail half way.
+func Migrations(current func(ctx context.Context) (version uint, dirty bool, err error), want uint) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		version, dirty, err := current(ctx)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return fmt.Errorf("migration %d is dirty", version)
+		}
+		if version != want {
+			return fmt.Errorf("schema is at version %d, want %d", version, want)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,43 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestMigration(t *testing.T) {
+	version, err := LatestMigration("./../../migrations")
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, version, uint(5))
+}
+
+func TestCheckerReady(t *testing.T) {
+	failing := errors.New("connection refused")
+	checker := NewChecker(
+		Check{Name: "postgres", Check: func(context.Context) error { return nil }},
+		Check{Name: "redis", Check: func(context.Context) error { return failing }},
+	)
+
+	ready, results := checker.Ready(context.Background())
+	require.False(t, ready)
+	require.NoError(t, results["postgres"])
+	require.ErrorIs(t, results["redis"], failing)
+
+	checker.Shutdown()
+	ready, results = checker.Ready(context.Background())
+	require.False(t, ready)
+	require.ErrorIs(t, results["server"], ErrShuttingDown)
+}
+
+func TestMigrations(t *testing.T) {
+	current := func(version uint, dirty bool) func(context.Context) (uint, bool, error) {
+		return func(context.Context) (uint, bool, error) { return version, dirty, nil }
+	}
+
+	require.NoError(t, Migrations(current(5, false), 5)(context.Background()))
+	require.Error(t, Migrations(current(4, false), 5)(context.Background()))
+	require.Error(t, Migrations(current(5, true), 5)(context.Background()))
+}
@@ -0,0 +1,97 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+
+	"golang.org/x/image/webp"
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrInvalidImage    = errors.New("invalid image")
+)
+
+type format struct {
+	ext    string
+	config func(io.Reader) (image.Config, error)
+	decode func(io.Reader) (image.Image, error)
+	strip  func([]byte) ([]byte, error)
+}
+
+// formats is the allowlist of image types that may be uploaded, keyed by
+// the sniffed content type.
+var formats = map[string]format{
+	"image/jpeg": {".jpg", jpeg.DecodeConfig, jpeg.Decode, stripJPEG},
+	"image/png":  {".png", png.DecodeConfig, png.Decode, stripPNG},
+	"image/webp": {".webp", webp.DecodeConfig, webp.Decode, stripWebP},
+}
+
+// Info describes an image whose type was detected from its content, never
+// from the name or headers the client sent.
+type Info struct {
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+// Inspect sniffs the content type of data and reads the image dimensions
+// from its header without decoding the pixels.
+func Inspect(data []byte) (*Info, error) {
+	contentType := http.DetectContentType(data)
+
+	f, ok := formats[contentType]
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	config, err := f.config(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	return &Info{
+		ContentType: contentType,
+		Ext:         f.ext,
+		Width:       config.Width,
+		Height:      config.Height,
+	}, nil
+}
+
+// Decode decodes the pixels of an image Inspect accepted. Call it only after
+// the dimensions have been checked, a small file can declare a huge canvas.
+func Decode(info *Info, data []byte) (image.Image, error) {
+	f, ok := formats[info.ContentType]
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	img, err := f.decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	return img, nil
+}
+
+// StripMetadata removes EXIF, XMP, IPTC and text metadata, GPS positions
+// included, without re-encoding the pixels. Color profiles are kept.
+func StripMetadata(info *Info, data []byte) ([]byte, error) {
+	f, ok := formats[info.ContentType]
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+
+	out, err := f.strip(data)
+	if err != nil {
+		return nil, ErrInvalidImage
+	}
+
+	return out, nil
+}
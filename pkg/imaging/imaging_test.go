@@ -0,0 +1,127 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	return img
+}
+
+func TestInspect(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage()))
+
+	info, err := Inspect(buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, &Info{ContentType: "image/png", Ext: ".png", Width: 4, Height: 3}, info)
+}
+
+func TestInspectRejectsOtherTypes(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, gif.Encode(&buf, testImage(), nil))
+
+	_, err := Inspect(buf.Bytes())
+	require.ErrorIs(t, err, ErrUnsupportedType)
+
+	_, err = Inspect([]byte("<html><script>alert(1)</script></html>"))
+	require.ErrorIs(t, err, ErrUnsupportedType)
+
+	// a PNG signature followed by garbage
+	_, err = Inspect(append(append([]byte(nil), pngSignature...), "garbage"...))
+	require.ErrorIs(t, err, ErrInvalidImage)
+}
+
+func TestStripJPEG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, testImage(), nil))
+	clean := buf.Bytes()
+
+	exif := []byte("Exif\x00\x00GPSLatitude=41.3")
+	segment := []byte{0xff, jpegAPP1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exif)+2))
+	segment = append(segment, exif...)
+
+	tagged := append(append(append([]byte(nil), clean[:2]...), segment...), clean[2:]...)
+	info, err := Inspect(tagged)
+	require.NoError(t, err)
+
+	stripped, err := StripMetadata(info, tagged)
+	require.NoError(t, err)
+	require.NotContains(t, string(stripped), "GPSLatitude")
+	require.Equal(t, clean, stripped)
+
+	_, err = jpeg.Decode(bytes.NewReader(stripped))
+	require.NoError(t, err)
+}
+
+func TestStripPNG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage()))
+	clean := buf.Bytes()
+
+	text := []byte("Comment\x00taken at home")
+	chunk := make([]byte, 4, 12+len(text))
+	binary.BigEndian.PutUint32(chunk, uint32(len(text)))
+	chunk = append(chunk, "tEXt"...)
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	// right after the 25 byte IHDR chunk
+	at := len(pngSignature) + 25
+	tagged := append(append(append([]byte(nil), clean[:at]...), chunk...), clean[at:]...)
+	info, err := Inspect(tagged)
+	require.NoError(t, err)
+
+	stripped, err := StripMetadata(info, tagged)
+	require.NoError(t, err)
+	require.Equal(t, clean, stripped)
+}
+
+func TestStripWebP(t *testing.T) {
+	vp8x := []byte("VP8X\x0a\x00\x00\x00" + "\x0c\x00\x00\x00" + "\x03\x00\x00\x02\x00\x00")
+	exif := []byte("EXIF\x03\x00\x00\x00GPS\x00")
+	data := append([]byte("RIFF\x00\x00\x00\x00WEBP"), vp8x...)
+	data = append(data, exif...)
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+
+	stripped, err := stripWebP(data)
+	require.NoError(t, err)
+	require.NotContains(t, string(stripped), "EXIF")
+	require.Equal(t, byte(0), stripped[20]&(webpFlagEXIF|webpFlagXMP))
+	require.Equal(t, uint32(len(stripped)-8), binary.LittleEndian.Uint32(stripped[4:]))
+}
+
+func TestResizeKeepsAspectRatio(t *testing.T) {
+	img := Resize(image.NewRGBA(image.Rect(0, 0, 400, 300)), 200)
+	require.Equal(t, image.Rect(0, 0, 200, 150), img.Bounds())
+}
+
+func TestEncodeKeepsTransparency(t *testing.T) {
+	var buf bytes.Buffer
+
+	contentType, _, err := Encode(&buf, image.NewRGBA(image.Rect(0, 0, 2, 2)))
+	require.NoError(t, err)
+	require.Equal(t, "image/png", contentType)
+
+	opaque := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	for i := 3; i < len(opaque.Pix); i += 4 {
+		opaque.Pix[i] = 255
+	}
+	contentType, ext, err := Encode(&buf, opaque)
+	require.NoError(t, err)
+	require.Equal(t, "image/jpeg", contentType)
+	require.Equal(t, ".jpg", ext)
+}
@@ -0,0 +1,35 @@
+package imaging
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+)
+
+const jpegQuality = 85
+
+// Resize scales img down to width pixels, keeping the aspect ratio.
+func Resize(img image.Image, width int) image.Image {
+	bounds := img.Bounds()
+	height := bounds.Dy() * width / bounds.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+// Encode writes img as a JPEG, or as a PNG when it has transparent pixels
+// a JPEG would lose. It returns the content type and extension used.
+func Encode(w io.Writer, img image.Image) (contentType, ext string, err error) {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && !opaque.Opaque() {
+		return "image/png", ".png", png.Encode(w, img)
+	}
+
+	return "image/jpeg", ".jpg", jpeg.Encode(w, img, &jpeg.Options{Quality: jpegQuality})
+}
@@ -0,0 +1,147 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errTruncated = errors.New("truncated image")
+
+// JPEG markers that carry metadata: APP1 holds EXIF and XMP, APP13 holds
+// IPTC and COM is a free text comment. APP0 (JFIF), APP2 (ICC profile) and
+// APP14 (Adobe color transform) affect rendering and are kept.
+const (
+	jpegSOS   = 0xda
+	jpegAPP1  = 0xe1
+	jpegAPP13 = 0xed
+	jpegCOM   = 0xfe
+)
+
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xff || data[1] != 0xd8 {
+		return nil, errTruncated
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	for i := 2; ; {
+		if i+2 > len(data) || data[i] != 0xff {
+			return nil, errTruncated
+		}
+
+		marker := data[i+1]
+		if marker == 0xff {
+			// fill byte before a marker
+			i++
+			continue
+		}
+		if marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7) {
+			out.Write(data[i : i+2])
+			i += 2
+			continue
+		}
+
+		if i+4 > len(data) {
+			return nil, errTruncated
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(data[i+2:]))
+		if end > len(data) {
+			return nil, errTruncated
+		}
+
+		if marker == jpegSOS {
+			// the entropy coded data runs to the end of the file
+			out.Write(data[i:])
+			return out.Bytes(), nil
+		}
+
+		if marker != jpegAPP1 && marker != jpegAPP13 && marker != jpegCOM {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks are ancillary chunks a decoder does not need.
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errTruncated
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+
+	for i := len(pngSignature); i < len(data); {
+		if i+8 > len(data) {
+			return nil, errTruncated
+		}
+		// length, type, data and CRC
+		end := i + 12 + int(binary.BigEndian.Uint32(data[i:]))
+		if end > len(data) || end < i {
+			return nil, errTruncated
+		}
+
+		if !pngMetadataChunks[string(data[i+4:i+8])] {
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	return out.Bytes(), nil
+}
+
+// VP8X flags announcing EXIF and XMP chunks.
+const (
+	webpFlagXMP  = 0x04
+	webpFlagEXIF = 0x08
+)
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errTruncated
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, errTruncated
+		}
+		size := int(binary.LittleEndian.Uint32(data[i+4:]))
+		// chunks are padded to an even size
+		end := i + 8 + size + size&1
+		if end > len(data) || end < i {
+			return nil, errTruncated
+		}
+
+		switch string(data[i : i+4]) {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if len(chunk) > 8 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+
+	result := out.Bytes()
+	binary.LittleEndian.PutUint32(result[4:], uint32(len(result)-8))
+	return result, nil
+}
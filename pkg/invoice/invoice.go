@@ -0,0 +1,158 @@
+// Package invoice lays out invoices and receipts as PDF.
+package invoice
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/money"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/pdf"
+)
+
+const (
+	margin     = 50.0
+	lineHeight = 16.0
+	// columns of the line items, measured from the left edge
+	quantityRight = 380.0
+	unitRight     = 460.0
+	amountRight   = pdf.PageWidth - margin
+)
+
+// Party is the issuer or the customer of an invoice.
+type Party struct {
+	Name               string
+	Address            string
+	TaxID              string
+	RegistrationNumber string
+	Email              string
+}
+
+// Line is one item. Amounts are in minor units; UnitAmount times Quantity
+// need not equal Amount when a remainder was spread. Included lines are
+// part of other lines, e.g. VAT included in the price, and are printed as
+// such.
+type Line struct {
+	Description string
+	Quantity    int
+	UnitAmount  int64
+	Amount      int64
+	Included    bool
+}
+
+// Data is everything printed on an invoice or receipt.
+type Data struct {
+	Title    string
+	Number   string
+	IssuedAt time.Time
+	Issuer   Party
+	Customer Party
+	// Reference describes what was bought, e.g. the hotel, room and dates.
+	Reference []string
+	Lines     []Line
+	Currency  string
+	Total     int64
+	// Notes are printed under the total.
+	Notes []string
+}
+
+// Render returns the PDF. Long lists of lines continue on further pages.
+func Render(data *Data) []byte {
+	doc := pdf.New(data.Title + " " + data.Number)
+	y := margin
+
+	doc.Text(margin, y+10, 20, true, data.Title)
+	doc.TextRight(amountRight, y, 10, true, data.Number)
+	doc.TextRight(amountRight, y+lineHeight, 10, false, "Issued "+data.IssuedAt.UTC().Format("2006-01-02"))
+	y += 3 * lineHeight
+
+	issuerY := party(doc, margin, y, "From", data.Issuer)
+	customerY := party(doc, pdf.PageWidth/2, y, "To", data.Customer)
+	if customerY > issuerY {
+		issuerY = customerY
+	}
+	y = issuerY + lineHeight
+
+	for _, ref := range data.Reference {
+		doc.Text(margin, y, 10, false, ref)
+		y += lineHeight
+	}
+	y += lineHeight
+
+	header := func() {
+		doc.Text(margin, y, 10, true, "Description")
+		doc.TextRight(quantityRight, y, 10, true, "Qty")
+		doc.TextRight(unitRight, y, 10, true, "Unit")
+		doc.TextRight(amountRight, y, 10, true, "Amount")
+		doc.Line(margin, y+5, amountRight, y+5)
+		y += lineHeight + 4
+	}
+	header()
+
+	for _, line := range data.Lines {
+		if y > pdf.PageHeight-margin-3*lineHeight {
+			doc.AddPage()
+			y = margin
+			header()
+		}
+
+		amount := money.Format(line.Amount, data.Currency)
+		if line.Included {
+			amount = "incl. " + amount
+		}
+
+		doc.Text(margin, y, 10, false, line.Description)
+		if line.Quantity > 0 {
+			doc.TextRight(quantityRight, y, 10, false, fmt.Sprint(line.Quantity))
+			doc.TextRight(unitRight, y, 10, false, money.Format(line.UnitAmount, data.Currency))
+		}
+		doc.TextRight(amountRight, y, 10, false, amount)
+		y += lineHeight
+	}
+
+	doc.Line(margin, y-10, amountRight, y-10)
+	y += 4
+	doc.Text(unitRight-100, y, 11, true, "Total "+data.Currency)
+	doc.TextRight(amountRight, y, 11, true, money.Format(data.Total, data.Currency))
+	y += 2 * lineHeight
+
+	for _, note := range data.Notes {
+		if y > pdf.PageHeight-margin {
+			doc.AddPage()
+			y = margin
+		}
+		doc.Text(margin, y, 9, false, note)
+		y += lineHeight
+	}
+
+	return doc.Bytes()
+}
+
+func party(doc *pdf.Document, x, y float64, label string, p Party) float64 {
+	doc.Text(x, y, 9, true, strings.ToUpper(label))
+	y += lineHeight
+	doc.Text(x, y, 10, true, p.Name)
+	y += lineHeight
+
+	for _, line := range []string{
+		p.Address,
+		prefixed("Tax ID ", p.TaxID),
+		prefixed("Reg. no. ", p.RegistrationNumber),
+		p.Email,
+	} {
+		if line == "" {
+			continue
+		}
+		doc.Text(x, y, 10, false, line)
+		y += lineHeight
+	}
+
+	return y
+}
+
+func prefixed(prefix, s string) string {
+	if s == "" {
+		return ""
+	}
+	return prefix + s
+}
@@ -0,0 +1,35 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	data := &Data{
+		Title:    "Invoice",
+		Number:   "INV-1-000001",
+		IssuedAt: time.Date(2022, 10, 5, 12, 0, 0, 0, time.UTC),
+		Issuer:   Party{Name: "Hotel LLC", Address: "Tashkent", TaxID: "123456789"},
+		Customer: Party{Name: "John Doe", Email: "john@example.com"},
+		Currency: "USD",
+		Total:    40000,
+	}
+	for i := 0; i < 60; i++ {
+		data.Lines = append(data.Lines, Line{Description: fmt.Sprintf("Night %d", i+1), Quantity: 1, UnitAmount: 10000, Amount: 10000})
+	}
+
+	data.Lines = append(data.Lines, Line{Description: "VAT", Quantity: 1, UnitAmount: 1200, Amount: 1200, Included: true})
+
+	out := Render(data)
+	require.True(t, bytes.HasPrefix(out, []byte("%PDF-")))
+	require.Contains(t, string(out), "(incl. 12.00) Tj")
+	require.Contains(t, string(out), "(INV-1-000001) Tj")
+	require.Contains(t, string(out), "(Tax ID 123456789) Tj")
+	require.Contains(t, string(out), "/Count 2")
+	require.Equal(t, out, Render(data))
+}
@@ -0,0 +1,94 @@
+package logger
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/MuhammadyusufAdhamov/booking/config"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID stores the request ID so every record logged with ctx
+// carries it, including records from storage and email.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, requestID)
+}
+
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	requestID, _ := ctx.Value(requestIDKey{}).(string)
+	return requestID
+}
+
+// Detach returns a background context that keeps the request ID, for work
+// that outlives the request, like sending emails.
+func Detach(ctx context.Context) context.Context {
+	return WithRequestID(context.Background(), RequestID(ctx))
+}
+
+// New builds the application logger from config. Unknown formats fall back to
+// JSON and unknown levels to info.
+func New(cfg *config.Log, w io.Writer) *slog.Logger {
+	opts := slog.HandlerOptions{
+		Level:       parseLevel(cfg.Level),
+		ReplaceAttr: redact,
+	}
+
+	var handler slog.Handler
+	if strings.EqualFold(cfg.Format, FormatText) {
+		handler = opts.NewTextHandler(w)
+	} else {
+		handler = opts.NewJSONHandler(w)
+	}
+
+	return slog.New(&contextHandler{Handler: handler})
+}
+
+func parseLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// contextHandler adds the request and trace IDs from the record's context.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if requestID := RequestID(ctx); requestID != "" {
+		r.AddAttrs(slog.String("request_id", requestID))
+	}
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,36 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoggerRedactsAndAddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	log := New(&config.Log{Level: "info", Format: FormatJSON}, &buf)
+
+	ctx := WithRequestID(context.Background(), "req-1")
+	log.InfoCtx(ctx, "user registered",
+		"email", "john@example.com",
+		"password", "hunter2",
+		"verification_code", "123456",
+		"user_id", 7,
+		"status_code", 201,
+	)
+	log.DebugCtx(ctx, "hidden")
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	require.Equal(t, "req-1", record["request_id"])
+	require.Equal(t, "j***@example.com", record["email"])
+	require.Equal(t, redacted, record["password"])
+	require.Equal(t, redacted, record["verification_code"])
+	require.EqualValues(t, 7, record["user_id"])
+	require.EqualValues(t, 201, record["status_code"])
+	require.NotContains(t, buf.String(), "hidden")
+}
@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"strings"
+
+	"golang.org/x/exp/slog"
+)
+
+const redacted = "[REDACTED]"
+
+// Values of attributes whose names contain one of secretKeys, or equal one
+// of secretNames, never reach the logs.
+var (
+	secretKeys  = []string{"password", "secret", "token", "authorization", "api_key", "dsn"}
+	secretNames = []string{"code", "verification_code"}
+)
+
+// piiKeys are attribute names whose values are masked but stay recognisable
+// enough to correlate records.
+var piiKeys = []string{"email", "phone"}
+
+func redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	for _, secret := range secretNames {
+		if key == secret {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	for _, pii := range piiKeys {
+		if strings.Contains(key, pii) {
+			return slog.String(a.Key, mask(a.Value.String()))
+		}
+	}
+
+	return a
+}
+
+// mask keeps the first character and, for emails, the domain:
+// "john@example.com" becomes "j***@example.com".
+func mask(value string) string {
+	if value == "" {
+		return ""
+	}
+
+	local, domain := value, ""
+	if at := strings.LastIndex(value, "@"); at >= 0 {
+		local, domain = value[:at], value[at:]
+	}
+
+	if len(local) <= 1 {
+		return "***" + domain
+	}
+	return local[:1] + "***" + domain
+}
@@ -0,0 +1,230 @@
+// Package money converts and formats amounts kept as integer minor units,
+// e.g. cents, so no float rounding creeps into prices.
+package money
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+)
+
+var (
+	ErrUnsupportedCurrency = errors.New("unsupported currency")
+	ErrNoRate              = errors.New("no exchange rate for currency")
+	ErrInvalidRate         = errors.New("exchange rate must be a positive decimal number")
+	ErrInvalidPercent      = errors.New("percentage must be a decimal number from 0 to 100")
+)
+
+// exponents are the ISO 4217 minor unit digits of the supported currencies.
+var exponents = map[string]int{
+	"AED": 2, "AUD": 2, "CAD": 2, "CHF": 2, "CNY": 2, "EUR": 2, "GBP": 2,
+	"INR": 2, "JPY": 0, "KGS": 2, "KRW": 0, "KZT": 2, "RUB": 2, "TJS": 2,
+	"TRY": 2, "USD": 2, "UZS": 2,
+}
+
+// Supported reports whether amounts in currency can be handled.
+func Supported(currency string) bool {
+	_, ok := exponents[currency]
+	return ok
+}
+
+// Exponent is the number of minor unit digits of currency.
+func Exponent(currency string) (int, error) {
+	exp, ok := exponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("%w %q", ErrUnsupportedCurrency, currency)
+	}
+	return exp, nil
+}
+
+// Format writes amount with the decimals of its currency, e.g. 1250 USD as
+// "12.50" and 1250 JPY as "1250".
+func Format(amount int64, currency string) string {
+	exp, err := Exponent(currency)
+	if err != nil {
+		exp = 2
+	}
+
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	if exp == 0 {
+		return fmt.Sprintf("%s%d", sign, amount)
+	}
+
+	unit := pow10(exp)
+	return fmt.Sprintf("%s%d.%0*d", sign, amount/unit, exp, amount%unit)
+}
+
+// ParseRate reads a positive decimal exchange rate.
+func ParseRate(s string) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || rate.Sign() <= 0 || strings.ContainsAny(s, "/eE") {
+		return nil, ErrInvalidRate
+	}
+	return rate, nil
+}
+
+// ParsePercent reads a decimal percentage from 0 to 100.
+func ParsePercent(s string) (*big.Rat, error) {
+	percent, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok || percent.Sign() < 0 || percent.Cmp(big.NewRat(100, 1)) > 0 || strings.ContainsAny(s, "/eE") {
+		return nil, ErrInvalidPercent
+	}
+	return percent, nil
+}
+
+// FormatRate writes a rate as a decimal with at most 12 fraction digits.
+func FormatRate(rate *big.Rat) string {
+	s := rate.FloatString(12)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// Rates holds how many units of each currency one unit of the base currency
+// buys.
+type Rates struct {
+	base  string
+	rates map[string]*big.Rat
+}
+
+// NewRates parses rates relative to base. The base currency always has the
+// rate 1.
+func NewRates(base string, rates map[string]string) (*Rates, error) {
+	if !Supported(base) {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedCurrency, base)
+	}
+
+	r := &Rates{
+		base:  base,
+		rates: map[string]*big.Rat{base: big.NewRat(1, 1)},
+	}
+
+	for currency, s := range rates {
+		if currency == base {
+			continue
+		}
+
+		rate, err := ParseRate(s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", currency, err)
+		}
+		r.rates[currency] = rate
+	}
+
+	return r, nil
+}
+
+func (r *Rates) Base() string {
+	return r.base
+}
+
+// Rate is how many units of to one unit of from buys.
+func (r *Rates) Rate(from, to string) (*big.Rat, error) {
+	fromRate, ok := r.rates[from]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrNoRate, from)
+	}
+
+	toRate, ok := r.rates[to]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrNoRate, to)
+	}
+
+	return new(big.Rat).Quo(toRate, fromRate), nil
+}
+
+// Convert converts amount minor units of from into minor units of to at
+// rate units of to per unit of from, rounding half away from zero.
+func Convert(amount int64, from, to string, rate *big.Rat) (int64, error) {
+	fromExp, err := Exponent(from)
+	if err != nil {
+		return 0, err
+	}
+
+	toExp, err := Exponent(to)
+	if err != nil {
+		return 0, err
+	}
+
+	v := new(big.Rat).SetInt64(amount)
+	v.Mul(v, rate)
+	v.Mul(v, new(big.Rat).SetFrac64(pow10(toExp), pow10(fromExp)))
+
+	return Round(v), nil
+}
+
+// Round rounds v to a whole number of minor units, half away from zero.
+func Round(v *big.Rat) int64 {
+	num := new(big.Int).Abs(v.Num())
+	den := v.Denom()
+
+	q, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	if rem.Mul(rem, big.NewInt(2)).Cmp(den) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+
+	if v.Sign() < 0 {
+		q.Neg(q)
+	}
+	return q.Int64()
+}
+
+func pow10(n int) int64 {
+	p := int64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+// LoadRates reads "CURRENCY,RATE" lines, skipping blank lines and lines
+// starting with #.
+func LoadRates(r io.Reader) (map[string]string, error) {
+	rates := make(map[string]string)
+
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.Split(line, ",")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("line %d: want CURRENCY,RATE", n)
+		}
+
+		currency := strings.ToUpper(strings.TrimSpace(parts[0]))
+		if !Supported(currency) {
+			return nil, fmt.Errorf("line %d: %w %q", n, ErrUnsupportedCurrency, currency)
+		}
+
+		rate, err := ParseRate(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		rates[currency] = FormatRate(rate)
+	}
+
+	return rates, scanner.Err()
+}
+
+// LoadRatesFile reads rates from a file in the LoadRates format.
+func LoadRatesFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadRates(f)
+}
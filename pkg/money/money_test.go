@@ -0,0 +1,83 @@
+package money
+
+import (
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormat(t *testing.T) {
+	require.Equal(t, "0.00", Format(0, "USD"))
+	require.Equal(t, "12.50", Format(1250, "USD"))
+	require.Equal(t, "120.00", Format(12000, "UZS"))
+	require.Equal(t, "-0.05", Format(-5, "EUR"))
+	require.Equal(t, "1250", Format(1250, "JPY"))
+}
+
+func TestConvert(t *testing.T) {
+	rates, err := NewRates("USD", map[string]string{"UZS": "12500", "EUR": "0.92", "JPY": "150"})
+	require.NoError(t, err)
+
+	rate, err := rates.Rate("USD", "UZS")
+	require.NoError(t, err)
+	amount, err := Convert(10000, "USD", "UZS", rate)
+	require.NoError(t, err)
+	require.Equal(t, int64(125000000), amount)
+
+	// 1,000,000.00 UZS is 80.00 USD
+	rate, err = rates.Rate("UZS", "USD")
+	require.NoError(t, err)
+	amount, err = Convert(100000000, "UZS", "USD", rate)
+	require.NoError(t, err)
+	require.Equal(t, int64(8000), amount)
+
+	// 10.00 EUR in JPY: 10 / 0.92 * 150 = 1630.43 rounds to 1630
+	rate, err = rates.Rate("EUR", "JPY")
+	require.NoError(t, err)
+	amount, err = Convert(1000, "EUR", "JPY", rate)
+	require.NoError(t, err)
+	require.Equal(t, int64(1630), amount)
+
+	_, err = rates.Rate("GBP", "USD")
+	require.ErrorIs(t, err, ErrNoRate)
+}
+
+func TestRound(t *testing.T) {
+	require.Equal(t, int64(3), Round(big.NewRat(5, 2)))
+	require.Equal(t, int64(-3), Round(big.NewRat(-5, 2)))
+	require.Equal(t, int64(2), Round(big.NewRat(7, 4)))
+}
+
+func TestParseRate(t *testing.T) {
+	rate, err := ParseRate("12500.5")
+	require.NoError(t, err)
+	require.Equal(t, "12500.5", FormatRate(rate))
+
+	for _, s := range []string{"0", "-1", "1/3", "1e3", "abc"} {
+		_, err := ParseRate(s)
+		require.ErrorIs(t, err, ErrInvalidRate, s)
+	}
+}
+
+func TestParsePercent(t *testing.T) {
+	for _, s := range []string{"0", "12.5", "100"} {
+		_, err := ParsePercent(s)
+		require.NoError(t, err, s)
+	}
+
+	for _, s := range []string{"-1", "100.01", "1/3", "1e1", "abc"} {
+		_, err := ParsePercent(s)
+		require.ErrorIs(t, err, ErrInvalidPercent, s)
+	}
+}
+
+func TestLoadRates(t *testing.T) {
+	rates, err := LoadRates(strings.NewReader("# rates per USD\nuzs, 12500\n\nEUR,0.920\n"))
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"UZS": "12500", "EUR": "0.92"}, rates)
+
+	_, err = LoadRates(strings.NewReader("XXX,1\n"))
+	require.ErrorIs(t, err, ErrUnsupportedCurrency)
+}
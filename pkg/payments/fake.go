@@ -0,0 +1,214 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+)
+
+// FakeSignatureHeader carries the signature of fake webhook deliveries.
+const FakeSignatureHeader = "Fake-Signature"
+
+// Fake is an in-memory provider for development and tests. Its outcomes
+// only depend on the amount, like test card numbers do:
+//
+//   - intents for amounts ending in 01 minor units are declined
+//   - intents for amounts ending in 02 stay pending until a webhook
+//     reports otherwise
+//   - every other intent is authorized right away
+//   - refunds for amounts ending in 01 fail, the others succeed
+//
+// Ids are derived from the references, so runs are reproducible.
+type Fake struct {
+	mu      sync.Mutex
+	secret  []byte
+	intents map[string]*Intent
+	refunds map[string]*Refund
+}
+
+func NewFake(secret string) *Fake {
+	return &Fake{
+		secret:  []byte(secret),
+		intents: make(map[string]*Intent),
+		refunds: make(map[string]*Refund),
+	}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) CreateIntent(ctx context.Context, amount int64, currency, reference string) (*Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := "pi_fake_" + reference
+	if intent, ok := f.intents[id]; ok {
+		return copyIntent(intent), nil
+	}
+
+	intent := &Intent{
+		ID:           id,
+		Status:       IntentAuthorized,
+		Amount:       amount,
+		Currency:     currency,
+		ClientSecret: id + "_secret",
+	}
+
+	switch amount % 100 {
+	case 1:
+		intent.Status = IntentFailed
+	case 2:
+		intent.Status = IntentPending
+	}
+
+	f.intents[id] = intent
+	return copyIntent(intent), nil
+}
+
+func (f *Fake) GetIntent(ctx context.Context, intentID string) (*Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return copyIntent(intent), nil
+}
+
+func (f *Fake) Capture(ctx context.Context, intentID string, amount int64) (*Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if intent.Status == IntentCaptured {
+		return copyIntent(intent), nil
+	}
+
+	if intent.Status != IntentAuthorized || amount > intent.Amount {
+		return nil, ErrInvalidState
+	}
+
+	intent.Status = IntentCaptured
+	intent.Amount = amount
+	return copyIntent(intent), nil
+}
+
+func (f *Fake) Cancel(ctx context.Context, intentID string) (*Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	if intent.Status == IntentPending || intent.Status == IntentAuthorized {
+		intent.Status = IntentCancelled
+	}
+
+	return copyIntent(intent), nil
+}
+
+func (f *Fake) Refund(ctx context.Context, intentID string, amount int64, reference string) (*Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	id := "re_fake_" + reference
+	if refund, ok := f.refunds[id]; ok {
+		r := *refund
+		return &r, nil
+	}
+
+	intent, ok := f.intents[intentID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	var refunded int64
+	for _, r := range f.refunds {
+		if r.IntentID == intentID && r.Status == RefundSucceeded {
+			refunded += r.Amount
+		}
+	}
+
+	if intent.Status != IntentCaptured || refunded+amount > intent.Amount {
+		return nil, ErrInvalidState
+	}
+
+	refund := &Refund{
+		ID:       id,
+		IntentID: intentID,
+		Status:   RefundSucceeded,
+		Amount:   amount,
+	}
+	if amount%100 == 1 {
+		refund.Status = RefundFailed
+	}
+
+	f.refunds[id] = refund
+	r := *refund
+	return &r, nil
+}
+
+func (f *Fake) ParseWebhook(payload []byte, header http.Header) (*Event, error) {
+	signature, err := hex.DecodeString(header.Get(FakeSignatureHeader))
+	if err != nil || !hmac.Equal(signature, f.mac(payload)) {
+		return nil, ErrInvalidWebhook
+	}
+
+	var event Event
+	err = json.Unmarshal(payload, &event)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+
+	if (event.Type == EventIntentUpdated && event.Intent == nil) || (event.Type == EventRefundUpdated && event.Refund == nil) {
+		return nil, ErrInvalidWebhook
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// keep the fake's own state in line with what it announced
+	if event.Intent != nil {
+		if intent, ok := f.intents[event.Intent.ID]; ok {
+			intent.Status = event.Intent.Status
+		}
+	}
+	if event.Refund != nil {
+		if refund, ok := f.refunds[event.Refund.ID]; ok {
+			refund.Status = event.Refund.Status
+		}
+	}
+
+	return &event, nil
+}
+
+// SignWebhook returns the FakeSignatureHeader value for payload, so tests
+// and developers can simulate deliveries.
+func (f *Fake) SignWebhook(payload []byte) string {
+	return hex.EncodeToString(f.mac(payload))
+}
+
+func (f *Fake) mac(payload []byte) []byte {
+	m := hmac.New(sha256.New, f.secret)
+	m.Write(payload)
+	return m.Sum(nil)
+}
+
+func copyIntent(intent *Intent) *Intent {
+	i := *intent
+	return &i
+}
@@ -0,0 +1,133 @@
+package payments
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeOutcomesDependOnAmount(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake("secret")
+
+	intent, err := f.CreateIntent(ctx, 10000, "USD", "payment_1")
+	require.NoError(t, err)
+	require.Equal(t, IntentAuthorized, intent.Status)
+	require.Equal(t, "pi_fake_payment_1", intent.ID)
+
+	// retries return the same intent
+	again, err := f.CreateIntent(ctx, 10000, "USD", "payment_1")
+	require.NoError(t, err)
+	require.Equal(t, intent, again)
+
+	declined, err := f.CreateIntent(ctx, 10001, "USD", "payment_2")
+	require.NoError(t, err)
+	require.Equal(t, IntentFailed, declined.Status)
+
+	pending, err := f.CreateIntent(ctx, 10002, "USD", "payment_3")
+	require.NoError(t, err)
+	require.Equal(t, IntentPending, pending.Status)
+
+	_, err = f.Capture(ctx, pending.ID, 10002)
+	require.ErrorIs(t, err, ErrInvalidState)
+
+	_, err = f.Capture(ctx, intent.ID, 20000)
+	require.ErrorIs(t, err, ErrInvalidState)
+
+	captured, err := f.Capture(ctx, intent.ID, 10000)
+	require.NoError(t, err)
+	require.Equal(t, IntentCaptured, captured.Status)
+
+	refund, err := f.Refund(ctx, intent.ID, 4000, "refund_1")
+	require.NoError(t, err)
+	require.Equal(t, RefundSucceeded, refund.Status)
+
+	_, err = f.Refund(ctx, intent.ID, 7000, "refund_2")
+	require.ErrorIs(t, err, ErrInvalidState, "more than is left")
+
+	failed, err := f.Refund(ctx, intent.ID, 101, "refund_3")
+	require.NoError(t, err)
+	require.Equal(t, RefundFailed, failed.Status)
+}
+
+func TestFakeWebhook(t *testing.T) {
+	f := NewFake("secret")
+	pending, err := f.CreateIntent(context.Background(), 10002, "USD", "payment_1")
+	require.NoError(t, err)
+
+	payload, err := json.Marshal(&Event{
+		ID:     "evt_1",
+		Type:   EventIntentUpdated,
+		Intent: &Intent{ID: pending.ID, Status: IntentAuthorized, Amount: 10002},
+	})
+	require.NoError(t, err)
+
+	_, err = f.ParseWebhook(payload, http.Header{FakeSignatureHeader: {NewFake("other").SignWebhook(payload)}})
+	require.ErrorIs(t, err, ErrInvalidWebhook)
+
+	event, err := f.ParseWebhook(payload, http.Header{FakeSignatureHeader: {f.SignWebhook(payload)}})
+	require.NoError(t, err)
+	require.Equal(t, IntentAuthorized, event.Intent.Status)
+
+	// the announced authorization can be captured
+	_, err = f.Capture(context.Background(), pending.ID, 10002)
+	require.NoError(t, err)
+}
+
+func TestFakeCancel(t *testing.T) {
+	ctx := context.Background()
+	f := NewFake("secret")
+
+	pending, err := f.CreateIntent(ctx, 10002, "USD", "payment_1")
+	require.NoError(t, err)
+
+	cancelled, err := f.Cancel(ctx, pending.ID)
+	require.NoError(t, err)
+	require.Equal(t, IntentCancelled, cancelled.Status)
+
+	// cancelling again changes nothing
+	cancelled, err = f.Cancel(ctx, pending.ID)
+	require.NoError(t, err)
+	require.Equal(t, IntentCancelled, cancelled.Status)
+
+	authorized, err := f.CreateIntent(ctx, 10000, "USD", "payment_2")
+	require.NoError(t, err)
+	_, err = f.Cancel(ctx, authorized.ID)
+	require.NoError(t, err)
+	_, err = f.Capture(ctx, authorized.ID, 10000)
+	require.ErrorIs(t, err, ErrInvalidState)
+
+	// captured intents stay captured
+	captured, err := f.CreateIntent(ctx, 10000, "USD", "payment_3")
+	require.NoError(t, err)
+	_, err = f.Capture(ctx, captured.ID, 10000)
+	require.NoError(t, err)
+	captured, err = f.Cancel(ctx, captured.ID)
+	require.NoError(t, err)
+	require.Equal(t, IntentCaptured, captured.Status)
+
+	_, err = f.Cancel(ctx, "pi_unknown")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestNewRequiresWebhookSecret(t *testing.T) {
+	_, err := New(&config.Payments{Provider: "fake"})
+	require.Error(t, err)
+
+	provider, err := New(&config.Payments{Provider: "fake", WebhookSecret: "secret"})
+	require.NoError(t, err)
+
+	intent, err := provider.CreateIntent(context.Background(), 10002, "USD", "payment_1")
+	require.NoError(t, err)
+
+	got, err := provider.GetIntent(context.Background(), intent.ID)
+	require.NoError(t, err)
+	require.Equal(t, IntentPending, got.Status)
+
+	_, err = provider.GetIntent(context.Background(), "pi_unknown")
+	require.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,103 @@
+// Package payments talks to payment providers. Amounts are in minor units
+// of the currency, e.g. cents.
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/MuhammadyusufAdhamov/booking/config"
+)
+
+// Intent statuses. A pending intent waits for the customer, an authorized
+// one can be captured. Cancelled intents can no longer be completed.
+const (
+	IntentPending    = "pending"
+	IntentAuthorized = "authorized"
+	IntentCaptured   = "captured"
+	IntentFailed     = "failed"
+	IntentCancelled  = "cancelled"
+)
+
+const (
+	RefundPending   = "pending"
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed"
+)
+
+// Webhook event types.
+const (
+	EventIntentUpdated = "intent.updated"
+	EventRefundUpdated = "refund.updated"
+)
+
+var (
+	ErrInvalidWebhook = errors.New("invalid webhook")
+	ErrNotFound       = errors.New("payment not found")
+	ErrInvalidState   = errors.New("payment is not in a state that allows this")
+)
+
+// Intent is the provider's side of a payment. ClientSecret is handed to the
+// customer's client to complete the payment with the provider.
+type Intent struct {
+	ID           string `json:"id"`
+	Status       string `json:"status"`
+	Amount       int64  `json:"amount"`
+	Currency     string `json:"currency"`
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+type Refund struct {
+	ID       string `json:"id"`
+	IntentID string `json:"intent_id"`
+	Status   string `json:"status"`
+	Amount   int64  `json:"amount"`
+}
+
+// Event is a webhook delivery. Depending on Type either Intent or Refund
+// holds the new state.
+type Event struct {
+	ID     string  `json:"id"`
+	Type   string  `json:"type"`
+	Intent *Intent `json:"intent,omitempty"`
+	Refund *Refund `json:"refund,omitempty"`
+}
+
+// Provider is a payment provider. Reference identifies the payment or
+// refund on our side; providers use it as idempotency key, so retrying a
+// call with the same reference does not charge or refund twice.
+type Provider interface {
+	Name() string
+	CreateIntent(ctx context.Context, amount int64, currency, reference string) (*Intent, error)
+	// GetIntent returns the current state of an intent. Webhooks only say
+	// that an intent changed, its state is always read back from here.
+	GetIntent(ctx context.Context, intentID string) (*Intent, error)
+	// Capture takes amount, at most the authorized amount, from an
+	// authorized intent.
+	Capture(ctx context.Context, intentID string, amount int64) (*Intent, error)
+	// Cancel voids a pending or authorized intent, so the customer can no
+	// longer complete it. Intents captured in the meantime are returned as
+	// they are and have to be refunded instead.
+	Cancel(ctx context.Context, intentID string) (*Intent, error)
+	Refund(ctx context.Context, intentID string, amount int64, reference string) (*Refund, error)
+	// ParseWebhook verifies a webhook delivery and decodes it. Deliveries
+	// that are not signed by the provider return ErrInvalidWebhook.
+	ParseWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+// New returns the provider selected by cfg. A webhook secret is required,
+// otherwise anyone could sign webhook deliveries.
+func New(cfg *config.Payments) (Provider, error) {
+	if cfg.WebhookSecret == "" {
+		return nil, errors.New("PAYMENTS_WEBHOOK_SECRET is not set")
+	}
+
+	switch cfg.Provider {
+	case "fake":
+		return NewFake(cfg.WebhookSecret), nil
+	}
+
+	return nil, fmt.Errorf("unknown payment provider %q", cfg.Provider)
+}
@@ -0,0 +1,42 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBytes(t *testing.T) {
+	d := New("Invoice (1)")
+	d.Text(50, 50, 12, true, "Hôtel (Tashkent)")
+	d.Line(50, 60, 545, 60)
+	d.AddPage()
+	d.TextRight(545, 50, 10, false, "Ташкент")
+
+	out := d.Bytes()
+	require.True(t, bytes.HasPrefix(out, []byte("%PDF-1.4")))
+	require.True(t, bytes.HasSuffix(out, []byte("%%EOF\n")))
+	require.Contains(t, string(out), "/Count 2")
+	require.Contains(t, string(out), "(H\xf4tel \\(Tashkent\\)) Tj")
+	require.Contains(t, string(out), "(???????) Tj")
+
+	// every xref entry points at its object
+	xref := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(out, -1)
+	require.Len(t, xref, 9)
+	for i, entry := range xref {
+		offset, err := strconv.Atoi(string(entry[1]))
+		require.NoError(t, err)
+		require.True(t, bytes.HasPrefix(out[offset:], []byte(fmt.Sprintf("%d 0 obj", i+1))))
+	}
+
+	require.Equal(t, out, d.Bytes())
+}
+
+func TestWidth(t *testing.T) {
+	require.Equal(t, 6.67, Width("A", 10, false))
+	require.Equal(t, 22.24, Width("0000", 10, false))
+}
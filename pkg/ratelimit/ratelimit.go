@@ -0,0 +1,104 @@
+package ratelimit
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-redis/redis/v9"
+)
+
+// slidingWindow keeps one sorted set member per accepted request, scored by
+// its time in milliseconds. Members older than the window are dropped before
+// counting, so the limit holds over any window-long span, not just aligned
+// buckets. Rejected requests are not recorded.
+var slidingWindow = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call("ZREMRANGEBYSCORE", key, "-inf", now - window)
+
+local allowed = 0
+local count = redis.call("ZCARD", key)
+if count < limit then
+	redis.call("ZADD", key, now, ARGV[4])
+	redis.call("PEXPIRE", key, window)
+	allowed = 1
+	count = count + 1
+end
+
+local reset = window
+local oldest = redis.call("ZRANGE", key, 0, 0, "WITHSCORES")
+if oldest[2] then
+	reset = tonumber(oldest[2]) + window - now
+end
+
+return {allowed, count, reset}
+`)
+
+// Result describes the caller's quota after a request was counted.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is when the oldest request in the window expires and a slot
+	// frees up. It doubles as Retry-After for rejected requests.
+	Reset time.Duration
+}
+
+type Limiter struct {
+	client *redis.Client
+	prefix string
+	now    func() time.Time
+}
+
+func New(client *redis.Client) *Limiter {
+	return &Limiter{
+		client: client,
+		prefix: "ratelimit:",
+		now:    time.Now,
+	}
+}
+
+// Allow counts one request for key and reports whether it fits in limit per
+// window.
+func (l *Limiter) Allow(ctx context.Context, key string, limit int, window time.Duration) (*Result, error) {
+	member, err := randomMember()
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := slidingWindow.Run(ctx, l.client,
+		[]string{l.prefix + key},
+		l.now().UnixMilli(),
+		window.Milliseconds(),
+		limit,
+		member,
+	).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	remaining := limit - int(values[1])
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &Result{
+		Allowed:   values[0] == 1,
+		Limit:     limit,
+		Remaining: remaining,
+		Reset:     time.Duration(values[2]) * time.Millisecond,
+	}, nil
+}
+
+func randomMember() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
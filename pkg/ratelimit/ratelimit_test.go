@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/go-redis/redis/v9"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func newRedis(t *testing.T) *redis.Client {
+	cfg := config.Load("./../..")
+
+	rdb := redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("redis is not available: %v", err)
+	}
+
+	return rdb
+}
+
+func TestSlidingWindow(t *testing.T) {
+	limiter := New(newRedis(t))
+	ctx := context.Background()
+	key := "test:" + uuid.NewString()
+
+	now := time.Now()
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow(ctx, key, 3, time.Minute)
+		require.NoError(t, err)
+		require.True(t, result.Allowed)
+		require.Equal(t, 2-i, result.Remaining)
+		now = now.Add(10 * time.Second)
+	}
+
+	result, err := limiter.Allow(ctx, key, 3, time.Minute)
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Equal(t, 0, result.Remaining)
+	require.Equal(t, 30*time.Second, result.Reset)
+
+	// The first request leaves the window, which frees exactly one slot.
+	now = now.Add(30 * time.Second)
+	result, err = limiter.Allow(ctx, key, 3, time.Minute)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+
+	result, err = limiter.Allow(ctx, key, 3, time.Minute)
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+}
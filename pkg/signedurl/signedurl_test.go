@@ -0,0 +1,43 @@
+package signedurl
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func parse(t *testing.T, link string) (string, url.Values) {
+	u, err := url.Parse(link)
+	require.NoError(t, err)
+	return u.Path, u.Query()
+}
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	s := New([]byte("secret"))
+	s.now = func() time.Time { return now }
+
+	link := s.Sign("/documents/1", now.Add(time.Minute))
+	require.True(t, strings.HasPrefix(link, "/documents/1?"))
+
+	path, query := parse(t, link)
+	require.NoError(t, s.Verify(path, query))
+
+	// another document
+	require.ErrorIs(t, s.Verify("/documents/2", query), ErrInvalidSignature)
+
+	// a later expiry
+	forged := url.Values{"expires": {"1800000000"}, "signature": query["signature"]}
+	require.ErrorIs(t, s.Verify(path, forged), ErrInvalidSignature)
+
+	// another key
+	require.ErrorIs(t, New([]byte("other")).Verify(path, query), ErrInvalidSignature)
+
+	require.ErrorIs(t, s.Verify(path, url.Values{}), ErrInvalidSignature)
+
+	s.now = func() time.Time { return now.Add(2 * time.Minute) }
+	require.ErrorIs(t, s.Verify(path, query), ErrExpired)
+}
@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// MergePatch applies an RFC 7396 JSON merge patch to target. Members set to
+// null in the patch are removed, objects are merged recursively and any
+// other value replaces the target's.
+func MergePatch(target, patch []byte) ([]byte, error) {
+	var t, p interface{}
+
+	if err := decodeNumbers(target, &t); err != nil {
+		return nil, err
+	}
+
+	if err := decodeNumbers(patch, &p); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(mergePatch(t, p))
+}
+
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = make(map[string]interface{})
+	}
+
+	for key, value := range p {
+		if value == nil {
+			delete(t, key)
+			continue
+		}
+		t[key] = mergePatch(t[key], value)
+	}
+
+	return t
+}
+
+// decodeNumbers keeps numbers as written so large integers survive the
+// round trip.
+func decodeNumbers(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,137 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/metrics"
+	"github.com/go-redis/redis/v9"
+	"golang.org/x/exp/slog"
+	"golang.org/x/sync/singleflight"
+)
+
+const keyPrefix = "cache:"
+
+type cache struct {
+	client *redis.Client
+	name   string
+	group  singleflight.Group
+}
+
+func newCache(client *redis.Client, name string) *cache {
+	return &cache{
+		client: client,
+		name:   name,
+	}
+}
+
+func (c *cache) key(parts ...string) string {
+	key := keyPrefix + c.name
+	for _, p := range parts {
+		key += ":" + p
+	}
+	return key
+}
+
+// fetch returns the value stored under key or loads it, stores it for ttl
+// and returns it. Concurrent misses for the same key share one load so an
+// expired hot key doesn't send a burst of identical queries to Postgres.
+// Redis being unavailable degrades to loading straight from the database.
+func fetch[T any](ctx context.Context, c *cache, key string, ttl time.Duration, load func() (T, error)) (T, error) {
+	var result T
+
+	data, err := c.client.Get(ctx, key).Bytes()
+	if err == nil && json.Unmarshal(data, &result) == nil {
+		metrics.CacheLookups.WithLabelValues(c.name, metrics.ResultHit).Inc()
+		return result, nil
+	}
+	metrics.CacheLookups.WithLabelValues(c.name, metrics.ResultMiss).Inc()
+
+	if err != nil && !errors.Is(err, redis.Nil) {
+		slog.WarnCtx(ctx, "cache unavailable, reading through", "cache", c.name, "error", err)
+		return load()
+	}
+
+	v, err, _ := c.group.Do(key, func() (interface{}, error) {
+		gen := c.generation(ctx)
+
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+
+		c.store(context.Background(), key, data, jitter(ttl), gen)
+		return data, nil
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = json.Unmarshal(v.([]byte), &result)
+	return result, err
+}
+
+// store sets key unless the generation has moved on from gen, which means a
+// write invalidated the cache while the value was being loaded and the value
+// may already be stale.
+func (c *cache) store(ctx context.Context, key string, data []byte, ttl time.Duration, gen string) {
+	genKey := c.key("gen")
+
+	err := c.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, genKey).Result()
+		if errors.Is(err, redis.Nil) {
+			current = "0"
+		} else if err != nil {
+			return err
+		}
+
+		if current != gen {
+			return nil
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, key, data, ttl)
+			return nil
+		})
+		return err
+	}, genKey)
+	if err != nil && !errors.Is(err, redis.TxFailedErr) {
+		slog.WarnCtx(ctx, "cache store failed", "cache", c.name, "error", err)
+	}
+}
+
+// generation returns the current list generation. Bumping it makes every
+// cached list page unreachable at once without scanning for keys.
+func (c *cache) generation(ctx context.Context) string {
+	gen, err := c.client.Get(ctx, c.key("gen")).Result()
+	if err != nil {
+		return "0"
+	}
+	return gen
+}
+
+// invalidate bumps the generation before deleting keys so a load that
+// started before the write can't store its value after the delete.
+func (c *cache) invalidate(ctx context.Context, keys ...string) {
+	c.client.Incr(ctx, c.key("gen"))
+	if len(keys) > 0 {
+		c.client.Del(ctx, keys...)
+	}
+}
+
+// jitter spreads expirations over an extra 10% so keys cached together don't
+// all expire in the same instant.
+func jitter(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return ttl
+	}
+	return ttl + time.Duration(rand.Int63n(int64(ttl)/10+1))
+}
@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/go-redis/redis/v9"
+)
+
+type hotelCache struct {
+	next    repo.HotelStorageI
+	cache   *cache
+	ttl     time.Duration
+	listTTL time.Duration
+}
+
+// NewHotel wraps next with a read-through Redis cache. Writes go to next and
+// then invalidate the affected keys.
+func NewHotel(next repo.HotelStorageI, client *redis.Client, ttl, listTTL time.Duration) repo.HotelStorageI {
+	return &hotelCache{
+		next:    next,
+		cache:   newCache(client, "hotel"),
+		ttl:     ttl,
+		listTTL: listTTL,
+	}
+}
+
+func (hc *hotelCache) Create(ctx context.Context, hotel *repo.Hotel) (*repo.Hotel, error) {
+	result, err := hc.next.Create(ctx, hotel)
+	if err != nil {
+		return nil, err
+	}
+
+	hc.cache.invalidate(ctx)
+	return result, nil
+}
+
+func (hc *hotelCache) Get(ctx context.Context, id int64) (*repo.Hotel, error) {
+	key := hc.cache.key(strconv.FormatInt(id, 10))
+
+	return fetch(ctx, hc.cache, key, hc.ttl, func() (*repo.Hotel, error) {
+		return hc.next.Get(ctx, id)
+	})
+}
+
+func (hc *hotelCache) GetAll(ctx context.Context, params *repo.GetAllHotelsParams) (*repo.GetAllHotelsResult, error) {
+	key := hc.cache.key("list", hc.cache.generation(ctx), listKey(params.Limit, params.Page, params.Search, params.Cursor, params.IncludeDeleted))
+
+	return fetch(ctx, hc.cache, key, hc.listTTL, func() (*repo.GetAllHotelsResult, error) {
+		return hc.next.GetAll(ctx, params)
+	})
+}
+
+func (hc *hotelCache) Update(ctx context.Context, hotel *repo.Hotel) (*repo.Hotel, error) {
+	result, err := hc.next.Update(ctx, hotel)
+	if err != nil {
+		return nil, err
+	}
+
+	hc.cache.invalidate(ctx, hc.cache.key(strconv.FormatInt(hotel.ID, 10)))
+	return result, nil
+}
+
+func (hc *hotelCache) Patch(ctx context.Context, id, version int64, fields map[string]interface{}) (*repo.Hotel, error) {
+	result, err := hc.next.Patch(ctx, id, version, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	hc.cache.invalidate(ctx, hc.cache.key(strconv.FormatInt(id, 10)))
+	return result, nil
+}
+
+func (hc *hotelCache) Delete(ctx context.Context, id, version int64) error {
+	err := hc.next.Delete(ctx, id, version)
+	if err != nil {
+		return err
+	}
+
+	hc.cache.invalidate(ctx, hc.cache.key(strconv.FormatInt(id, 10)))
+	return nil
+}
+
+func (hc *hotelCache) Restore(ctx context.Context, id int64) (*repo.Hotel, error) {
+	result, err := hc.next.Restore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	hc.cache.invalidate(ctx, hc.cache.key(strconv.FormatInt(id, 10)))
+	return result, nil
+}
+
+func (hc *hotelCache) Purge(ctx context.Context, before time.Time) (int64, error) {
+	count, err := hc.next.Purge(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+
+	if count > 0 {
+		hc.cache.invalidate(ctx)
+	}
+	return count, nil
+}
+
+func listKey(limit, page int32, search string, cursor *repo.Cursor, includeDeleted bool) string {
+	key := fmt.Sprintf("%d:%d:%q:%t", limit, page, search, includeDeleted)
+	if cursor != nil {
+		key += fmt.Sprintf(":%d:%d", cursor.CreatedAt.UnixNano(), cursor.ID)
+	}
+	return key
+}
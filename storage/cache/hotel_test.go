@@ -0,0 +1,107 @@
+package cache_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/MuhammadyusufAdhamov/booking/storage/cache"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/go-redis/redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+type countingHotels struct {
+	repo.HotelStorageI
+	gets int32
+}
+
+func (c *countingHotels) Get(ctx context.Context, id int64) (*repo.Hotel, error) {
+	atomic.AddInt32(&c.gets, 1)
+	time.Sleep(20 * time.Millisecond)
+	return &repo.Hotel{ID: id, HotelName: "cached", Version: 1}, nil
+}
+
+func (c *countingHotels) Update(ctx context.Context, hotel *repo.Hotel) (*repo.Hotel, error) {
+	return hotel, nil
+}
+
+func newRedis(t *testing.T) *redis.Client {
+	cfg := config.Load("./../..")
+
+	rdb := redis.NewClient(&redis.Options{Addr: cfg.Redis.Addr})
+	if err := rdb.Ping(context.Background()).Err(); err != nil {
+		t.Skipf("redis is not available: %v", err)
+	}
+
+	return rdb
+}
+
+func TestHotelCacheReadThrough(t *testing.T) {
+	rdb := newRedis(t)
+	inner := &countingHotels{}
+	hotels := cache.NewHotel(inner, rdb, time.Minute, time.Minute)
+
+	id := time.Now().UnixNano()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hotel, err := hotels.Get(context.Background(), id)
+			require.NoError(t, err)
+			require.Equal(t, "cached", hotel.HotelName)
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, int32(1), atomic.LoadInt32(&inner.gets))
+
+	_, err := hotels.Update(context.Background(), &repo.Hotel{ID: id})
+	require.NoError(t, err)
+
+	_, err = hotels.Get(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&inner.gets))
+}
+
+type blockingHotels struct {
+	countingHotels
+	started, release chan struct{}
+}
+
+func (b *blockingHotels) Get(ctx context.Context, id int64) (*repo.Hotel, error) {
+	if atomic.AddInt32(&b.gets, 1) == 1 {
+		close(b.started)
+		<-b.release
+	}
+	return &repo.Hotel{ID: id, HotelName: "cached", Version: 1}, nil
+}
+
+func TestHotelCacheSkipsStaleLoad(t *testing.T) {
+	rdb := newRedis(t)
+	inner := &blockingHotels{started: make(chan struct{}), release: make(chan struct{})}
+	hotels := cache.NewHotel(inner, rdb, time.Minute, time.Minute)
+
+	id := time.Now().UnixNano()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := hotels.Get(context.Background(), id)
+		require.NoError(t, err)
+	}()
+
+	<-inner.started
+	_, err := hotels.Update(context.Background(), &repo.Hotel{ID: id})
+	require.NoError(t, err)
+	close(inner.release)
+	<-done
+
+	_, err = hotels.Get(context.Background(), id)
+	require.NoError(t, err)
+	require.Equal(t, int32(2), atomic.LoadInt32(&inner.gets))
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/go-redis/redis/v9"
+)
+
+type roomCache struct {
+	next    repo.RoomsStorageI
+	cache   *cache
+	ttl     time.Duration
+	listTTL time.Duration
+}
+
+// NewRoom wraps next with a read-through Redis cache. Writes go to next and
+// then invalidate the affected keys.
+func NewRoom(next repo.RoomsStorageI, client *redis.Client, ttl, listTTL time.Duration) repo.RoomsStorageI {
+	return &roomCache{
+		next:    next,
+		cache:   newCache(client, "room"),
+		ttl:     ttl,
+		listTTL: listTTL,
+	}
+}
+
+func (rc *roomCache) Create(ctx context.Context, room *repo.Room) (*repo.Room, error) {
+	result, err := rc.next.Create(ctx, room)
+	if err != nil {
+		return nil, err
+	}
+
+	rc.cache.invalidate(ctx)
+	return result, nil
+}
+
+func (rc *roomCache) Get(ctx context.Context, id int64) (*repo.Room, error) {
+	key := rc.cache.key(strconv.FormatInt(id, 10))
+
+	return fetch(ctx, rc.cache, key, rc.ttl, func() (*repo.Room, error) {
+		return rc.next.Get(ctx, id)
+	})
+}
+
+func (rc *roomCache) GetAll(ctx context.Context, params *repo.GetAllRoomsParams) (*repo.GetAllRoomsResult, error) {
+	key := rc.cache.key("list", rc.cache.generation(ctx), listKey(params.Limit, params.Page, params.Search, params.Cursor, params.IncludeDeleted))
+
+	return fetch(ctx, rc.cache, key, rc.listTTL, func() (*repo.GetAllRoomsResult, error) {
+		return rc.next.GetAll(ctx, params)
+	})
+}
+
+func (rc *roomCache) Update(ctx context.Context, room *repo.Room) (*repo.Room, error) {
+	result, err := rc.next.Update(ctx, room)
+	if err != nil {
+		return nil, err
+	}
+
+	rc.cache.invalidate(ctx, rc.cache.key(strconv.FormatInt(room.ID, 10)))
+	return result, nil
+}
+
+func (rc *roomCache) Patch(ctx context.Context, id, version int64, fields map[string]interface{}) (*repo.Room, error) {
+	result, err := rc.next.Patch(ctx, id, version, fields)
+	if err != nil {
+		return nil, err
+	}
+
+	rc.cache.invalidate(ctx, rc.cache.key(strconv.FormatInt(id, 10)))
+	return result, nil
+}
+
+func (rc *roomCache) Delete(ctx context.Context, id, version int64) error {
+	err := rc.next.Delete(ctx, id, version)
+	if err != nil {
+		return err
+	}
+
+	rc.cache.invalidate(ctx, rc.cache.key(strconv.FormatInt(id, 10)))
+	return nil
+}
+
+func (rc *roomCache) Restore(ctx context.Context, id int64) (*repo.Room, error) {
+	result, err := rc.next.Restore(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rc.cache.invalidate(ctx, rc.cache.key(strconv.FormatInt(id, 10)))
+	return result, nil
+}
+
+func (rc *roomCache) Purge(ctx context.Context, before time.Time) (int64, error) {
+	count, err := rc.next.Purge(ctx, before)
+	if err != nil {
+		return 0, err
+	}
+
+	if count > 0 {
+		rc.cache.invalidate(ctx)
+	}
+	return count, nil
+}
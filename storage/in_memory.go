@@ -7,8 +7,8 @@ import (
 )
 
 type InMemoryStorageI interface {
-	Set(key, value string, exp time.Duration) error
-	Get(key string) (string, error)
+	Set(ctx context.Context, key, value string, exp time.Duration) error
+	Get(ctx context.Context, key string) (string, error)
 }
 
 type storageRedis struct {
@@ -21,16 +21,16 @@ func NewInMemoryStorage(rdb *redis.Client) InMemoryStorageI {
 	}
 }
 
-func (r *storageRedis) Set(key, value string, exp time.Duration) error {
-	err := r.client.Set(context.Background(), key, value, exp).Err()
+func (r *storageRedis) Set(ctx context.Context, key, value string, exp time.Duration) error {
+	err := r.client.Set(ctx, key, value, exp).Err()
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
-func (r *storageRedis) Get(key string) (string, error) {
-	val, err := r.client.Get(context.Background(), key).Result()
+func (r *storageRedis) Get(ctx context.Context, key string) (string, error) {
+	val, err := r.client.Get(ctx, key).Result()
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,300 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/jmoiron/sqlx"
+)
+
+const redacted = "[REDACTED]"
+
+// redactedFields are never written to the audit log in clear text. A change
+// to them is still recorded, just without the values.
+var redactedFields = map[string]bool{
+	"password": true,
+}
+
+type auditRepo struct {
+	db *sqlx.DB
+}
+
+func NewAudit(db *sqlx.DB) repo.AuditStorageI {
+	return &auditRepo{
+		db: db,
+	}
+}
+
+// writeAudit records a change made inside tx together with the actor carried
+// by ctx. before is nil for creates and after is nil for deletes.
+func writeAudit(ctx context.Context, tx *sqlx.Tx, entity string, entityID int64, action string, before, after interface{}) error {
+	beforeMap, err := snapshot(before)
+	if err != nil {
+		return err
+	}
+
+	afterMap, err := snapshot(after)
+	if err != nil {
+		return err
+	}
+
+	changes := diff(beforeMap, afterMap)
+	redact(beforeMap)
+	redact(afterMap)
+
+	actor := repo.ActorFromContext(ctx)
+
+	query := `
+		INSERT INTO audit_logs(
+			entity,
+			entity_id,
+			action,
+			actor_id,
+			actor_type,
+			ip,
+			request_id,
+			before,
+			after,
+			changes
+		) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+	`
+
+	_, err = tx.ExecContext(
+		ctx,
+		query,
+		entity,
+		entityID,
+		action,
+		actor.UserID,
+		nullString(actor.UserType),
+		nullString(actor.IP),
+		nullString(actor.RequestID),
+		jsonValue(beforeMap),
+		jsonValue(afterMap),
+		jsonValue(changes),
+	)
+	return err
+}
+
+// snapshot turns a repo struct into a map keyed by snake_case column names.
+func snapshot(v interface{}) (map[string]interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]interface{}
+	err = json.Unmarshal(data, &fields)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		result[toSnakeCase(key)] = value
+	}
+
+	return result, nil
+}
+
+type change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+func diff(before, after map[string]interface{}) map[string]interface{} {
+	changes := make(map[string]interface{})
+
+	for key, value := range after {
+		if old, ok := before[key]; !ok || !reflect.DeepEqual(old, value) {
+			changes[key] = change{From: before[key], To: value}
+		}
+	}
+
+	for key, value := range before {
+		if _, ok := after[key]; !ok {
+			changes[key] = change{From: value}
+		}
+	}
+
+	for key := range changes {
+		if redactedFields[key] {
+			changes[key] = change{From: redacted, To: redacted}
+		}
+	}
+
+	return changes
+}
+
+func redact(fields map[string]interface{}) {
+	for key := range fields {
+		if redactedFields[key] {
+			fields[key] = redacted
+		}
+	}
+}
+
+func toSnakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			prevLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			nextLower := i > 0 && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if prevLower || nextLower {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+func jsonValue(v map[string]interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+
+	return string(data)
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+func (ar *auditRepo) GetAll(ctx context.Context, params *repo.GetAllAuditLogsParams) (*repo.GetAllAuditLogsResult, error) {
+	ctx, span := startQuery(ctx, "audit.get_all")
+	defer span.End()
+
+	result := repo.GetAllAuditLogsResult{
+		AuditLogs: make([]*repo.AuditLog, 0),
+	}
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	addCondition := func(condition string, value interface{}) {
+		args = append(args, value)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if params.Entity != "" {
+		addCondition("entity=$%d", params.Entity)
+	}
+	if params.EntityID != 0 {
+		addCondition("entity_id=$%d", params.EntityID)
+	}
+	if params.ActorID != 0 {
+		addCondition("actor_id=$%d", params.ActorID)
+	}
+	if params.From != nil {
+		addCondition("created_at >= $%d", *params.From)
+	}
+	if params.To != nil {
+		addCondition("created_at < $%d", *params.To)
+	}
+
+	filter := ""
+	if len(conditions) > 0 {
+		filter = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	pageFilter, limit, pageArgs := paginate(filter, args, params.Limit, params.Page, params.Cursor)
+
+	query := `
+		SELECT
+			id,
+			entity,
+			entity_id,
+			action,
+			actor_id,
+			COALESCE(actor_type, ''),
+			COALESCE(ip, ''),
+			COALESCE(request_id, ''),
+			before,
+			after,
+			changes,
+			created_at
+		FROM audit_logs
+		` + pageFilter + `
+		ORDER BY created_at desc, id desc
+		` + limit
+
+	rows, err := ar.db.QueryContext(ctx, query, pageArgs...)
+	if err != nil {
+		return nil, logQueryError(ctx, "audit.get_all", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			a                      repo.AuditLog
+			before, after, changes []byte
+		)
+
+		err := rows.Scan(
+			&a.ID,
+			&a.Entity,
+			&a.EntityID,
+			&a.Action,
+			&a.ActorID,
+			&a.ActorType,
+			&a.IP,
+			&a.RequestID,
+			&before,
+			&after,
+			&changes,
+			&a.CreatedAt,
+		)
+		if err != nil {
+			return nil, logQueryError(ctx, "audit.get_all", err)
+		}
+
+		a.Before = before
+		a.After = after
+		a.Changes = changes
+
+		result.AuditLogs = append(result.AuditLogs, &a)
+	}
+
+	if len(result.AuditLogs) > int(params.Limit) {
+		result.AuditLogs = result.AuditLogs[:params.Limit]
+
+		last := result.AuditLogs[len(result.AuditLogs)-1]
+		result.NextCursor = &repo.Cursor{
+			CreatedAt: last.CreatedAt,
+			ID:        last.ID,
+		}
+	}
+
+	queryCount := `SELECT count(1) FROM audit_logs ` + filter
+	err = ar.db.QueryRowContext(ctx, queryCount, args...).Scan(&result.Count)
+	if err != nil {
+		return nil, logQueryError(ctx, "audit.get_all", err)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,71 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/bxcodec/faker/v4"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuditLogRecordsChanges(t *testing.T) {
+	user := createUser(t)
+
+	ctx := repo.WithActor(context.Background(), &repo.Actor{
+		UserID:    &user.ID,
+		UserType:  repo.UserTypeSuperadmin,
+		IP:        "127.0.0.1",
+		RequestID: faker.UUIDHyphenated(),
+	})
+
+	hotel, err := strg.Hotel().Create(ctx, &repo.Hotel{
+		HotelName:     faker.Name(),
+		HotelLocation: faker.Sentence(),
+		UserID:        user.ID,
+	})
+	require.NoError(t, err)
+
+	hotel.HotelName = faker.Name()
+	hotel, err = strg.Hotel().Update(ctx, hotel)
+	require.NoError(t, err)
+
+	result, err := strg.Audit().GetAll(context.Background(), &repo.GetAllAuditLogsParams{
+		Limit:    10,
+		Page:     1,
+		Entity:   repo.AuditEntityHotel,
+		EntityID: hotel.ID,
+		ActorID:  user.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, int(result.Count))
+
+	update := result.AuditLogs[0]
+	require.Equal(t, repo.AuditActionUpdate, update.Action)
+	require.Equal(t, "127.0.0.1", update.IP)
+	require.Contains(t, string(update.Changes), "hotel_name")
+}
+
+func TestAuditLogRedactsPassword(t *testing.T) {
+	user := createUser(t)
+
+	err := strg.User().UpdatePassword(context.Background(), &repo.UpdatePassword{
+		UserID:   user.ID,
+		Password: faker.Password(),
+	})
+	require.NoError(t, err)
+
+	result, err := strg.Audit().GetAll(context.Background(), &repo.GetAllAuditLogsParams{
+		Limit:    10,
+		Page:     1,
+		Entity:   repo.AuditEntityUser,
+		EntityID: user.ID,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, result.AuditLogs)
+
+	for _, a := range result.AuditLogs {
+		require.NotContains(t, string(a.After), user.Password)
+		require.NotContains(t, string(a.Changes), user.Password)
+	}
+}
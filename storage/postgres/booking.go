@@ -1,8 +1,11 @@
 package postgres
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/jmoiron/sqlx"
 )
@@ -17,7 +20,75 @@ func NewBooking(db *sqlx.DB) repo.BookingsStorageI {
 	}
 }
 
-func (ur *bookingRepo) Create(booking *repo.Booking) (*repo.Booking, error) {
+const bookingColumns = `
+	id,
+	room_id,
+	user_id,
+	hotel_id,
+	from_date,
+	to_date,
+	price,
+	currency,
+	exchange_rate,
+	guests,
+	charges,
+	total,
+	commission_rate::TEXT,
+	status,
+	version,
+	created_at,
+	deleted_at
+`
+
+func scanBooking(row interface{ Scan(...interface{}) error }) (*repo.Booking, error) {
+	var (
+		result  repo.Booking
+		charges []byte
+	)
+
+	err := row.Scan(
+		&result.ID,
+		&result.RoomId,
+		&result.UserId,
+		&result.HotelId,
+		&result.FromDate,
+		&result.ToDate,
+		&result.Price,
+		&result.Currency,
+		&result.ExchangeRate,
+		&result.Guests,
+		&charges,
+		&result.Total,
+		&result.CommissionRate,
+		&result.Status,
+		&result.Version,
+		&result.CreatedAt,
+		&result.DeletedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(charges, &result.Charges)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+// encodeCharges stores no charges as an empty list rather than null.
+func encodeCharges(charges []repo.BookingCharge) ([]byte, error) {
+	if charges == nil {
+		charges = []repo.BookingCharge{}
+	}
+	return json.Marshal(charges)
+}
+
+func (ur *bookingRepo) Create(ctx context.Context, booking *repo.Booking) (*repo.Booking, error) {
+	ctx, span := startQuery(ctx, "booking.create")
+	defer span.End()
+
 	query := `
 		INSERT INTO bookings(
 			 room_id,
@@ -25,177 +96,492 @@ func (ur *bookingRepo) Create(booking *repo.Booking) (*repo.Booking, error) {
 		     hotel_id,
 		     from_date,
 		     to_date,
-		     price
-		) VALUES($1, $2, $3, $4, $5, $6)
-		RETURNING id, created_at
+		     price,
+		     currency,
+		     exchange_rate,
+		     guests,
+		     charges,
+		     total,
+		     commission_rate
+		) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, status, version, created_at
 	`
 
-	row := ur.db.QueryRow(
-		query,
-		booking.RoomId,
-		booking.UserId,
-		booking.HotelId,
-		booking.FromDate,
-		booking.ToDate,
-		booking.Price,
-	)
-	err := row.Scan(&booking.ID, &booking.CreatedAt)
+	charges, err := encodeCharges(booking.Charges)
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "booking.create", err)
+	}
+
+	err = inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowContext(
+			ctx,
+			query,
+			booking.RoomId,
+			booking.UserId,
+			booking.HotelId,
+			booking.FromDate,
+			booking.ToDate,
+			booking.Price,
+			booking.Currency,
+			booking.ExchangeRate,
+			booking.Guests,
+			charges,
+			booking.Total,
+			booking.CommissionRate,
+		)
+		err := row.Scan(&booking.ID, &booking.Status, &booking.Version, &booking.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		err = redeem(ctx, tx, booking)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityBooking, booking.ID, repo.AuditActionCreate, nil, booking)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "booking.create", err)
 	}
 
 	return booking, nil
 }
 
-func (ur *bookingRepo) Get(id int64) (*repo.Booking, error) {
-	var result repo.Booking
+func (ur *bookingRepo) Get(ctx context.Context, id int64) (*repo.Booking, error) {
+	ctx, span := startQuery(ctx, "booking.get")
+	defer span.End()
+
+	result, err := ur.get(ctx, ur.db, id, activeRows, false)
+	if err != nil {
+		return nil, logQueryError(ctx, "booking.get", err)
+	}
+
+	return result, nil
+}
+
+func (ur *bookingRepo) get(ctx context.Context, q queryer, id int64, scope string, forUpdate bool) (*repo.Booking, error) {
+	return getBooking(ctx, q, id, scope, forUpdate)
+}
 
+func getBooking(ctx context.Context, q queryer, id int64, scope string, forUpdate bool) (*repo.Booking, error) {
 	query := `
-		SELECT
-			id,
-			room_id,
-			user_id,
-			hotel_id,
-			from_date,
-			to_date,
-			price,
-			created_at
+		SELECT ` + bookingColumns + `
 		FROM bookings
-		WHERE id=$1
+		WHERE id=$1 AND ` + scope + `
 	`
-
-	row := ur.db.QueryRow(query, id)
-	err := row.Scan(
-		&result.ID,
-		&result.RoomId,
-		&result.UserId,
-		&result.HotelId,
-		&result.FromDate,
-		&result.ToDate,
-		&result.Price,
-		&result.CreatedAt,
-	)
-	if err != nil {
-		return nil, err
+	if forUpdate {
+		query += " FOR UPDATE"
 	}
 
-	return &result, nil
+	return scanBooking(q.QueryRowContext(ctx, query, id))
 }
 
-func (ur *bookingRepo) GetAll(params *repo.GetAllBookingsParams) (*repo.GetAllBookingResult, error) {
+func (ur *bookingRepo) GetAll(ctx context.Context, params *repo.GetAllBookingsParams) (*repo.GetAllBookingResult, error) {
+	ctx, span := startQuery(ctx, "booking.get_all")
+	defer span.End()
+
 	result := repo.GetAllBookingResult{
 		Bookings: make([]*repo.Booking, 0),
 	}
 
-	offset := (params.Page - 1) * params.Limit
-
-	limit := fmt.Sprintf(" LIMIT %d OFFSET %d ", params.Limit, offset)
-
 	filter := ""
+	if !params.IncludeDeleted {
+		filter = where(filter, activeRows)
+	}
+
+	var args []interface{}
 	if params.Search != "" {
-		str := "%" + params.Search + "%"
-		filter += fmt.Sprintf(`
-			WHERE stay ILIKE '%s' `,
-			str,
-		)
+		args = append(args, "%"+params.Search+"%")
+		filter = where(filter, `(from_date ILIKE $1 OR to_date ILIKE $1 OR status ILIKE $1)`)
 	}
 
+	pageFilter, limit, pageArgs := paginate(filter, args, params.Limit, params.Page, params.Cursor)
+
 	query := `
-		SELECT
-			id,
-			room_id,
-			user_id,
-			hotel_id,
-			from_date,
-			to_date,
-			price,
-			created_at
+		SELECT ` + bookingColumns + `
 		FROM bookings
-		` + filter + `
-		ORDER BY created_at desc
+		` + pageFilter + `
+		ORDER BY created_at desc, id desc
 		` + limit
 
-	rows, err := ur.db.Query(query)
+	rows, err := ur.db.QueryContext(ctx, query, pageArgs...)
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "booking.get_all", err)
 	}
 
 	defer rows.Close()
 
 	for rows.Next() {
-		var u repo.Booking
-
-		err := rows.Scan(
-			&u.ID,
-			&u.RoomId,
-			&u.UserId,
-			&u.HotelId,
-			&u.FromDate,
-			&u.ToDate,
-			&u.Price,
-			&u.CreatedAt,
-		)
+		u, err := scanBooking(rows)
 		if err != nil {
-			return nil, err
+			return nil, logQueryError(ctx, "booking.get_all", err)
 		}
 
-		result.Bookings = append(result.Bookings, &u)
+		result.Bookings = append(result.Bookings, u)
+	}
+
+	if len(result.Bookings) > int(params.Limit) {
+		result.Bookings = result.Bookings[:params.Limit]
+
+		last := result.Bookings[len(result.Bookings)-1]
+		result.NextCursor = &repo.Cursor{
+			CreatedAt: last.CreatedAt,
+			ID:        last.ID,
+		}
 	}
 
 	queryCount := `SELECT count(1) FROM bookings ` + filter
-	err = ur.db.QueryRow(queryCount).Scan(&result.Count)
+	err = ur.db.QueryRowContext(ctx, queryCount, args...).Scan(&result.Count)
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "booking.get_all", err)
 	}
 
 	return &result, nil
 }
 
-func (ur *bookingRepo) Update(booking *repo.Booking) (*repo.Booking, error) {
+func (ur *bookingRepo) Update(ctx context.Context, booking *repo.Booking) (*repo.Booking, error) {
+	ctx, span := startQuery(ctx, "booking.update")
+	defer span.End()
+
 	query := `update bookings set 
 			room_id=$1,
 			user_id=$2,
 			hotel_id=$3,
 			from_date=$4,
 			to_date=$5,
-			price=$6
-		where id=$7
-		returning created_at
+			price=$6,
+			currency=$7,
+			exchange_rate=$8,
+			guests=$9,
+			charges=$10,
+			total=$11,
+			commission_rate=$12,
+			version=version+1
+		where id=$13
+		returning version, created_at
 		`
 
-	err := ur.db.QueryRow(
-		query,
-		booking.RoomId,
-		booking.UserId,
-		booking.HotelId,
-		booking.FromDate,
-		booking.ToDate,
-		booking.Price,
-		booking.ID,
-	).Scan(&booking.CreatedAt)
+	charges, err := encodeCharges(booking.Charges)
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "booking.update", err)
+	}
+
+	err = inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, booking.ID, activeRows, true)
+		if err != nil {
+			return err
+		}
+
+		if before.Version != booking.Version {
+			return repo.ErrVersionMismatch
+		}
+
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			booking.RoomId,
+			booking.UserId,
+			booking.HotelId,
+			booking.FromDate,
+			booking.ToDate,
+			booking.Price,
+			booking.Currency,
+			booking.ExchangeRate,
+			booking.Guests,
+			charges,
+			booking.Total,
+			booking.CommissionRate,
+			booking.ID,
+		).Scan(&booking.Version, &booking.CreatedAt)
+		if err != nil {
+			return err
+		}
+		booking.Status = before.Status
+
+		err = syncRedemptions(ctx, tx, booking)
+		if err != nil {
+			return err
+		}
+
+		err = adjustCommission(ctx, tx, booking)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityBooking, booking.ID, repo.AuditActionUpdate, before, booking)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "booking.update", err)
 	}
 
 	return booking, nil
 }
 
-func (ur *bookingRepo) Delete(id int64) error {
-	query := `delete from bookings where id=$1 returning id`
+// Patch updates only the given columns, keyed by column name. Charges are
+// given as []repo.BookingCharge.
+func (ur *bookingRepo) Patch(ctx context.Context, id, version int64, fields map[string]interface{}) (*repo.Booking, error) {
+	ctx, span := startQuery(ctx, "booking.patch")
+	defer span.End()
+
+	if charges, ok := fields["charges"].([]repo.BookingCharge); ok {
+		encoded, err := encodeCharges(charges)
+		if err != nil {
+			return nil, logQueryError(ctx, "booking.patch", err)
+		}
+		fields["charges"] = encoded
+	}
 
-	result, err := ur.db.Exec(query, id)
+	set, args, err := patchSet(fields,
+		"room_id",
+		"user_id",
+		"hotel_id",
+		"from_date",
+		"to_date",
+		"price",
+		"currency",
+		"exchange_rate",
+		"guests",
+		"charges",
+		"total",
+		"commission_rate",
+	)
 	if err != nil {
-		return err
+		return nil, logQueryError(ctx, "booking.patch", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	var result *repo.Booking
+	err = inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, id, activeRows, true)
+		if err != nil {
+			return err
+		}
+
+		if before.Version != version {
+			return repo.ErrVersionMismatch
+		}
+
+		if len(fields) == 0 {
+			result = before
+			return nil
+		}
+
+		query := "update bookings set " + set + ", version=version+1 where id=$" + strconv.Itoa(len(args)+1)
+		_, err = tx.ExecContext(ctx, query, append(args, id)...)
+		if err != nil {
+			return err
+		}
+
+		result, err = ur.get(ctx, tx, id, activeRows, false)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := fields["charges"]; ok {
+			err = syncRedemptions(ctx, tx, result)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, repriced := fields["total"]
+		_, relocked := fields["commission_rate"]
+		_, moved := fields["hotel_id"]
+		if repriced || relocked || moved {
+			err = adjustCommission(ctx, tx, result)
+			if err != nil {
+				return err
+			}
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityBooking, id, repo.AuditActionUpdate, before, result)
+	})
 	if err != nil {
+		return nil, logQueryError(ctx, "booking.patch", err)
+	}
+
+	return result, nil
+}
+
+// SetStatus moves a booking along repo.BookingTransitions. Setting the
+// current status again changes nothing.
+func (ur *bookingRepo) SetStatus(ctx context.Context, id int64, status string) (*repo.Booking, error) {
+	ctx, span := startQuery(ctx, "booking.set_status")
+	defer span.End()
+
+	var result *repo.Booking
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = setBookingStatus(ctx, tx, id, status)
 		return err
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "booking.set_status", err)
+	}
+
+	return result, nil
+}
+
+// setBookingStatus is SetStatus within tx. Confirming a booking earns its
+// commission.
+func setBookingStatus(ctx context.Context, tx *sqlx.Tx, id int64, status string) (*repo.Booking, error) {
+	before, err := getBooking(ctx, tx, id, activeRows, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if before.Status == status {
+		return before, nil
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	if !repo.CanTransition(repo.BookingTransitions, before.Status, status) {
+		return nil, repo.ErrBookingState
+	}
+
+	after := *before
+	after.Status = status
+	err = tx.QueryRowContext(ctx, "update bookings set status=$1, version=version+1 where id=$2 returning version", status, id).Scan(&after.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if status == repo.BookingStatusConfirmed {
+		err = earnCommission(ctx, tx, &after)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = writeAudit(ctx, tx, repo.AuditEntityBooking, id, repo.AuditActionUpdate, before, &after)
+	if err != nil {
+		return nil, err
+	}
+
+	return &after, nil
+}
+
+func (ur *bookingRepo) Delete(ctx context.Context, id, version int64) error {
+	ctx, span := startQuery(ctx, "booking.delete")
+	defer span.End()
+
+	query := `update bookings set
+			deleted_at=CURRENT_TIMESTAMP,
+			version=version+1
+		where id=$1
+		returning version, deleted_at
+	`
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, id, activeRows, true)
+		if err != nil {
+			return err
+		}
+
+		if before.Version != version {
+			return repo.ErrVersionMismatch
+		}
+
+		after := *before
+		err = tx.QueryRowContext(ctx, query, id).Scan(&after.Version, &after.DeletedAt)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityBooking, id, repo.AuditActionDelete, before, &after)
+	})
+
+	return logQueryError(ctx, "booking.delete", err)
+}
+
+func (ur *bookingRepo) Restore(ctx context.Context, id int64) (*repo.Booking, error) {
+	ctx, span := startQuery(ctx, "booking.restore")
+	defer span.End()
+
+	query := `update bookings set
+			deleted_at=NULL,
+			version=version+1
+		where id=$1
+		returning version
+	`
+
+	var result *repo.Booking
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, id, deletedRows, true)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.DeletedAt = nil
+		err = tx.QueryRowContext(ctx, query, id).Scan(&after.Version)
+		if err != nil {
+			return err
+		}
+
+		result = &after
+		return writeAudit(ctx, tx, repo.AuditEntityBooking, id, repo.AuditActionRestore, before, &after)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "booking.restore", err)
+	}
+
+	return result, nil
+}
+
+// Purge hard deletes rows soft deleted before the given time, skipping rows
+// that are still referenced.
+func (ur *bookingRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := startQuery(ctx, "booking.purge")
+	defer span.End()
+
+	query := `delete from bookings
+		where deleted_at < $1
+			AND NOT EXISTS (SELECT 1 FROM documents d WHERE d.booking_id=bookings.id)
+			AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.booking_id=bookings.id)
+			AND NOT EXISTS (SELECT 1 FROM invoices i WHERE i.booking_id=bookings.id)
+			AND NOT EXISTS (SELECT 1 FROM campaign_redemptions c WHERE c.booking_id=bookings.id)
+			AND NOT EXISTS (SELECT 1 FROM commission_entries c WHERE c.booking_id=bookings.id)
+		returning id
+	`
+
+	var count int64
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, before)
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			err := writeAudit(ctx, tx, repo.AuditEntityBooking, id, repo.AuditActionPurge, nil, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		count = int64(len(ids))
+		return nil
+	})
+	if err != nil {
+		return 0, logQueryError(ctx, "booking.purge", err)
 	}
 
-	return nil
+	return count, nil
 }
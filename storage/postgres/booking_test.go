@@ -1,10 +1,12 @@
 package postgres_test
 
 import (
+	"context"
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/bxcodec/faker/v4"
 	"github.com/stretchr/testify/require"
 	"testing"
+	"time"
 )
 
 func createBooking(t *testing.T) *repo.Booking {
@@ -12,11 +14,17 @@ func createBooking(t *testing.T) *repo.Booking {
 	user := createUser(t)
 	hotel := createHotel(t)
 
-	booking, err := strg.Booking().Create(&repo.Booking{
-		RoomId:   int(room.ID),
-		UserId:   int(user.ID),
-		HotelId:  int(hotel.ID),
-		FromDate: faker.DATE,
+	booking, err := strg.Booking().Create(context.Background(), &repo.Booking{
+		RoomId:         int(room.ID),
+		UserId:         int(user.ID),
+		HotelId:        int(hotel.ID),
+		FromDate:       faker.DATE,
+		Price:          12500,
+		Currency:       "EUR",
+		ExchangeRate:   "1.08",
+		CommissionRate: "10",
+		Guests:         2,
+		Total:          12500,
 	})
 	require.NoError(t, err)
 	require.NotEmpty(t, booking)
@@ -27,7 +35,7 @@ func createBooking(t *testing.T) *repo.Booking {
 func TestGetBooking(t *testing.T) {
 	c := createBooking(t)
 
-	booking, err := strg.Booking().Get(c.ID)
+	booking, err := strg.Booking().Get(context.Background(), c.ID)
 	require.NoError(t, err)
 	require.NotEmpty(t, booking)
 }
@@ -39,7 +47,7 @@ func TestCreateBooking(t *testing.T) {
 func TestGetAllBookings(t *testing.T) {
 	createBooking(t)
 
-	result, err := strg.Booking().GetAll(&repo.GetAllBookingsParams{
+	result, err := strg.Booking().GetAll(context.Background(), &repo.GetAllBookingsParams{
 		Limit: 3,
 		Page:  1,
 	})
@@ -47,20 +55,73 @@ func TestGetAllBookings(t *testing.T) {
 	require.GreaterOrEqual(t, int(result.Count), 1)
 }
 
+func TestGetAllBookingsCursor(t *testing.T) {
+	createBooking(t)
+	createBooking(t)
+	createBooking(t)
+
+	first, err := strg.Booking().GetAll(context.Background(), &repo.GetAllBookingsParams{
+		Limit: 2,
+		Page:  1,
+	})
+	require.NoError(t, err)
+	require.Len(t, first.Bookings, 2)
+	require.NotNil(t, first.NextCursor)
+
+	second, err := strg.Booking().GetAll(context.Background(), &repo.GetAllBookingsParams{
+		Limit:  2,
+		Cursor: first.NextCursor,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, second.Bookings)
+
+	last := first.Bookings[len(first.Bookings)-1]
+	for _, b := range second.Bookings {
+		require.True(t, b.CreatedAt.Before(last.CreatedAt) ||
+			(b.CreatedAt.Equal(last.CreatedAt) && b.ID < last.ID))
+	}
+}
+
 func TestUpdateBooking(t *testing.T) {
 	c := createBooking(t)
 
 	c.FromDate = faker.DATE
 
-	booking, err := strg.Booking().Update(c)
+	booking, err := strg.Booking().Update(context.Background(), c)
 	require.NoError(t, err)
 	require.NotEmpty(t, booking)
 	require.Equal(t, booking.FromDate, c.FromDate)
 }
 
+func TestUpdateBookingVersionMismatch(t *testing.T) {
+	c := createBooking(t)
+
+	stale := *c
+
+	_, err := strg.Booking().Update(context.Background(), c)
+	require.NoError(t, err)
+
+	_, err = strg.Booking().Update(context.Background(), &stale)
+	require.ErrorIs(t, err, repo.ErrVersionMismatch)
+}
+
 func TestDeleteBooking(t *testing.T) {
 	c := createBooking(t)
 
-	err := strg.Booking().Delete(c.ID)
+	err := strg.Booking().Delete(context.Background(), c.ID, c.Version)
+	require.NoError(t, err)
+}
+
+func TestPurgeBookings(t *testing.T) {
+	c := createBooking(t)
+
+	err := strg.Booking().Delete(context.Background(), c.ID, c.Version)
 	require.NoError(t, err)
+
+	count, err := strg.Booking().Purge(context.Background(), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, count, int64(1))
+
+	_, err = strg.Booking().Restore(context.Background(), c.ID)
+	require.Error(t, err)
 }
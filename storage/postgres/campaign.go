@@ -0,0 +1,435 @@
+package postgres
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type campaignRepo struct {
+	db *sqlx.DB
+}
+
+func NewCampaign(db *sqlx.DB) repo.CampaignStorageI {
+	return &campaignRepo{
+		db: db,
+	}
+}
+
+const campaignColumns = `
+	id,
+	COALESCE(code, ''),
+	name,
+	hotel_id,
+	created_by,
+	type,
+	COALESCE(percent::TEXT, ''),
+	COALESCE(amount, 0),
+	COALESCE(currency, ''),
+	valid_from,
+	valid_until,
+	min_nights,
+	max_uses,
+	max_uses_per_user,
+	stackable,
+	created_at,
+	updated_at,
+	deleted_at
+`
+
+// campaignUsage counts the redemptions of live bookings, overall and of the
+// user given as $2.
+const campaignUsage = `
+	(SELECT count(1) FROM campaign_redemptions r JOIN bookings b ON b.id=r.booking_id
+		WHERE r.campaign_id=campaigns.id AND b.status<>'cancelled' AND b.deleted_at IS NULL),
+	(SELECT count(1) FROM campaign_redemptions r JOIN bookings b ON b.id=r.booking_id
+		WHERE r.campaign_id=campaigns.id AND b.status<>'cancelled' AND b.deleted_at IS NULL AND r.user_id=$2)
+`
+
+func scanCampaign(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*repo.Campaign, error) {
+	var result repo.Campaign
+
+	dest := []interface{}{
+		&result.ID,
+		&result.Code,
+		&result.Name,
+		&result.HotelID,
+		&result.CreatedBy,
+		&result.Type,
+		&result.Percent,
+		&result.Amount,
+		&result.Currency,
+		&result.ValidFrom,
+		&result.ValidUntil,
+		&result.MinNights,
+		&result.MaxUses,
+		&result.MaxUsesPerUser,
+		&result.Stackable,
+		&result.CreatedAt,
+		&result.UpdatedAt,
+		&result.DeletedAt,
+	}
+
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (ur *campaignRepo) Create(ctx context.Context, c *repo.Campaign) (*repo.Campaign, error) {
+	ctx, span := startQuery(ctx, "campaign.create")
+	defer span.End()
+
+	query := `
+		INSERT INTO campaigns(
+			code,
+			name,
+			hotel_id,
+			created_by,
+			type,
+			percent,
+			amount,
+			currency,
+			valid_from,
+			valid_until,
+			min_nights,
+			max_uses,
+			max_uses_per_user,
+			stackable
+		) VALUES(NULLIF($1, ''), $2, $3, $4, $5, NULLIF($6, '')::NUMERIC, NULLIF($7, 0), NULLIF($8, ''), $9, $10, $11, $12, $13, $14)
+		RETURNING ` + campaignColumns
+
+	var result *repo.Campaign
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = scanCampaign(tx.QueryRowContext(ctx, query,
+			c.Code,
+			c.Name,
+			c.HotelID,
+			c.CreatedBy,
+			c.Type,
+			c.Percent,
+			c.Amount,
+			c.Currency,
+			c.ValidFrom,
+			c.ValidUntil,
+			c.MinNights,
+			c.MaxUses,
+			c.MaxUsesPerUser,
+			c.Stackable,
+		))
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityCampaign, result.ID, repo.AuditActionCreate, nil, result)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "campaign.create", err)
+	}
+
+	return result, nil
+}
+
+func (ur *campaignRepo) Get(ctx context.Context, id int64) (*repo.Campaign, error) {
+	ctx, span := startQuery(ctx, "campaign.get")
+	defer span.End()
+
+	result, err := scanCampaign(ur.db.QueryRowContext(ctx,
+		`SELECT `+campaignColumns+` FROM campaigns WHERE id=$1 AND `+activeRows, id))
+	if err != nil {
+		return nil, logQueryError(ctx, "campaign.get", err)
+	}
+
+	return result, nil
+}
+
+func (ur *campaignRepo) GetAll(ctx context.Context, params *repo.GetAllCampaignsParams) ([]*repo.Campaign, error) {
+	ctx, span := startQuery(ctx, "campaign.get_all")
+	defer span.End()
+
+	filter := where("", activeRows)
+	var args []interface{}
+
+	if params.PartnerID != 0 {
+		args = append(args, params.PartnerID)
+		filter = where(filter, "hotel_id IN (SELECT id FROM hotels WHERE user_id=$"+strconv.Itoa(len(args))+")")
+	}
+
+	if params.HotelID != 0 {
+		args = append(args, params.HotelID)
+		filter = where(filter, "hotel_id=$"+strconv.Itoa(len(args)))
+	}
+
+	return ur.list(ctx, "campaign.get_all", `SELECT `+campaignColumns+` FROM campaigns `+filter+` ORDER BY id`, args...)
+}
+
+func (ur *campaignRepo) GetByIDs(ctx context.Context, ids []int64) ([]*repo.Campaign, error) {
+	ctx, span := startQuery(ctx, "campaign.get_by_ids")
+	defer span.End()
+
+	return ur.list(ctx, "campaign.get_by_ids", `SELECT `+campaignColumns+` FROM campaigns WHERE id = ANY($1) ORDER BY id`, pq.Array(ids))
+}
+
+func (ur *campaignRepo) list(ctx context.Context, name, query string, args ...interface{}) ([]*repo.Campaign, error) {
+	rows, err := ur.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, logQueryError(ctx, name, err)
+	}
+	defer rows.Close()
+
+	result := make([]*repo.Campaign, 0)
+	for rows.Next() {
+		c, err := scanCampaign(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, name, err)
+		}
+		result = append(result, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, name, err)
+	}
+
+	return result, nil
+}
+
+func (ur *campaignRepo) GetApplicable(ctx context.Context, params *repo.GetApplicableCampaignsParams) ([]*repo.Campaign, error) {
+	ctx, span := startQuery(ctx, "campaign.get_applicable")
+	defer span.End()
+
+	query := `
+		SELECT ` + campaignColumns + `, ` + campaignUsage + `
+		FROM campaigns
+		WHERE deleted_at IS NULL AND (
+			(
+				code IS NULL
+				AND (hotel_id IS NULL OR hotel_id=$1)
+				AND (valid_from IS NULL OR valid_from <= $3)
+				AND (valid_until IS NULL OR valid_until > $3)
+			)
+			OR code=$4
+		)
+		ORDER BY id
+	`
+
+	rows, err := ur.db.QueryContext(ctx, query, params.HotelID, params.UserID, params.At, params.Code)
+	if err != nil {
+		return nil, logQueryError(ctx, "campaign.get_applicable", err)
+	}
+	defer rows.Close()
+
+	result := make([]*repo.Campaign, 0)
+	for rows.Next() {
+		var uses, userUses int
+
+		c, err := scanCampaign(rows, &uses, &userUses)
+		if err != nil {
+			return nil, logQueryError(ctx, "campaign.get_applicable", err)
+		}
+
+		c.Uses, c.UserUses = uses, userUses
+		result = append(result, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "campaign.get_applicable", err)
+	}
+
+	return result, nil
+}
+
+func (ur *campaignRepo) Update(ctx context.Context, c *repo.Campaign) (*repo.Campaign, error) {
+	ctx, span := startQuery(ctx, "campaign.update")
+	defer span.End()
+
+	query := `
+		UPDATE campaigns SET
+			code=NULLIF($1, ''),
+			name=$2,
+			hotel_id=$3,
+			type=$4,
+			percent=NULLIF($5, '')::NUMERIC,
+			amount=NULLIF($6, 0),
+			currency=NULLIF($7, ''),
+			valid_from=$8,
+			valid_until=$9,
+			min_nights=$10,
+			max_uses=$11,
+			max_uses_per_user=$12,
+			stackable=$13,
+			updated_at=CURRENT_TIMESTAMP
+		WHERE id=$14
+		RETURNING ` + campaignColumns
+
+	var result *repo.Campaign
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := scanCampaign(tx.QueryRowContext(ctx,
+			`SELECT `+campaignColumns+` FROM campaigns WHERE id=$1 AND `+activeRows+` FOR UPDATE`, c.ID))
+		if err != nil {
+			return err
+		}
+
+		result, err = scanCampaign(tx.QueryRowContext(ctx, query,
+			c.Code,
+			c.Name,
+			c.HotelID,
+			c.Type,
+			c.Percent,
+			c.Amount,
+			c.Currency,
+			c.ValidFrom,
+			c.ValidUntil,
+			c.MinNights,
+			c.MaxUses,
+			c.MaxUsesPerUser,
+			c.Stackable,
+			c.ID,
+		))
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityCampaign, c.ID, repo.AuditActionUpdate, before, result)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "campaign.update", err)
+	}
+
+	return result, nil
+}
+
+// Delete ends a campaign. Its redemptions are kept for the reports.
+func (ur *campaignRepo) Delete(ctx context.Context, id int64) error {
+	ctx, span := startQuery(ctx, "campaign.delete")
+	defer span.End()
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := scanCampaign(tx.QueryRowContext(ctx,
+			`SELECT `+campaignColumns+` FROM campaigns WHERE id=$1 AND `+activeRows+` FOR UPDATE`, id))
+		if err != nil {
+			return err
+		}
+
+		after, err := scanCampaign(tx.QueryRowContext(ctx,
+			`UPDATE campaigns SET deleted_at=CURRENT_TIMESTAMP WHERE id=$1 RETURNING `+campaignColumns, id))
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityCampaign, id, repo.AuditActionDelete, before, after)
+	})
+
+	return logQueryError(ctx, "campaign.delete", err)
+}
+
+func (ur *campaignRepo) GetRedemptions(ctx context.Context, campaignID int64) ([]*repo.Redemption, error) {
+	ctx, span := startQuery(ctx, "campaign.get_redemptions")
+	defer span.End()
+
+	query := `
+		SELECT
+			r.id,
+			r.campaign_id,
+			r.booking_id,
+			r.user_id,
+			r.amount,
+			r.currency,
+			b.status='cancelled' OR b.deleted_at IS NOT NULL,
+			r.created_at
+		FROM campaign_redemptions r
+		JOIN bookings b ON b.id=r.booking_id
+		WHERE r.campaign_id=$1
+		ORDER BY r.id
+	`
+
+	rows, err := ur.db.QueryContext(ctx, query, campaignID)
+	if err != nil {
+		return nil, logQueryError(ctx, "campaign.get_redemptions", err)
+	}
+	defer rows.Close()
+
+	result := make([]*repo.Redemption, 0)
+	for rows.Next() {
+		var r repo.Redemption
+
+		err := rows.Scan(&r.ID, &r.CampaignID, &r.BookingID, &r.UserID, &r.Amount, &r.Currency, &r.Cancelled, &r.CreatedAt)
+		if err != nil {
+			return nil, logQueryError(ctx, "campaign.get_redemptions", err)
+		}
+		result = append(result, &r)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "campaign.get_redemptions", err)
+	}
+
+	return result, nil
+}
+
+// redeem records the campaigns among the charges of a new booking. The
+// campaign row is locked while its caps are checked, so concurrent bookings
+// cannot both take the last use.
+func redeem(ctx context.Context, tx *sqlx.Tx, booking *repo.Booking) error {
+	for _, charge := range booking.Charges {
+		if charge.CampaignID == 0 {
+			continue
+		}
+
+		var maxUses, maxUsesPerUser, uses, userUses int
+
+		err := tx.QueryRowContext(ctx, `
+			SELECT max_uses, max_uses_per_user, `+campaignUsage+`
+			FROM campaigns WHERE id=$1 FOR UPDATE
+		`, charge.CampaignID, booking.UserId).Scan(&maxUses, &maxUsesPerUser, &uses, &userUses)
+		if err != nil {
+			return err
+		}
+
+		if (maxUses > 0 && uses >= maxUses) || (maxUsesPerUser > 0 && userUses >= maxUsesPerUser) {
+			return repo.ErrCampaignExhausted
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO campaign_redemptions(campaign_id, booking_id, user_id, amount, currency)
+			VALUES($1, $2, $3, $4, $5)
+		`, charge.CampaignID, booking.ID, booking.UserId, -charge.Amount, booking.Currency)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// syncRedemptions brings the redemptions of a repriced booking in line with
+// its charges. Campaigns are not added to existing bookings, only their
+// amounts change or they are dropped.
+func syncRedemptions(ctx context.Context, tx *sqlx.Tx, booking *repo.Booking) error {
+	ids := []int64{}
+	for _, charge := range booking.Charges {
+		if charge.CampaignID == 0 {
+			continue
+		}
+
+		ids = append(ids, charge.CampaignID)
+		_, err := tx.ExecContext(ctx, `
+			UPDATE campaign_redemptions SET amount=$1, currency=$2, user_id=$3
+			WHERE booking_id=$4 AND campaign_id=$5
+		`, -charge.Amount, booking.Currency, booking.UserId, booking.ID, charge.CampaignID)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`DELETE FROM campaign_redemptions WHERE booking_id=$1 AND NOT (campaign_id = ANY($2))`, booking.ID, pq.Array(ids))
+	return err
+}
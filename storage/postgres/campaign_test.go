@@ -0,0 +1,118 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCampaign(t *testing.T) {
+	hotel := createHotel(t)
+	hotelID := hotel.ID
+
+	campaign, err := strg.Campaign().Create(context.Background(), &repo.Campaign{
+		Name:      "Summer sale",
+		HotelID:   &hotelID,
+		CreatedBy: hotel.UserID,
+		Type:      repo.CampaignTypePercent,
+		Percent:   "15",
+		Stackable: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "15.0000", campaign.Percent)
+	require.Empty(t, campaign.Code)
+
+	campaign.Name = "Late summer sale"
+	updated, err := strg.Campaign().Update(context.Background(), campaign)
+	require.NoError(t, err)
+	require.Equal(t, "Late summer sale", updated.Name)
+
+	list, err := strg.Campaign().GetAll(context.Background(), &repo.GetAllCampaignsParams{PartnerID: hotel.UserID})
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+
+	require.NoError(t, strg.Campaign().Delete(context.Background(), campaign.ID))
+	_, err = strg.Campaign().Get(context.Background(), campaign.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	deleted, err := strg.Campaign().GetByIDs(context.Background(), []int64{campaign.ID})
+	require.NoError(t, err)
+	require.Len(t, deleted, 1)
+}
+
+func TestCampaignRedemptions(t *testing.T) {
+	booking := createBooking(t)
+	code := fmt.Sprintf("ONCE%d", booking.ID)
+
+	campaign, err := strg.Campaign().Create(context.Background(), &repo.Campaign{
+		Code:      code,
+		Name:      "One off",
+		CreatedBy: int64(booking.UserId),
+		Type:      repo.CampaignTypeFixed,
+		Amount:    1000,
+		Currency:  "EUR",
+		MaxUses:   1,
+	})
+	require.NoError(t, err)
+
+	discounted := func(b *repo.Booking) *repo.Booking {
+		return &repo.Booking{
+			RoomId:         b.RoomId,
+			UserId:         b.UserId,
+			HotelId:        b.HotelId,
+			FromDate:       b.FromDate,
+			Price:          b.Price,
+			Currency:       b.Currency,
+			ExchangeRate:   b.ExchangeRate,
+			CommissionRate: b.CommissionRate,
+			Guests:         b.Guests,
+			Charges: []repo.BookingCharge{
+				{CampaignID: campaign.ID, Name: "One off", Kind: repo.ChargeKindDiscount, Quantity: 1, UnitAmount: -1000, Amount: -1000},
+			},
+			Total: b.Price - 1000,
+		}
+	}
+
+	first, err := strg.Booking().Create(context.Background(), discounted(booking))
+	require.NoError(t, err)
+
+	applicable, err := strg.Campaign().GetApplicable(context.Background(), &repo.GetApplicableCampaignsParams{
+		HotelID: int64(booking.HotelId),
+		UserID:  int64(booking.UserId),
+		At:      time.Now(),
+		Code:    code,
+	})
+	require.NoError(t, err)
+
+	var found *repo.Campaign
+	for _, c := range applicable {
+		if c.ID == campaign.ID {
+			found = c
+		}
+	}
+	require.NotNil(t, found)
+	require.Equal(t, 1, found.Uses)
+	require.Equal(t, 1, found.UserUses)
+
+	_, err = strg.Booking().Create(context.Background(), discounted(booking))
+	require.ErrorIs(t, err, repo.ErrCampaignExhausted)
+
+	// a cancelled booking gives its use back
+	_, err = strg.Booking().SetStatus(context.Background(), first.ID, repo.BookingStatusCancelled)
+	require.NoError(t, err)
+
+	_, err = strg.Booking().Create(context.Background(), discounted(booking))
+	require.NoError(t, err)
+
+	redemptions, err := strg.Campaign().GetRedemptions(context.Background(), campaign.ID)
+	require.NoError(t, err)
+	require.Len(t, redemptions, 2)
+	require.True(t, redemptions[0].Cancelled)
+	require.Equal(t, int64(1000), redemptions[1].Amount)
+	require.Equal(t, "EUR", redemptions[1].Currency)
+}
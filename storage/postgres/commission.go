@@ -0,0 +1,630 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/money"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type commissionRepo struct {
+	db *sqlx.DB
+}
+
+func NewCommission(db *sqlx.DB) repo.CommissionStorageI {
+	return &commissionRepo{
+		db: db,
+	}
+}
+
+const commissionEntryColumns = `
+	id,
+	partner_id,
+	hotel_id,
+	booking_id,
+	refund_id,
+	kind,
+	rate::TEXT,
+	base,
+	amount,
+	currency,
+	note,
+	created_by,
+	payout_id,
+	created_at
+`
+
+const payoutColumns = `
+	id,
+	partner_id,
+	currency,
+	period_from,
+	period_until,
+	gross,
+	commission,
+	amount,
+	status,
+	reference,
+	created_by,
+	settled_by,
+	settled_at,
+	created_at
+`
+
+func scanCommissionRate(row interface{ Scan(...interface{}) error }) (*repo.CommissionRate, error) {
+	var result repo.CommissionRate
+
+	err := row.Scan(&result.PartnerID, &result.Rate, &result.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func scanCommissionEntry(row interface{ Scan(...interface{}) error }) (*repo.CommissionEntry, error) {
+	var result repo.CommissionEntry
+
+	err := row.Scan(
+		&result.ID,
+		&result.PartnerID,
+		&result.HotelID,
+		&result.BookingID,
+		&result.RefundID,
+		&result.Kind,
+		&result.Rate,
+		&result.Base,
+		&result.Amount,
+		&result.Currency,
+		&result.Note,
+		&result.CreatedBy,
+		&result.PayoutID,
+		&result.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func scanPayout(row interface{ Scan(...interface{}) error }) (*repo.Payout, error) {
+	var result repo.Payout
+
+	err := row.Scan(
+		&result.ID,
+		&result.PartnerID,
+		&result.Currency,
+		&result.PeriodFrom,
+		&result.PeriodUntil,
+		&result.Gross,
+		&result.Commission,
+		&result.Amount,
+		&result.Status,
+		&result.Reference,
+		&result.CreatedBy,
+		&result.SettledBy,
+		&result.SettledAt,
+		&result.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (ur *commissionRepo) GetRate(ctx context.Context, partnerID int64) (*repo.CommissionRate, error) {
+	ctx, span := startQuery(ctx, "commission.get_rate")
+	defer span.End()
+
+	result, err := scanCommissionRate(ur.db.QueryRowContext(ctx,
+		`SELECT partner_id, rate::TEXT, updated_at FROM commission_rates WHERE partner_id=$1`, partnerID))
+	if err != nil {
+		return nil, logQueryError(ctx, "commission.get_rate", err)
+	}
+
+	return result, nil
+}
+
+func (ur *commissionRepo) getRate(ctx context.Context, tx *sqlx.Tx, partnerID int64) (*repo.CommissionRate, error) {
+	return scanCommissionRate(tx.QueryRowContext(ctx,
+		`SELECT partner_id, rate::TEXT, updated_at FROM commission_rates WHERE partner_id=$1 FOR UPDATE`, partnerID))
+}
+
+func (ur *commissionRepo) SetRate(ctx context.Context, rate *repo.CommissionRate) (*repo.CommissionRate, error) {
+	ctx, span := startQuery(ctx, "commission.set_rate")
+	defer span.End()
+
+	query := `
+		INSERT INTO commission_rates(partner_id, rate) VALUES($1, $2)
+		ON CONFLICT (partner_id) DO UPDATE SET
+			rate=EXCLUDED.rate,
+			updated_at=CURRENT_TIMESTAMP
+		RETURNING partner_id, rate::TEXT, updated_at
+	`
+
+	var result *repo.CommissionRate
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.getRate(ctx, tx, rate.PartnerID)
+		if errors.Is(err, sql.ErrNoRows) {
+			before = nil
+		} else if err != nil {
+			return err
+		}
+
+		result, err = scanCommissionRate(tx.QueryRowContext(ctx, query, rate.PartnerID, rate.Rate))
+		if err != nil {
+			return err
+		}
+
+		action := repo.AuditActionUpdate
+		if before == nil {
+			action = repo.AuditActionCreate
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityCommission, rate.PartnerID, action, before, result)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "commission.set_rate", err)
+	}
+
+	return result, nil
+}
+
+func (ur *commissionRepo) DeleteRate(ctx context.Context, partnerID int64) error {
+	ctx, span := startQuery(ctx, "commission.delete_rate")
+	defer span.End()
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.getRate(ctx, tx, partnerID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM commission_rates WHERE partner_id=$1`, partnerID)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityCommission, partnerID, repo.AuditActionDelete, before, nil)
+	})
+
+	return logQueryError(ctx, "commission.delete_rate", err)
+}
+
+func (ur *commissionRepo) GetEntries(ctx context.Context, params *repo.GetCommissionEntriesParams) ([]*repo.CommissionEntry, error) {
+	ctx, span := startQuery(ctx, "commission.get_entries")
+	defer span.End()
+
+	var (
+		filter string
+		args   []interface{}
+	)
+
+	if params.PartnerID != 0 {
+		args = append(args, params.PartnerID)
+		filter = where(filter, "partner_id=$"+strconv.Itoa(len(args)))
+	}
+
+	if params.BookingID != 0 {
+		args = append(args, params.BookingID)
+		filter = where(filter, "booking_id=$"+strconv.Itoa(len(args)))
+	}
+
+	if params.PayoutID != 0 {
+		args = append(args, params.PayoutID)
+		filter = where(filter, "payout_id=$"+strconv.Itoa(len(args)))
+	}
+
+	if params.Unpaid {
+		filter = where(filter, "payout_id IS NULL")
+	}
+
+	limit := ""
+	if params.Limit > 0 {
+		limit = fmt.Sprintf(" LIMIT %d OFFSET %d ", params.Limit, (params.Page-1)*params.Limit)
+	}
+
+	rows, err := ur.db.QueryContext(ctx, `SELECT `+commissionEntryColumns+` FROM commission_entries `+filter+` ORDER BY id`+limit, args...)
+	if err != nil {
+		return nil, logQueryError(ctx, "commission.get_entries", err)
+	}
+	defer rows.Close()
+
+	result := make([]*repo.CommissionEntry, 0)
+	for rows.Next() {
+		entry, err := scanCommissionEntry(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "commission.get_entries", err)
+		}
+		result = append(result, entry)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "commission.get_entries", err)
+	}
+
+	return result, nil
+}
+
+func (ur *commissionRepo) Adjust(ctx context.Context, entry *repo.CommissionEntry) (*repo.CommissionEntry, error) {
+	ctx, span := startQuery(ctx, "commission.adjust")
+	defer span.End()
+
+	query := `
+		INSERT INTO commission_entries(partner_id, hotel_id, booking_id, kind, rate, base, amount, currency, note, created_by)
+		SELECT e.partner_id, e.hotel_id, e.booking_id, $2, e.rate, 0, $3, b.currency, $4, $5
+		FROM commission_entries e
+		JOIN bookings b ON b.id=e.booking_id
+		WHERE e.booking_id=$1 AND e.kind='earned'
+		RETURNING ` + commissionEntryColumns
+
+	var result *repo.CommissionEntry
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = scanCommissionEntry(tx.QueryRowContext(ctx, query,
+			entry.BookingID,
+			repo.CommissionKindAdjusted,
+			entry.Amount,
+			entry.Note,
+			entry.CreatedBy,
+		))
+		if errors.Is(err, sql.ErrNoRows) {
+			return repo.ErrNoCommission
+		}
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityCommission, result.PartnerID, repo.AuditActionCreate, nil, result)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "commission.adjust", err)
+	}
+
+	return result, nil
+}
+
+// CreatePayouts assigns the entries first and sums up what was assigned, so
+// entries committed meanwhile are either fully on a payout or left for the
+// next one. The table lock keeps two runs from splitting the entries.
+func (ur *commissionRepo) CreatePayouts(ctx context.Context, until time.Time, createdBy int64) ([]*repo.Payout, error) {
+	ctx, span := startQuery(ctx, "commission.create_payouts")
+	defer span.End()
+
+	result := make([]*repo.Payout, 0)
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, `LOCK TABLE payouts IN SHARE ROW EXCLUSIVE MODE`)
+		if err != nil {
+			return err
+		}
+
+		rows, err := tx.QueryContext(ctx, `
+			INSERT INTO payouts(partner_id, currency, period_from, period_until, created_by)
+			SELECT partner_id, currency, min(created_at), $1, $2
+			FROM commission_entries
+			WHERE payout_id IS NULL AND created_at < $1
+			GROUP BY partner_id, currency
+			ORDER BY partner_id, currency
+			RETURNING id
+		`, until, createdBy)
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(ids) == 0 {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			UPDATE commission_entries e SET payout_id=p.id
+			FROM payouts p
+			WHERE p.id = ANY($1)
+				AND e.partner_id=p.partner_id AND e.currency=p.currency
+				AND e.payout_id IS NULL AND e.created_at < $2
+		`, pq.Array(ids), until)
+		if err != nil {
+			return err
+		}
+
+		rows, err = tx.QueryContext(ctx, `
+			UPDATE payouts SET
+				period_from=s.first_entry,
+				gross=s.base,
+				commission=s.commission_sum,
+				amount=s.base-s.commission_sum
+			FROM (
+				SELECT payout_id, min(created_at) AS first_entry, sum(base) AS base, sum(amount) AS commission_sum
+				FROM commission_entries
+				WHERE payout_id = ANY($1)
+				GROUP BY payout_id
+			) s
+			WHERE payouts.id=s.payout_id
+			RETURNING `+payoutColumns, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+
+		for rows.Next() {
+			payout, err := scanPayout(rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			result = append(result, payout)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, payout := range result {
+			err = writeAudit(ctx, tx, repo.AuditEntityPayout, payout.ID, repo.AuditActionCreate, nil, payout)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "commission.create_payouts", err)
+	}
+
+	return result, nil
+}
+
+func (ur *commissionRepo) GetPayout(ctx context.Context, id int64) (*repo.Payout, error) {
+	ctx, span := startQuery(ctx, "commission.get_payout")
+	defer span.End()
+
+	result, err := scanPayout(ur.db.QueryRowContext(ctx, `SELECT `+payoutColumns+` FROM payouts WHERE id=$1`, id))
+	if err != nil {
+		return nil, logQueryError(ctx, "commission.get_payout", err)
+	}
+
+	return result, nil
+}
+
+func (ur *commissionRepo) GetAllPayouts(ctx context.Context, params *repo.GetAllPayoutsParams) ([]*repo.Payout, error) {
+	ctx, span := startQuery(ctx, "commission.get_all_payouts")
+	defer span.End()
+
+	var (
+		filter string
+		args   []interface{}
+	)
+
+	if params.PartnerID != 0 {
+		args = append(args, params.PartnerID)
+		filter = where(filter, "partner_id=$"+strconv.Itoa(len(args)))
+	}
+
+	if params.Status != "" {
+		args = append(args, params.Status)
+		filter = where(filter, "status=$"+strconv.Itoa(len(args)))
+	}
+
+	rows, err := ur.db.QueryContext(ctx, `SELECT `+payoutColumns+` FROM payouts `+filter+` ORDER BY id DESC`, args...)
+	if err != nil {
+		return nil, logQueryError(ctx, "commission.get_all_payouts", err)
+	}
+	defer rows.Close()
+
+	result := make([]*repo.Payout, 0)
+	for rows.Next() {
+		payout, err := scanPayout(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "commission.get_all_payouts", err)
+		}
+		result = append(result, payout)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "commission.get_all_payouts", err)
+	}
+
+	return result, nil
+}
+
+func (ur *commissionRepo) SettlePayout(ctx context.Context, id, settledBy int64, reference string) (*repo.Payout, error) {
+	ctx, span := startQuery(ctx, "commission.settle_payout")
+	defer span.End()
+
+	var result *repo.Payout
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := scanPayout(tx.QueryRowContext(ctx, `SELECT `+payoutColumns+` FROM payouts WHERE id=$1 FOR UPDATE`, id))
+		if err != nil {
+			return err
+		}
+
+		if before.Status == repo.PayoutStatusSettled {
+			return repo.ErrPayoutSettled
+		}
+
+		result, err = scanPayout(tx.QueryRowContext(ctx, `
+			UPDATE payouts SET status=$1, reference=$2, settled_by=$3, settled_at=CURRENT_TIMESTAMP
+			WHERE id=$4
+			RETURNING `+payoutColumns, repo.PayoutStatusSettled, reference, settledBy, id))
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityPayout, id, repo.AuditActionUpdate, before, result)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "commission.settle_payout", err)
+	}
+
+	return result, nil
+}
+
+// commissionOn is rate percent of amount, rounded like prices are.
+func commissionOn(amount int64, rate string) (int64, error) {
+	r, ok := new(big.Rat).SetString(rate)
+	if !ok {
+		return 0, fmt.Errorf("invalid commission rate %q", rate)
+	}
+
+	return money.Round(r.Mul(r, big.NewRat(amount, 100))), nil
+}
+
+// earnCommission records the commission of a booking that has just been
+// confirmed, payable by the partner owning its hotel.
+func earnCommission(ctx context.Context, tx *sqlx.Tx, booking *repo.Booking) error {
+	amount, err := commissionOn(booking.Total, booking.CommissionRate)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO commission_entries(partner_id, hotel_id, booking_id, kind, rate, base, amount, currency)
+		SELECT user_id, id, $2, $3, $4, $5, $6, $7 FROM hotels WHERE id=$1
+	`, booking.HotelId, booking.ID, repo.CommissionKindEarned, booking.CommissionRate, booking.Total, amount, booking.Currency)
+	return err
+}
+
+// refundCommission gives back the commission on a refund that succeeded, at
+// the rate the booking earned it at. Bookings refunded before they were
+// confirmed never earned any.
+func refundCommission(ctx context.Context, tx *sqlx.Tx, payment *repo.Payment, refund *repo.Refund) error {
+	var partnerID, hotelID int64
+	var rate string
+
+	err := tx.QueryRowContext(ctx,
+		`SELECT partner_id, hotel_id, rate::TEXT FROM commission_entries WHERE booking_id=$1 AND kind='earned'`,
+		payment.BookingID).Scan(&partnerID, &hotelID, &rate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	amount, err := commissionOn(refund.Amount, rate)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO commission_entries(partner_id, hotel_id, booking_id, refund_id, kind, rate, base, amount, currency)
+		VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, partnerID, hotelID, payment.BookingID, refund.ID, repo.CommissionKindRefunded, rate, -refund.Amount, -amount, payment.Currency)
+	return err
+}
+
+// adjustCommission brings the commission of a confirmed booking in line with
+// its hotel, total and rate after it has been changed. What was earned in
+// another currency or for another hotel is reversed, and the rest is owed by
+// the partner who owns the hotel now. Refunds and adjustments made by hand are
+// left alone.
+func adjustCommission(ctx context.Context, tx *sqlx.Tx, booking *repo.Booking) error {
+	if booking.Status != repo.BookingStatusConfirmed {
+		return nil
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT partner_id, hotel_id, currency, sum(base), sum(amount)
+		FROM commission_entries
+		WHERE booking_id=$1 AND kind IN ('earned', 'adjusted') AND created_by IS NULL
+		GROUP BY partner_id, hotel_id, currency
+	`, booking.ID)
+	if err != nil {
+		return err
+	}
+
+	type earned struct {
+		partnerID, hotelID int64
+		currency           string
+		base, amount       int64
+	}
+
+	var sums []earned
+	for rows.Next() {
+		var e earned
+		if err := rows.Scan(&e.partnerID, &e.hotelID, &e.currency, &e.base, &e.amount); err != nil {
+			rows.Close()
+			return err
+		}
+		sums = append(sums, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// bookings confirmed before commissions existed earned nothing
+	if len(sums) == 0 {
+		return nil
+	}
+
+	amount, err := commissionOn(booking.Total, booking.CommissionRate)
+	if err != nil {
+		return err
+	}
+
+	target := earned{hotelID: int64(booking.HotelId), currency: booking.Currency}
+	err = tx.QueryRowContext(ctx, `SELECT user_id FROM hotels WHERE id=$1`, booking.HotelId).Scan(&target.partnerID)
+	if err != nil {
+		return err
+	}
+
+	adjustments := []earned{}
+
+	for _, e := range sums {
+		if e.hotelID == target.hotelID && e.currency == target.currency {
+			target.partnerID = e.partnerID
+			target.base, target.amount = e.base, e.amount
+			continue
+		}
+		adjustments = append(adjustments, earned{e.partnerID, e.hotelID, e.currency, -e.base, -e.amount})
+	}
+
+	adjustments = append(adjustments, earned{
+		target.partnerID, target.hotelID, booking.Currency,
+		booking.Total - target.base, amount - target.amount,
+	})
+
+	for _, a := range adjustments {
+		if a.base == 0 && a.amount == 0 {
+			continue
+		}
+
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO commission_entries(partner_id, hotel_id, booking_id, kind, rate, base, amount, currency)
+			VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+		`, a.partnerID, a.hotelID, booking.ID, repo.CommissionKindAdjusted, booking.CommissionRate, a.base, a.amount, a.currency)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
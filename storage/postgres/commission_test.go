@@ -0,0 +1,110 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCommissionRate(t *testing.T) {
+	partner := createUser(t)
+
+	_, err := strg.Commission().GetRate(context.Background(), partner.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	rate, err := strg.Commission().SetRate(context.Background(), &repo.CommissionRate{PartnerID: partner.ID, Rate: "12.5"})
+	require.NoError(t, err)
+	require.Equal(t, "12.5000", rate.Rate)
+
+	_, err = strg.Commission().SetRate(context.Background(), &repo.CommissionRate{PartnerID: partner.ID, Rate: "9"})
+	require.NoError(t, err)
+
+	rate, err = strg.Commission().GetRate(context.Background(), partner.ID)
+	require.NoError(t, err)
+	require.Equal(t, "9.0000", rate.Rate)
+
+	require.NoError(t, strg.Commission().DeleteRate(context.Background(), partner.ID))
+	require.ErrorIs(t, strg.Commission().DeleteRate(context.Background(), partner.ID), sql.ErrNoRows)
+}
+
+func TestCommissionLedger(t *testing.T) {
+	booking := createBooking(t)
+
+	_, err := strg.Commission().Adjust(context.Background(), &repo.CommissionEntry{BookingID: booking.ID, Amount: 100, Note: "too early"})
+	require.ErrorIs(t, err, repo.ErrNoCommission)
+
+	_, err = strg.Booking().SetStatus(context.Background(), booking.ID, repo.BookingStatusConfirmed)
+	require.NoError(t, err)
+
+	entries, err := strg.Commission().GetEntries(context.Background(), &repo.GetCommissionEntriesParams{BookingID: booking.ID})
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, repo.CommissionKindEarned, entries[0].Kind)
+	require.Equal(t, int64(12500), entries[0].Base)
+	require.Equal(t, int64(1250), entries[0].Amount)
+	require.Equal(t, "EUR", entries[0].Currency)
+
+	partnerID := entries[0].PartnerID
+	adjusted, err := strg.Commission().Adjust(context.Background(), &repo.CommissionEntry{
+		BookingID: booking.ID,
+		Amount:    -250,
+		Note:      "Goodwill credit",
+		CreatedBy: &partnerID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, repo.CommissionKindAdjusted, adjusted.Kind)
+	require.Equal(t, partnerID, adjusted.PartnerID)
+
+	payouts, err := strg.Commission().CreatePayouts(context.Background(), time.Now().Add(time.Second), partnerID)
+	require.NoError(t, err)
+
+	var payout *repo.Payout
+	for _, p := range payouts {
+		if p.PartnerID == partnerID {
+			payout = p
+		}
+	}
+	require.NotNil(t, payout)
+	require.Equal(t, repo.PayoutStatusPending, payout.Status)
+	require.Equal(t, int64(12500), payout.Gross)
+	require.Equal(t, int64(1000), payout.Commission)
+	require.Equal(t, int64(11500), payout.Amount)
+
+	unpaid, err := strg.Commission().GetEntries(context.Background(), &repo.GetCommissionEntriesParams{PartnerID: partnerID, Unpaid: true})
+	require.NoError(t, err)
+	require.Empty(t, unpaid)
+
+	settled, err := strg.Commission().SettlePayout(context.Background(), payout.ID, partnerID, "SEPA-1")
+	require.NoError(t, err)
+	require.Equal(t, repo.PayoutStatusSettled, settled.Status)
+	require.Equal(t, "SEPA-1", settled.Reference)
+
+	_, err = strg.Commission().SettlePayout(context.Background(), payout.ID, partnerID, "SEPA-2")
+	require.ErrorIs(t, err, repo.ErrPayoutSettled)
+
+	moved := createBooking(t)
+	confirmed, err := strg.Booking().SetStatus(context.Background(), moved.ID, repo.BookingStatusConfirmed)
+	require.NoError(t, err)
+
+	hotel := createHotel(t)
+	_, err = strg.Booking().Patch(context.Background(), moved.ID, confirmed.Version, map[string]interface{}{
+		"hotel_id":        hotel.ID,
+		"commission_rate": "20",
+	})
+	require.NoError(t, err)
+
+	entries, err = strg.Commission().GetEntries(context.Background(), &repo.GetCommissionEntriesParams{BookingID: moved.ID})
+	require.NoError(t, err)
+
+	net := map[int64]int64{}
+	for _, e := range entries {
+		net[e.PartnerID] += e.Amount
+	}
+	require.Len(t, net, 2)
+	require.Equal(t, int64(0), net[entries[0].PartnerID])
+	require.Equal(t, int64(2500), net[hotel.UserID])
+}
@@ -0,0 +1,162 @@
+package postgres
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/jmoiron/sqlx"
+)
+
+type documentRepo struct {
+	db *sqlx.DB
+}
+
+func NewDocument(db *sqlx.DB) repo.DocumentStorageI {
+	return &documentRepo{
+		db: db,
+	}
+}
+
+const documentColumns = `
+	id,
+	owner_id,
+	kind,
+	hotel_id,
+	booking_id,
+	checksum,
+	file_name,
+	content_type,
+	size,
+	created_at
+`
+
+func scanDocument(row interface{ Scan(...interface{}) error }) (*repo.Document, error) {
+	var result repo.Document
+
+	err := row.Scan(
+		&result.ID,
+		&result.OwnerID,
+		&result.Kind,
+		&result.HotelID,
+		&result.BookingID,
+		&result.Checksum,
+		&result.FileName,
+		&result.ContentType,
+		&result.Size,
+		&result.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (ur *documentRepo) Create(ctx context.Context, d *repo.Document) (*repo.Document, error) {
+	ctx, span := startQuery(ctx, "document.create")
+	defer span.End()
+
+	query := `
+		INSERT INTO documents(
+			owner_id,
+			kind,
+			hotel_id,
+			booking_id,
+			checksum,
+			file_name,
+			content_type,
+			size
+		) VALUES($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowContext(
+			ctx,
+			query,
+			d.OwnerID,
+			d.Kind,
+			d.HotelID,
+			d.BookingID,
+			d.Checksum,
+			d.FileName,
+			d.ContentType,
+			d.Size,
+		)
+
+		err := row.Scan(&d.ID, &d.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityDocument, d.ID, repo.AuditActionCreate, nil, d)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "document.create", err)
+	}
+
+	return d, nil
+}
+
+func (ur *documentRepo) Get(ctx context.Context, id int64) (*repo.Document, error) {
+	ctx, span := startQuery(ctx, "document.get")
+	defer span.End()
+
+	query := "SELECT " + documentColumns + " FROM documents WHERE id=$1"
+
+	result, err := scanDocument(ur.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, logQueryError(ctx, "document.get", err)
+	}
+
+	return result, nil
+}
+
+func (ur *documentRepo) GetAll(ctx context.Context, params *repo.GetAllDocumentsParams) ([]*repo.Document, error) {
+	ctx, span := startQuery(ctx, "document.get_all")
+	defer span.End()
+
+	var (
+		filter string
+		args   []interface{}
+	)
+
+	if params.HotelID != nil {
+		args = append(args, *params.HotelID)
+		filter = where(filter, "hotel_id=$"+strconv.Itoa(len(args)))
+	}
+
+	if params.BookingID != nil {
+		args = append(args, *params.BookingID)
+		filter = where(filter, "booking_id=$"+strconv.Itoa(len(args)))
+	}
+
+	if params.Kind != "" {
+		args = append(args, params.Kind)
+		filter = where(filter, "kind=$"+strconv.Itoa(len(args)))
+	}
+
+	query := "SELECT " + documentColumns + " FROM documents " + filter + " ORDER BY id"
+
+	rows, err := ur.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, logQueryError(ctx, "document.get_all", err)
+	}
+	defer rows.Close()
+
+	result := make([]*repo.Document, 0)
+	for rows.Next() {
+		d, err := scanDocument(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "document.get_all", err)
+		}
+		result = append(result, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "document.get_all", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,50 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateDocument(t *testing.T) {
+	hotel := createHotel(t)
+	checksum := uuid.NewString() + uuid.NewString()
+
+	doc, err := strg.Document().Create(context.Background(), &repo.Document{
+		OwnerID:     hotel.UserID,
+		Kind:        repo.DocumentKindContract,
+		HotelID:     hotel.ID,
+		Checksum:    checksum[:64],
+		FileName:    uuid.NewString() + ".pdf",
+		ContentType: "application/pdf",
+		Size:        2048,
+	})
+	require.NoError(t, err)
+	require.NotZero(t, doc.ID)
+
+	got, err := strg.Document().Get(context.Background(), doc.ID)
+	require.NoError(t, err)
+	require.Equal(t, doc.FileName, got.FileName)
+
+	docs, err := strg.Document().GetAll(context.Background(), &repo.GetAllDocumentsParams{
+		HotelID: &hotel.ID,
+		Kind:    repo.DocumentKindContract,
+	})
+	require.NoError(t, err)
+	require.Len(t, docs, 1)
+
+	// identity documents need a booking
+	_, err = strg.Document().Create(context.Background(), &repo.Document{
+		OwnerID:     hotel.UserID,
+		Kind:        repo.DocumentKindIdentity,
+		HotelID:     hotel.ID,
+		Checksum:    checksum[:64],
+		FileName:    uuid.NewString() + ".pdf",
+		ContentType: "application/pdf",
+		Size:        2048,
+	})
+	require.Error(t, err)
+}
@@ -0,0 +1,201 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/jmoiron/sqlx"
+)
+
+type exchangeRateRepo struct {
+	db *sqlx.DB
+}
+
+func NewExchangeRate(db *sqlx.DB) repo.ExchangeRateStorageI {
+	return &exchangeRateRepo{
+		db: db,
+	}
+}
+
+// Rates are audited under the id 0, the currency is part of the snapshot.
+const exchangeRateAuditID = 0
+
+func scanExchangeRate(row interface{ Scan(...interface{}) error }) (*repo.ExchangeRate, error) {
+	var result repo.ExchangeRate
+
+	err := row.Scan(&result.Currency, &result.Rate, &result.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (ur *exchangeRateRepo) GetAll(ctx context.Context) ([]*repo.ExchangeRate, error) {
+	ctx, span := startQuery(ctx, "exchange_rate.get_all")
+	defer span.End()
+
+	rows, err := ur.db.QueryContext(ctx, `SELECT currency, rate::TEXT, updated_at FROM exchange_rates ORDER BY currency`)
+	if err != nil {
+		return nil, logQueryError(ctx, "exchange_rate.get_all", err)
+	}
+	defer rows.Close()
+
+	result := make([]*repo.ExchangeRate, 0)
+	for rows.Next() {
+		rate, err := scanExchangeRate(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "exchange_rate.get_all", err)
+		}
+		result = append(result, rate)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "exchange_rate.get_all", err)
+	}
+
+	return result, nil
+}
+
+func (ur *exchangeRateRepo) get(ctx context.Context, tx *sqlx.Tx, currency string) (*repo.ExchangeRate, error) {
+	return scanExchangeRate(tx.QueryRowContext(ctx,
+		`SELECT currency, rate::TEXT, updated_at FROM exchange_rates WHERE currency=$1 FOR UPDATE`, currency))
+}
+
+func (ur *exchangeRateRepo) Set(ctx context.Context, rate *repo.ExchangeRate) (*repo.ExchangeRate, error) {
+	ctx, span := startQuery(ctx, "exchange_rate.set")
+	defer span.End()
+
+	query := `
+		INSERT INTO exchange_rates(currency, rate) VALUES($1, $2)
+		ON CONFLICT (currency) DO UPDATE SET
+			rate=EXCLUDED.rate,
+			updated_at=CURRENT_TIMESTAMP
+		RETURNING currency, rate::TEXT, updated_at
+	`
+
+	var result *repo.ExchangeRate
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, rate.Currency)
+		if errors.Is(err, sql.ErrNoRows) {
+			before = nil
+		} else if err != nil {
+			return err
+		}
+
+		result, err = scanExchangeRate(tx.QueryRowContext(ctx, query, rate.Currency, rate.Rate))
+		if err != nil {
+			return err
+		}
+
+		action := repo.AuditActionUpdate
+		if before == nil {
+			action = repo.AuditActionCreate
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityExchangeRate, exchangeRateAuditID, action, before, result)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "exchange_rate.set", err)
+	}
+
+	return result, nil
+}
+
+func (ur *exchangeRateRepo) Delete(ctx context.Context, currency string) error {
+	ctx, span := startQuery(ctx, "exchange_rate.delete")
+	defer span.End()
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, currency)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM exchange_rates WHERE currency=$1`, currency)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityExchangeRate, exchangeRateAuditID, repo.AuditActionDelete, before, nil)
+	})
+
+	return logQueryError(ctx, "exchange_rate.delete", err)
+}
+
+func (ur *exchangeRateRepo) Rebase(ctx context.Context, base string) error {
+	ctx, span := startQuery(ctx, "exchange_rate.rebase")
+	defer span.End()
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		var old string
+		err := tx.QueryRowContext(ctx, `SELECT currency FROM currency_base FOR UPDATE`).Scan(&old)
+		if err != nil {
+			return err
+		}
+
+		if old == base {
+			return nil
+		}
+
+		// units of the new base one unit of the old base buys
+		var rate string
+		err = tx.QueryRowContext(ctx, `SELECT rate::TEXT FROM exchange_rates WHERE currency=$1`, base).Scan(&rate)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			// fine as long as there is nothing to convert
+			var used bool
+			err = tx.QueryRowContext(ctx,
+				`SELECT EXISTS (SELECT 1 FROM exchange_rates) OR EXISTS (SELECT 1 FROM bookings)`).Scan(&used)
+			if err != nil {
+				return err
+			}
+			if used {
+				return fmt.Errorf("%w: rebasing from %s to %s", repo.ErrNoBaseRate, old, base)
+			}
+		case err != nil:
+			return err
+		default:
+			err = rebase(ctx, tx, old, base, rate)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.ExecContext(ctx, `UPDATE currency_base SET currency=$1`, base)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityExchangeRate, exchangeRateAuditID, repo.AuditActionUpdate,
+			map[string]string{"base": old}, map[string]string{"base": base})
+	})
+
+	return logQueryError(ctx, "exchange_rate.rebase", err)
+}
+
+// rebase converts the rates from old to base, rate being how many units of
+// base one unit of old buys. The old base gets a rate of its own.
+func rebase(ctx context.Context, tx *sqlx.Tx, old, base, rate string) error {
+	_, err := tx.ExecContext(ctx, `UPDATE bookings SET exchange_rate=exchange_rate*$1::NUMERIC`, rate)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM exchange_rates WHERE currency=$1`, base)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE exchange_rates SET rate=rate/$1::NUMERIC, updated_at=CURRENT_TIMESTAMP`, rate)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO exchange_rates(currency, rate) VALUES($1, 1/$2::NUMERIC)`, old, rate)
+	return err
+}
@@ -0,0 +1,69 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExchangeRate(t *testing.T) {
+	rate, err := strg.ExchangeRate().Set(context.Background(), &repo.ExchangeRate{Currency: "EUR", Rate: "0.92"})
+	require.NoError(t, err)
+	require.Equal(t, "EUR", rate.Currency)
+
+	_, err = strg.ExchangeRate().Set(context.Background(), &repo.ExchangeRate{Currency: "EUR", Rate: "0.95"})
+	require.NoError(t, err)
+
+	rates, err := strg.ExchangeRate().GetAll(context.Background())
+	require.NoError(t, err)
+
+	found := false
+	for _, r := range rates {
+		if r.Currency == "EUR" {
+			found = true
+			require.Equal(t, "0.950000000000", r.Rate)
+		}
+	}
+	require.True(t, found)
+
+	require.NoError(t, strg.ExchangeRate().Delete(context.Background(), "EUR"))
+	require.ErrorIs(t, strg.ExchangeRate().Delete(context.Background(), "EUR"), sql.ErrNoRows)
+}
+
+func TestExchangeRateRebase(t *testing.T) {
+	booking := createBooking(t)
+	require.NoError(t, strg.ExchangeRate().Rebase(context.Background(), "USD"))
+
+	_, err := strg.ExchangeRate().Set(context.Background(), &repo.ExchangeRate{Currency: "EUR", Rate: "0.5"})
+	require.NoError(t, err)
+
+	require.ErrorIs(t, strg.ExchangeRate().Rebase(context.Background(), "UZS"), repo.ErrNoBaseRate)
+
+	// bookings keep what they were worth, now counted in euros
+	require.NoError(t, strg.ExchangeRate().Rebase(context.Background(), "EUR"))
+	got, err := strg.Booking().Get(context.Background(), booking.ID)
+	require.NoError(t, err)
+	require.Equal(t, "0.540000000000", got.ExchangeRate)
+
+	rates, err := strg.ExchangeRate().GetAll(context.Background())
+	require.NoError(t, err)
+	found := false
+	for _, r := range rates {
+		require.NotEqual(t, "EUR", r.Currency)
+		if r.Currency == "USD" {
+			found = true
+			require.Equal(t, "2.000000000000", r.Rate)
+		}
+	}
+	require.True(t, found)
+
+	require.NoError(t, strg.ExchangeRate().Rebase(context.Background(), "USD"))
+	got, err = strg.Booking().Get(context.Background(), booking.ID)
+	require.NoError(t, err)
+	require.Equal(t, "1.080000000000", got.ExchangeRate)
+
+	require.NoError(t, strg.ExchangeRate().Delete(context.Background(), "EUR"))
+}
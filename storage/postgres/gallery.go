@@ -0,0 +1,297 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// galleryRepo stores the galleries of hotels or rooms, which only differ in
+// their tables.
+type galleryRepo struct {
+	db     *sqlx.DB
+	table  string
+	owner  string
+	parent string
+	entity string
+}
+
+func NewHotelGallery(db *sqlx.DB) repo.GalleryStorageI {
+	return &galleryRepo{
+		db:     db,
+		table:  "hotel_images",
+		owner:  "hotel_id",
+		parent: "hotels",
+		entity: repo.AuditEntityHotelGallery,
+	}
+}
+
+func NewRoomGallery(db *sqlx.DB) repo.GalleryStorageI {
+	return &galleryRepo{
+		db:     db,
+		table:  "room_images",
+		owner:  "room_id",
+		parent: "rooms",
+		entity: repo.AuditEntityRoomGallery,
+	}
+}
+
+type rowsQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+func (ur *galleryRepo) columns() string {
+	return ur.owner + ", media_id, position, caption, alt_text, is_cover, created_at"
+}
+
+func (ur *galleryRepo) list(ctx context.Context, q rowsQueryer, query string, args ...interface{}) ([]*repo.GalleryImage, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*repo.GalleryImage, 0)
+	for rows.Next() {
+		var img repo.GalleryImage
+
+		err := rows.Scan(
+			&img.OwnerID,
+			&img.MediaID,
+			&img.Position,
+			&img.Caption,
+			&img.AltText,
+			&img.Cover,
+			&img.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, &img)
+	}
+
+	return result, rows.Err()
+}
+
+func (ur *galleryRepo) get(ctx context.Context, q rowsQueryer, ownerID int64) ([]*repo.GalleryImage, error) {
+	query := "SELECT " + ur.columns() + " FROM " + ur.table + " WHERE " + ur.owner + "=$1 ORDER BY position"
+	return ur.list(ctx, q, query, ownerID)
+}
+
+// write runs fn on the gallery of ownerID and records the gallery before
+// and after in the audit log. Writers of one gallery take turns on the
+// owner's row, which also has to exist and not be deleted.
+func (ur *galleryRepo) write(ctx context.Context, ownerID int64, fn func(tx *sqlx.Tx, before []*repo.GalleryImage) error) ([]*repo.GalleryImage, error) {
+	var after []*repo.GalleryImage
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		var id int64
+		err := tx.QueryRowContext(ctx, "SELECT id FROM "+ur.parent+" WHERE id=$1 AND "+activeRows+" FOR NO KEY UPDATE", ownerID).Scan(&id)
+		if err != nil {
+			return err
+		}
+
+		before, err := ur.get(ctx, tx, ownerID)
+		if err != nil {
+			return err
+		}
+
+		err = fn(tx, before)
+		if err != nil {
+			return err
+		}
+
+		after, err = ur.get(ctx, tx, ownerID)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, ur.entity, ownerID, repo.AuditActionUpdate, before, after)
+	})
+
+	return after, err
+}
+
+func (ur *galleryRepo) unsetCover(ctx context.Context, tx *sqlx.Tx, ownerID int64) error {
+	_, err := tx.ExecContext(ctx, "UPDATE "+ur.table+" SET is_cover=FALSE WHERE "+ur.owner+"=$1 AND is_cover", ownerID)
+	return err
+}
+
+func findImage(gallery []*repo.GalleryImage, mediaID int64) *repo.GalleryImage {
+	for _, img := range gallery {
+		if img.MediaID == mediaID {
+			return img
+		}
+	}
+	return nil
+}
+
+func (ur *galleryRepo) Add(ctx context.Context, img *repo.GalleryImage) ([]*repo.GalleryImage, error) {
+	ctx, span := startQuery(ctx, ur.entity+".add")
+	defer span.End()
+
+	query := `INSERT INTO ` + ur.table + `(
+			` + ur.owner + `,
+			media_id,
+			position,
+			caption,
+			alt_text,
+			is_cover
+		) VALUES($1, $2, $3, $4, $5, $6)
+	`
+
+	result, err := ur.write(ctx, img.OwnerID, func(tx *sqlx.Tx, before []*repo.GalleryImage) error {
+		if img.Cover {
+			err := ur.unsetCover(ctx, tx, img.OwnerID)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.ExecContext(
+			ctx,
+			query,
+			img.OwnerID,
+			img.MediaID,
+			len(before)+1,
+			img.Caption,
+			img.AltText,
+			img.Cover,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, ur.entity+".add", err)
+	}
+
+	return result, nil
+}
+
+func (ur *galleryRepo) Get(ctx context.Context, ownerID int64) ([]*repo.GalleryImage, error) {
+	ctx, span := startQuery(ctx, ur.entity+".get")
+	defer span.End()
+
+	result, err := ur.get(ctx, ur.db, ownerID)
+	if err != nil {
+		return nil, logQueryError(ctx, ur.entity+".get", err)
+	}
+
+	return result, nil
+}
+
+func (ur *galleryRepo) GetCovers(ctx context.Context, ownerIDs []int64) ([]*repo.GalleryImage, error) {
+	ctx, span := startQuery(ctx, ur.entity+".get_covers")
+	defer span.End()
+
+	query := `
+		SELECT DISTINCT ON (` + ur.owner + `) ` + ur.columns() + `
+		FROM ` + ur.table + `
+		WHERE ` + ur.owner + ` = ANY($1)
+		ORDER BY ` + ur.owner + `, is_cover DESC, position
+	`
+
+	result, err := ur.list(ctx, ur.db, query, pq.Array(ownerIDs))
+	if err != nil {
+		return nil, logQueryError(ctx, ur.entity+".get_covers", err)
+	}
+
+	return result, nil
+}
+
+func (ur *galleryRepo) Update(ctx context.Context, img *repo.GalleryImage) ([]*repo.GalleryImage, error) {
+	ctx, span := startQuery(ctx, ur.entity+".update")
+	defer span.End()
+
+	query := `UPDATE ` + ur.table + ` SET
+			caption=$1,
+			alt_text=$2,
+			is_cover=$3
+		WHERE ` + ur.owner + `=$4 AND media_id=$5
+	`
+
+	result, err := ur.write(ctx, img.OwnerID, func(tx *sqlx.Tx, before []*repo.GalleryImage) error {
+		if findImage(before, img.MediaID) == nil {
+			return sql.ErrNoRows
+		}
+
+		if img.Cover {
+			err := ur.unsetCover(ctx, tx, img.OwnerID)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err := tx.ExecContext(ctx, query, img.Caption, img.AltText, img.Cover, img.OwnerID, img.MediaID)
+		return err
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, ur.entity+".update", err)
+	}
+
+	return result, nil
+}
+
+func (ur *galleryRepo) Reorder(ctx context.Context, ownerID int64, mediaIDs []int64) ([]*repo.GalleryImage, error) {
+	ctx, span := startQuery(ctx, ur.entity+".reorder")
+	defer span.End()
+
+	query := "UPDATE " + ur.table + " SET position=$1 WHERE " + ur.owner + "=$2 AND media_id=$3"
+
+	result, err := ur.write(ctx, ownerID, func(tx *sqlx.Tx, before []*repo.GalleryImage) error {
+		if len(mediaIDs) != len(before) {
+			return repo.ErrGalleryOrder
+		}
+
+		seen := make(map[int64]bool, len(mediaIDs))
+		for _, id := range mediaIDs {
+			if seen[id] || findImage(before, id) == nil {
+				return repo.ErrGalleryOrder
+			}
+			seen[id] = true
+		}
+
+		for i, id := range mediaIDs {
+			_, err := tx.ExecContext(ctx, query, i+1, ownerID, id)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, ur.entity+".reorder", err)
+	}
+
+	return result, nil
+}
+
+func (ur *galleryRepo) Remove(ctx context.Context, ownerID, mediaID int64) ([]*repo.GalleryImage, error) {
+	ctx, span := startQuery(ctx, ur.entity+".remove")
+	defer span.End()
+
+	result, err := ur.write(ctx, ownerID, func(tx *sqlx.Tx, before []*repo.GalleryImage) error {
+		img := findImage(before, mediaID)
+		if img == nil {
+			return sql.ErrNoRows
+		}
+
+		_, err := tx.ExecContext(ctx, "DELETE FROM "+ur.table+" WHERE "+ur.owner+"=$1 AND media_id=$2", ownerID, mediaID)
+		if err != nil {
+			return err
+		}
+
+		// keep the positions contiguous
+		_, err = tx.ExecContext(ctx, "UPDATE "+ur.table+" SET position=position-1 WHERE "+ur.owner+"=$1 AND position>$2", ownerID, img.Position)
+		return err
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, ur.entity+".remove", err)
+	}
+
+	return result, nil
+}
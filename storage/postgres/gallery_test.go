@@ -0,0 +1,63 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func mediaIDs(gallery []*repo.GalleryImage) []int64 {
+	ids := make([]int64, 0, len(gallery))
+	for _, img := range gallery {
+		ids = append(ids, img.MediaID)
+	}
+	return ids
+}
+
+func TestHotelGallery(t *testing.T) {
+	ctx := context.Background()
+	hotel := createHotel(t)
+	a, b, c := createMedia(t), createMedia(t), createMedia(t)
+
+	for _, m := range []*repo.Media{a, b, c} {
+		_, err := strg.HotelGallery().Add(ctx, &repo.GalleryImage{OwnerID: hotel.ID, MediaID: m.ID})
+		require.NoError(t, err)
+	}
+
+	gallery, err := strg.HotelGallery().Add(ctx, &repo.GalleryImage{OwnerID: hotel.ID, MediaID: a.ID})
+	require.Error(t, err, "an image is in a gallery once")
+	require.Nil(t, gallery)
+
+	// no cover marked yet, so the first image is the cover
+	covers, err := strg.HotelGallery().GetCovers(ctx, []int64{hotel.ID})
+	require.NoError(t, err)
+	require.Len(t, covers, 1)
+	require.Equal(t, a.ID, covers[0].MediaID)
+
+	gallery, err = strg.HotelGallery().Update(ctx, &repo.GalleryImage{OwnerID: hotel.ID, MediaID: c.ID, Caption: "Pool", Cover: true})
+	require.NoError(t, err)
+	require.Equal(t, "Pool", gallery[2].Caption)
+
+	gallery, err = strg.HotelGallery().Update(ctx, &repo.GalleryImage{OwnerID: hotel.ID, MediaID: b.ID, Cover: true})
+	require.NoError(t, err)
+	require.False(t, gallery[2].Cover, "the previous cover is unmarked")
+	require.True(t, gallery[1].Cover)
+
+	_, err = strg.HotelGallery().Reorder(ctx, hotel.ID, []int64{c.ID, a.ID})
+	require.ErrorIs(t, err, repo.ErrGalleryOrder)
+
+	gallery, err = strg.HotelGallery().Reorder(ctx, hotel.ID, []int64{c.ID, a.ID, b.ID})
+	require.NoError(t, err)
+	require.Equal(t, []int64{c.ID, a.ID, b.ID}, mediaIDs(gallery))
+
+	gallery, err = strg.HotelGallery().Remove(ctx, hotel.ID, a.ID)
+	require.NoError(t, err)
+	require.Equal(t, []int64{c.ID, b.ID}, mediaIDs(gallery))
+	require.Equal(t, 2, gallery[1].Position)
+
+	// gallery images are not orphans
+	err = strg.Media().DeleteOrphan(ctx, b.ID)
+	require.Error(t, err)
+}
@@ -1,8 +1,9 @@
 package postgres
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
+	"strconv"
+	"time"
 
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/jmoiron/sqlx"
@@ -18,36 +19,59 @@ func NewHotel(db *sqlx.DB) repo.HotelStorageI {
 	}
 }
 
-func (ur *hotelRepo) Create(hotel *repo.Hotel) (*repo.Hotel, error) {
+func (ur *hotelRepo) Create(ctx context.Context, hotel *repo.Hotel) (*repo.Hotel, error) {
+	ctx, span := startQuery(ctx, "hotel.create")
+	defer span.End()
+
 	query := `
 		INSERT INTO hotels(
 			user_id,
 			hotel_name,
 			hotel_location,
-			hotel_image_url,
+			image_id,
 			number_of_rooms
 		) VALUES($1, $2, $3, $4, $5)
-		RETURNING id, created_at
+		RETURNING id, version, created_at
 	`
 
-	row := ur.db.QueryRow(
-		query,
-		hotel.UserID,
-		hotel.HotelName,
-		hotel.HotelLocation,
-		hotel.HotelImageUrl,
-		hotel.NumberOfRooms,
-	)
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowContext(
+			ctx,
+			query,
+			hotel.UserID,
+			hotel.HotelName,
+			hotel.HotelLocation,
+			hotel.ImageID,
+			hotel.NumberOfRooms,
+		)
+
+		err := row.Scan(&hotel.ID, &hotel.Version, &hotel.CreatedAt)
+		if err != nil {
+			return err
+		}
 
-	err := row.Scan(&hotel.ID, &hotel.CreatedAt)
+		return writeAudit(ctx, tx, repo.AuditEntityHotel, hotel.ID, repo.AuditActionCreate, nil, hotel)
+	})
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "hotel.create", err)
 	}
 
 	return hotel, nil
 }
 
-func (ur *hotelRepo) Get(id int64) (*repo.Hotel, error) {
+func (ur *hotelRepo) Get(ctx context.Context, id int64) (*repo.Hotel, error) {
+	ctx, span := startQuery(ctx, "hotel.get")
+	defer span.End()
+
+	result, err := ur.get(ctx, ur.db, id, activeRows, false)
+	if err != nil {
+		return nil, logQueryError(ctx, "hotel.get", err)
+	}
+
+	return result, nil
+}
+
+func (ur *hotelRepo) get(ctx context.Context, q queryer, id int64, scope string, forUpdate bool) (*repo.Hotel, error) {
 	var result repo.Hotel
 
 	query := `
@@ -56,22 +80,31 @@ func (ur *hotelRepo) Get(id int64) (*repo.Hotel, error) {
 			user_id,
 			hotel_name,
 			hotel_location,
+			image_id,
 			hotel_image_url,
 			number_of_rooms,
-			created_at
+			version,
+			created_at,
+			deleted_at
 		FROM hotels
-		WHERE id=$1
+		WHERE id=$1 AND ` + scope + `
 	`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
 
-	row := ur.db.QueryRow(query, id)
+	row := q.QueryRowContext(ctx, query, id)
 	err := row.Scan(
 		&result.ID,
 		&result.UserID,
 		&result.HotelName,
 		&result.HotelLocation,
-		&result.HotelImageUrl,
+		&result.ImageID,
+		&result.ImageURL,
 		&result.NumberOfRooms,
+		&result.Version,
 		&result.CreatedAt,
+		&result.DeletedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -80,41 +113,47 @@ func (ur *hotelRepo) Get(id int64) (*repo.Hotel, error) {
 	return &result, nil
 }
 
-func (ur *hotelRepo) GetAll(params *repo.GetAllHotelsParams) (*repo.GetAllHotelsResult, error) {
+func (ur *hotelRepo) GetAll(ctx context.Context, params *repo.GetAllHotelsParams) (*repo.GetAllHotelsResult, error) {
+	ctx, span := startQuery(ctx, "hotel.get_all")
+	defer span.End()
+
 	result := repo.GetAllHotelsResult{
 		Hotels: make([]*repo.Hotel, 0),
 	}
 
-	offset := (params.Page - 1) * params.Limit
-
-	limit := fmt.Sprintf(" LIMIT %d OFFSET %d ", params.Limit, offset)
-
 	filter := ""
+	if !params.IncludeDeleted {
+		filter = where(filter, activeRows)
+	}
+
+	var args []interface{}
 	if params.Search != "" {
-		str := "%" + params.Search + "%"
-		filter += fmt.Sprintf(`
-			WHERE hotel_name ILIKE '%s' OR hotel_rating ILIKE '%s' OR hotel_location ILIKE '%s' `,
-			str, str, str,
-		)
+		args = append(args, "%"+params.Search+"%")
+		filter = where(filter, `(hotel_name ILIKE $1 OR hotel_location ILIKE $1)`)
 	}
 
+	pageFilter, limit, pageArgs := paginate(filter, args, params.Limit, params.Page, params.Cursor)
+
 	query := `
 		SELECT
 			id,
 			user_id,
 			hotel_name,
 			hotel_location,
+			image_id,
 			hotel_image_url,
 			number_of_rooms,
-			created_at
+			version,
+			created_at,
+			deleted_at
 		FROM hotels
-		` + filter + `
-		ORDER BY created_at desc
+		` + pageFilter + `
+		ORDER BY created_at desc, id desc
 		` + limit
 
-	rows, err := ur.db.Query(query)
+	rows, err := ur.db.QueryContext(ctx, query, pageArgs...)
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "hotel.get_all", err)
 	}
 
 	defer rows.Close()
@@ -127,69 +166,267 @@ func (ur *hotelRepo) GetAll(params *repo.GetAllHotelsParams) (*repo.GetAllHotels
 			&h.UserID,
 			&h.HotelName,
 			&h.HotelLocation,
-			&h.HotelImageUrl,
+			&h.ImageID,
+			&h.ImageURL,
 			&h.NumberOfRooms,
+			&h.Version,
 			&h.CreatedAt,
+			&h.DeletedAt,
 		)
 		if err != nil {
-			return nil, err
+			return nil, logQueryError(ctx, "hotel.get_all", err)
 		}
 
 		result.Hotels = append(result.Hotels, &h)
 	}
 
+	if len(result.Hotels) > int(params.Limit) {
+		result.Hotels = result.Hotels[:params.Limit]
+
+		last := result.Hotels[len(result.Hotels)-1]
+		result.NextCursor = &repo.Cursor{
+			CreatedAt: last.CreatedAt,
+			ID:        last.ID,
+		}
+	}
+
 	queryCount := `SELECT count(1) FROM hotels ` + filter
-	err = ur.db.QueryRow(queryCount).Scan(&result.Count)
+	err = ur.db.QueryRowContext(ctx, queryCount, args...).Scan(&result.Count)
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "hotel.get_all", err)
 	}
 
 	return &result, nil
 }
 
-func (ur *hotelRepo) Update(hotel *repo.Hotel) (*repo.Hotel, error) {
+func (ur *hotelRepo) Update(ctx context.Context, hotel *repo.Hotel) (*repo.Hotel, error) {
+	ctx, span := startQuery(ctx, "hotel.update")
+	defer span.End()
+
 	query := `update hotels set 
 			user_id=$1,
 			hotel_name=$2,
 			hotel_location=$3,
-			hotel_image_url=$4,
-			number_of_rooms=$5
+			image_id=$4,
+			hotel_image_url=CASE WHEN $4::BIGINT IS NULL THEN hotel_image_url END,
+			number_of_rooms=$5,
+			version=version+1
 		where id=$6
-		returning created_at
+		returning version, created_at, hotel_image_url
 		`
 
-	err := ur.db.QueryRow(
-		query,
-		hotel.UserID,
-		hotel.HotelName,
-		hotel.HotelLocation,
-		hotel.HotelImageUrl,
-		hotel.NumberOfRooms,
-		hotel.ID,
-	).Scan(&hotel.CreatedAt)
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, hotel.ID, activeRows, true)
+		if err != nil {
+			return err
+		}
+
+		if before.Version != hotel.Version {
+			return repo.ErrVersionMismatch
+		}
+
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			hotel.UserID,
+			hotel.HotelName,
+			hotel.HotelLocation,
+			hotel.ImageID,
+			hotel.NumberOfRooms,
+			hotel.ID,
+		).Scan(&hotel.Version, &hotel.CreatedAt, &hotel.ImageURL)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityHotel, hotel.ID, repo.AuditActionUpdate, before, hotel)
+	})
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "hotel.update", err)
 	}
 
 	return hotel, nil
 }
 
-func (ur *hotelRepo) Delete(id int64) error {
-	query := `delete from hotels where id=$1 returning id`
+// Patch updates only the given columns, keyed by column name.
+func (ur *hotelRepo) Patch(ctx context.Context, id, version int64, fields map[string]interface{}) (*repo.Hotel, error) {
+	ctx, span := startQuery(ctx, "hotel.patch")
+	defer span.End()
+
+	set, args, err := patchSet(fields,
+		"user_id",
+		"hotel_name",
+		"hotel_location",
+		"image_id",
+		"number_of_rooms",
+	)
+	if err != nil {
+		return nil, logQueryError(ctx, "hotel.patch", err)
+	}
+
+	var result *repo.Hotel
+	err = inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, id, activeRows, true)
+		if err != nil {
+			return err
+		}
+
+		if before.Version != version {
+			return repo.ErrVersionMismatch
+		}
+
+		if len(fields) == 0 {
+			result = before
+			return nil
+		}
 
-	result, err := ur.db.Exec(query, id)
+		// a patched image replaces the legacy one, even when it is cleared
+		if _, ok := fields["image_id"]; ok {
+			set += ", hotel_image_url=NULL"
+		}
+
+		query := "update hotels set " + set + ", version=version+1 where id=$" + strconv.Itoa(len(args)+1)
+		_, err = tx.ExecContext(ctx, query, append(args, id)...)
+		if err != nil {
+			return err
+		}
+
+		result, err = ur.get(ctx, tx, id, activeRows, false)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityHotel, id, repo.AuditActionUpdate, before, result)
+	})
 	if err != nil {
-		return err
+		return nil, logQueryError(ctx, "hotel.patch", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return result, nil
+}
+
+func (ur *hotelRepo) Delete(ctx context.Context, id, version int64) error {
+	ctx, span := startQuery(ctx, "hotel.delete")
+	defer span.End()
+
+	query := `update hotels set
+			deleted_at=CURRENT_TIMESTAMP,
+			version=version+1
+		where id=$1
+		returning version, deleted_at
+	`
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, id, activeRows, true)
+		if err != nil {
+			return err
+		}
+
+		if before.Version != version {
+			return repo.ErrVersionMismatch
+		}
+
+		after := *before
+		err = tx.QueryRowContext(ctx, query, id).Scan(&after.Version, &after.DeletedAt)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityHotel, id, repo.AuditActionDelete, before, &after)
+	})
+
+	return logQueryError(ctx, "hotel.delete", err)
+}
+
+func (ur *hotelRepo) Restore(ctx context.Context, id int64) (*repo.Hotel, error) {
+	ctx, span := startQuery(ctx, "hotel.restore")
+	defer span.End()
+
+	query := `update hotels set
+			deleted_at=NULL,
+			version=version+1
+		where id=$1
+		returning version
+	`
+
+	var result *repo.Hotel
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, id, deletedRows, true)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.DeletedAt = nil
+		err = tx.QueryRowContext(ctx, query, id).Scan(&after.Version)
+		if err != nil {
+			return err
+		}
+
+		result = &after
+		return writeAudit(ctx, tx, repo.AuditEntityHotel, id, repo.AuditActionRestore, before, &after)
+	})
 	if err != nil {
-		return err
+		return nil, logQueryError(ctx, "hotel.restore", err)
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	return result, nil
+}
+
+// Purge hard deletes rows soft deleted before the given time, skipping rows
+// that are still referenced.
+func (ur *hotelRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := startQuery(ctx, "hotel.purge")
+	defer span.End()
+
+	query := `delete from hotels
+		where deleted_at < $1
+			AND NOT EXISTS (SELECT 1 FROM bookings b WHERE b.hotel_id=hotels.id)
+			AND NOT EXISTS (SELECT 1 FROM rooms r WHERE r.hotel_id=hotels.id)
+			AND NOT EXISTS (SELECT 1 FROM documents d WHERE d.hotel_id=hotels.id)
+			AND NOT EXISTS (SELECT 1 FROM invoices i WHERE i.hotel_id=hotels.id)
+			AND NOT EXISTS (SELECT 1 FROM campaigns c WHERE c.hotel_id=hotels.id)
+			AND NOT EXISTS (SELECT 1 FROM commission_entries c WHERE c.hotel_id=hotels.id)
+		returning id
+	`
+
+	var count int64
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, before)
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			err := writeAudit(ctx, tx, repo.AuditEntityHotel, id, repo.AuditActionPurge, nil, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		count = int64(len(ids))
+		return nil
+	})
+	if err != nil {
+		return 0, logQueryError(ctx, "hotel.purge", err)
 	}
 
-	return nil
+	return count, nil
 }
@@ -1,6 +1,8 @@
 package postgres_test
 
 import (
+	"context"
+	"database/sql"
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/bxcodec/faker/v4"
 	"github.com/stretchr/testify/require"
@@ -10,7 +12,7 @@ import (
 func createHotel(t *testing.T) *repo.Hotel {
 	user := createUser(t)
 
-	hotel, err := strg.Hotel().Create(&repo.Hotel{
+	hotel, err := strg.Hotel().Create(context.Background(), &repo.Hotel{
 		HotelName:     faker.NAME,
 		HotelLocation: faker.SENTENCE,
 		UserID:        user.ID,
@@ -24,7 +26,7 @@ func createHotel(t *testing.T) *repo.Hotel {
 func TestGetHotel(t *testing.T) {
 	c := createHotel(t)
 
-	hotel, err := strg.Hotel().Get(c.ID)
+	hotel, err := strg.Hotel().Get(context.Background(), c.ID)
 	require.NoError(t, err)
 	require.NotEmpty(t, hotel)
 }
@@ -36,7 +38,7 @@ func TestCreateHotel(t *testing.T) {
 func TestGetAllHotels(t *testing.T) {
 	createHotel(t)
 
-	result, err := strg.Hotel().GetAll(&repo.GetAllHotelsParams{
+	result, err := strg.Hotel().GetAll(context.Background(), &repo.GetAllHotelsParams{
 		Limit: 3,
 		Page:  1,
 	})
@@ -44,21 +46,124 @@ func TestGetAllHotels(t *testing.T) {
 	require.GreaterOrEqual(t, int(result.Count), 1)
 }
 
+func TestGetAllHotelsSearch(t *testing.T) {
+	c := createHotel(t)
+
+	result, err := strg.Hotel().GetAll(context.Background(), &repo.GetAllHotelsParams{
+		Limit:  3,
+		Page:   1,
+		Search: c.HotelLocation,
+	})
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, int(result.Count), 1)
+
+	result, err = strg.Hotel().GetAll(context.Background(), &repo.GetAllHotelsParams{
+		Limit:  3,
+		Page:   1,
+		Search: "' OR 1=1 --",
+	})
+	require.NoError(t, err)
+	require.Zero(t, result.Count)
+}
+
+func TestGetAllHotelsCursor(t *testing.T) {
+	createHotel(t)
+	createHotel(t)
+	createHotel(t)
+
+	first, err := strg.Hotel().GetAll(context.Background(), &repo.GetAllHotelsParams{
+		Limit: 2,
+		Page:  1,
+	})
+	require.NoError(t, err)
+	require.Len(t, first.Hotels, 2)
+	require.NotNil(t, first.NextCursor)
+
+	second, err := strg.Hotel().GetAll(context.Background(), &repo.GetAllHotelsParams{
+		Limit:  2,
+		Cursor: first.NextCursor,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, second.Hotels)
+
+	for _, h := range second.Hotels {
+		require.NotEqual(t, first.Hotels[0].ID, h.ID)
+		require.NotEqual(t, first.Hotels[1].ID, h.ID)
+	}
+}
+
 func TestUpdateHotel(t *testing.T) {
 	c := createHotel(t)
 
 	c.HotelName = faker.NAME
 	c.HotelLocation = faker.SENTENCE
 
-	hotel, err := strg.Hotel().Update(c)
+	hotel, err := strg.Hotel().Update(context.Background(), c)
 	require.NoError(t, err)
 	require.NotEmpty(t, hotel)
 	require.Equal(t, hotel.HotelName, c.HotelName)
 }
 
+func TestPatchHotel(t *testing.T) {
+	c := createHotel(t)
+	image := createMedia(t)
+
+	hotel, err := strg.Hotel().Patch(context.Background(), c.ID, c.Version, map[string]interface{}{
+		"image_id": image.ID,
+	})
+	require.NoError(t, err)
+	require.Equal(t, c.Version+1, hotel.Version)
+	require.Equal(t, c.HotelName, hotel.HotelName)
+	require.Equal(t, image.ID, *hotel.ImageID)
+
+	_, err = strg.Hotel().Patch(context.Background(), c.ID, c.Version, map[string]interface{}{
+		"hotel_name": faker.NAME,
+	})
+	require.ErrorIs(t, err, repo.ErrVersionMismatch)
+
+	_, err = strg.Hotel().Patch(context.Background(), c.ID, hotel.Version, map[string]interface{}{
+		"version": 1,
+	})
+	require.Error(t, err)
+}
+
+func TestUpdateHotelVersionMismatch(t *testing.T) {
+	c := createHotel(t)
+
+	c.HotelName = faker.NAME
+	_, err := strg.Hotel().Update(context.Background(), c)
+	require.NoError(t, err)
+
+	stale := *c
+	stale.Version--
+
+	_, err = strg.Hotel().Update(context.Background(), &stale)
+	require.ErrorIs(t, err, repo.ErrVersionMismatch)
+
+	err = strg.Hotel().Delete(context.Background(), c.ID, stale.Version)
+	require.ErrorIs(t, err, repo.ErrVersionMismatch)
+}
+
 func TestDeleteHotel(t *testing.T) {
 	c := createHotel(t)
 
-	err := strg.Hotel().Delete(c.ID)
+	err := strg.Hotel().Delete(context.Background(), c.ID, c.Version)
+	require.NoError(t, err)
+}
+
+func TestRestoreHotel(t *testing.T) {
+	c := createHotel(t)
+
+	err := strg.Hotel().Delete(context.Background(), c.ID, c.Version)
+	require.NoError(t, err)
+
+	_, err = strg.Hotel().Get(context.Background(), c.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	hotel, err := strg.Hotel().Restore(context.Background(), c.ID)
+	require.NoError(t, err)
+	require.Nil(t, hotel.DeletedAt)
+
+	_, err = strg.Hotel().Get(context.Background(), c.ID)
 	require.NoError(t, err)
 }
@@ -0,0 +1,221 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// invoicePrefixes start the numbers of each kind, e.g. INV-3-000042.
+var invoicePrefixes = map[string]string{
+	repo.InvoiceKindInvoice: "INV",
+	repo.InvoiceKindReceipt: "RCT",
+}
+
+type invoiceRepo struct {
+	db *sqlx.DB
+}
+
+func NewInvoice(db *sqlx.DB) repo.InvoiceStorageI {
+	return &invoiceRepo{
+		db: db,
+	}
+}
+
+func (ur *invoiceRepo) Create(ctx context.Context, inv *repo.Invoice, render func(*repo.Invoice) ([]byte, error)) (*repo.Invoice, error) {
+	ctx, span := startQuery(ctx, "invoice.create")
+	defer span.End()
+
+	prefix, ok := invoicePrefixes[inv.Kind]
+	if !ok {
+		return nil, logQueryError(ctx, "invoice.create", fmt.Errorf("unknown invoice kind %q", inv.Kind))
+	}
+
+	result := *inv
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		var exists bool
+		err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM invoices WHERE booking_id=$1 AND kind=$2)`,
+			inv.BookingID, inv.Kind,
+		).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return repo.ErrInvoiceExists
+		}
+
+		// the row stays locked until commit, so concurrent invoices of the
+		// hotel wait for this one
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO invoice_sequences(hotel_id, kind, last_number) VALUES($1, $2, 1)
+			ON CONFLICT (hotel_id, kind) DO UPDATE SET last_number=invoice_sequences.last_number+1
+			RETURNING last_number
+		`, inv.HotelID, inv.Kind).Scan(&result.Sequence)
+		if err != nil {
+			return err
+		}
+
+		result.Number = fmt.Sprintf("%s-%d-%06d", prefix, inv.HotelID, result.Sequence)
+		err = tx.QueryRowContext(ctx, `SELECT CURRENT_TIMESTAMP`).Scan(&result.IssuedAt)
+		if err != nil {
+			return err
+		}
+
+		result.Content, err = render(&result)
+		if err != nil {
+			return err
+		}
+
+		sum := sha256.Sum256(result.Content)
+		result.Checksum = hex.EncodeToString(sum[:])
+
+		lines, err := json.Marshal(result.Lines)
+		if err != nil {
+			return err
+		}
+
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO invoices(
+				hotel_id,
+				booking_id,
+				kind,
+				sequence,
+				number,
+				currency,
+				total,
+				lines,
+				content,
+				checksum,
+				issued_at
+			) VALUES($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			RETURNING id
+		`,
+			result.HotelID,
+			result.BookingID,
+			result.Kind,
+			result.Sequence,
+			result.Number,
+			result.Currency,
+			result.Total,
+			lines,
+			result.Content,
+			result.Checksum,
+			result.IssuedAt,
+		).Scan(&result.ID)
+		if err != nil {
+			return err
+		}
+
+		// the PDF would only bloat the audit log, the checksum identifies it
+		audited := result
+		audited.Content = nil
+		return writeAudit(ctx, tx, repo.AuditEntityInvoice, result.ID, repo.AuditActionCreate, nil, &audited)
+	})
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Name() == "unique_violation" && pqErr.Constraint == "invoices_booking_id_kind_key" {
+		err = repo.ErrInvoiceExists
+	}
+	if err != nil {
+		return nil, logQueryError(ctx, "invoice.create", err)
+	}
+
+	return &result, nil
+}
+
+const invoiceColumns = `
+	id,
+	hotel_id,
+	booking_id,
+	kind,
+	sequence,
+	number,
+	currency,
+	total,
+	lines,
+	checksum,
+	issued_at
+`
+
+func scanInvoice(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*repo.Invoice, error) {
+	var (
+		result repo.Invoice
+		lines  []byte
+	)
+
+	err := row.Scan(append([]interface{}{
+		&result.ID,
+		&result.HotelID,
+		&result.BookingID,
+		&result.Kind,
+		&result.Sequence,
+		&result.Number,
+		&result.Currency,
+		&result.Total,
+		&lines,
+		&result.Checksum,
+		&result.IssuedAt,
+	}, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(lines, &result.Lines)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (ur *invoiceRepo) Get(ctx context.Context, id int64) (*repo.Invoice, error) {
+	ctx, span := startQuery(ctx, "invoice.get")
+	defer span.End()
+
+	var content []byte
+	result, err := scanInvoice(ur.db.QueryRowContext(ctx,
+		`SELECT `+invoiceColumns+`, content FROM invoices WHERE id=$1`, id,
+	), &content)
+	if err != nil {
+		return nil, logQueryError(ctx, "invoice.get", err)
+	}
+
+	result.Content = content
+	return result, nil
+}
+
+func (ur *invoiceRepo) GetByBooking(ctx context.Context, bookingID int64) ([]*repo.Invoice, error) {
+	ctx, span := startQuery(ctx, "invoice.get_by_booking")
+	defer span.End()
+
+	rows, err := ur.db.QueryContext(ctx,
+		`SELECT `+invoiceColumns+` FROM invoices WHERE booking_id=$1 ORDER BY id`, bookingID)
+	if err != nil {
+		return nil, logQueryError(ctx, "invoice.get_by_booking", err)
+	}
+	defer rows.Close()
+
+	result := make([]*repo.Invoice, 0)
+	for rows.Next() {
+		inv, err := scanInvoice(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "invoice.get_by_booking", err)
+		}
+		result = append(result, inv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "invoice.get_by_booking", err)
+	}
+
+	return result, nil
+}
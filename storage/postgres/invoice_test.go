@@ -0,0 +1,75 @@
+package postgres_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegalDetails(t *testing.T) {
+	hotel := createHotel(t)
+
+	details, err := strg.LegalDetails().Set(context.Background(), &repo.LegalDetails{
+		HotelID:   hotel.ID,
+		LegalName: "Hotel LLC",
+		Address:   "Tashkent",
+		TaxID:     "123456789",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Hotel LLC", details.LegalName)
+
+	_, err = strg.LegalDetails().Set(context.Background(), &repo.LegalDetails{
+		HotelID:   hotel.ID,
+		LegalName: "Hotel Group LLC",
+		Address:   "Tashkent",
+		TaxID:     "123456789",
+	})
+	require.NoError(t, err)
+
+	got, err := strg.LegalDetails().Get(context.Background(), hotel.ID)
+	require.NoError(t, err)
+	require.Equal(t, "Hotel Group LLC", got.LegalName)
+}
+
+func TestCreateInvoice(t *testing.T) {
+	booking := createBooking(t)
+	render := func(inv *repo.Invoice) ([]byte, error) {
+		return []byte("%PDF-1.4 " + inv.Number), nil
+	}
+
+	inv, err := strg.Invoice().Create(context.Background(), &repo.Invoice{
+		HotelID:   int64(booking.HotelId),
+		BookingID: booking.ID,
+		Kind:      repo.InvoiceKindInvoice,
+		Currency:  "USD",
+		Total:     10000,
+		Lines:     []repo.InvoiceLine{{Kind: repo.InvoiceLineNight, Description: "Night", Quantity: 1, UnitAmount: 10000, Amount: 10000}},
+	}, render)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), inv.Sequence)
+
+	receipt, err := strg.Invoice().Create(context.Background(), &repo.Invoice{
+		HotelID:   int64(booking.HotelId),
+		BookingID: booking.ID,
+		Kind:      repo.InvoiceKindReceipt,
+		Currency:  "USD",
+		Total:     10000,
+	}, render)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), receipt.Sequence)
+
+	_, err = strg.Invoice().Create(context.Background(), &repo.Invoice{
+		HotelID:   int64(booking.HotelId),
+		BookingID: booking.ID,
+		Kind:      repo.InvoiceKindInvoice,
+		Currency:  "USD",
+	}, render)
+	require.ErrorIs(t, err, repo.ErrInvoiceExists)
+
+	got, err := strg.Invoice().Get(context.Background(), inv.ID)
+	require.NoError(t, err)
+	require.Equal(t, "%PDF-1.4 "+inv.Number, string(got.Content))
+	require.Len(t, got.Lines, 1)
+}
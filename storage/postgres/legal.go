@@ -0,0 +1,121 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/jmoiron/sqlx"
+)
+
+type legalDetailsRepo struct {
+	db *sqlx.DB
+}
+
+func NewLegalDetails(db *sqlx.DB) repo.LegalDetailsStorageI {
+	return &legalDetailsRepo{
+		db: db,
+	}
+}
+
+const legalDetailsColumns = `
+	hotel_id,
+	legal_name,
+	address,
+	tax_id,
+	registration_number,
+	email,
+	updated_at
+`
+
+func scanLegalDetails(row interface{ Scan(...interface{}) error }) (*repo.LegalDetails, error) {
+	var result repo.LegalDetails
+
+	err := row.Scan(
+		&result.HotelID,
+		&result.LegalName,
+		&result.Address,
+		&result.TaxID,
+		&result.RegistrationNumber,
+		&result.Email,
+		&result.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (ur *legalDetailsRepo) Get(ctx context.Context, hotelID int64) (*repo.LegalDetails, error) {
+	ctx, span := startQuery(ctx, "legal_details.get")
+	defer span.End()
+
+	result, err := scanLegalDetails(ur.db.QueryRowContext(ctx,
+		`SELECT `+legalDetailsColumns+` FROM hotel_legal_details WHERE hotel_id=$1`, hotelID))
+	if err != nil {
+		return nil, logQueryError(ctx, "legal_details.get", err)
+	}
+
+	return result, nil
+}
+
+func (ur *legalDetailsRepo) Set(ctx context.Context, d *repo.LegalDetails) (*repo.LegalDetails, error) {
+	ctx, span := startQuery(ctx, "legal_details.set")
+	defer span.End()
+
+	query := `
+		INSERT INTO hotel_legal_details(
+			hotel_id,
+			legal_name,
+			address,
+			tax_id,
+			registration_number,
+			email
+		) VALUES($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (hotel_id) DO UPDATE SET
+			legal_name=EXCLUDED.legal_name,
+			address=EXCLUDED.address,
+			tax_id=EXCLUDED.tax_id,
+			registration_number=EXCLUDED.registration_number,
+			email=EXCLUDED.email,
+			updated_at=CURRENT_TIMESTAMP
+		RETURNING ` + legalDetailsColumns
+
+	var result *repo.LegalDetails
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := scanLegalDetails(tx.QueryRowContext(ctx,
+			`SELECT `+legalDetailsColumns+` FROM hotel_legal_details WHERE hotel_id=$1 FOR UPDATE`, d.HotelID))
+		if errors.Is(err, sql.ErrNoRows) {
+			before = nil
+		} else if err != nil {
+			return err
+		}
+
+		result, err = scanLegalDetails(tx.QueryRowContext(ctx, query,
+			d.HotelID,
+			d.LegalName,
+			d.Address,
+			d.TaxID,
+			d.RegistrationNumber,
+			d.Email,
+		))
+		if err != nil {
+			return err
+		}
+
+		action := repo.AuditActionUpdate
+		if before == nil {
+			action = repo.AuditActionCreate
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityLegalDetails, d.HotelID, action, before, result)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "legal_details.set", err)
+	}
+
+	return result, nil
+}
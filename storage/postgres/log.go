@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+	"github.com/MuhammadyusufAdhamov/booking/pkg/tracing"
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/lib/pq"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/exp/slog"
+)
+
+// startQuery starts the span of a repository call. Every query the call runs,
+// including its transaction, belongs to this span.
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	return tracing.Start(ctx, query,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			attribute.String("db.operation", query),
+		),
+	)
+}
+
+// logQueryError logs a failed query under its name, marks the query span as
+// failed and returns err so it can wrap return statements. Missing rows,
+// version conflicts and the other errors listed in isExpected are expected
+// outcomes and constraint violations are the client's fault, so those are
+// not logged as errors.
+func logQueryError(ctx context.Context, query string, err error) error {
+	if err == nil || isExpected(err) {
+		return err
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code.Class() == "23" {
+		slog.WarnCtx(ctx, "query rejected by constraint",
+			"query", query,
+			"constraint", pqErr.Constraint,
+			"sqlstate", string(pqErr.Code),
+		)
+		return err
+	}
+
+	slog.ErrorCtx(ctx, "query failed", err, "query", query)
+	return err
+}
+
+// isExpected reports whether err is an outcome callers handle rather than a
+// failure of the query. Domain errors such as rejected patch columns are
+// always expected.
+func isExpected(err error) bool {
+	var domainErr *errs.Error
+	if errors.As(err, &domainErr) {
+		return true
+	}
+
+	for _, expected := range []error{
+		sql.ErrNoRows,
+		repo.ErrVersionMismatch,
+		repo.ErrGalleryOrder,
+		repo.ErrBookingState,
+		repo.ErrPaymentState,
+		repo.ErrRefundTooLarge,
+		repo.ErrPaymentTooLarge,
+		repo.ErrBookingPaid,
+		repo.ErrBookingCancelled,
+		repo.ErrInvoiceExists,
+		repo.ErrCampaignExhausted,
+		repo.ErrNoCommission,
+		repo.ErrPayoutSettled,
+	} {
+		if errors.Is(err, expected) {
+			return true
+		}
+	}
+	return false
+}
@@ -35,4 +35,4 @@ func TestMain(m *testing.M) {
 
 	strg = storage.NewStoragePg(db)
 	os.Exit(m.Run())
-}
\ No newline at end of file
+}
@@ -0,0 +1,283 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type mediaRepo struct {
+	db *sqlx.DB
+}
+
+func NewMedia(db *sqlx.DB) repo.MediaStorageI {
+	return &mediaRepo{
+		db: db,
+	}
+}
+
+const mediaColumns = `
+	id,
+	owner_id,
+	checksum,
+	file_name,
+	content_type,
+	size,
+	width,
+	height,
+	derivatives,
+	processed_at,
+	created_at
+`
+
+func scanMedia(row interface{ Scan(...interface{}) error }) (*repo.Media, error) {
+	var (
+		result      repo.Media
+		derivatives []byte
+	)
+
+	err := row.Scan(
+		&result.ID,
+		&result.OwnerID,
+		&result.Checksum,
+		&result.FileName,
+		&result.ContentType,
+		&result.Size,
+		&result.Width,
+		&result.Height,
+		&derivatives,
+		&result.ProcessedAt,
+		&result.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(derivatives, &result.Derivatives)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (ur *mediaRepo) Create(ctx context.Context, m *repo.Media) (*repo.Media, error) {
+	ctx, span := startQuery(ctx, "media.create")
+	defer span.End()
+
+	query := `
+		INSERT INTO media(
+			owner_id,
+			checksum,
+			file_name,
+			content_type,
+			size,
+			width,
+			height
+		) VALUES($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at
+	`
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowContext(
+			ctx,
+			query,
+			m.OwnerID,
+			m.Checksum,
+			m.FileName,
+			m.ContentType,
+			m.Size,
+			m.Width,
+			m.Height,
+		)
+
+		err := row.Scan(&m.ID, &m.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityMedia, m.ID, repo.AuditActionCreate, nil, m)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "media.create", err)
+	}
+
+	return m, nil
+}
+
+func (ur *mediaRepo) Get(ctx context.Context, id int64) (*repo.Media, error) {
+	ctx, span := startQuery(ctx, "media.get")
+	defer span.End()
+
+	query := "SELECT " + mediaColumns + " FROM media WHERE id=$1"
+
+	result, err := scanMedia(ur.db.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, logQueryError(ctx, "media.get", err)
+	}
+
+	return result, nil
+}
+
+func (ur *mediaRepo) GetByChecksum(ctx context.Context, ownerID int64, checksum string) (*repo.Media, error) {
+	ctx, span := startQuery(ctx, "media.get_by_checksum")
+	defer span.End()
+
+	query := "SELECT " + mediaColumns + " FROM media WHERE owner_id=$1 AND checksum=$2"
+
+	result, err := scanMedia(ur.db.QueryRowContext(ctx, query, ownerID, checksum))
+	if err != nil {
+		return nil, logQueryError(ctx, "media.get_by_checksum", err)
+	}
+
+	return result, nil
+}
+
+func (ur *mediaRepo) GetMany(ctx context.Context, ids []int64) ([]*repo.Media, error) {
+	ctx, span := startQuery(ctx, "media.get_many")
+	defer span.End()
+
+	result, err := ur.list(ctx, "SELECT "+mediaColumns+" FROM media WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return nil, logQueryError(ctx, "media.get_many", err)
+	}
+
+	return result, nil
+}
+
+func (ur *mediaRepo) GetUnprocessed(ctx context.Context, limit int) ([]*repo.Media, error) {
+	ctx, span := startQuery(ctx, "media.get_unprocessed")
+	defer span.End()
+
+	query := "SELECT " + mediaColumns + " FROM media WHERE processed_at IS NULL ORDER BY id LIMIT $1"
+
+	result, err := ur.list(ctx, query, limit)
+	if err != nil {
+		return nil, logQueryError(ctx, "media.get_unprocessed", err)
+	}
+
+	return result, nil
+}
+
+func (ur *mediaRepo) list(ctx context.Context, query string, args ...interface{}) ([]*repo.Media, error) {
+	rows, err := ur.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make([]*repo.Media, 0)
+	for rows.Next() {
+		m, err := scanMedia(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, m)
+	}
+
+	return result, rows.Err()
+}
+
+func (ur *mediaRepo) SetDerivatives(ctx context.Context, id int64, derivatives []*repo.Derivative) error {
+	ctx, span := startQuery(ctx, "media.set_derivatives")
+	defer span.End()
+
+	data, err := json.Marshal(derivatives)
+	if err != nil {
+		return err
+	}
+
+	result, err := ur.db.ExecContext(ctx, "UPDATE media SET derivatives=$1, processed_at=$2 WHERE id=$3", data, time.Now(), id)
+	if err != nil {
+		return logQueryError(ctx, "media.set_derivatives", err)
+	}
+
+	if rowsCount, _ := result.RowsAffected(); rowsCount == 0 {
+		return logQueryError(ctx, "media.set_derivatives", sql.ErrNoRows)
+	}
+
+	return nil
+}
+
+func (ur *mediaRepo) GetOrphans(ctx context.Context, before time.Time, afterID int64, limit int) ([]*repo.Media, error) {
+	ctx, span := startQuery(ctx, "media.get_orphans")
+	defer span.End()
+
+	query := `
+		SELECT ` + mediaColumns + `
+		FROM media m
+		WHERE m.created_at < $1 AND m.id > $2
+			AND NOT EXISTS (SELECT 1 FROM media_references r WHERE r.media_id = m.id)
+		ORDER BY m.id
+		LIMIT $3
+	`
+
+	result, err := ur.list(ctx, query, before, afterID, limit)
+	if err != nil {
+		return nil, logQueryError(ctx, "media.get_orphans", err)
+	}
+
+	return result, nil
+}
+
+func (ur *mediaRepo) DeleteOrphan(ctx context.Context, id int64) error {
+	ctx, span := startQuery(ctx, "media.delete_orphan")
+	defer span.End()
+
+	query := `
+		DELETE FROM media m
+		WHERE m.id = $1 AND NOT EXISTS (SELECT 1 FROM media_references r WHERE r.media_id = m.id)
+		RETURNING ` + mediaColumns
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := scanMedia(tx.QueryRowContext(ctx, query, id))
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityMedia, id, repo.AuditActionDelete, before, nil)
+	})
+
+	return logQueryError(ctx, "media.delete_orphan", err)
+}
+
+func (ur *mediaRepo) ChecksumInUse(ctx context.Context, checksum string, exceptID int64) (bool, error) {
+	ctx, span := startQuery(ctx, "media.checksum_in_use")
+	defer span.End()
+
+	var inUse bool
+	err := ur.db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM media WHERE checksum=$1 AND id<>$2)", checksum, exceptID).Scan(&inUse)
+	if err != nil {
+		return false, logQueryError(ctx, "media.checksum_in_use", err)
+	}
+
+	return inUse, nil
+}
+
+func (ur *mediaRepo) LockChecksum(ctx context.Context, checksum string, fn func() error) error {
+	ctx, span := startQuery(ctx, "media.lock_checksum")
+	defer span.End()
+
+	// the lock lives as long as the transaction, errors of fn are the
+	// caller's and not logged as query failures
+	var fnErr error
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", checksum)
+		if err != nil {
+			return err
+		}
+
+		fnErr = fn()
+		return nil
+	})
+	if err != nil {
+		return logQueryError(ctx, "media.lock_checksum", err)
+	}
+
+	return fnErr
+}
@@ -0,0 +1,114 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func createMedia(t *testing.T) *repo.Media {
+	user := createUser(t)
+	checksum := uuid.NewString() + uuid.NewString()
+
+	media, err := strg.Media().Create(context.Background(), &repo.Media{
+		OwnerID:     user.ID,
+		Checksum:    checksum[:64],
+		FileName:    checksum[:64] + ".jpg",
+		ContentType: "image/jpeg",
+		Size:        1024,
+		Width:       640,
+		Height:      480,
+	})
+	require.NoError(t, err)
+	require.NotZero(t, media.ID)
+
+	return media
+}
+
+func TestGetMediaByChecksum(t *testing.T) {
+	m := createMedia(t)
+
+	media, err := strg.Media().GetByChecksum(context.Background(), m.OwnerID, m.Checksum)
+	require.NoError(t, err)
+	require.Equal(t, m.ID, media.ID)
+
+	_, err = strg.Media().GetByChecksum(context.Background(), m.OwnerID+1, m.Checksum)
+	require.Error(t, err)
+}
+
+func TestDeleteOrphanedMedia(t *testing.T) {
+	orphan := createMedia(t)
+	attached := createMedia(t)
+
+	hotel := createHotel(t)
+	hotel.ImageID = &attached.ID
+	_, err := strg.Hotel().Update(context.Background(), hotel)
+	require.NoError(t, err)
+
+	orphans, err := strg.Media().GetOrphans(context.Background(), time.Now().Add(time.Minute), orphan.ID-1, 100)
+	require.NoError(t, err)
+
+	ids := make([]int64, 0, len(orphans))
+	for _, m := range orphans {
+		ids = append(ids, m.ID)
+	}
+	require.Contains(t, ids, orphan.ID)
+	require.NotContains(t, ids, attached.ID)
+
+	err = strg.Media().DeleteOrphan(context.Background(), attached.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	err = strg.Media().DeleteOrphan(context.Background(), orphan.ID)
+	require.NoError(t, err)
+
+	_, err = strg.Media().Get(context.Background(), orphan.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestLockChecksum(t *testing.T) {
+	checksum := uuid.NewString()
+	locked := make(chan struct{})
+	release := make(chan struct{})
+
+	done := make(chan error)
+	go func() {
+		done <- strg.Media().LockChecksum(context.Background(), checksum, func() error {
+			close(locked)
+			<-release
+			return nil
+		})
+	}()
+	<-locked
+
+	var (
+		mu    sync.Mutex
+		order []string
+	)
+	record := func(step string) {
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, step)
+	}
+
+	waiting := make(chan error)
+	go func() {
+		waiting <- strg.Media().LockChecksum(context.Background(), checksum, func() error {
+			record("second")
+			return nil
+		})
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	record("first")
+	close(release)
+
+	require.NoError(t, <-done)
+	require.NoError(t, <-waiting)
+	require.Equal(t, []string{"first", "second"}, order)
+}
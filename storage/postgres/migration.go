@@ -0,0 +1,16 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MigrationVersion reads the schema version recorded by golang-migrate.
+func MigrationVersion(ctx context.Context, db *sqlx.DB) (version uint, dirty bool, err error) {
+	ctx, span := startQuery(ctx, "migration.version")
+	defer span.End()
+
+	err = db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	return version, dirty, logQueryError(ctx, "migration.version", err)
+}
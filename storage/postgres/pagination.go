@@ -0,0 +1,31 @@
+package postgres
+
+import (
+	"fmt"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+)
+
+// paginate appends the keyset condition to filter when a cursor is given and
+// builds the matching LIMIT clause. args holds the placeholders already used
+// by filter. One extra row is always requested so the caller can tell whether
+// another page follows.
+func paginate(filter string, args []interface{}, limit, page int32, cursor *repo.Cursor) (string, string, []interface{}) {
+	if cursor == nil {
+		offset := (page - 1) * limit
+		return filter, fmt.Sprintf(" LIMIT %d OFFSET %d ", limit+1, offset), args
+	}
+
+	filter = where(filter, fmt.Sprintf("(created_at, id) < ($%d, $%d)", len(args)+1, len(args)+2))
+
+	args = append(args[:len(args):len(args)], cursor.CreatedAt, cursor.ID)
+	return filter, fmt.Sprintf(" LIMIT %d ", limit+1), args
+}
+
+// where adds condition to a filter that may or may not have a WHERE yet.
+func where(filter, condition string) string {
+	if filter == "" {
+		return " WHERE " + condition + " "
+	}
+	return filter + " AND " + condition + " "
+}
@@ -0,0 +1,40 @@
+package postgres
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/MuhammadyusufAdhamov/booking/pkg/errs"
+)
+
+// patchSet builds the SET list of a partial update from column/value pairs.
+// Only the allowed columns may be patched, the rest are rejected so callers
+// can never reach id, version or timestamps. Placeholders start at $1, the
+// id goes last.
+func patchSet(fields map[string]interface{}, allowed ...string) (string, []interface{}, error) {
+	permitted := make(map[string]bool, len(allowed))
+	for _, column := range allowed {
+		permitted[column] = true
+	}
+
+	columns := make([]string, 0, len(fields))
+	for column := range fields {
+		if !permitted[column] {
+			return "", nil, errs.Validation(errs.Field(column, "can not be patched"))
+		}
+		columns = append(columns, column)
+	}
+	sort.Strings(columns)
+
+	var (
+		set  []string
+		args []interface{}
+	)
+	for i, column := range columns {
+		set = append(set, fmt.Sprintf("%s=$%d", column, i+1))
+		args = append(args, fields[column])
+	}
+
+	return strings.Join(set, ", "), args, nil
+}
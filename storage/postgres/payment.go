@@ -0,0 +1,560 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/jmoiron/sqlx"
+)
+
+type paymentRepo struct {
+	db *sqlx.DB
+}
+
+func NewPayment(db *sqlx.DB) repo.PaymentStorageI {
+	return &paymentRepo{
+		db: db,
+	}
+}
+
+const paymentColumns = `
+	id,
+	booking_id,
+	provider,
+	COALESCE(provider_ref, ''),
+	amount,
+	currency,
+	status,
+	refunded,
+	created_at,
+	updated_at
+`
+
+const refundColumns = `
+	id,
+	payment_id,
+	COALESCE(provider_ref, ''),
+	amount,
+	reason,
+	status,
+	created_at,
+	updated_at
+`
+
+func scanPayment(row interface{ Scan(...interface{}) error }) (*repo.Payment, error) {
+	var result repo.Payment
+
+	err := row.Scan(
+		&result.ID,
+		&result.BookingID,
+		&result.Provider,
+		&result.ProviderRef,
+		&result.Amount,
+		&result.Currency,
+		&result.Status,
+		&result.Refunded,
+		&result.CreatedAt,
+		&result.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func scanRefund(row interface{ Scan(...interface{}) error }) (*repo.Refund, error) {
+	var result repo.Refund
+
+	err := row.Scan(
+		&result.ID,
+		&result.PaymentID,
+		&result.ProviderRef,
+		&result.Amount,
+		&result.Reason,
+		&result.Status,
+		&result.CreatedAt,
+		&result.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (ur *paymentRepo) Create(ctx context.Context, p *repo.Payment) (*repo.Payment, error) {
+	ctx, span := startQuery(ctx, "payment.create")
+	defer span.End()
+
+	query := `
+		INSERT INTO payments(
+			booking_id,
+			provider,
+			amount,
+			currency,
+			status
+		) VALUES($1, $2, $3, $4, $5)
+		RETURNING ` + paymentColumns
+
+	var result *repo.Payment
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		outstanding, currency, err := outstandingBalance(ctx, tx, p.BookingID)
+		if err != nil {
+			return err
+		}
+
+		if outstanding <= 0 {
+			return repo.ErrBookingPaid
+		}
+
+		amount := p.Amount
+		if amount == 0 {
+			amount = outstanding
+		}
+		if amount > outstanding {
+			return repo.ErrPaymentTooLarge
+		}
+
+		result, err = scanPayment(tx.QueryRowContext(ctx, query, p.BookingID, p.Provider, amount, currency, p.Status))
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityPayment, result.ID, repo.AuditActionCreate, nil, result)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "payment.create", err)
+	}
+
+	return result, nil
+}
+
+// outstandingBalance locks the booking and returns what is left to pay on
+// it: the total less what was captured and not refunded and the payments
+// still in flight. Pending refunds count as refunded.
+func outstandingBalance(ctx context.Context, tx *sqlx.Tx, bookingID int64) (int64, string, error) {
+	var (
+		total    int64
+		currency string
+		status   string
+	)
+
+	err := tx.QueryRowContext(ctx,
+		`SELECT total, currency, status FROM bookings WHERE id=$1 AND `+activeRows+` FOR UPDATE`, bookingID,
+	).Scan(&total, &currency, &status)
+	if err != nil {
+		return 0, "", err
+	}
+
+	if status == repo.BookingStatusCancelled {
+		return 0, "", repo.ErrBookingCancelled
+	}
+
+	var taken int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(SUM(CASE
+			WHEN p.status=$2 THEN p.amount - p.refunded - COALESCE((
+				SELECT SUM(r.amount) FROM refunds r WHERE r.payment_id=p.id AND r.status=$3
+			), 0)
+			ELSE p.amount
+		END), 0)
+		FROM payments p
+		WHERE p.booking_id=$1 AND p.status IN ($2, $4, $5)
+	`, bookingID, repo.PaymentStatusCaptured, repo.RefundStatusPending, repo.PaymentStatusPending, repo.PaymentStatusAuthorized).Scan(&taken)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return total - taken, currency, nil
+}
+
+func (ur *paymentRepo) Get(ctx context.Context, id int64) (*repo.Payment, error) {
+	ctx, span := startQuery(ctx, "payment.get")
+	defer span.End()
+
+	result, err := ur.get(ctx, ur.db, id, false)
+	if err != nil {
+		return nil, logQueryError(ctx, "payment.get", err)
+	}
+
+	return result, nil
+}
+
+func (ur *paymentRepo) get(ctx context.Context, q queryer, id int64, forUpdate bool) (*repo.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE id=$1`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	return scanPayment(q.QueryRowContext(ctx, query, id))
+}
+
+func (ur *paymentRepo) GetByProviderRef(ctx context.Context, provider, ref string) (*repo.Payment, error) {
+	ctx, span := startQuery(ctx, "payment.get_by_provider_ref")
+	defer span.End()
+
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE provider=$1 AND provider_ref=$2`
+
+	result, err := scanPayment(ur.db.QueryRowContext(ctx, query, provider, ref))
+	if err != nil {
+		return nil, logQueryError(ctx, "payment.get_by_provider_ref", err)
+	}
+
+	return result, nil
+}
+
+func (ur *paymentRepo) GetByBooking(ctx context.Context, bookingID int64) ([]*repo.Payment, error) {
+	ctx, span := startQuery(ctx, "payment.get_by_booking")
+	defer span.End()
+
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE booking_id=$1 ORDER BY id`
+
+	rows, err := ur.db.QueryContext(ctx, query, bookingID)
+	if err != nil {
+		return nil, logQueryError(ctx, "payment.get_by_booking", err)
+	}
+	defer rows.Close()
+
+	result := make([]*repo.Payment, 0)
+	byID := make(map[int64]*repo.Payment)
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "payment.get_by_booking", err)
+		}
+
+		p.Refunds = make([]*repo.Refund, 0)
+		result = append(result, p)
+		byID[p.ID] = p
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "payment.get_by_booking", err)
+	}
+
+	refundsQuery := `
+		SELECT ` + refundColumns + ` FROM refunds
+		WHERE payment_id IN (SELECT id FROM payments WHERE booking_id=$1)
+		ORDER BY id
+	`
+
+	refundRows, err := ur.db.QueryContext(ctx, refundsQuery, bookingID)
+	if err != nil {
+		return nil, logQueryError(ctx, "payment.get_by_booking", err)
+	}
+	defer refundRows.Close()
+
+	for refundRows.Next() {
+		r, err := scanRefund(refundRows)
+		if err != nil {
+			return nil, logQueryError(ctx, "payment.get_by_booking", err)
+		}
+
+		if p, ok := byID[r.PaymentID]; ok {
+			p.Refunds = append(p.Refunds, r)
+		}
+	}
+
+	if err := refundRows.Err(); err != nil {
+		return nil, logQueryError(ctx, "payment.get_by_booking", err)
+	}
+
+	return result, nil
+}
+
+func (ur *paymentRepo) SetProviderRef(ctx context.Context, id int64, ref string) error {
+	ctx, span := startQuery(ctx, "payment.set_provider_ref")
+	defer span.End()
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, id, true)
+		if err != nil {
+			return err
+		}
+
+		after, err := scanPayment(tx.QueryRowContext(ctx,
+			`UPDATE payments SET provider_ref=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2 RETURNING `+paymentColumns, ref, id))
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityPayment, id, repo.AuditActionUpdate, before, after)
+	})
+
+	return logQueryError(ctx, "payment.set_provider_ref", err)
+}
+
+func (ur *paymentRepo) SetStatus(ctx context.Context, id int64, status string) (*repo.Payment, error) {
+	ctx, span := startQuery(ctx, "payment.set_status")
+	defer span.End()
+
+	var result *repo.Payment
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = ur.setStatus(ctx, tx, id, status)
+		return err
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "payment.set_status", err)
+	}
+
+	return result, nil
+}
+
+func (ur *paymentRepo) setStatus(ctx context.Context, tx *sqlx.Tx, id int64, status string) (*repo.Payment, error) {
+	before, err := ur.get(ctx, tx, id, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if before.Status == status {
+		return before, nil
+	}
+
+	if !repo.CanTransition(repo.PaymentTransitions, before.Status, status) {
+		return nil, repo.ErrPaymentState
+	}
+
+	result, err := scanPayment(tx.QueryRowContext(ctx,
+		`UPDATE payments SET status=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2 RETURNING `+paymentColumns, status, id))
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeAudit(ctx, tx, repo.AuditEntityPayment, id, repo.AuditActionUpdate, before, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (ur *paymentRepo) CreateRefund(ctx context.Context, r *repo.Refund) (*repo.Refund, error) {
+	ctx, span := startQuery(ctx, "payment.create_refund")
+	defer span.End()
+
+	var result *repo.Refund
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = ur.createRefund(ctx, tx, r)
+		return err
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "payment.create_refund", err)
+	}
+
+	return result, nil
+}
+
+func (ur *paymentRepo) createRefund(ctx context.Context, tx *sqlx.Tx, r *repo.Refund) (*repo.Refund, error) {
+	// the lock serializes refunds of the same payment
+	payment, err := ur.get(ctx, tx, r.PaymentID, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if payment.Status != repo.PaymentStatusCaptured {
+		return nil, repo.ErrPaymentState
+	}
+
+	var pending int64
+	err = tx.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(amount), 0) FROM refunds WHERE payment_id=$1 AND status=$2`,
+		r.PaymentID, repo.RefundStatusPending,
+	).Scan(&pending)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.Amount > payment.Amount-payment.Refunded-pending {
+		return nil, repo.ErrRefundTooLarge
+	}
+
+	result, err := scanRefund(tx.QueryRowContext(ctx, `
+		INSERT INTO refunds(
+			payment_id,
+			amount,
+			reason,
+			status
+		) VALUES($1, $2, $3, $4)
+		RETURNING `+refundColumns, r.PaymentID, r.Amount, r.Reason, repo.RefundStatusPending))
+	if err != nil {
+		return nil, err
+	}
+
+	err = writeAudit(ctx, tx, repo.AuditEntityRefund, result.ID, repo.AuditActionCreate, nil, result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (ur *paymentRepo) CancelBooking(ctx context.Context, bookingID int64, statuses map[int64]string, refunds []*repo.Refund) (*repo.Booking, []*repo.Refund, error) {
+	ctx, span := startQuery(ctx, "payment.cancel_booking")
+	defer span.End()
+
+	var (
+		booking *repo.Booking
+		result  = make([]*repo.Refund, 0, len(refunds))
+	)
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		var err error
+		booking, err = setBookingStatus(ctx, tx, bookingID, repo.BookingStatusCancelled)
+		if err != nil {
+			return err
+		}
+
+		// in order of id, so the rows are always locked alike
+		ids := make([]int64, 0, len(statuses))
+		for id := range statuses {
+			ids = append(ids, id)
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		for _, id := range ids {
+			payment, err := ur.setStatus(ctx, tx, id, statuses[id])
+			if err != nil {
+				return err
+			}
+			if payment.BookingID != bookingID {
+				return sql.ErrNoRows
+			}
+		}
+
+		for _, r := range refunds {
+			refund, err := ur.createRefund(ctx, tx, r)
+			if err != nil {
+				return err
+			}
+			result = append(result, refund)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, logQueryError(ctx, "payment.cancel_booking", err)
+	}
+
+	return booking, result, nil
+}
+
+func (ur *paymentRepo) getRefund(ctx context.Context, q queryer, id int64) (*repo.Refund, error) {
+	return scanRefund(q.QueryRowContext(ctx, `SELECT `+refundColumns+` FROM refunds WHERE id=$1 FOR UPDATE`, id))
+}
+
+func (ur *paymentRepo) SetRefundProviderRef(ctx context.Context, id int64, ref string) error {
+	ctx, span := startQuery(ctx, "payment.set_refund_provider_ref")
+	defer span.End()
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.getRefund(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		after, err := scanRefund(tx.QueryRowContext(ctx,
+			`UPDATE refunds SET provider_ref=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2 RETURNING `+refundColumns, ref, id))
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityRefund, id, repo.AuditActionUpdate, before, after)
+	})
+
+	return logQueryError(ctx, "payment.set_refund_provider_ref", err)
+}
+
+func (ur *paymentRepo) GetRefundByProviderRef(ctx context.Context, provider, ref string) (*repo.Refund, error) {
+	ctx, span := startQuery(ctx, "payment.get_refund_by_provider_ref")
+	defer span.End()
+
+	query := `
+		SELECT ` + refundColumns + ` FROM refunds
+		WHERE provider_ref=$2
+			AND payment_id IN (SELECT id FROM payments WHERE provider=$1)
+	`
+
+	result, err := scanRefund(ur.db.QueryRowContext(ctx, query, provider, ref))
+	if err != nil {
+		return nil, logQueryError(ctx, "payment.get_refund_by_provider_ref", err)
+	}
+
+	return result, nil
+}
+
+func (ur *paymentRepo) SetRefundStatus(ctx context.Context, id int64, status string) (*repo.Refund, error) {
+	ctx, span := startQuery(ctx, "payment.set_refund_status")
+	defer span.End()
+
+	var result *repo.Refund
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		var paymentID int64
+		err := tx.QueryRowContext(ctx, `SELECT payment_id FROM refunds WHERE id=$1`, id).Scan(&paymentID)
+		if err != nil {
+			return err
+		}
+
+		// lock the payment first, as CreateRefund does
+		payment, err := ur.get(ctx, tx, paymentID, true)
+		if err != nil {
+			return err
+		}
+
+		before, err := ur.getRefund(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if before.Status == status {
+			result = before
+			return nil
+		}
+
+		if !repo.CanTransition(repo.RefundTransitions, before.Status, status) {
+			return repo.ErrPaymentState
+		}
+
+		result, err = scanRefund(tx.QueryRowContext(ctx,
+			`UPDATE refunds SET status=$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2 RETURNING `+refundColumns, status, id))
+		if err != nil {
+			return err
+		}
+
+		err = writeAudit(ctx, tx, repo.AuditEntityRefund, id, repo.AuditActionUpdate, before, result)
+		if err != nil {
+			return err
+		}
+
+		if status != repo.RefundStatusSucceeded {
+			return nil
+		}
+
+		after, err := scanPayment(tx.QueryRowContext(ctx,
+			`UPDATE payments SET refunded=refunded+$1, updated_at=CURRENT_TIMESTAMP WHERE id=$2 RETURNING `+paymentColumns,
+			result.Amount, paymentID))
+		if err != nil {
+			return err
+		}
+
+		err = writeAudit(ctx, tx, repo.AuditEntityPayment, paymentID, repo.AuditActionUpdate, payment, after)
+		if err != nil {
+			return err
+		}
+
+		return refundCommission(ctx, tx, after, result)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "payment.set_refund_status", err)
+	}
+
+	return result, nil
+}
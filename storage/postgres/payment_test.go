@@ -0,0 +1,151 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func createPayment(t *testing.T, bookingID int64) *repo.Payment {
+	payment, err := strg.Payment().Create(context.Background(), &repo.Payment{
+		BookingID: bookingID,
+		Provider:  "fake",
+		Amount:    10000,
+		Status:    repo.PaymentStatusPending,
+	})
+	require.NoError(t, err)
+
+	err = strg.Payment().SetProviderRef(context.Background(), payment.ID, "pi_"+uuid.NewString())
+	require.NoError(t, err)
+
+	return payment
+}
+
+func TestBookingStatus(t *testing.T) {
+	booking := createBooking(t)
+	require.Equal(t, repo.BookingStatusPending, booking.Status)
+
+	confirmed, err := strg.Booking().SetStatus(context.Background(), booking.ID, repo.BookingStatusConfirmed)
+	require.NoError(t, err)
+	require.Equal(t, repo.BookingStatusConfirmed, confirmed.Status)
+	require.Equal(t, booking.Version+1, confirmed.Version)
+
+	_, err = strg.Booking().SetStatus(context.Background(), booking.ID, repo.BookingStatusPending)
+	require.ErrorIs(t, err, repo.ErrBookingState)
+}
+
+func TestPaymentStatus(t *testing.T) {
+	booking := createBooking(t)
+	payment := createPayment(t, booking.ID)
+
+	captured, err := strg.Payment().SetStatus(context.Background(), payment.ID, repo.PaymentStatusCaptured)
+	require.NoError(t, err)
+	require.Equal(t, repo.PaymentStatusCaptured, captured.Status)
+
+	// webhooks may arrive twice
+	_, err = strg.Payment().SetStatus(context.Background(), payment.ID, repo.PaymentStatusCaptured)
+	require.NoError(t, err)
+
+	_, err = strg.Payment().SetStatus(context.Background(), payment.ID, repo.PaymentStatusFailed)
+	require.ErrorIs(t, err, repo.ErrPaymentState)
+
+	got, err := strg.Payment().GetByProviderRef(context.Background(), "fake", captured.ProviderRef)
+	require.NoError(t, err)
+	require.Equal(t, payment.ID, got.ID)
+}
+
+func TestRefund(t *testing.T) {
+	booking := createBooking(t)
+	payment := createPayment(t, booking.ID)
+
+	// only captured payments can be refunded
+	_, err := strg.Payment().CreateRefund(context.Background(), &repo.Refund{PaymentID: payment.ID, Amount: 100})
+	require.ErrorIs(t, err, repo.ErrPaymentState)
+
+	_, err = strg.Payment().SetStatus(context.Background(), payment.ID, repo.PaymentStatusCaptured)
+	require.NoError(t, err)
+
+	refund, err := strg.Payment().CreateRefund(context.Background(), &repo.Refund{PaymentID: payment.ID, Amount: 6000})
+	require.NoError(t, err)
+	require.Equal(t, repo.RefundStatusPending, refund.Status)
+
+	// the pending refund counts against what is left
+	_, err = strg.Payment().CreateRefund(context.Background(), &repo.Refund{PaymentID: payment.ID, Amount: 5000})
+	require.ErrorIs(t, err, repo.ErrRefundTooLarge)
+
+	err = strg.Payment().SetRefundProviderRef(context.Background(), refund.ID, "re_"+uuid.NewString())
+	require.NoError(t, err)
+
+	_, err = strg.Payment().SetRefundStatus(context.Background(), refund.ID, repo.RefundStatusSucceeded)
+	require.NoError(t, err)
+
+	payments, err := strg.Payment().GetByBooking(context.Background(), booking.ID)
+	require.NoError(t, err)
+	require.Len(t, payments, 1)
+	require.Equal(t, int64(6000), payments[0].Refunded)
+	require.Len(t, payments[0].Refunds, 1)
+}
+
+func TestPaymentBalance(t *testing.T) {
+	booking := createBooking(t)
+	createPayment(t, booking.ID)
+
+	// the payment in flight holds its part of the balance back
+	_, err := strg.Payment().Create(context.Background(), &repo.Payment{
+		BookingID: booking.ID,
+		Provider:  "fake",
+		Amount:    3000,
+		Status:    repo.PaymentStatusPending,
+	})
+	require.ErrorIs(t, err, repo.ErrPaymentTooLarge)
+
+	rest, err := strg.Payment().Create(context.Background(), &repo.Payment{
+		BookingID: booking.ID,
+		Provider:  "fake",
+		Status:    repo.PaymentStatusPending,
+	})
+	require.NoError(t, err)
+	require.Equal(t, booking.Total-10000, rest.Amount)
+	require.Equal(t, booking.Currency, rest.Currency)
+
+	_, err = strg.Payment().Create(context.Background(), &repo.Payment{
+		BookingID: booking.ID,
+		Provider:  "fake",
+		Status:    repo.PaymentStatusPending,
+	})
+	require.ErrorIs(t, err, repo.ErrBookingPaid)
+}
+
+func TestCancelBookingPayments(t *testing.T) {
+	booking := createBooking(t)
+	captured := createPayment(t, booking.ID)
+	_, err := strg.Payment().SetStatus(context.Background(), captured.ID, repo.PaymentStatusCaptured)
+	require.NoError(t, err)
+	pending := createPayment(t, createBooking(t).ID)
+
+	// a refund that is too large rolls the whole cancellation back
+	_, _, err = strg.Payment().CancelBooking(context.Background(), booking.ID, nil, []*repo.Refund{
+		{PaymentID: captured.ID, Amount: 20000},
+	})
+	require.ErrorIs(t, err, repo.ErrRefundTooLarge)
+
+	got, err := strg.Booking().Get(context.Background(), booking.ID)
+	require.NoError(t, err)
+	require.Equal(t, repo.BookingStatusPending, got.Status)
+
+	// payments of other bookings are left alone
+	_, _, err = strg.Payment().CancelBooking(context.Background(), booking.ID, map[int64]string{pending.ID: repo.PaymentStatusCancelled}, nil)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	cancelled, refunds, err := strg.Payment().CancelBooking(context.Background(), booking.ID, nil, []*repo.Refund{
+		{PaymentID: captured.ID, Amount: 4000, Reason: "booking cancelled"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, repo.BookingStatusCancelled, cancelled.Status)
+	require.Len(t, refunds, 1)
+	require.Equal(t, repo.RefundStatusPending, refunds[0].Status)
+}
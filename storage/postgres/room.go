@@ -1,8 +1,9 @@
 package postgres
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
+	"strconv"
+	"time"
 
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/jmoiron/sqlx"
@@ -18,36 +19,63 @@ func NewRoom(db *sqlx.DB) repo.RoomsStorageI {
 	}
 }
 
-func (ur *roomRepo) Create(room *repo.Room) (*repo.Room, error) {
+func (ur *roomRepo) Create(ctx context.Context, room *repo.Room) (*repo.Room, error) {
+	ctx, span := startQuery(ctx, "room.create")
+	defer span.End()
+
 	query := `
 		INSERT INTO rooms(
 			type,
 			number_of_room,
-			room_image_url,
+			price,
+			currency,
+			image_id,
 			status,
 		    hotel_id
-		) VALUES($1, $2, $3, $4, $5)
-		RETURNING id, created_at
+		) VALUES($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, version, created_at
 	`
 
-	row := ur.db.QueryRow(
-		query,
-		room.Type,
-		room.NumberOfRoom,
-		room.RoomImageUrl,
-		room.Status,
-		room.HotelId,
-	)
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowContext(
+			ctx,
+			query,
+			room.Type,
+			room.NumberOfRoom,
+			room.Price,
+			room.Currency,
+			room.ImageID,
+			room.Status,
+			room.HotelId,
+		)
+
+		err := row.Scan(&room.ID, &room.Version, &room.CreatedAt)
+		if err != nil {
+			return err
+		}
 
-	err := row.Scan(&room.ID, &room.CreatedAt)
+		return writeAudit(ctx, tx, repo.AuditEntityRoom, room.ID, repo.AuditActionCreate, nil, room)
+	})
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "room.create", err)
 	}
 
 	return room, nil
 }
 
-func (ur *roomRepo) Get(id int64) (*repo.Room, error) {
+func (ur *roomRepo) Get(ctx context.Context, id int64) (*repo.Room, error) {
+	ctx, span := startQuery(ctx, "room.get")
+	defer span.End()
+
+	result, err := ur.get(ctx, ur.db, id, activeRows, false)
+	if err != nil {
+		return nil, logQueryError(ctx, "room.get", err)
+	}
+
+	return result, nil
+}
+
+func (ur *roomRepo) get(ctx context.Context, q queryer, id int64, scope string, forUpdate bool) (*repo.Room, error) {
 	var result repo.Room
 
 	query := `
@@ -55,23 +83,36 @@ func (ur *roomRepo) Get(id int64) (*repo.Room, error) {
 			id,
 			type,
 			number_of_room,
+			price,
+			currency,
+			image_id,
 			room_image_url,
 			status,
 			hotel_id,
-			created_at
+			version,
+			created_at,
+			deleted_at
 		FROM rooms
-		WHERE id=$1
+		WHERE id=$1 AND ` + scope + `
 	`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
 
-	row := ur.db.QueryRow(query, id)
+	row := q.QueryRowContext(ctx, query, id)
 	err := row.Scan(
 		&result.ID,
 		&result.Type,
 		&result.NumberOfRoom,
-		&result.RoomImageUrl,
+		&result.Price,
+		&result.Currency,
+		&result.ImageID,
+		&result.ImageURL,
 		&result.Status,
 		&result.HotelId,
+		&result.Version,
 		&result.CreatedAt,
+		&result.DeletedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -80,41 +121,49 @@ func (ur *roomRepo) Get(id int64) (*repo.Room, error) {
 	return &result, nil
 }
 
-func (ur *roomRepo) GetAll(params *repo.GetAllRoomsParams) (*repo.GetAllRoomsResult, error) {
+func (ur *roomRepo) GetAll(ctx context.Context, params *repo.GetAllRoomsParams) (*repo.GetAllRoomsResult, error) {
+	ctx, span := startQuery(ctx, "room.get_all")
+	defer span.End()
+
 	result := repo.GetAllRoomsResult{
 		Rooms: make([]*repo.Room, 0),
 	}
 
-	offset := (params.Page - 1) * params.Limit
-
-	limit := fmt.Sprintf(" LIMIT %d OFFSET %d ", params.Limit, offset)
-
 	filter := ""
+	if !params.IncludeDeleted {
+		filter = where(filter, activeRows)
+	}
+
+	var args []interface{}
 	if params.Search != "" {
-		str := "%" + params.Search + "%"
-		filter += fmt.Sprintf(`
-			WHERE type ILIKE '%s' OR sleeps ILIKE '%s' OR status ILIKE '%s' `,
-			str, str, str,
-		)
+		args = append(args, "%"+params.Search+"%")
+		filter = where(filter, `(type ILIKE $1 OR status ILIKE $1)`)
 	}
 
+	pageFilter, limit, pageArgs := paginate(filter, args, params.Limit, params.Page, params.Cursor)
+
 	query := `
 		SELECT
 			id,
 			type,
 			number_of_room,
+			price,
+			currency,
+			image_id,
 			room_image_url,
 			status,
 			hotel_id,
-			created_at
+			version,
+			created_at,
+			deleted_at
 		FROM rooms
-		` + filter + `
-		ORDER BY created_at desc
+		` + pageFilter + `
+		ORDER BY created_at desc, id desc
 		` + limit
 
-	rows, err := ur.db.Query(query)
+	rows, err := ur.db.QueryContext(ctx, query, pageArgs...)
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "room.get_all", err)
 	}
 
 	defer rows.Close()
@@ -126,70 +175,271 @@ func (ur *roomRepo) GetAll(params *repo.GetAllRoomsParams) (*repo.GetAllRoomsRes
 			&u.ID,
 			&u.Type,
 			&u.NumberOfRoom,
-			&u.RoomImageUrl,
+			&u.Price,
+			&u.Currency,
+			&u.ImageID,
+			&u.ImageURL,
 			&u.Status,
 			&u.HotelId,
+			&u.Version,
 			&u.CreatedAt,
+			&u.DeletedAt,
 		)
 		if err != nil {
-			return nil, err
+			return nil, logQueryError(ctx, "room.get_all", err)
 		}
 
 		result.Rooms = append(result.Rooms, &u)
 	}
 
+	if len(result.Rooms) > int(params.Limit) {
+		result.Rooms = result.Rooms[:params.Limit]
+
+		last := result.Rooms[len(result.Rooms)-1]
+		result.NextCursor = &repo.Cursor{
+			CreatedAt: last.CreatedAt,
+			ID:        last.ID,
+		}
+	}
+
 	queryCount := `SELECT count(1) FROM rooms ` + filter
-	err = ur.db.QueryRow(queryCount).Scan(&result.Count)
+	err = ur.db.QueryRowContext(ctx, queryCount, args...).Scan(&result.Count)
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "room.get_all", err)
 	}
 
 	return &result, nil
 }
 
-func (ur *roomRepo) Update(room *repo.Room) (*repo.Room, error) {
+func (ur *roomRepo) Update(ctx context.Context, room *repo.Room) (*repo.Room, error) {
+	ctx, span := startQuery(ctx, "room.update")
+	defer span.End()
+
 	query := `update rooms set 
 			type=$1,
 			number_of_room=$2,
-			room_image_url=$3,
-			status=$4,
-			hotel_id=$5
-		where id=$6
-		returning created_at
+			price=$3,
+			currency=$4,
+			image_id=$5,
+			room_image_url=CASE WHEN $5::BIGINT IS NULL THEN room_image_url END,
+			status=$6,
+			hotel_id=$7,
+			version=version+1
+		where id=$8
+		returning version, created_at, room_image_url
 		`
 
-	err := ur.db.QueryRow(
-		query,
-		room.Type,
-		room.NumberOfRoom,
-		room.RoomImageUrl,
-		room.Status,
-		room.HotelId,
-		room.ID,
-	).Scan(&room.CreatedAt)
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, room.ID, activeRows, true)
+		if err != nil {
+			return err
+		}
+
+		if before.Version != room.Version {
+			return repo.ErrVersionMismatch
+		}
+
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			room.Type,
+			room.NumberOfRoom,
+			room.Price,
+			room.Currency,
+			room.ImageID,
+			room.Status,
+			room.HotelId,
+			room.ID,
+		).Scan(&room.Version, &room.CreatedAt, &room.ImageURL)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityRoom, room.ID, repo.AuditActionUpdate, before, room)
+	})
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "room.update", err)
 	}
 
 	return room, nil
 }
 
-func (ur *roomRepo) Delete(id int64) error {
-	query := `delete from rooms where id=$1 returning id`
+// Patch updates only the given columns, keyed by column name.
+func (ur *roomRepo) Patch(ctx context.Context, id, version int64, fields map[string]interface{}) (*repo.Room, error) {
+	ctx, span := startQuery(ctx, "room.patch")
+	defer span.End()
+
+	set, args, err := patchSet(fields,
+		"type",
+		"number_of_room",
+		"price",
+		"currency",
+		"image_id",
+		"status",
+		"hotel_id",
+	)
+	if err != nil {
+		return nil, logQueryError(ctx, "room.patch", err)
+	}
+
+	var result *repo.Room
+	err = inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, id, activeRows, true)
+		if err != nil {
+			return err
+		}
+
+		if before.Version != version {
+			return repo.ErrVersionMismatch
+		}
+
+		if len(fields) == 0 {
+			result = before
+			return nil
+		}
+
+		// a patched image replaces the legacy one, even when it is cleared
+		if _, ok := fields["image_id"]; ok {
+			set += ", room_image_url=NULL"
+		}
+
+		query := "update rooms set " + set + ", version=version+1 where id=$" + strconv.Itoa(len(args)+1)
+		_, err = tx.ExecContext(ctx, query, append(args, id)...)
+		if err != nil {
+			return err
+		}
+
+		result, err = ur.get(ctx, tx, id, activeRows, false)
+		if err != nil {
+			return err
+		}
 
-	result, err := ur.db.Exec(query, id)
+		return writeAudit(ctx, tx, repo.AuditEntityRoom, id, repo.AuditActionUpdate, before, result)
+	})
 	if err != nil {
-		return err
+		return nil, logQueryError(ctx, "room.patch", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	return result, nil
+}
+
+func (ur *roomRepo) Delete(ctx context.Context, id, version int64) error {
+	ctx, span := startQuery(ctx, "room.delete")
+	defer span.End()
+
+	query := `update rooms set
+			deleted_at=CURRENT_TIMESTAMP,
+			version=version+1
+		where id=$1
+		returning version, deleted_at
+	`
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, id, activeRows, true)
+		if err != nil {
+			return err
+		}
+
+		if before.Version != version {
+			return repo.ErrVersionMismatch
+		}
+
+		after := *before
+		err = tx.QueryRowContext(ctx, query, id).Scan(&after.Version, &after.DeletedAt)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityRoom, id, repo.AuditActionDelete, before, &after)
+	})
+
+	return logQueryError(ctx, "room.delete", err)
+}
+
+func (ur *roomRepo) Restore(ctx context.Context, id int64) (*repo.Room, error) {
+	ctx, span := startQuery(ctx, "room.restore")
+	defer span.End()
+
+	query := `update rooms set
+			deleted_at=NULL,
+			version=version+1
+		where id=$1
+		returning version
+	`
+
+	var result *repo.Room
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.get(ctx, tx, id, deletedRows, true)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.DeletedAt = nil
+		err = tx.QueryRowContext(ctx, query, id).Scan(&after.Version)
+		if err != nil {
+			return err
+		}
+
+		result = &after
+		return writeAudit(ctx, tx, repo.AuditEntityRoom, id, repo.AuditActionRestore, before, &after)
+	})
 	if err != nil {
-		return err
+		return nil, logQueryError(ctx, "room.restore", err)
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
+	return result, nil
+}
+
+// Purge hard deletes rows soft deleted before the given time, skipping rows
+// that are still referenced.
+func (ur *roomRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := startQuery(ctx, "room.purge")
+	defer span.End()
+
+	query := `delete from rooms
+		where deleted_at < $1
+			AND NOT EXISTS (SELECT 1 FROM bookings b WHERE b.room_id=rooms.id)
+		returning id
+	`
+
+	var count int64
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, before)
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			err := writeAudit(ctx, tx, repo.AuditEntityRoom, id, repo.AuditActionPurge, nil, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		count = int64(len(ids))
+		return nil
+	})
+	if err != nil {
+		return 0, logQueryError(ctx, "room.purge", err)
 	}
 
-	return nil
+	return count, nil
 }
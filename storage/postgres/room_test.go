@@ -1,6 +1,7 @@
 package postgres_test
 
 import (
+	"context"
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/bxcodec/faker/v4"
 	"github.com/stretchr/testify/require"
@@ -10,7 +11,7 @@ import (
 func createRoom(t *testing.T) *repo.Room {
 	hotel := createHotel(t)
 
-	room, err := strg.Room().Create(&repo.Room{
+	room, err := strg.Room().Create(context.Background(), &repo.Room{
 		Type:    faker.SENTENCE,
 		HotelId: int(hotel.ID),
 	})
@@ -23,7 +24,7 @@ func createRoom(t *testing.T) *repo.Room {
 func TestGetRoom(t *testing.T) {
 	c := createRoom(t)
 
-	room, err := strg.Room().Get(c.ID)
+	room, err := strg.Room().Get(context.Background(), c.ID)
 	require.NoError(t, err)
 	require.NotEmpty(t, room)
 }
@@ -35,7 +36,7 @@ func TestCreateRoom(t *testing.T) {
 func TestGetAllRooms(t *testing.T) {
 	createRoom(t)
 
-	result, err := strg.Room().GetAll(&repo.GetAllRoomsParams{
+	result, err := strg.Room().GetAll(context.Background(), &repo.GetAllRoomsParams{
 		Limit: 3,
 		Page:  1,
 	})
@@ -48,7 +49,7 @@ func TestUpdateRoom(t *testing.T) {
 
 	c.Type = faker.SENTENCE
 
-	room, err := strg.Room().Update(c)
+	room, err := strg.Room().Update(context.Background(), c)
 	require.NoError(t, err)
 	require.NotEmpty(t, room)
 	require.Equal(t, room.Type, c.Type)
@@ -57,6 +58,6 @@ func TestUpdateRoom(t *testing.T) {
 func TestDeleteRoom(t *testing.T) {
 	c := createRoom(t)
 
-	err := strg.Room().Delete(c.ID)
+	err := strg.Room().Delete(context.Background(), c.ID, c.Version)
 	require.NoError(t, err)
 }
@@ -0,0 +1,208 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/jmoiron/sqlx"
+)
+
+type taxRuleRepo struct {
+	db *sqlx.DB
+}
+
+func NewTaxRule(db *sqlx.DB) repo.TaxRuleStorageI {
+	return &taxRuleRepo{
+		db: db,
+	}
+}
+
+const taxRuleColumns = `
+	id,
+	hotel_id,
+	name,
+	kind,
+	type,
+	basis,
+	COALESCE(percent::TEXT, ''),
+	COALESCE(amount, 0),
+	COALESCE(currency, ''),
+	inclusive,
+	created_at,
+	updated_at
+`
+
+func scanTaxRule(row interface{ Scan(...interface{}) error }) (*repo.TaxRule, error) {
+	var result repo.TaxRule
+
+	err := row.Scan(
+		&result.ID,
+		&result.HotelID,
+		&result.Name,
+		&result.Kind,
+		&result.Type,
+		&result.Basis,
+		&result.Percent,
+		&result.Amount,
+		&result.Currency,
+		&result.Inclusive,
+		&result.CreatedAt,
+		&result.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (ur *taxRuleRepo) Create(ctx context.Context, rule *repo.TaxRule) (*repo.TaxRule, error) {
+	ctx, span := startQuery(ctx, "tax_rule.create")
+	defer span.End()
+
+	query := `
+		INSERT INTO tax_rules(
+			hotel_id,
+			name,
+			kind,
+			type,
+			basis,
+			percent,
+			amount,
+			currency,
+			inclusive
+		) VALUES($1, $2, $3, $4, $5, NULLIF($6, '')::NUMERIC, NULLIF($7, 0), NULLIF($8, ''), $9)
+		RETURNING ` + taxRuleColumns
+
+	var result *repo.TaxRule
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		var err error
+		result, err = scanTaxRule(tx.QueryRowContext(ctx, query,
+			rule.HotelID,
+			rule.Name,
+			rule.Kind,
+			rule.Type,
+			rule.Basis,
+			rule.Percent,
+			rule.Amount,
+			rule.Currency,
+			rule.Inclusive,
+		))
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityTaxRule, result.ID, repo.AuditActionCreate, nil, result)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "tax_rule.create", err)
+	}
+
+	return result, nil
+}
+
+func (ur *taxRuleRepo) Get(ctx context.Context, id int64) (*repo.TaxRule, error) {
+	ctx, span := startQuery(ctx, "tax_rule.get")
+	defer span.End()
+
+	result, err := scanTaxRule(ur.db.QueryRowContext(ctx, `SELECT `+taxRuleColumns+` FROM tax_rules WHERE id=$1`, id))
+	if err != nil {
+		return nil, logQueryError(ctx, "tax_rule.get", err)
+	}
+
+	return result, nil
+}
+
+func (ur *taxRuleRepo) GetByHotel(ctx context.Context, hotelID int64) ([]*repo.TaxRule, error) {
+	ctx, span := startQuery(ctx, "tax_rule.get_by_hotel")
+	defer span.End()
+
+	rows, err := ur.db.QueryContext(ctx, `SELECT `+taxRuleColumns+` FROM tax_rules WHERE hotel_id=$1 ORDER BY id`, hotelID)
+	if err != nil {
+		return nil, logQueryError(ctx, "tax_rule.get_by_hotel", err)
+	}
+	defer rows.Close()
+
+	result := make([]*repo.TaxRule, 0)
+	for rows.Next() {
+		rule, err := scanTaxRule(rows)
+		if err != nil {
+			return nil, logQueryError(ctx, "tax_rule.get_by_hotel", err)
+		}
+		result = append(result, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, logQueryError(ctx, "tax_rule.get_by_hotel", err)
+	}
+
+	return result, nil
+}
+
+func (ur *taxRuleRepo) Update(ctx context.Context, rule *repo.TaxRule) (*repo.TaxRule, error) {
+	ctx, span := startQuery(ctx, "tax_rule.update")
+	defer span.End()
+
+	query := `
+		UPDATE tax_rules SET
+			name=$1,
+			kind=$2,
+			type=$3,
+			basis=$4,
+			percent=NULLIF($5, '')::NUMERIC,
+			amount=NULLIF($6, 0),
+			currency=NULLIF($7, ''),
+			inclusive=$8,
+			updated_at=CURRENT_TIMESTAMP
+		WHERE id=$9
+		RETURNING ` + taxRuleColumns
+
+	var result *repo.TaxRule
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := scanTaxRule(tx.QueryRowContext(ctx, `SELECT `+taxRuleColumns+` FROM tax_rules WHERE id=$1 FOR UPDATE`, rule.ID))
+		if err != nil {
+			return err
+		}
+
+		result, err = scanTaxRule(tx.QueryRowContext(ctx, query,
+			rule.Name,
+			rule.Kind,
+			rule.Type,
+			rule.Basis,
+			rule.Percent,
+			rule.Amount,
+			rule.Currency,
+			rule.Inclusive,
+			rule.ID,
+		))
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityTaxRule, rule.ID, repo.AuditActionUpdate, before, result)
+	})
+	if err != nil {
+		return nil, logQueryError(ctx, "tax_rule.update", err)
+	}
+
+	return result, nil
+}
+
+// Delete removes a rule. Bookings keep the charges they were priced with.
+func (ur *taxRuleRepo) Delete(ctx context.Context, id int64) error {
+	ctx, span := startQuery(ctx, "tax_rule.delete")
+	defer span.End()
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := scanTaxRule(tx.QueryRowContext(ctx, `DELETE FROM tax_rules WHERE id=$1 RETURNING `+taxRuleColumns, id))
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityTaxRule, id, repo.AuditActionDelete, before, nil)
+	})
+
+	return logQueryError(ctx, "tax_rule.delete", err)
+}
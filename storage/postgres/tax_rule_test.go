@@ -0,0 +1,52 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaxRule(t *testing.T) {
+	hotel := createHotel(t)
+
+	vat, err := strg.TaxRule().Create(context.Background(), &repo.TaxRule{
+		HotelID:   hotel.ID,
+		Name:      "VAT",
+		Kind:      repo.TaxRuleKindTax,
+		Type:      repo.TaxRuleTypePercent,
+		Basis:     repo.TaxRuleBasisStay,
+		Percent:   "12",
+		Inclusive: true,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "12.0000", vat.Percent)
+	require.Zero(t, vat.Amount)
+
+	tourist, err := strg.TaxRule().Create(context.Background(), &repo.TaxRule{
+		HotelID:  hotel.ID,
+		Name:     "Tourist tax",
+		Kind:     repo.TaxRuleKindTax,
+		Type:     repo.TaxRuleTypeFixed,
+		Basis:    repo.TaxRuleBasisGuestNight,
+		Amount:   1500000,
+		Currency: "UZS",
+	})
+	require.NoError(t, err)
+	require.Empty(t, tourist.Percent)
+
+	tourist.Amount = 2000000
+	updated, err := strg.TaxRule().Update(context.Background(), tourist)
+	require.NoError(t, err)
+	require.Equal(t, int64(2000000), updated.Amount)
+
+	rules, err := strg.TaxRule().GetByHotel(context.Background(), hotel.ID)
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+
+	require.NoError(t, strg.TaxRule().Delete(context.Background(), vat.ID))
+	_, err = strg.TaxRule().Get(context.Background(), vat.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
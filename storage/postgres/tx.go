@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Scopes for single row lookups.
+const (
+	activeRows  = "deleted_at IS NULL"
+	deletedRows = "deleted_at IS NOT NULL"
+)
+
+// queryer is satisfied by both *sqlx.DB and *sqlx.Tx so single row lookups
+// can be shared between plain reads and transactional writes.
+type queryer interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// inTx runs fn inside a transaction and commits it when fn succeeds.
+func inTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	err = fn(tx)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
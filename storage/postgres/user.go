@@ -1,8 +1,9 @@
 package postgres
 
 import (
-	"database/sql"
-	"fmt"
+	"context"
+	"strconv"
+	"time"
 
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/jmoiron/sqlx"
@@ -18,7 +19,10 @@ func NewUser(db *sqlx.DB) repo.UserStorageI {
 	}
 }
 
-func (ur *userRepo) Create(user *repo.User) (*repo.User, error) {
+func (ur *userRepo) Create(ctx context.Context, user *repo.User) (*repo.User, error) {
+	ctx, span := startQuery(ctx, "user.create")
+	defer span.End()
+
 	query := `
 		INSERT INTO users(
 			first_name,
@@ -29,29 +33,61 @@ func (ur *userRepo) Create(user *repo.User) (*repo.User, error) {
 			password,
 		    type
 		) VALUES($1, $2, $3, $4, $5, $6, $7)
-		RETURNING id, created_at
+		RETURNING id, version, created_at
 	`
 
-	row := ur.db.QueryRow(
-		query,
-		user.FirstName,
-		user.LastName,
-		user.Email,
-		user.PhoneNumber,
-		user.Username,
-		user.Password,
-		user.Type,
-	)
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		row := tx.QueryRowContext(
+			ctx,
+			query,
+			user.FirstName,
+			user.LastName,
+			user.Email,
+			user.PhoneNumber,
+			user.Username,
+			user.Password,
+			user.Type,
+		)
+
+		err := row.Scan(&user.ID, &user.Version, &user.CreatedAt)
+		if err != nil {
+			return err
+		}
 
-	err := row.Scan(&user.ID, &user.CreatedAt)
+		return writeAudit(ctx, tx, repo.AuditEntityUser, user.ID, repo.AuditActionCreate, nil, user)
+	})
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "user.create", err)
 	}
 
 	return user, nil
 }
 
-func (ur *userRepo) Get(id int64) (*repo.User, error) {
+func (ur *userRepo) Get(ctx context.Context, id int64) (*repo.User, error) {
+	ctx, span := startQuery(ctx, "user.get")
+	defer span.End()
+
+	result, err := ur.getBy(ctx, ur.db, "id", id, activeRows, false)
+	if err != nil {
+		return nil, logQueryError(ctx, "user.get", err)
+	}
+
+	return result, nil
+}
+
+func (ur *userRepo) GetByEmail(ctx context.Context, email string) (*repo.User, error) {
+	ctx, span := startQuery(ctx, "user.get_by_email")
+	defer span.End()
+
+	result, err := ur.getBy(ctx, ur.db, "email", email, activeRows, false)
+	if err != nil {
+		return nil, logQueryError(ctx, "user.get_by_email", err)
+	}
+
+	return result, nil
+}
+
+func (ur *userRepo) getBy(ctx context.Context, q queryer, column string, value interface{}, scope string, forUpdate bool) (*repo.User, error) {
 	var result repo.User
 
 	query := `
@@ -64,12 +100,17 @@ func (ur *userRepo) Get(id int64) (*repo.User, error) {
 			username,
 			password,
 			type,
-			created_at
+			version,
+			created_at,
+			deleted_at
 		FROM users
-		WHERE id=$1
+		WHERE ` + column + `=$1 AND ` + scope + `
 	`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
 
-	row := ur.db.QueryRow(query, id)
+	row := q.QueryRowContext(ctx, query, value)
 	err := row.Scan(
 		&result.ID,
 		&result.FirstName,
@@ -79,7 +120,9 @@ func (ur *userRepo) Get(id int64) (*repo.User, error) {
 		&result.Username,
 		&result.Password,
 		&result.Type,
+		&result.Version,
 		&result.CreatedAt,
+		&result.DeletedAt,
 	)
 	if err != nil {
 		return nil, err
@@ -88,25 +131,28 @@ func (ur *userRepo) Get(id int64) (*repo.User, error) {
 	return &result, nil
 }
 
-func (ur *userRepo) GetAll(params *repo.GetAllUsersParams) (*repo.GetAllUsersResult, error) {
+func (ur *userRepo) GetAll(ctx context.Context, params *repo.GetAllUsersParams) (*repo.GetAllUsersResult, error) {
+	ctx, span := startQuery(ctx, "user.get_all")
+	defer span.End()
+
 	result := repo.GetAllUsersResult{
 		Users: make([]*repo.User, 0),
 	}
 
-	offset := (params.Page - 1) * params.Limit
-
-	limit := fmt.Sprintf(" LIMIT %d OFFSET %d ", params.Limit, offset)
-
 	filter := ""
+	if !params.IncludeDeleted {
+		filter = where(filter, activeRows)
+	}
+
+	var args []interface{}
 	if params.Search != "" {
-		str := "%" + params.Search + "%"
-		filter += fmt.Sprintf(`
-			WHERE first_name ILIKE '%s' OR last_name ILIKE '%s' OR email ILIKE '%s' 
-				OR username ILIKE '%s' OR phone_number ILIKE '%s'`,
-			str, str, str, str, str,
-		)
+		args = append(args, "%"+params.Search+"%")
+		filter = where(filter, `(first_name ILIKE $1 OR last_name ILIKE $1 OR email ILIKE $1
+				OR username ILIKE $1 OR phone_number ILIKE $1)`)
 	}
 
+	pageFilter, limit, pageArgs := paginate(filter, args, params.Limit, params.Page, params.Cursor)
+
 	query := `
 		SELECT
 			id,
@@ -117,15 +163,17 @@ func (ur *userRepo) GetAll(params *repo.GetAllUsersParams) (*repo.GetAllUsersRes
 			username,
 			password,
 			type,
-			created_at
+			version,
+			created_at,
+			deleted_at
 		FROM users
-		` + filter + `
-		ORDER BY created_at desc
+		` + pageFilter + `
+		ORDER BY created_at desc, id desc
 		` + limit
 
-	rows, err := ur.db.Query(query)
+	rows, err := ur.db.QueryContext(ctx, query, pageArgs...)
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "user.get_all", err)
 	}
 
 	defer rows.Close()
@@ -142,25 +190,40 @@ func (ur *userRepo) GetAll(params *repo.GetAllUsersParams) (*repo.GetAllUsersRes
 			&u.Username,
 			&u.Password,
 			&u.Type,
+			&u.Version,
 			&u.CreatedAt,
+			&u.DeletedAt,
 		)
 		if err != nil {
-			return nil, err
+			return nil, logQueryError(ctx, "user.get_all", err)
 		}
 
 		result.Users = append(result.Users, &u)
 	}
 
+	if len(result.Users) > int(params.Limit) {
+		result.Users = result.Users[:params.Limit]
+
+		last := result.Users[len(result.Users)-1]
+		result.NextCursor = &repo.Cursor{
+			CreatedAt: last.CreatedAt,
+			ID:        last.ID,
+		}
+	}
+
 	queryCount := `SELECT count(1) FROM users ` + filter
-	err = ur.db.QueryRow(queryCount).Scan(&result.Count)
+	err = ur.db.QueryRowContext(ctx, queryCount, args...).Scan(&result.Count)
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "user.get_all", err)
 	}
 
 	return &result, nil
 }
 
-func (ur *userRepo) Update(user *repo.User) (*repo.User, error) {
+func (ur *userRepo) Update(ctx context.Context, user *repo.User) (*repo.User, error) {
+	ctx, span := startQuery(ctx, "user.update")
+	defer span.End()
+
 	query := `update users set 
 			first_name=$1,
 			last_name=$2,
@@ -168,93 +231,250 @@ func (ur *userRepo) Update(user *repo.User) (*repo.User, error) {
 			phone_number=$4,
 			username=$5,
 			password=$6,
-			type=$7
+			type=$7,
+			version=version+1
 		where id=$8
-		returning created_at
+		returning version, created_at
 		`
 
-	err := ur.db.QueryRow(
-		query,
-		user.FirstName,
-		user.LastName,
-		user.Email,
-		user.PhoneNumber,
-		user.Username,
-		user.Password,
-		user.Type,
-		user.ID,
-	).Scan(&user.CreatedAt)
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.getBy(ctx, tx, "id", user.ID, activeRows, true)
+		if err != nil {
+			return err
+		}
+
+		if before.Version != user.Version {
+			return repo.ErrVersionMismatch
+		}
+
+		err = tx.QueryRowContext(
+			ctx,
+			query,
+			user.FirstName,
+			user.LastName,
+			user.Email,
+			user.PhoneNumber,
+			user.Username,
+			user.Password,
+			user.Type,
+			user.ID,
+		).Scan(&user.Version, &user.CreatedAt)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityUser, user.ID, repo.AuditActionUpdate, before, user)
+	})
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "user.update", err)
 	}
 
 	return user, nil
 }
 
-func (ur *userRepo) Delete(id int64) error {
-	query := `delete from users where id=$1`
-
-	result, err := ur.db.Exec(query, id)
+// Patch updates only the given columns, keyed by column name.
+func (ur *userRepo) Patch(ctx context.Context, id, version int64, fields map[string]interface{}) (*repo.User, error) {
+	ctx, span := startQuery(ctx, "user.patch")
+	defer span.End()
+
+	set, args, err := patchSet(fields,
+		"first_name",
+		"last_name",
+		"email",
+		"phone_number",
+		"username",
+		"type",
+	)
 	if err != nil {
-		return err
+		return nil, logQueryError(ctx, "user.patch", err)
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	var result *repo.User
+	err = inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.getBy(ctx, tx, "id", id, activeRows, true)
+		if err != nil {
+			return err
+		}
+
+		if before.Version != version {
+			return repo.ErrVersionMismatch
+		}
+
+		if len(fields) == 0 {
+			result = before
+			return nil
+		}
+
+		query := "update users set " + set + ", version=version+1 where id=$" + strconv.Itoa(len(args)+1)
+		_, err = tx.ExecContext(ctx, query, append(args, id)...)
+		if err != nil {
+			return err
+		}
+
+		result, err = ur.getBy(ctx, tx, "id", id, activeRows, false)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityUser, id, repo.AuditActionUpdate, before, result)
+	})
 	if err != nil {
-		return err
+		return nil, logQueryError(ctx, "user.patch", err)
 	}
 
-	if rowsAffected == 0 {
-		return sql.ErrNoRows
-	}
+	return result, nil
+}
 
-	return nil
+func (ur *userRepo) Delete(ctx context.Context, id, version int64) error {
+	ctx, span := startQuery(ctx, "user.delete")
+	defer span.End()
+
+	query := `update users set
+			deleted_at=CURRENT_TIMESTAMP,
+			version=version+1
+		where id=$1
+		returning version, deleted_at
+	`
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.getBy(ctx, tx, "id", id, activeRows, true)
+		if err != nil {
+			return err
+		}
+
+		if before.Version != version {
+			return repo.ErrVersionMismatch
+		}
+
+		after := *before
+		err = tx.QueryRowContext(ctx, query, id).Scan(&after.Version, &after.DeletedAt)
+		if err != nil {
+			return err
+		}
+
+		return writeAudit(ctx, tx, repo.AuditEntityUser, id, repo.AuditActionDelete, before, &after)
+	})
+
+	return logQueryError(ctx, "user.delete", err)
 }
 
-func (ur *userRepo) GetByEmail(email string) (*repo.User, error) {
-	var result repo.User
+func (ur *userRepo) Restore(ctx context.Context, id int64) (*repo.User, error) {
+	ctx, span := startQuery(ctx, "user.restore")
+	defer span.End()
 
-	query := `
-		SELECT
-			id,
-			first_name,
-			last_name,
-			email,
-			phone_number,
-			username,
-			password,
-			type,
-			created_at
-		FROM users
-		WHERE email=$1
+	query := `update users set
+			deleted_at=NULL,
+			version=version+1
+		where id=$1
+		returning version
 	`
 
-	row := ur.db.QueryRow(query, email)
-	err := row.Scan(
-		&result.ID,
-		&result.FirstName,
-		&result.LastName,
-		&result.Email,
-		&result.PhoneNumber,
-		&result.Username,
-		&result.Password,
-		&result.Type,
-		&result.CreatedAt,
-	)
+	var result *repo.User
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.getBy(ctx, tx, "id", id, deletedRows, true)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.DeletedAt = nil
+		err = tx.QueryRowContext(ctx, query, id).Scan(&after.Version)
+		if err != nil {
+			return err
+		}
+
+		result = &after
+		return writeAudit(ctx, tx, repo.AuditEntityUser, id, repo.AuditActionRestore, before, &after)
+	})
 	if err != nil {
-		return nil, err
+		return nil, logQueryError(ctx, "user.restore", err)
 	}
 
-	return &result, nil
+	return result, nil
 }
 
-func (ur *userRepo) UpdatePassword(req *repo.UpdatePassword) error {
-	query := `UPDATE users SET password=$1 WHERE id=$2`
+// Purge hard deletes rows soft deleted before the given time, skipping rows
+// that are still referenced.
+func (ur *userRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	ctx, span := startQuery(ctx, "user.purge")
+	defer span.End()
+
+	query := `delete from users
+		where deleted_at < $1
+			AND NOT EXISTS (SELECT 1 FROM bookings b WHERE b.user_id=users.id)
+			AND NOT EXISTS (SELECT 1 FROM hotels h WHERE h.user_id=users.id)
+			AND NOT EXISTS (SELECT 1 FROM media m WHERE m.owner_id=users.id)
+			AND NOT EXISTS (SELECT 1 FROM documents d WHERE d.owner_id=users.id)
+			AND NOT EXISTS (SELECT 1 FROM campaigns c WHERE c.created_by=users.id)
+			AND NOT EXISTS (SELECT 1 FROM commission_entries c WHERE users.id IN (c.partner_id, c.created_by))
+			AND NOT EXISTS (SELECT 1 FROM payouts p WHERE users.id IN (p.partner_id, p.created_by, p.settled_by))
+		returning id
+	`
+
+	var count int64
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		rows, err := tx.QueryContext(ctx, query, before)
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
 
-	_, err := ur.db.Exec(query, req.Password, req.UserID)
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			err := writeAudit(ctx, tx, repo.AuditEntityUser, id, repo.AuditActionPurge, nil, nil)
+			if err != nil {
+				return err
+			}
+		}
+
+		count = int64(len(ids))
+		return nil
+	})
 	if err != nil {
-		return err
+		return 0, logQueryError(ctx, "user.purge", err)
 	}
 
-	return nil
+	return count, nil
+}
+
+func (ur *userRepo) UpdatePassword(ctx context.Context, req *repo.UpdatePassword) error {
+	ctx, span := startQuery(ctx, "user.update_password")
+	defer span.End()
+
+	query := `UPDATE users SET password=$1, version=version+1 WHERE id=$2`
+
+	err := inTx(ctx, ur.db, func(tx *sqlx.Tx) error {
+		before, err := ur.getBy(ctx, tx, "id", req.UserID, activeRows, true)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, query, req.Password, req.UserID)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.Password = req.Password
+		after.Version++
+
+		return writeAudit(ctx, tx, repo.AuditEntityUser, req.UserID, repo.AuditActionUpdate, before, &after)
+	})
+
+	return logQueryError(ctx, "user.update_password", err)
 }
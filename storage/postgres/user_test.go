@@ -1,7 +1,9 @@
 package postgres_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
 	"github.com/bxcodec/faker/v4"
@@ -9,11 +11,11 @@ import (
 )
 
 func createUser(t *testing.T) *repo.User {
-	user, err := strg.User().Create(&repo.User{
+	user, err := strg.User().Create(context.Background(), &repo.User{
 		FirstName: faker.FirstName(),
-		LastName: faker.LastName(),
-		Email: faker.Email(),
-		Password: faker.Password(),
+		LastName:  faker.LastName(),
+		Email:     faker.Email(),
+		Password:  faker.Password(),
 	})
 	require.NoError(t, err)
 	require.NotEmpty(t, user)
@@ -24,7 +26,7 @@ func createUser(t *testing.T) *repo.User {
 func TestGetUser(t *testing.T) {
 	c := createUser(t)
 
-	user, err := strg.User().Get(c.ID)
+	user, err := strg.User().Get(context.Background(), c.ID)
 	require.NoError(t, err)
 	require.NotEmpty(t, user)
 }
@@ -36,9 +38,9 @@ func TestCreateUser(t *testing.T) {
 func TestGetAllUsers(t *testing.T) {
 	createUser(t)
 
-	result, err := strg.User().GetAll(&repo.GetAllUsersParams{
+	result, err := strg.User().GetAll(context.Background(), &repo.GetAllUsersParams{
 		Limit: 3,
-		Page: 1,
+		Page:  1,
 	})
 	require.NoError(t, err)
 	require.GreaterOrEqual(t, int(result.Count), 1)
@@ -49,7 +51,7 @@ func TestUpdateUser(t *testing.T) {
 
 	c.FirstName = faker.FirstName()
 
-	user, err := strg.User().Update(c)
+	user, err := strg.User().Update(context.Background(), c)
 	require.NoError(t, err)
 	require.NotEmpty(t, user)
 	require.Equal(t, user.FirstName, c.FirstName)
@@ -58,6 +60,25 @@ func TestUpdateUser(t *testing.T) {
 func TestDeleteUser(t *testing.T) {
 	c := createUser(t)
 
-	err := strg.User().Delete(c.ID)
+	err := strg.User().Delete(context.Background(), c.ID, c.Version)
 	require.NoError(t, err)
-}
\ No newline at end of file
+}
+
+func TestPurgeUsersSkipsMediaOwners(t *testing.T) {
+	media := createMedia(t)
+	owner, err := strg.User().Get(context.Background(), media.OwnerID)
+	require.NoError(t, err)
+	c := createUser(t)
+
+	require.NoError(t, strg.User().Delete(context.Background(), owner.ID, owner.Version))
+	require.NoError(t, strg.User().Delete(context.Background(), c.ID, c.Version))
+
+	_, err = strg.User().Purge(context.Background(), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+
+	_, err = strg.User().Restore(context.Background(), c.ID)
+	require.Error(t, err)
+
+	_, err = strg.User().Restore(context.Background(), owner.ID)
+	require.NoError(t, err)
+}
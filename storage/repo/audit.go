@@ -0,0 +1,96 @@
+package repo
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionPurge   = "purge"
+)
+
+const (
+	AuditEntityUser         = "user"
+	AuditEntityHotel        = "hotel"
+	AuditEntityRoom         = "room"
+	AuditEntityBooking      = "booking"
+	AuditEntityMedia        = "media"
+	AuditEntityDocument     = "document"
+	AuditEntityHotelGallery = "hotel_gallery"
+	AuditEntityRoomGallery  = "room_gallery"
+	AuditEntityPayment      = "payment"
+	AuditEntityRefund       = "refund"
+	AuditEntityInvoice      = "invoice"
+	AuditEntityLegalDetails = "legal_details"
+	AuditEntityExchangeRate = "exchange_rate"
+	AuditEntityTaxRule      = "tax_rule"
+	AuditEntityCampaign     = "campaign"
+	AuditEntityCommission   = "commission"
+	AuditEntityPayout       = "payout"
+)
+
+// Actor describes who made a change. It travels with the request context so
+// repositories can record it next to every write.
+type Actor struct {
+	UserID    *int64
+	UserType  string
+	IP        string
+	RequestID string
+}
+
+type actorKey struct{}
+
+func WithActor(ctx context.Context, actor *Actor) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor stored in ctx or an empty one for writes
+// that don't come from an HTTP request.
+func ActorFromContext(ctx context.Context) *Actor {
+	actor, ok := ctx.Value(actorKey{}).(*Actor)
+	if !ok || actor == nil {
+		return &Actor{}
+	}
+	return actor
+}
+
+type AuditLog struct {
+	ID        int64
+	Entity    string
+	EntityID  int64
+	Action    string
+	ActorID   *int64
+	ActorType string
+	IP        string
+	RequestID string
+	Before    json.RawMessage
+	After     json.RawMessage
+	Changes   json.RawMessage
+	CreatedAt time.Time
+}
+
+type GetAllAuditLogsParams struct {
+	Limit    int32
+	Page     int32
+	Cursor   *Cursor
+	Entity   string
+	EntityID int64
+	ActorID  int64
+	From     *time.Time
+	To       *time.Time
+}
+
+type GetAllAuditLogsResult struct {
+	AuditLogs  []*AuditLog
+	Count      int32
+	NextCursor *Cursor
+}
+
+type AuditStorageI interface {
+	GetAll(ctx context.Context, params *GetAllAuditLogsParams) (*GetAllAuditLogsResult, error)
+}
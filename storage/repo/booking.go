@@ -1,33 +1,96 @@
 package repo
 
-import "time"
+import (
+	"context"
+	"errors"
+	"time"
+)
 
+// A booking is pending until enough of it is paid for, see config.Payments.
+const (
+	BookingStatusPending   = "pending"
+	BookingStatusConfirmed = "confirmed"
+	BookingStatusCancelled = "cancelled"
+)
+
+// BookingTransitions lists the statuses a booking may move to from each
+// status.
+var BookingTransitions = map[string][]string{
+	BookingStatusPending:   {BookingStatusConfirmed, BookingStatusCancelled},
+	BookingStatusConfirmed: {BookingStatusCancelled},
+}
+
+// ErrBookingState is returned by SetStatus for moves BookingTransitions
+// does not allow.
+var ErrBookingState = errors.New("booking cannot change to that status")
+
+// Booking prices are in minor units of Currency. ExchangeRate is how many
+// units of the base currency one unit of Currency was worth when the booking
+// was made, kept as a decimal string so it is not rounded. Charges are the
+// taxes and fees of the hotel when the booking was priced and Total is
+// Price plus the exclusive ones. CommissionRate is the percentage of Total
+// the partner of the hotel pays, locked like the exchange rate.
 type Booking struct {
-	ID        int64
-	RoomId    int
-	UserId    int
-	HotelId   int
-	FromDate  string
-	ToDate    string
-	Price     float64
-	CreatedAt time.Time
+	ID             int64
+	RoomId         int
+	UserId         int
+	HotelId        int
+	FromDate       string
+	ToDate         string
+	Price          int64
+	Currency       string
+	ExchangeRate   string
+	Guests         int
+	Charges        []BookingCharge
+	Total          int64
+	CommissionRate string
+	Status         string
+	Version        int64
+	CreatedAt      time.Time
+	DeletedAt      *time.Time
+}
+
+// ChargeKindDiscount marks the charges of campaigns, their amounts are
+// negative. The other charges are taxes and fees of a TaxRuleKind.
+const ChargeKindDiscount = "discount"
+
+// BookingCharge is a tax, fee or discount of a booking, in minor units of the
+// booking currency. RuleID is set for taxes and fees, CampaignID for
+// discounts.
+type BookingCharge struct {
+	RuleID     int64  `json:"rule_id,omitempty"`
+	CampaignID int64  `json:"campaign_id,omitempty"`
+	Name       string `json:"name"`
+	Kind       string `json:"kind"`
+	Basis      string `json:"basis"`
+	Inclusive  bool   `json:"inclusive"`
+	Quantity   int    `json:"quantity"`
+	UnitAmount int64  `json:"unit_amount"`
+	Amount     int64  `json:"amount"`
 }
 
 type GetAllBookingsParams struct {
-	Limit  int32
-	Page   int32
-	Search string
+	Limit          int32
+	Page           int32
+	Search         string
+	Cursor         *Cursor
+	IncludeDeleted bool
 }
 
 type GetAllBookingResult struct {
-	Bookings []*Booking
-	Count    int32
+	Bookings   []*Booking
+	Count      int32
+	NextCursor *Cursor
 }
 
 type BookingsStorageI interface {
-	Create(u *Booking) (*Booking, error)
-	Get(id int64) (*Booking, error)
-	GetAll(params *GetAllBookingsParams) (*GetAllBookingResult, error)
-	Update(u *Booking) (*Booking, error)
-	Delete(id int64) error
+	Create(ctx context.Context, u *Booking) (*Booking, error)
+	Get(ctx context.Context, id int64) (*Booking, error)
+	GetAll(ctx context.Context, params *GetAllBookingsParams) (*GetAllBookingResult, error)
+	Update(ctx context.Context, u *Booking) (*Booking, error)
+	Patch(ctx context.Context, id, version int64, fields map[string]interface{}) (*Booking, error)
+	Delete(ctx context.Context, id, version int64) error
+	Restore(ctx context.Context, id int64) (*Booking, error)
+	SetStatus(ctx context.Context, id int64, status string) (*Booking, error)
+	Purge(ctx context.Context, before time.Time) (int64, error)
 }
@@ -0,0 +1,92 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	CampaignTypePercent = "percent"
+	CampaignTypeFixed   = "fixed"
+)
+
+// ErrCampaignExhausted is returned when recording a redemption would go over
+// a usage cap of the campaign.
+var ErrCampaignExhausted = errors.New("campaign has been used up")
+
+// Campaign is a discount. With a Code it is redeemed by giving the code on
+// booking, without one it applies to every booking it matches. A nil HotelID
+// makes it apply to all hotels. Percent is a decimal string for percent
+// campaigns, Amount and Currency are set for fixed ones. Zero caps and
+// minimum nights mean no limit. Stackable campaigns combine with each other,
+// the others only apply on their own.
+type Campaign struct {
+	ID             int64
+	Code           string
+	Name           string
+	HotelID        *int64
+	CreatedBy      int64
+	Type           string
+	Percent        string
+	Amount         int64
+	Currency       string
+	ValidFrom      *time.Time
+	ValidUntil     *time.Time
+	MinNights      int
+	MaxUses        int
+	MaxUsesPerUser int
+	Stackable      bool
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeletedAt      *time.Time
+	// Uses and UserUses count the redemptions of bookings that are not
+	// cancelled, UserUses those of one guest. They are only filled in by
+	// GetApplicable.
+	Uses     int
+	UserUses int
+}
+
+// Redemption records a campaign applied to a booking. Amount is the discount
+// in minor units of Currency. Cancelled is set when the booking has been
+// cancelled or deleted since, it then no longer counts towards the caps.
+type Redemption struct {
+	ID         int64
+	CampaignID int64
+	BookingID  int64
+	UserID     int64
+	Amount     int64
+	Currency   string
+	Cancelled  bool
+	CreatedAt  time.Time
+}
+
+type GetAllCampaignsParams struct {
+	// PartnerID limits the list to campaigns of the partner's hotels.
+	PartnerID int64
+	HotelID   int64
+}
+
+type GetApplicableCampaignsParams struct {
+	HotelID int64
+	UserID  int64
+	At      time.Time
+	// Code also returns the campaign with that code, whether it applies or
+	// not, so the caller can tell why.
+	Code string
+}
+
+type CampaignStorageI interface {
+	Create(ctx context.Context, c *Campaign) (*Campaign, error)
+	Get(ctx context.Context, id int64) (*Campaign, error)
+	GetAll(ctx context.Context, params *GetAllCampaignsParams) ([]*Campaign, error)
+	// GetApplicable returns the campaigns without a code that are running
+	// at the given time for the hotel, plus the one with the given code,
+	// with their usage.
+	GetApplicable(ctx context.Context, params *GetApplicableCampaignsParams) ([]*Campaign, error)
+	// GetByIDs returns campaigns, deleted ones included.
+	GetByIDs(ctx context.Context, ids []int64) ([]*Campaign, error)
+	Update(ctx context.Context, c *Campaign) (*Campaign, error)
+	Delete(ctx context.Context, id int64) error
+	GetRedemptions(ctx context.Context, campaignID int64) ([]*Redemption, error)
+}
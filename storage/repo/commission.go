@@ -0,0 +1,111 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	CommissionKindEarned   = "earned"
+	CommissionKindRefunded = "refunded"
+	CommissionKindAdjusted = "adjusted"
+)
+
+const (
+	PayoutStatusPending = "pending"
+	PayoutStatusSettled = "settled"
+)
+
+var (
+	// ErrNoCommission is returned by Adjust for bookings that have not
+	// earned a commission, because they were never confirmed.
+	ErrNoCommission = errors.New("booking has not earned a commission")
+	// ErrPayoutSettled is returned by SettlePayout for payouts settled
+	// before.
+	ErrPayoutSettled = errors.New("payout has already been settled")
+)
+
+// CommissionRate is the percentage of their bookings a partner pays, as a
+// decimal string.
+type CommissionRate struct {
+	PartnerID int64
+	Rate      string
+	UpdatedAt time.Time
+}
+
+// CommissionEntry is a line of the commission ledger. Base is the part of
+// the booking the commission was taken on and Amount the commission, both in
+// minor units of Currency; refunds make them negative. RefundID is set for
+// refunded entries and CreatedBy for adjustments made by hand. PayoutID is
+// the statement the entry was paid out with.
+type CommissionEntry struct {
+	ID        int64
+	PartnerID int64
+	HotelID   int64
+	BookingID int64
+	RefundID  *int64
+	Kind      string
+	Rate      string
+	Base      int64
+	Amount    int64
+	Currency  string
+	Note      string
+	CreatedBy *int64
+	PayoutID  *int64
+	CreatedAt time.Time
+}
+
+// Payout is the statement of what a partner is paid for the ledger entries
+// in one currency up to PeriodUntil: Gross less Commission.
+type Payout struct {
+	ID          int64
+	PartnerID   int64
+	Currency    string
+	PeriodFrom  time.Time
+	PeriodUntil time.Time
+	Gross       int64
+	Commission  int64
+	Amount      int64
+	Status      string
+	Reference   string
+	CreatedBy   int64
+	SettledBy   *int64
+	SettledAt   *time.Time
+	CreatedAt   time.Time
+}
+
+type GetCommissionEntriesParams struct {
+	Limit     int32
+	Page      int32
+	PartnerID int64
+	BookingID int64
+	PayoutID  int64
+	// Unpaid leaves out the entries that are on a payout.
+	Unpaid bool
+}
+
+type GetAllPayoutsParams struct {
+	PartnerID int64
+	Status    string
+}
+
+// The ledger is written by the booking and payment repositories when a
+// booking is confirmed, repriced or refunded, in the same transaction.
+type CommissionStorageI interface {
+	GetRate(ctx context.Context, partnerID int64) (*CommissionRate, error)
+	// SetRate creates or replaces the rate of a partner. It applies to
+	// bookings made from then on.
+	SetRate(ctx context.Context, rate *CommissionRate) (*CommissionRate, error)
+	DeleteRate(ctx context.Context, partnerID int64) error
+	GetEntries(ctx context.Context, params *GetCommissionEntriesParams) ([]*CommissionEntry, error)
+	// Adjust records an adjustment of the commission on a booking in its
+	// currency, taking the partner and rate from what it earned.
+	Adjust(ctx context.Context, entry *CommissionEntry) (*CommissionEntry, error)
+	// CreatePayouts puts the entries made before until that are not on a
+	// payout yet on one payout per partner and currency.
+	CreatePayouts(ctx context.Context, until time.Time, createdBy int64) ([]*Payout, error)
+	GetPayout(ctx context.Context, id int64) (*Payout, error)
+	GetAllPayouts(ctx context.Context, params *GetAllPayoutsParams) ([]*Payout, error)
+	SettlePayout(ctx context.Context, id, settledBy int64, reference string) (*Payout, error)
+}
@@ -0,0 +1,39 @@
+package repo
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	DocumentKindIdentity = "identity"
+	DocumentKindContract = "contract"
+)
+
+// Document is a private upload: an ID scan a guest attached to a booking
+// or a contract of a hotel. Unlike media its file is never public.
+type Document struct {
+	ID          int64
+	OwnerID     int64
+	Kind        string
+	HotelID     int64
+	BookingID   *int64
+	Checksum    string
+	FileName    string
+	ContentType string
+	Size        int64
+	CreatedAt   time.Time
+}
+
+// GetAllDocumentsParams filters documents. Unset fields match everything.
+type GetAllDocumentsParams struct {
+	HotelID   *int64
+	BookingID *int64
+	Kind      string
+}
+
+type DocumentStorageI interface {
+	Create(ctx context.Context, d *Document) (*Document, error)
+	Get(ctx context.Context, id int64) (*Document, error)
+	GetAll(ctx context.Context, params *GetAllDocumentsParams) ([]*Document, error)
+}
@@ -0,0 +1,18 @@
+package repo
+
+import "errors"
+
+// ErrVersionMismatch is returned by Update and Delete when the row exists but
+// has been changed since the caller read it.
+var ErrVersionMismatch = errors.New("version mismatch")
+
+// CanTransition reports whether transitions allow moving from one status to
+// another.
+func CanTransition(transitions map[string][]string, from, to string) bool {
+	for _, status := range transitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
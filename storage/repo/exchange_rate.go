@@ -0,0 +1,30 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrNoBaseRate is returned by Rebase when the rate of the new base
+// currency against the old one is not stored.
+var ErrNoBaseRate = errors.New("no exchange rate for the new base currency")
+
+// ExchangeRate is how many units of Currency one unit of the base currency
+// buys, as a decimal string.
+type ExchangeRate struct {
+	Currency  string
+	Rate      string
+	UpdatedAt time.Time
+}
+
+type ExchangeRateStorageI interface {
+	GetAll(ctx context.Context) ([]*ExchangeRate, error)
+	// Set creates or replaces the rate of a currency.
+	Set(ctx context.Context, rate *ExchangeRate) (*ExchangeRate, error)
+	Delete(ctx context.Context, currency string) error
+	// Rebase makes the stored rates and the rates locked on bookings
+	// relative to base when they are kept relative to another currency,
+	// using the stored rate of base.
+	Rebase(ctx context.Context, base string) error
+}
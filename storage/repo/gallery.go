@@ -0,0 +1,39 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrGalleryOrder is returned by Reorder when the ids are not exactly the
+// images of the gallery.
+var ErrGalleryOrder = errors.New("order must list every image of the gallery once")
+
+// GalleryImage is an uploaded image shown in the gallery of a hotel or a
+// room. OwnerID is the id of the hotel or room. Position starts at 1.
+type GalleryImage struct {
+	OwnerID   int64
+	MediaID   int64
+	Position  int
+	Caption   string
+	AltText   string
+	Cover     bool
+	CreatedAt time.Time
+}
+
+// GalleryStorageI manages the galleries of one kind of owner. Every write
+// returns the whole gallery in order.
+type GalleryStorageI interface {
+	// Add appends an image to the gallery. If it is the cover the previous
+	// cover is unmarked.
+	Add(ctx context.Context, img *GalleryImage) ([]*GalleryImage, error)
+	Get(ctx context.Context, ownerID int64) ([]*GalleryImage, error)
+	// GetCovers returns the cover of every given gallery that has images.
+	// Galleries without a marked cover fall back to their first image.
+	GetCovers(ctx context.Context, ownerIDs []int64) ([]*GalleryImage, error)
+	// Update changes the caption, alt text and cover flag of an image.
+	Update(ctx context.Context, img *GalleryImage) ([]*GalleryImage, error)
+	Reorder(ctx context.Context, ownerID int64, mediaIDs []int64) ([]*GalleryImage, error)
+	Remove(ctx context.Context, ownerID, mediaID int64) ([]*GalleryImage, error)
+}
@@ -1,32 +1,46 @@
 package repo
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type Hotel struct {
 	ID            int64
 	UserID        int64
 	HotelName     string
 	HotelLocation string
-	HotelImageUrl *string
+	ImageID       *int64
+	// ImageURL is the image of hotels created before uploads existed. It is
+	// only shown while ImageID is not set and is cleared once it is.
+	ImageURL      *string
 	NumberOfRooms int32
+	Version       int64
 	CreatedAt     time.Time
+	DeletedAt     *time.Time
 }
 
 type GetAllHotelsParams struct {
-	Limit  int32
-	Page   int32
-	Search string
+	Limit          int32
+	Page           int32
+	Search         string
+	Cursor         *Cursor
+	IncludeDeleted bool
 }
 
 type GetAllHotelsResult struct {
-	Hotels []*Hotel
-	Count  int32
+	Hotels     []*Hotel
+	Count      int32
+	NextCursor *Cursor
 }
 
 type HotelStorageI interface {
-	Create(u *Hotel) (*Hotel, error)
-	Get(id int64) (*Hotel, error)
-	GetAll(params *GetAllHotelsParams) (*GetAllHotelsResult, error)
-	Update(u *Hotel) (*Hotel, error)
-	Delete(id int64) error
+	Create(ctx context.Context, u *Hotel) (*Hotel, error)
+	Get(ctx context.Context, id int64) (*Hotel, error)
+	GetAll(ctx context.Context, params *GetAllHotelsParams) (*GetAllHotelsResult, error)
+	Update(ctx context.Context, u *Hotel) (*Hotel, error)
+	Patch(ctx context.Context, id, version int64, fields map[string]interface{}) (*Hotel, error)
+	Delete(ctx context.Context, id, version int64) error
+	Restore(ctx context.Context, id int64) (*Hotel, error)
+	Purge(ctx context.Context, before time.Time) (int64, error)
 }
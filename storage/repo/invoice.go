@@ -0,0 +1,85 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	InvoiceKindInvoice = "invoice"
+	InvoiceKindReceipt = "receipt"
+)
+
+const (
+	InvoiceLineNight    = "night"
+	InvoiceLineTax      = "tax"
+	InvoiceLineFee      = "fee"
+	InvoiceLineDiscount = "discount"
+	InvoiceLinePayment  = "payment"
+	InvoiceLineRefund   = "refund"
+)
+
+// ErrInvoiceExists is returned by Create when the booking already has an
+// invoice of that kind.
+var ErrInvoiceExists = errors.New("invoice already exists")
+
+// LegalDetails identify a hotel's operating company on its invoices.
+type LegalDetails struct {
+	HotelID            int64
+	LegalName          string
+	Address            string
+	TaxID              string
+	RegistrationNumber string
+	Email              string
+	UpdatedAt          time.Time
+}
+
+type LegalDetailsStorageI interface {
+	Get(ctx context.Context, hotelID int64) (*LegalDetails, error)
+	// Set creates or replaces the details of a hotel. Invoices already
+	// issued keep the details they were issued with.
+	Set(ctx context.Context, d *LegalDetails) (*LegalDetails, error)
+}
+
+// InvoiceLine is an item of an invoice. Amounts are in minor units.
+// Included lines, such as inclusive taxes, are already part of other lines
+// and do not add to the total.
+type InvoiceLine struct {
+	Kind        string `json:"kind"`
+	Description string `json:"description"`
+	Quantity    int    `json:"quantity"`
+	UnitAmount  int64  `json:"unit_amount"`
+	Amount      int64  `json:"amount"`
+	Included    bool   `json:"included,omitempty"`
+}
+
+// Invoice is an issued invoice or receipt. Number is unique per hotel and
+// kind and derived from Sequence, which has no gaps. Content is the PDF,
+// which never changes once issued.
+type Invoice struct {
+	ID        int64
+	HotelID   int64
+	BookingID int64
+	Kind      string
+	Sequence  int64
+	Number    string
+	Currency  string
+	Total     int64
+	Lines     []InvoiceLine
+	Content   []byte
+	Checksum  string
+	IssuedAt  time.Time
+}
+
+type InvoiceStorageI interface {
+	// Create takes the next number of the hotel and kind, has render
+	// produce the PDF for the numbered invoice and stores both in one
+	// transaction. The number is only used up if the invoice is stored.
+	Create(ctx context.Context, inv *Invoice, render func(*Invoice) ([]byte, error)) (*Invoice, error)
+	// Get returns an invoice with its content.
+	Get(ctx context.Context, id int64) (*Invoice, error)
+	// GetByBooking returns the invoices of a booking without their
+	// content.
+	GetByBooking(ctx context.Context, bookingID int64) ([]*Invoice, error)
+}
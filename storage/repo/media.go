@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"context"
+	"time"
+)
+
+// Media is an uploaded image. FileName is content addressed, so owners who
+// upload the same bytes share one file.
+type Media struct {
+	ID          int64
+	OwnerID     int64
+	Checksum    string
+	FileName    string
+	ContentType string
+	Size        int64
+	Width       int
+	Height      int
+	Derivatives []*Derivative
+	ProcessedAt *time.Time
+	CreatedAt   time.Time
+}
+
+// Keys returns the blob keys of the media file and its derivatives.
+func (m *Media) Keys() []string {
+	keys := []string{m.FileName}
+	for _, d := range m.Derivatives {
+		keys = append(keys, d.FileName)
+	}
+	return keys
+}
+
+// Derivative is a resized copy of a media file, such as its thumbnail.
+type Derivative struct {
+	Name        string `json:"name"`
+	FileName    string `json:"file_name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+}
+
+type MediaStorageI interface {
+	Create(ctx context.Context, m *Media) (*Media, error)
+	Get(ctx context.Context, id int64) (*Media, error)
+	GetMany(ctx context.Context, ids []int64) ([]*Media, error)
+	GetByChecksum(ctx context.Context, ownerID int64, checksum string) (*Media, error)
+	// GetUnprocessed returns up to limit media whose derivatives have not
+	// been generated yet, oldest first.
+	GetUnprocessed(ctx context.Context, limit int) ([]*Media, error)
+	SetDerivatives(ctx context.Context, id int64, derivatives []*Derivative) error
+	// GetOrphans returns up to limit media created before the given time
+	// that no hotel or room refers to, with ids greater than afterID.
+	GetOrphans(ctx context.Context, before time.Time, afterID int64, limit int) ([]*Media, error)
+	// DeleteOrphan deletes the media unless something refers to it by now,
+	// in which case sql.ErrNoRows is returned.
+	DeleteOrphan(ctx context.Context, id int64) error
+	// ChecksumInUse reports whether media other than exceptID has the
+	// checksum, and so shares its files.
+	ChecksumInUse(ctx context.Context, checksum string, exceptID int64) (bool, error)
+	// LockChecksum runs fn while holding a lock on the checksum. Uploads and
+	// the sweeper take it around the files they share, so a file is never
+	// deleted between an upload finding it and recording its media.
+	LockChecksum(ctx context.Context, checksum string, fn func() error) error
+}
@@ -0,0 +1,9 @@
+package repo
+
+import "time"
+
+// Cursor points at the last row of a page in (created_at, id) order.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	PaymentStatusPending    = "pending"
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusCaptured   = "captured"
+	PaymentStatusFailed     = "failed"
+	PaymentStatusCancelled  = "cancelled"
+)
+
+// PaymentTransitions lists the statuses a payment may move to from each
+// status. Providers may report a capture without an authorization first.
+var PaymentTransitions = map[string][]string{
+	PaymentStatusPending:    {PaymentStatusAuthorized, PaymentStatusCaptured, PaymentStatusFailed, PaymentStatusCancelled},
+	PaymentStatusAuthorized: {PaymentStatusCaptured, PaymentStatusFailed, PaymentStatusCancelled},
+}
+
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusFailed    = "failed"
+)
+
+var RefundTransitions = map[string][]string{
+	RefundStatusPending: {RefundStatusSucceeded, RefundStatusFailed},
+}
+
+var (
+	// ErrPaymentState is returned for status changes PaymentTransitions or
+	// RefundTransitions do not allow.
+	ErrPaymentState = errors.New("payment cannot change to that status")
+	// ErrRefundTooLarge is returned by CreateRefund when the payment has
+	// less left to refund.
+	ErrRefundTooLarge = errors.New("refund exceeds what is left of the payment")
+	// ErrPaymentTooLarge is returned by Create when the payment exceeds the
+	// outstanding balance of the booking.
+	ErrPaymentTooLarge = errors.New("payment exceeds the outstanding balance")
+	// ErrBookingPaid is returned by Create when nothing is left to pay.
+	ErrBookingPaid = errors.New("booking has been paid")
+	// ErrBookingCancelled is returned by Create for cancelled bookings.
+	ErrBookingCancelled = errors.New("booking has been cancelled")
+)
+
+// Payment is one attempt to pay for a booking with a provider. Amounts are
+// in minor units of Currency. ProviderRef is the provider's id of the
+// payment, empty until the provider has been asked. Refunded is the sum of
+// the succeeded refunds.
+type Payment struct {
+	ID          int64
+	BookingID   int64
+	Provider    string
+	ProviderRef string
+	Amount      int64
+	Currency    string
+	Status      string
+	Refunded    int64
+	Refunds     []*Refund
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type Refund struct {
+	ID          int64
+	PaymentID   int64
+	ProviderRef string
+	Amount      int64
+	Reason      string
+	Status      string
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+type PaymentStorageI interface {
+	// Create records a payment in the currency of the booking, of its
+	// outstanding balance when p.Amount is 0. The booking is locked while the
+	// balance is checked, so concurrent payments cannot both take it.
+	Create(ctx context.Context, p *Payment) (*Payment, error)
+	Get(ctx context.Context, id int64) (*Payment, error)
+	GetByProviderRef(ctx context.Context, provider, ref string) (*Payment, error)
+	// GetByBooking returns the payments of a booking with their refunds,
+	// oldest first.
+	GetByBooking(ctx context.Context, bookingID int64) ([]*Payment, error)
+	SetProviderRef(ctx context.Context, id int64, ref string) error
+	// SetStatus moves a payment along PaymentTransitions. Setting the current
+	// status again changes nothing, so webhooks may be delivered twice.
+	SetStatus(ctx context.Context, id int64, status string) (*Payment, error)
+	// CreateRefund records a pending refund of a captured payment. Pending
+	// refunds count against what is left to refund.
+	CreateRefund(ctx context.Context, r *Refund) (*Refund, error)
+	SetRefundProviderRef(ctx context.Context, id int64, ref string) error
+	GetRefundByProviderRef(ctx context.Context, provider, ref string) (*Refund, error)
+	// CancelBooking cancels a booking in one transaction: the booking, the
+	// payments in statuses moved to their status and refunds recorded as
+	// pending. A booking that is cancelled already only gets the refunds.
+	CancelBooking(ctx context.Context, bookingID int64, statuses map[int64]string, refunds []*Refund) (*Booking, []*Refund, error)
+	// SetRefundStatus moves a refund along RefundTransitions and adds it to
+	// the refunded amount of its payment once it succeeded.
+	SetRefundStatus(ctx context.Context, id int64, status string) (*Refund, error)
+}
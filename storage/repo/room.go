@@ -1,32 +1,58 @@
 package repo
 
-import "time"
+import (
+	"context"
+	"time"
+)
+
+const (
+	RoomStatusAvailable   = "available"
+	RoomStatusOccupied    = "occupied"
+	RoomStatusMaintenance = "maintenance"
+)
+
+var RoomStatuses = []string{RoomStatusAvailable, RoomStatusOccupied, RoomStatusMaintenance}
 
 type Room struct {
 	ID           int64
 	Type         string
 	NumberOfRoom int
-	RoomImageUrl *string
-	Status       string
-	HotelId      int
-	CreatedAt    time.Time
+	// Price is the nightly price in minor units of Currency, nil until the
+	// room is priced.
+	Price    *int64
+	Currency string
+	ImageID  *int64
+	// ImageURL is the image of rooms created before uploads existed. It is
+	// only shown while ImageID is not set and is cleared once it is.
+	ImageURL  *string
+	Status    string
+	HotelId   int
+	Version   int64
+	CreatedAt time.Time
+	DeletedAt *time.Time
 }
 
 type GetAllRoomsParams struct {
-	Limit  int32
-	Page   int32
-	Search string
+	Limit          int32
+	Page           int32
+	Search         string
+	Cursor         *Cursor
+	IncludeDeleted bool
 }
 
 type GetAllRoomsResult struct {
-	Rooms []*Room
-	Count int32
+	Rooms      []*Room
+	Count      int32
+	NextCursor *Cursor
 }
 
 type RoomsStorageI interface {
-	Create(u *Room) (*Room, error)
-	Get(id int64) (*Room, error)
-	GetAll(params *GetAllRoomsParams) (*GetAllRoomsResult, error)
-	Update(u *Room) (*Room, error)
-	Delete(id int64) error
+	Create(ctx context.Context, u *Room) (*Room, error)
+	Get(ctx context.Context, id int64) (*Room, error)
+	GetAll(ctx context.Context, params *GetAllRoomsParams) (*GetAllRoomsResult, error)
+	Update(ctx context.Context, u *Room) (*Room, error)
+	Patch(ctx context.Context, id, version int64, fields map[string]interface{}) (*Room, error)
+	Delete(ctx context.Context, id, version int64) error
+	Restore(ctx context.Context, id int64) (*Room, error)
+	Purge(ctx context.Context, before time.Time) (int64, error)
 }
@@ -0,0 +1,51 @@
+package repo
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	TaxRuleKindTax = "tax"
+	TaxRuleKindFee = "fee"
+)
+
+const (
+	TaxRuleTypePercent = "percent"
+	TaxRuleTypeFixed   = "fixed"
+)
+
+// A fixed rule is charged once per stay, per night or per guest and night.
+// Percentages always apply to the whole price.
+const (
+	TaxRuleBasisStay       = "stay"
+	TaxRuleBasisNight      = "night"
+	TaxRuleBasisGuestNight = "guest_night"
+)
+
+// TaxRule is a tax or fee a hotel charges on its bookings. Percent is a
+// decimal string for percent rules, Amount and Currency are set for fixed
+// ones. Inclusive rules are already part of the price, exclusive ones are
+// added on top of it.
+type TaxRule struct {
+	ID        int64
+	HotelID   int64
+	Name      string
+	Kind      string
+	Type      string
+	Basis     string
+	Percent   string
+	Amount    int64
+	Currency  string
+	Inclusive bool
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type TaxRuleStorageI interface {
+	Create(ctx context.Context, rule *TaxRule) (*TaxRule, error)
+	Get(ctx context.Context, id int64) (*TaxRule, error)
+	GetByHotel(ctx context.Context, hotelID int64) ([]*TaxRule, error)
+	Update(ctx context.Context, rule *TaxRule) (*TaxRule, error)
+	Delete(ctx context.Context, id int64) error
+}
@@ -1,6 +1,9 @@
 package repo
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 const (
 	UserTypeUser       = "user"
@@ -17,18 +20,23 @@ type User struct {
 	Username    *string
 	Password    string
 	Type        string
+	Version     int64
 	CreatedAt   time.Time
+	DeletedAt   *time.Time
 }
 
 type GetAllUsersParams struct {
-	Limit  int32
-	Page   int32
-	Search string
+	Limit          int32
+	Page           int32
+	Search         string
+	Cursor         *Cursor
+	IncludeDeleted bool
 }
 
 type GetAllUsersResult struct {
-	Users []*User
-	Count int32
+	Users      []*User
+	Count      int32
+	NextCursor *Cursor
 }
 
 type UpdatePassword struct {
@@ -37,11 +45,14 @@ type UpdatePassword struct {
 }
 
 type UserStorageI interface {
-	Create(u *User) (*User, error)
-	Get(id int64) (*User, error)
-	GetByEmail(email string) (*User, error)
-	GetAll(params *GetAllUsersParams) (*GetAllUsersResult, error)
-	UpdatePassword(req *UpdatePassword) error
-	Update(u *User) (*User, error)
-	Delete(id int64) error
+	Create(ctx context.Context, u *User) (*User, error)
+	Get(ctx context.Context, id int64) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetAll(ctx context.Context, params *GetAllUsersParams) (*GetAllUsersResult, error)
+	UpdatePassword(ctx context.Context, req *UpdatePassword) error
+	Update(ctx context.Context, u *User) (*User, error)
+	Patch(ctx context.Context, id, version int64, fields map[string]interface{}) (*User, error)
+	Delete(ctx context.Context, id, version int64) error
+	Restore(ctx context.Context, id int64) (*User, error)
+	Purge(ctx context.Context, before time.Time) (int64, error)
 }
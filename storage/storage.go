@@ -1,8 +1,11 @@
 package storage
 
 import (
+	"github.com/MuhammadyusufAdhamov/booking/config"
+	"github.com/MuhammadyusufAdhamov/booking/storage/cache"
 	"github.com/MuhammadyusufAdhamov/booking/storage/postgres"
 	"github.com/MuhammadyusufAdhamov/booking/storage/repo"
+	"github.com/go-redis/redis/v9"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -11,21 +14,57 @@ type StorageI interface {
 	Hotel() repo.HotelStorageI
 	Room() repo.RoomsStorageI
 	Booking() repo.BookingsStorageI
+	Audit() repo.AuditStorageI
+	Media() repo.MediaStorageI
+	Document() repo.DocumentStorageI
+	HotelGallery() repo.GalleryStorageI
+	RoomGallery() repo.GalleryStorageI
+	Payment() repo.PaymentStorageI
+	Invoice() repo.InvoiceStorageI
+	LegalDetails() repo.LegalDetailsStorageI
+	ExchangeRate() repo.ExchangeRateStorageI
+	TaxRule() repo.TaxRuleStorageI
+	Campaign() repo.CampaignStorageI
+	Commission() repo.CommissionStorageI
 }
 
 type storagePg struct {
-	userRepo    repo.UserStorageI
-	hotelRepo   repo.HotelStorageI
-	roomRepo    repo.RoomsStorageI
-	bookingRepo repo.BookingsStorageI
+	userRepo     repo.UserStorageI
+	hotelRepo    repo.HotelStorageI
+	roomRepo     repo.RoomsStorageI
+	bookingRepo  repo.BookingsStorageI
+	auditRepo    repo.AuditStorageI
+	mediaRepo    repo.MediaStorageI
+	documentRepo repo.DocumentStorageI
+	hotelGallery repo.GalleryStorageI
+	roomGallery  repo.GalleryStorageI
+	paymentRepo  repo.PaymentStorageI
+	invoiceRepo  repo.InvoiceStorageI
+	legalRepo    repo.LegalDetailsStorageI
+	rateRepo     repo.ExchangeRateStorageI
+	taxRuleRepo  repo.TaxRuleStorageI
+	campaignRepo repo.CampaignStorageI
+	commission   repo.CommissionStorageI
 }
 
 func NewStoragePg(db *sqlx.DB) StorageI {
 	return &storagePg{
-		userRepo:    postgres.NewUser(db),
-		hotelRepo:   postgres.NewHotel(db),
-		roomRepo:    postgres.NewRoom(db),
-		bookingRepo: postgres.NewBooking(db),
+		userRepo:     postgres.NewUser(db),
+		hotelRepo:    postgres.NewHotel(db),
+		roomRepo:     postgres.NewRoom(db),
+		bookingRepo:  postgres.NewBooking(db),
+		auditRepo:    postgres.NewAudit(db),
+		mediaRepo:    postgres.NewMedia(db),
+		documentRepo: postgres.NewDocument(db),
+		hotelGallery: postgres.NewHotelGallery(db),
+		roomGallery:  postgres.NewRoomGallery(db),
+		paymentRepo:  postgres.NewPayment(db),
+		invoiceRepo:  postgres.NewInvoice(db),
+		legalRepo:    postgres.NewLegalDetails(db),
+		rateRepo:     postgres.NewExchangeRate(db),
+		taxRuleRepo:  postgres.NewTaxRule(db),
+		campaignRepo: postgres.NewCampaign(db),
+		commission:   postgres.NewCommission(db),
 	}
 }
 
@@ -44,3 +83,75 @@ func (s *storagePg) Room() repo.RoomsStorageI {
 func (s *storagePg) Booking() repo.BookingsStorageI {
 	return s.bookingRepo
 }
+
+func (s *storagePg) Audit() repo.AuditStorageI {
+	return s.auditRepo
+}
+
+func (s *storagePg) Media() repo.MediaStorageI {
+	return s.mediaRepo
+}
+
+func (s *storagePg) Document() repo.DocumentStorageI {
+	return s.documentRepo
+}
+
+func (s *storagePg) HotelGallery() repo.GalleryStorageI {
+	return s.hotelGallery
+}
+
+func (s *storagePg) RoomGallery() repo.GalleryStorageI {
+	return s.roomGallery
+}
+
+func (s *storagePg) Payment() repo.PaymentStorageI {
+	return s.paymentRepo
+}
+
+func (s *storagePg) Invoice() repo.InvoiceStorageI {
+	return s.invoiceRepo
+}
+
+func (s *storagePg) LegalDetails() repo.LegalDetailsStorageI {
+	return s.legalRepo
+}
+
+func (s *storagePg) ExchangeRate() repo.ExchangeRateStorageI {
+	return s.rateRepo
+}
+
+func (s *storagePg) TaxRule() repo.TaxRuleStorageI {
+	return s.taxRuleRepo
+}
+
+func (s *storagePg) Campaign() repo.CampaignStorageI {
+	return s.campaignRepo
+}
+
+func (s *storagePg) Commission() repo.CommissionStorageI {
+	return s.commission
+}
+
+type cachedStorage struct {
+	StorageI
+	hotelRepo repo.HotelStorageI
+	roomRepo  repo.RoomsStorageI
+}
+
+// WithCache puts a Redis read-through cache in front of the hotel and room
+// repositories of strg. The other repositories are used as they are.
+func WithCache(strg StorageI, rdb *redis.Client, cfg *config.Cache) StorageI {
+	return &cachedStorage{
+		StorageI:  strg,
+		hotelRepo: cache.NewHotel(strg.Hotel(), rdb, cfg.HotelTTL, cfg.HotelListTTL),
+		roomRepo:  cache.NewRoom(strg.Room(), rdb, cfg.RoomTTL, cfg.RoomListTTL),
+	}
+}
+
+func (s *cachedStorage) Hotel() repo.HotelStorageI {
+	return s.hotelRepo
+}
+
+func (s *cachedStorage) Room() repo.RoomsStorageI {
+	return s.roomRepo
+}